@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"ping0/internal/asn"
+	"ping0/internal/config"
+)
+
+// runASNUpdateMode 下载ASN注册数据并写入-asn-db指定的文件
+// 数据来自NRO分配统计和RIPE的ASN名称列表，下载完成后查询时即可离线补充ASN注册信息
+func runASNUpdateMode(cfg *config.Config) {
+	if cfg.ASNDB == "" {
+		fmt.Println("错误: -asn-update 需要通过 -asn-db 参数或配置文件指定ASN数据文件路径")
+		fmt.Println("用法示例:")
+		fmt.Println("  更新ASN数据: pong0 -asn-db asn.txt -asn-update")
+		os.Exit(exitUsage)
+	}
+
+	fmt.Fprintf(os.Stderr, "正在下载ASN注册数据到 %s...\n", cfg.ASNDB)
+
+	client := &http.Client{Transport: http.DefaultTransport}
+	count, err := asn.Download(context.Background(), client, cfg.ASNDB)
+	if err != nil {
+		fmt.Printf("更新ASN数据失败: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+
+	fmt.Printf("已保存 %d 条ASN记录到 %s\n", count, cfg.ASNDB)
+}
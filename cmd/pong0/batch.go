@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"ping0/internal/config"
+	"ping0/internal/models"
+	"ping0/internal/sink"
+)
+
+// batchResult 批量查询中单个IP的结果
+// 成功时直接输出IPInfo，失败时输出包含ip和error字段的对象
+type batchResult struct {
+	IP       string `json:"ip"`
+	Error    string `json:"error"`
+	Princess string `json:"princess,omitempty"`
+}
+
+// readIPList 从文件中读取待查询的IP列表
+// 文件每行一个IP，空行和以#开头的注释行会被忽略
+//
+// 参数:
+//   - path: IP列表文件路径
+//
+// 返回:
+//   - []string: 读取到的IP列表
+//   - error: 如果文件读取失败则返回相应错误
+func readIPList(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开IP列表文件失败: %w", err)
+	}
+	defer file.Close()
+
+	var ips []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ips = append(ips, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取IP列表文件失败: %w", err)
+	}
+
+	return ips, nil
+}
+
+// runBatchMode 在批量查询模式下运行程序
+// 依次查询文件中的每个IP，按-o指定的格式输出全部结果，启用-ndjson时每行输出一条结果
+func runBatchMode(cfg *config.Config) {
+	ips, err := readIPList(ipFile)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+
+	if cfg.Verbose {
+		fmt.Println("-------------------------------------")
+		fmt.Println("Pong0 Pong0 Pong0")
+		fmt.Println("-------------------------------------")
+		fmt.Printf("批量查询 %d 个IP\n", len(ips))
+	}
+
+	runQueries(cfg, ips)
+}
+
+// runQueries 使用-workers指定数量的工作协程查询多个IP并输出全部结果
+// 相邻两次查询的开始时间至少相隔-delay指定的时间，遇到限流或验证失败时自动增大间隔。
+// 单个IP查询失败不会中断其余查询，全部查询都失败时以非零状态码退出。
+// 指定-sink时与-ndjson相同逐条输出记录（按完成顺序，附带序号），但写入-sink指定的输出目标；
+// 其他情况下按输入顺序输出全部结果。
+func runQueries(cfg *config.Config, ips []string) {
+	stream := ndjson || sinkSpec != ""
+	var out sink.Sink
+	if stream {
+		out = openSink(sinkSpec)
+	}
+
+	results := make([]interface{}, len(ips))
+	failed := 0
+	exitCode := exitOK
+	risky := false
+	p := newPacer(queryDelay, cfg.Log("batch"))
+
+	// mu 保护结果、计数和输出，工作协程并发完成查询
+	var mu sync.Mutex
+	query := func(i int) {
+		queryIP := ips[i]
+		p.wait()
+		var result interface{}
+		startTime := time.Now()
+		ipInfo, err := lookupIP(context.Background(), cfg, queryIP)
+		elapsed := time.Since(startTime)
+		p.observe(err)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			failed++
+			// 所有失败属于同一类别时使用该类别的退出码，否则使用通用失败退出码
+			if code := exitCodeFor(err); exitCode == exitOK || exitCode == code {
+				exitCode = code
+			} else {
+				exitCode = exitFailure
+			}
+			if cfg.Verbose {
+				fmt.Printf("查询 %s 失败: %v\n", queryIP, err)
+			}
+			result = batchResult{
+				IP:       queryIP,
+				Error:    err.Error(),
+				Princess: models.Princess(cfg.Branding()),
+			}
+		} else {
+			result = ipInfo
+			if cfg.Verbose {
+				for _, w := range ipInfo.Warnings {
+					fmt.Printf("解析 %s 的结果页面时发现问题: %s\n", queryIP, w)
+				}
+			}
+			if riskExceeded(ipInfo) {
+				risky = true
+			}
+		}
+
+		// NDJSON模式下每完成一个查询立即输出一行，附带序号和耗时
+		if stream {
+			if quiet || len(selectedFields) > 0 {
+				if shaped, err := shapeResult(result); err == nil {
+					result = shaped
+				}
+			}
+			jsonData, _ := json.Marshal(models.StreamRecord{
+				Sequence: i + 1,
+				Elapsed:  elapsed,
+				Result:   result,
+			})
+			if err := out.Write(jsonData); err != nil {
+				fmt.Printf("写入结果失败: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+		results[i] = result
+	}
+
+	idxs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(queryWorkers, len(ips)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idxs {
+				query(i)
+			}
+		}()
+	}
+	for i := range ips {
+		idxs <- i
+	}
+	close(idxs)
+	wg.Wait()
+	flushTraces(cfg)
+
+	if stream {
+		// S3输出在关闭时上传剩余的记录
+		if err := out.Close(); err != nil {
+			fmt.Printf("写入结果失败: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		if cfg.Verbose {
+			printStageStats(cfg)
+			fmt.Println("-------------------------------------")
+		}
+		if err := writeOutput(os.Stdout, outputFormat, results, false); err != nil {
+			fmt.Printf("输出结果失败: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// 全部查询失败时以非零状态码退出
+	if len(ips) > 0 && failed == len(ips) {
+		os.Exit(exitCode)
+	}
+	// 任一成功查询的风控值超过 -max-risk 指定的阈值时以exitRisky退出
+	if risky {
+		os.Exit(exitRisky)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"ping0/internal/config"
+	"ping0/internal/core"
+	"ping0/internal/diskcache"
+	"ping0/internal/models"
+)
+
+// resultCache 命令行查询使用的磁盘缓存，未启用时为nil
+var resultCache *diskcache.Cache
+
+// lookupIP 查询IP信息，启用磁盘缓存时优先返回缓存时间内的结果
+// 查询当前IP（ip为空）时不使用缓存，因为本机的出口IP可能随网络变化；
+// 指定-no-cache时跳过缓存直接查询，成功的结果仍然写入缓存；指定-tag时结果带着标签保存到历史记录，来自缓存的结果也不例外。
+//
+// 参数:
+//   - ctx: 查询上下文
+//   - cfg: 运行时配置
+//   - ip: 要查询的IP，为空时查询当前IP
+//
+// 返回:
+//   - *models.IPInfo: 查询结果，来自缓存时AgeSeconds不为nil
+//   - error: 如果查询失败则返回相应错误
+func lookupIP(ctx context.Context, cfg *config.Config, ip string) (*models.IPInfo, error) {
+	ctx = core.WithTag(ctx, queryTag)
+	if resultCache == nil || ip == "" {
+		return core.ProcessIPInfo(ctx, cfg, ip)
+	}
+
+	key := resultCacheKey(cfg, ip)
+	log := cfg.Log("cache")
+	if !noCache {
+		if info, ok := resultCache.Get(key); ok {
+			log.Debug("使用缓存的查询结果", "ip", ip, "age_seconds", *info.AgeSeconds)
+			// 缓存键不包含NoBranding，按当前配置设置Princess字段
+			info.Princess = models.Princess(cfg.Branding())
+			core.SaveCachedResult(ctx, cfg, info)
+			return info, nil
+		}
+	}
+
+	info, err := core.ProcessIPInfo(ctx, cfg, ip)
+	if err != nil {
+		return nil, err
+	}
+	if err := resultCache.Put(key, info); err != nil {
+		log.Warn("保存查询结果到缓存失败", "ip", ip, "error", err)
+	}
+	return info, nil
+}
+
+// resultCacheKey 返回缓存键，包含所有会改变结果内容的配置
+// 切换站点、输出语言、附加数据源或解析设置后不会读到按其他配置保存的结果。
+func resultCacheKey(cfg *config.Config, ip string) string {
+	return strings.Join([]string{
+		ip,
+		cfg.BaseURL,
+		cfg.Lang,
+		strconv.FormatBool(cfg.RDNS),
+		cfg.ASNDB,
+		cfg.MaxMindDB,
+		strconv.FormatBool(cfg.IPAPI),
+		strconv.FormatBool(cfg.RIPEstat),
+		cfg.ParseMode,
+		cfg.SelectorsFile,
+	}, "|")
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+
+	"ping0/internal/models"
+	"ping0/internal/output"
+)
+
+// maxCompareIPs compare子命令一次最多比较的IP数量，再多的列在终端中难以阅读
+const maxCompareIPs = 8
+
+// compareFields compare子命令并排显示的字段，依次为位置、ASN、组织、IP类型和风控
+var compareFields = []string{
+	"ip_location", "country_code",
+	"asn", "asn_owner", "asn_type", "prefix",
+	"organization", "org_type",
+	"ip_type", "native_ip",
+	"risk_value", "risk_label",
+}
+
+// compareRow 比较结果中的一个字段
+type compareRow struct {
+	Field   string   `json:"field"`
+	Values  []string `json:"values"`  // 与ips顺序一致的字段值，查询失败的IP为空
+	Differs bool     `json:"differs"` // 成功查询的IP之间该字段的值是否不同
+}
+
+// compareReport compare子命令以JSON输出时的结果
+type compareReport struct {
+	IPs        []string          `json:"ips"`
+	Rows       []compareRow      `json:"rows"`
+	Errors     map[string]string `json:"errors,omitempty"`         // 查询失败的IP及错误信息
+	LowestRisk string            `json:"lowest_risk_ip,omitempty"` // 风控值最低的IP，没有IP给出风控值时省略
+}
+
+// runCompareCommand 执行compare子命令，查询多个IP并以并排的表格比较ASN、组织、IP类型、风控值和位置
+// 用法:
+//
+//	pong0 [查询参数] compare 1.1.1.1 8.8.8.8 9.9.9.9
+//
+// 适合在多个候选的VPS出口或代理之间挑选。默认输出对齐的文本，值不同的字段以“*”标记，
+// 最后给出风控值最低的IP；指定 -o json 时输出JSON。查询依次进行，遇到限流时自动增大间隔；
+// 单个IP查询失败不影响其他IP，全部查询都失败时以非零状态码退出。
+//
+// 参数:
+//   - args: compare之后的参数，即要比较的IP
+func runCompareCommand(args []string) {
+	if len(args) < 2 || len(args) > maxCompareIPs {
+		fmt.Printf("错误: compare 子命令需要2到%d个IP\n", maxCompareIPs)
+		fmt.Println("用法示例:")
+		fmt.Println("  pong0 compare 1.1.1.1 8.8.8.8 9.9.9.9")
+		os.Exit(exitUsage)
+	}
+	for i, ip := range args {
+		if net.ParseIP(ip) == nil {
+			fmt.Printf("错误: 无效的IP地址: %s\n", ip)
+			os.Exit(exitUsage)
+		}
+		if slices.Contains(args[:i], ip) {
+			fmt.Printf("错误: 重复的IP地址: %s\n", ip)
+			os.Exit(exitUsage)
+		}
+	}
+	validateCommandLineOptions()
+	cfg := buildConfig()
+
+	infos := make([]*models.IPInfo, len(args))
+	errs := make(map[string]string)
+	exitCode := exitOK
+	p := newPacer(0, cfg.Log("compare"))
+	for i, ip := range args {
+		p.wait()
+		info, err := lookupIP(context.Background(), cfg, ip)
+		p.observe(err)
+		if err != nil {
+			errs[ip] = err.Error()
+			// 所有失败属于同一类别时使用该类别的退出码，否则使用通用失败退出码
+			if code := exitCodeFor(err); exitCode == exitOK || exitCode == code {
+				exitCode = code
+			} else {
+				exitCode = exitFailure
+			}
+			continue
+		}
+		infos[i] = info
+	}
+	flushTraces(cfg)
+
+	report, err := compareResults(args, infos)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "转换查询结果失败: %v\n", err)
+		os.Exit(exitFailure)
+	}
+	if len(errs) > 0 {
+		report.Errors = errs
+	}
+
+	if outputFormatSet() && outputFormat == formatJSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err == nil {
+			fmt.Println(string(data))
+		}
+	} else {
+		writeCompare(os.Stdout, report)
+	}
+
+	if len(errs) == len(args) {
+		os.Exit(exitCode)
+	}
+}
+
+// compareResults 按compareFields逐字段排列多个查询结果
+// 只比较成功查询的IP，查询失败的IP（infos中为nil）的值为空且不参与比较。
+func compareResults(ips []string, infos []*models.IPInfo) (compareReport, error) {
+	report := compareReport{IPs: ips, Rows: make([]compareRow, 0, len(compareFields))}
+
+	records := make([]output.Record, len(infos))
+	lowest := -1
+	for i, info := range infos {
+		if info == nil {
+			continue
+		}
+		rec, err := output.ToRecord(info)
+		if err != nil {
+			return report, err
+		}
+		records[i] = rec
+		if info.RiskValue != "" && (lowest < 0 || info.RiskScore < infos[lowest].RiskScore) {
+			lowest = i
+		}
+	}
+	if lowest >= 0 {
+		report.LowestRisk = ips[lowest]
+	}
+
+	for _, field := range compareFields {
+		row := compareRow{Field: field, Values: make([]string, len(ips))}
+		first := ""
+		seen := false
+		for i, rec := range records {
+			if rec == nil {
+				continue
+			}
+			if v, ok := rec.Lookup(field); ok {
+				row.Values[i] = output.CellString(v)
+			}
+			if !seen {
+				first, seen = row.Values[i], true
+			} else if row.Values[i] != first {
+				row.Differs = true
+			}
+		}
+		report.Rows = append(report.Rows, row)
+	}
+	return report, nil
+}
+
+// writeCompare 以对齐的文本输出比较结果，值不同的字段以“*”标记
+func writeCompare(w io.Writer, report compareReport) {
+	header := append([]string{"", "字段"}, report.IPs...)
+	rows := make([][]string, 0, len(report.Rows)+1)
+	differs := 0
+	for _, r := range report.Rows {
+		mark := ""
+		if r.Differs {
+			mark = "*"
+			differs++
+		}
+		rows = append(rows, append([]string{mark, r.Field}, r.Values...))
+	}
+	if len(report.Errors) > 0 {
+		row := []string{"", "error"}
+		for _, ip := range report.IPs {
+			row = append(row, report.Errors[ip])
+		}
+		rows = append(rows, row)
+	}
+	writeAligned(w, header, rows)
+
+	fmt.Fprintf(w, "\n共 %d 个字段不同", differs)
+	if report.LowestRisk != "" {
+		i := slices.Index(report.IPs, report.LowestRisk)
+		risk := report.Rows[slices.Index(compareFields, "risk_value")].Values[i]
+		fmt.Fprintf(w, "，风控值最低的是 %s（%s）", report.LowestRisk, risk)
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+
+	"ping0/internal/core"
+	"ping0/internal/output"
+)
+
+// diffIgnoredFields 比较时忽略的字段，它们每次查询都不同，与IP本身的属性无关
+var diffIgnoredFields = map[string]bool{
+	"princess":    true,
+	"request_id":  true,
+	"age_seconds": true,
+	"queried_at":  true,
+}
+
+// diffHighlightFields 风控和IP类型相关的字段，发生变化时在输出中以“!”标记
+var diffHighlightFields = map[string]bool{
+	"risk_value": true,
+	"risk_score": true,
+	"risk_label": true,
+	"ip_type":    true,
+	"native_ip":  true,
+}
+
+// fieldDiff 两个查询结果中一个字段的差异
+type fieldDiff struct {
+	Field     string `json:"field"`
+	Old       string `json:"old"`
+	New       string `json:"new"`
+	Highlight bool   `json:"highlight"` // 是否为风控或IP类型字段
+}
+
+// diffReport diff子命令以JSON输出时的结果
+type diffReport struct {
+	Old     string      `json:"old"` // 原结果的来源
+	New     string      `json:"new"` // 新结果的来源：文件路径或query
+	Changes []fieldDiff `json:"changes"`
+}
+
+// runDiffCommand 执行diff子命令，逐字段比较保存的查询结果与重新查询的结果（或另一个保存的结果）
+// 用法:
+//
+//	pong0 [查询参数] diff old.json            重新查询old.json中的IP并比较
+//	pong0 [查询参数] diff old.json 1.1.1.1    查询指定IP并与old.json比较
+//	pong0 diff old.json new.json              比较两个保存的结果
+//
+// 保存的结果是 pong0 -ip 1.1.1.1 > old.json 输出的JSON对象，路径为 - 时从标准输入读取。
+// 默认输出对齐的文本，风控值、IP类型等字段的变化以“!”标记；指定 -o json 时输出JSON。
+//
+// 参数:
+//   - args: diff之后的参数
+func runDiffCommand(args []string) {
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Println("错误: diff 子命令需要一个保存的结果文件，以及可选的IP或另一个结果文件")
+		fmt.Println("用法示例:")
+		fmt.Println("  重新查询并比较: pong0 diff old.json")
+		fmt.Println("  比较两个文件: pong0 diff old.json new.json")
+		os.Exit(exitUsage)
+	}
+	validateCommandLineOptions()
+
+	oldRec, oldIP, err := readSavedResult(args[0])
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	var newRec output.Record
+	newSource := "query"
+	if len(args) == 2 && net.ParseIP(args[1]) == nil {
+		newSource = args[1]
+		if newRec, _, err = readSavedResult(args[1]); err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(exitUsage)
+		}
+	} else {
+		ip := oldIP
+		if len(args) == 2 {
+			ip = args[1]
+		}
+		cfg := buildConfig()
+		// 总是重新查询，不使用磁盘缓存中的结果
+		info, err := core.ProcessIPInfo(context.Background(), cfg, ip)
+		flushTraces(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "获取IP信息失败: %v\n", err)
+			os.Exit(exitCodeFor(err))
+		}
+		if newRec, err = output.ToRecord(info); err != nil {
+			fmt.Fprintf(os.Stderr, "转换查询结果失败: %v\n", err)
+			os.Exit(exitFailure)
+		}
+	}
+
+	report := diffReport{Old: args[0], New: newSource, Changes: diffRecords(oldRec, newRec)}
+	if outputFormatSet() && outputFormat == formatJSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err == nil {
+			fmt.Println(string(data))
+		}
+		return
+	}
+	writeDiff(os.Stdout, report)
+}
+
+// readSavedResult 读取保存的查询结果
+//
+// 参数:
+//   - path: 结果文件路径，为 - 时从标准输入读取
+//
+// 返回:
+//   - output.Record: 按字段顺序排列的结果
+//   - string: 结果中的IP
+//   - error: 如果无法读取、不是JSON对象或是失败的结果则返回相应错误
+func readSavedResult(path string) (output.Record, string, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("读取结果文件失败: %w", err)
+	}
+
+	rec, err := output.ToRecord(json.RawMessage(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%s 不是保存的查询结果（需要JSON对象）: %w", path, err)
+	}
+	if msg, ok := rec.Lookup("error"); ok {
+		return nil, "", fmt.Errorf("%s 是失败的查询结果: %s", path, output.CellString(msg))
+	}
+	ip, _ := rec.Lookup("ip")
+	ipStr, _ := ip.(string)
+	if net.ParseIP(ipStr) == nil {
+		return nil, "", fmt.Errorf("%s 中没有有效的ip字段", path)
+	}
+	return rec, ipStr, nil
+}
+
+// diffRecords 逐字段比较两个结果，返回值不同的字段
+// 风控和IP类型字段排在最前，其余字段按新结果中的顺序排列，只在原结果中出现的字段排在最后；嵌套的对象和数组按紧凑JSON比较。
+func diffRecords(oldRec, newRec output.Record) []fieldDiff {
+	changes := []fieldDiff{}
+	compare := func(key string) {
+		if diffIgnoredFields[key] {
+			return
+		}
+		var oldValue, newValue string
+		if v, ok := oldRec.Lookup(key); ok {
+			oldValue = output.CellString(v)
+		}
+		if v, ok := newRec.Lookup(key); ok {
+			newValue = output.CellString(v)
+		}
+		if oldValue != newValue {
+			changes = append(changes, fieldDiff{Field: key, Old: oldValue, New: newValue, Highlight: diffHighlightFields[key]})
+		}
+	}
+
+	for _, f := range newRec {
+		compare(f.Key)
+	}
+	for _, f := range oldRec {
+		if _, ok := newRec.Lookup(f.Key); !ok {
+			compare(f.Key)
+		}
+	}
+	slices.SortStableFunc(changes, func(a, b fieldDiff) int {
+		switch {
+		case a.Highlight && !b.Highlight:
+			return -1
+		case !a.Highlight && b.Highlight:
+			return 1
+		}
+		return 0
+	})
+	return changes
+}
+
+// writeDiff 以对齐的文本输出比较结果，风控和IP类型字段的变化以“!”标记
+func writeDiff(w io.Writer, report diffReport) {
+	newSource := report.New
+	if newSource == "query" {
+		newSource = "重新查询的结果"
+	}
+	if len(report.Changes) == 0 {
+		fmt.Fprintf(w, "%s 与 %s 没有差异\n", report.Old, newSource)
+		return
+	}
+
+	highlighted := 0
+	rows := make([][]string, 0, len(report.Changes))
+	for _, c := range report.Changes {
+		mark := ""
+		if c.Highlight {
+			mark = "!"
+			highlighted++
+		}
+		rows = append(rows, []string{mark, c.Field, c.Old, c.New})
+	}
+	writeAligned(w, []string{"", "字段", report.Old, newSource}, rows)
+	fmt.Fprintf(w, "\n共 %d 个字段不同，其中 %d 个为风控或IP类型字段\n", len(report.Changes), highlighted)
+}
+
+// outputFormatSet 判断命令行中是否指定了 -o 参数
+func outputFormatSet() bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "o" {
+			set = true
+		}
+	})
+	return set
+}
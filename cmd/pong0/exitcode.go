@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	perrors "ping0/internal/errors"
+	"ping0/internal/models"
+)
+
+// 命令行程序的退出码，便于定时任务和CI脚本根据失败类型分别处理
+const (
+	exitOK        = 0 // 成功
+	exitFailure   = 1 // 其他错误
+	exitNetwork   = 2 // 网络错误：连接失败、超时、上游拒绝访问或限流
+	exitChallenge = 3 // 验证失败：缺少x1、POW失败、密钥被拒绝（算法可能已更新）
+	exitParse     = 4 // 解析失败：无法从页面中解析出IP信息
+	exitUsage     = 5 // 参数无效：参数组合错误、配置无效等
+	exitRisky     = 6 // 风控值超过 -max-risk 指定的阈值
+)
+
+// exitCodeFor 根据错误类别返回对应的退出码
+//
+// 参数:
+//   - err: 查询过程返回的错误
+//
+// 返回:
+//   - int: 对应的退出码，err为nil时返回exitOK
+func exitCodeFor(err error) int {
+	if err == nil {
+		return exitOK
+	}
+
+	switch perrors.Class(err) {
+	case perrors.ErrNetwork, perrors.ErrTimeout, perrors.ErrUpstreamBlocked, perrors.ErrRateLimited:
+		return exitNetwork
+	case perrors.ErrChallengeFailed:
+		return exitChallenge
+	case perrors.ErrParseFailure:
+		return exitParse
+	default:
+		return exitFailure
+	}
+}
+
+// riskExceeded 判断查询结果的风控值是否超过 -max-risk 指定的阈值
+// 结果中没有风控值时（如Ping0.cc不可用时返回的降级结果）无法确认IP的信誉，同样视为超过阈值。
+//
+// 参数:
+//   - info: 查询结果
+//
+// 返回:
+//   - bool: 未指定 -max-risk 时总是返回false
+func riskExceeded(info *models.IPInfo) bool {
+	if maxRisk < 0 {
+		return false
+	}
+	if info.RiskValue == "" {
+		fmt.Fprintf(os.Stderr, "%s 没有风控值，视为超过阈值 %d\n", info.IP, maxRisk)
+		return true
+	}
+	if info.RiskScore > maxRisk {
+		fmt.Fprintf(os.Stderr, "%s 的风控值 %d 超过阈值 %d\n", info.IP, info.RiskScore, maxRisk)
+		return true
+	}
+	return false
+}
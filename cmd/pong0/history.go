@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"ping0/internal/config"
+	"ping0/internal/models"
+	"ping0/internal/store"
+)
+
+// runHistoryMode 在历史记录模式下运行程序
+// 从历史记录数据库中读取指定IP的查询记录，按-o指定的格式输出
+func runHistoryMode(cfg *config.Config) {
+	if cfg.History == nil {
+		fmt.Println("错误: -history 参数需要通过 -db 参数或配置文件指定历史记录数据库")
+		os.Exit(exitUsage)
+	}
+
+	records, err := cfg.History.History(context.Background(), historyIP, store.DefaultHistoryLimit)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(exitFailure)
+	}
+
+	values := make([]interface{}, len(records))
+	for i, rec := range records {
+		// 保存记录时的配置可能不同，按当前配置设置Princess字段
+		rec.Info.Princess = models.Princess(cfg.Branding())
+		values[i] = rec
+	}
+	if err := writeOutput(os.Stdout, outputFormat, values, false); err != nil {
+		fmt.Printf("输出结果失败: %v\n", err)
+		os.Exit(exitFailure)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"ping0/internal/config"
+	"ping0/internal/resolver"
+)
+
+// runHostMode 在主机名查询模式下运行程序
+// 先解析主机名的A和AAAA记录，再依次查询每个地址，按批量查询的形式输出全部结果
+func runHostMode(cfg *config.Config) {
+	r, err := resolver.New(cfg.Resolver)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.RequestTimeout())
+	ips, err := resolver.LookupHost(ctx, r, host)
+	cancel()
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(exitNetwork)
+	}
+
+	if cfg.Verbose {
+		fmt.Println("-------------------------------------")
+		fmt.Println("Pong0 Pong0 Pong0")
+		fmt.Println("-------------------------------------")
+		fmt.Printf("主机名 %s 解析到 %d 个IP: %v\n", host, len(ips), ips)
+	}
+
+	runQueries(cfg, ips)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"ping0/internal/config"
+	"ping0/internal/core"
+	"ping0/internal/models"
+)
+
+// runKeysOnlyMode 在仅计算密钥模式下运行程序
+// 获取初始页面并计算访问密钥后，输出x1、difficulty、js1key和pow等参数，不请求最终页面
+func runKeysOnlyMode(cfg *config.Config) {
+	if cfg.Verbose {
+		fmt.Println("-------------------------------------")
+		fmt.Println("Pong0 Pong0 Pong0")
+		fmt.Println("-------------------------------------")
+		fmt.Println("仅计算访问密钥")
+	}
+
+	keyInfo, err := core.GenerateKeys(context.Background(), cfg)
+	if err != nil {
+		if cfg.Verbose {
+			fmt.Printf("计算访问密钥失败: %v\n", err)
+		} else {
+			errorResult := models.WithPrincess(map[string]string{
+				"error": err.Error(),
+			}, cfg.Branding())
+			writeOutput(os.Stdout, outputFormat, []interface{}{errorResult}, true)
+		}
+		os.Exit(exitCodeFor(err))
+	}
+
+	if cfg.Verbose {
+		fmt.Println("-------------------------------------")
+	}
+
+	if err := writeOutput(os.Stdout, outputFormat, []interface{}{keyInfo}, true); err != nil {
+		fmt.Printf("输出结果失败: %v\n", err)
+		os.Exit(exitFailure)
+	}
+}
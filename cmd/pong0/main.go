@@ -3,26 +3,136 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
+	"ping0/internal/asn"
+	"ping0/internal/audit"
+	"ping0/internal/auth"
+	"ping0/internal/client"
+	"ping0/internal/config"
 	"ping0/internal/constants"
 	"ping0/internal/core"
+	"ping0/internal/diskcache"
+	"ping0/internal/i18n"
+	"ping0/internal/logger"
+	"ping0/internal/models"
+	"ping0/internal/parser"
+	"ping0/internal/providers"
 	"ping0/internal/server"
+	"ping0/internal/sink"
+	"ping0/internal/store"
+	"ping0/internal/tracing"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
 )
 
 // 命令行选项定义
 var (
-	ip              string // 要查询的IP地址
-	port            string // API服务器端口
-	apiKey          string // API访问密钥
-	serverMode      bool   // 是否启动API服务器模式
-	verbose         bool   // 详细输出模式
-	manualX1Value   string // 手动指定x1值
-	manualDiffValue string // 手动指定difficulty值
-	showVersion     bool   // 显示版本信息
+	ip              string        // 要查询的IP地址
+	port            string        // API服务器端口
+	apiKey          string        // API访问密钥
+	apiKeysFile     string        // 多个API密钥的配置文件
+	adminKey        string        // 管理员密钥
+	signingKey      string        // 响应签名密钥
+	tlsCert         string        // 服务器的TLS证书文件
+	tlsKey          string        // 服务器的TLS私钥文件
+	clientCA        string        // 验证客户端证书的CA证书文件
+	serverMode      bool          // 是否启动API服务器模式
+	verbose         bool          // 详细输出模式
+	manualX1Value   string        // 手动指定x1值
+	manualDiffValue string        // 手动指定difficulty值
+	showVersion     bool          // 显示版本信息
+	ipFile          string        // 批量查询的IP列表文件
+	host            string        // 要解析并查询的主机名
+	dnsServer       string        // 解析主机名使用的DNS服务器
+	rdns            bool          // 是否查询反向DNS记录
+	historyDB       string        // 历史记录数据库路径或连接地址
+	historyIP       string        // 要查看历史记录的IP
+	queryTag        string        // 查询结果保存到历史记录时附带的标签
+	monitorFile     string        // 监控模式的IP列表文件
+	monitorInterval time.Duration // 监控模式的查询间隔
+	webhook         string        // IP属性变化时接收通知的Webhook地址
+	watchInterval   time.Duration // 定时自检模式的查询间隔
+	watchOutput     string        // 定时自检模式追加写入记录的文件
+	changesOnly     bool          // 定时自检模式下只在变化时输出记录
+	keysOnly        bool          // 只计算访问密钥，不请求最终页面
+	parseFile       string        // 离线解析的HTML文件
+	ndjson          bool          // 批量查询时以NDJSON格式输出
+	queryWorkers    int           // 批量查询同时进行的查询数量
+	queryDelay      time.Duration // 批量查询相邻两次查询的最小间隔
+	sinkSpec        string        // 批量查询和定时自检模式写入NDJSON记录的输出目标
+	maxRisk         int           // 风控值阈值，超过时以exitRisky退出，-1表示不检查
+	proxy           string        // 代理地址
+	baseURL         string        // Ping0服务的基础URL
+	mirrors         string        // 镜像站点的基础URL
+	userAgent       string        // HTTP请求的User-Agent头
+	headerProfile   string        // 浏览器请求头配置名称
+	headerJitter    bool          // 随机变化请求头
+	maxIdleConns    int           // 保持的最大空闲连接数
+	idleConnTimeout time.Duration // 空闲连接保持的时间
+	tlsTimeout      time.Duration // TLS握手的超时时间
+	httpVersion     string        // HTTP协议版本
+	noKeepAlives    bool          // 禁用连接复用
+	powMax          int           // POW计算最大迭代次数
+	keyAlgorithm    string        // 密钥生成算法版本
+	algoFallback    bool          // 密钥被拒绝时尝试其他算法版本
+	selectorsFile   string        // 解析结果页面使用的CSS选择器定义文件
+	parseMode       string        // 解析模式
+	rateLimit       int           // 每个客户端IP每分钟允许的查询次数
+	globalRateLimit int           // 服务器每分钟允许的查询总次数
+	rateRedis       string        // 保存限流计数的Redis地址
+	trustedProxies  string        // 可信的反向代理
+	concurrency     int           // 同时发往Ping0.cc的最大查询数量
+	queueDepth      int           // 达到并发上限后允许排队等待的查询数量
+	sessionPool     int           // 服务器模式下预先完成握手的访问密钥数量
+	poolRefresh     time.Duration // 会话池中访问密钥的刷新间隔
+	logLevel        string        // 日志级别
+	logFormat       string        // 日志输出格式
+	outputFormat    string        // 查询结果输出格式
+	quiet           bool          // 只输出查询结果
+	outputFields    string        // 只输出指定的字段，多个以逗号分隔
+	noHeader        bool          // CSV输出时不输出表头行
+	lang            string        // 标签值的输出语言
+	noBranding      bool          // 去掉输出中的Princess字段
+	configPath      string        // 配置文件路径
+	timeout         time.Duration // 单个上游请求的超时时间
+	connectTimeout  time.Duration // 建立TCP连接的超时时间
+	readTimeout     time.Duration // 等待响应头的超时时间
+	shutdownTimeout time.Duration // 服务器优雅退出的等待时间
+	maxQueryTimeout time.Duration // API调用方可以设置的最长查询时间
+	cacheTTL        time.Duration // 服务器缓存查询结果的最长时间
+	cacheSoftTTL    time.Duration // 缓存结果在后台刷新的时间
+	jobRetention    time.Duration // 批量查询任务完成后保留结果的时间
+	cacheDir        string        // 命令行查询结果的磁盘缓存目录
+	noCache         bool          // 不使用缓存的查询结果
+	docs            bool          // 是否提供Swagger UI页面
+	accessLogPath   string        // 访问日志文件路径
+	accessLogFormat string        // 访问日志格式
+	auditLog        string        // 审计日志路径
+	auditRetention  time.Duration // 审计日志的保留时间
+	historyRetain   time.Duration // 历史记录的保留时间
+	sessionFile     string        // 访问密钥的持久化文件
+	sessionRedis    string        // 共享访问密钥的Redis地址
+	jsPathFile      string        // 初始页面中脚本路径的记录文件
+	knownScripts    string        // 已知可用的JavaScript文件SHA-256
+	cookieFile      string        // cookie jar的持久化文件
+	dumpDir         string        // 解析失败时保存原始HTML响应的目录
+	otlpEndpoint    string        // OTLP/HTTP追踪接收端地址
+	otlpHeaders     string        // 导出追踪时附带的请求头
+	asnDB           string        // ASN注册数据文件路径
+	asnUpdate       bool          // 下载ASN注册数据后退出
+	maxmindDB       string        // MaxMind mmdb数据库路径
+	useIPAPI        bool          // 是否使用ip-api.com数据源
+	useRIPEstat     bool          // 是否使用RIPEstat数据源
+	useFallback     bool          // Ping0.cc不可用时是否返回降级结果
 )
 
 // 构建信息，在编译时通过-ldflags注入
@@ -40,14 +150,109 @@ func init() {
 	flag.StringVar(&ip, "ip", "", "要查询的IP地址，不提供则查询本机IP")
 	flag.StringVar(&port, "p", "8080", "API服务器监听端口")
 	flag.StringVar(&apiKey, "k", "", "API访问密钥")
+	flag.StringVar(&apiKeysFile, "keys", "", "多个API密钥的配置文件（YAML或SQLite），每个密钥可以设置每日配额和允许的客户端IP")
+	flag.StringVar(&adminKey, "admin-key", "", "管理员密钥，请求头X-Admin-Key与之一致时允许在POST /query中手动指定x1和difficulty，以及通过/admin/audit读取审计日志")
+	flag.StringVar(&signingKey, "signing-key", "", "响应签名密钥，设置后JSON查询结果带有HMAC-SHA256签名（signature字段）")
+	flag.StringVar(&tlsCert, "tls-cert", "", "服务器模式下的TLS证书文件（PEM），与 -tls-key 同时指定时以HTTPS提供服务")
+	flag.StringVar(&tlsKey, "tls-key", "", "服务器模式下的TLS私钥文件（PEM）")
+	flag.StringVar(&clientCA, "client-ca", "", "验证客户端证书的CA证书文件（PEM），指定后启用mTLS，持有有效客户端证书的请求无需API密钥")
 	flag.StringVar(&manualX1Value, "x1", "", "手动指定x1值")
 	flag.StringVar(&manualDiffValue, "diff", "", "手动指定difficulty值")
 	flag.BoolVar(&serverMode, "c", false, "启动API服务器模式")
+	flag.IntVar(&rateLimit, "rate", 0, "服务器模式下每个客户端IP每分钟允许的查询次数，0表示不限制")
+	flag.IntVar(&globalRateLimit, "rate-global", 0, "服务器模式下每分钟允许的查询总次数，0表示不限制")
+	flag.StringVar(&rateRedis, "rate-redis", "", "在Redis中保存限流计数，如 redis://10.0.0.5:6379/0，-rate 和 -rate-global 由连接同一Redis的全部服务器副本共同遵守")
+	flag.StringVar(&trustedProxies, "trusted-proxies", "", "服务器模式下可信的反向代理，IP或CIDR网段以逗号分隔，如 10.0.0.0/8,127.0.0.1；只有来自这些地址的请求才根据X-Forwarded-For确定客户端IP，未设置时一律使用连接的对端地址")
+	flag.IntVar(&concurrency, "concurrency", 0, "服务器模式下同时发往Ping0.cc的最大查询数量，0表示不限制")
+	flag.IntVar(&queueDepth, "queue", config.DefaultQueueDepth, "服务器模式下达到并发上限后允许排队等待的查询数量，队列已满时返回503")
+	flag.IntVar(&sessionPool, "session-pool", 0, "服务器模式下在后台预先完成握手和POW计算的访问密钥数量，查询轮流使用，0表示不使用会话池")
+	flag.DurationVar(&poolRefresh, "session-pool-refresh", config.DefaultSessionPoolRefresh, "会话池中访问密钥的刷新间隔，超过该时间的密钥在后台替换")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", config.DefaultShutdownTimeout, "服务器模式下收到退出信号后等待进行中查询完成的最长时间")
+	flag.DurationVar(&maxQueryTimeout, "max-query-timeout", config.DefaultMaxQueryTimeout, "服务器模式下API调用方通过timeout参数可以设置的最长查询时间")
+	flag.DurationVar(&cacheTTL, "cache-ttl", 0, "缓存查询结果的最长时间，如 10m，0表示不缓存；服务器模式下缓存在内存中，其他模式下缓存在磁盘上")
+	flag.StringVar(&cacheDir, "cache-dir", "", "命令行查询结果的磁盘缓存目录，默认为用户缓存目录下的pong0（如 ~/.cache/pong0）")
+	flag.BoolVar(&noCache, "no-cache", false, "不使用缓存的查询结果，直接查询并更新缓存")
+	flag.DurationVar(&cacheSoftTTL, "cache-soft-ttl", 0, "服务器模式下超过该时间的缓存结果仍然立即返回，同时在后台重新查询（stale-while-revalidate），需小于 -cache-ttl")
+	flag.DurationVar(&jobRetention, "job-retention", config.DefaultJobRetention, "服务器模式下批量查询任务（/jobs）完成后保留结果的时间")
+	flag.BoolVar(&docs, "docs", false, "服务器模式下在/docs提供Swagger UI页面")
+	flag.StringVar(&accessLogPath, "access-log", "", "服务器模式下的访问日志文件路径，文件超过大小限制后自动轮转")
+	flag.StringVar(&accessLogFormat, "access-log-format", server.AccessLogCombined, "访问日志格式: combined、json")
+	flag.StringVar(&auditLog, "audit-log", "", "服务器模式下的审计日志路径，记录每次查询的调用方、API密钥、查询的IP和结果状态；扩展名为.db、.sqlite或.sqlite3时使用SQLite数据库，postgres://开头时使用PostgreSQL数据库，否则为JSON Lines文件")
+	flag.DurationVar(&auditRetention, "audit-retention", 0, "服务器模式下审计日志的保留时间，如 2160h，更早的记录每小时在后台删除一次，0表示永久保留")
+	flag.DurationVar(&historyRetain, "history-retention", 0, "服务器模式下历史记录（-db）的保留时间，如 720h，更早的记录每小时在后台删除一次，0表示永久保留")
 	flag.BoolVar(&verbose, "all", false, "输出详细日志")
 	flag.BoolVar(&showVersion, "v", false, "显示版本信息")
+	flag.StringVar(&logLevel, "log-level", "", "日志级别: debug、info、warn、error，默认info，使用-all时为debug")
+	flag.StringVar(&logFormat, "log-format", "text", "日志输出格式: text、json")
+	flag.StringVar(&ipFile, "file", "", "批量查询的IP列表文件，每行一个IP")
+	flag.StringVar(&outputFormat, "o", formatJSON, "查询结果输出格式: json、yaml、csv、table")
+	flag.BoolVar(&quiet, "q", false, "安静模式: 只输出查询结果，JSON不缩进且不包含princess字段，失败时错误信息输出到标准错误")
+	flag.StringVar(&outputFields, "fields", "", "只输出指定的字段，多个以逗号分隔，如 ip,risk_value,ip_type")
+	flag.BoolVar(&noHeader, "no-header", false, "CSV输出时不输出表头行，便于追加到已有的表格")
+	flag.StringVar(&lang, "lang", i18n.LangZH, "IP类型、风控等级等标签值的输出语言: zh、en")
+	flag.BoolVar(&noBranding, "no-branding", false, "从查询结果、错误信息和API响应中去掉固定添加的princess字段")
+	flag.IntVar(&maxRisk, "max-risk", -1, "风控值阈值（0-100），查询结果的风控值超过该值或没有风控值时以退出码6退出，便于CI和部署脚本拒绝信誉差的IP")
+	flag.StringVar(&host, "host", "", "要查询的主机名，解析其全部A和AAAA记录后逐个查询")
+	flag.StringVar(&dnsServer, "resolver", "", "解析主机名和反向DNS使用的DNS服务器，如 8.8.8.8 或 1.1.1.1:53，不提供则使用系统解析器")
+	flag.BoolVar(&rdns, "rdns", false, "查询IP的反向DNS（PTR）记录，结果输出在ptr字段中")
+	flag.StringVar(&historyDB, "db", "", "历史记录数据库，SQLite文件路径或PostgreSQL连接地址（postgres://用户:密码@主机/数据库），指定后每次成功的查询都会保存到数据库，服务器模式下同时保存已完成的批量查询任务")
+	flag.StringVar(&historyIP, "history", "", "显示指定IP的历史查询记录（需要 -db）")
+	flag.StringVar(&queryTag, "tag", "", "与查询结果一起保存到历史记录的标签，如 proxy-batch-2024-06，便于按批次分组查看和导出（需要 -db）")
+	flag.StringVar(&monitorFile, "monitor", "", "监控模式的IP列表文件，定期查询其中的IP并在风控值、IP类型或原生IP变化时发出通知")
+	flag.DurationVar(&monitorInterval, "interval", config.DefaultMonitorInterval, "监控模式或API服务器/ws订阅的两轮查询之间的间隔")
+	flag.StringVar(&webhook, "webhook", "", "监控模式下IP属性变化时POST通知的Webhook地址；监控模式和API服务器模式下，初始页面中的脚本路径变化时也会通知该地址")
+	flag.DurationVar(&watchInterval, "watch", 0, "定时自检模式，按指定间隔（如 5m）重复查询本机IP或-ip指定的IP，每次输出一行JSON记录")
+	flag.StringVar(&watchOutput, "watch-out", "", "定时自检模式下将记录追加写入指定文件，不提供则输出到标准输出，与 -sink 相同")
+	flag.BoolVar(&changesOnly, "changes-only", false, "定时自检模式下只在IP、风控值、IP类型或原生IP变化时输出记录")
+	flag.BoolVar(&keysOnly, "keys-only", false, "只获取初始页面并计算访问密钥，输出x1、difficulty、js1key和pow，不请求最终页面")
+	flag.StringVar(&parseFile, "parse-file", "", "解析保存在磁盘上的HTML页面，不进行任何网络请求")
+	flag.BoolVar(&ndjson, "ndjson", false, "批量查询时以NDJSON格式逐行输出结果")
+	flag.IntVar(&queryWorkers, "workers", 1, "批量查询同时进行的查询数量（1-32），过大容易被Ping0.cc限流")
+	flag.DurationVar(&queryDelay, "delay", 0, "批量查询相邻两次查询开始的最小间隔，如 500ms；遇到限流或验证失败时自动增大间隔")
+	flag.StringVar(&sinkSpec, "sink", "", "批量查询和定时自检模式下NDJSON记录的输出目标：文件路径、file://路径?max_size=100&daily=true 或 s3://bucket/prefix")
+	flag.IntVar(&powMax, "pow-max", config.DefaultPowMaxIterations, "POW计算的最大迭代次数")
+	flag.StringVar(&keyAlgorithm, "algo", parser.AlgorithmAuto, "密钥生成算法版本，auto表示根据页面引用的JavaScript自动选择，可选: "+strings.Join(parser.Algorithms(), "、"))
+	flag.BoolVar(&algoFallback, "algo-fallback", false, "密钥被拒绝时依次尝试其他已注册的算法版本")
+	flag.StringVar(&parseMode, "parse-mode", config.ParseModeLenient, "解析模式: lenient返回已找到的字段并在missing_fields中列出缺少的字段，strict在任一字段缺失时报错")
+	flag.StringVar(&selectorsFile, "selectors", "", "解析结果页面使用的CSS选择器定义文件，Ping0.cc调整页面结构时用于临时修复解析，pong0 selectors 输出内置的定义")
+	flag.StringVar(&configPath, "config", "", "配置文件路径，默认读取 ~/.pong0.yaml（如存在），也可通过PONG0_CONFIG环境变量指定")
+	flag.DurationVar(&timeout, "timeout", config.DefaultTimeout, "单个上游请求（获取初始页面、获取最终页面）或一次POW计算的超时时间，如 10s、30s")
+	flag.DurationVar(&connectTimeout, "connect-timeout", 0, "与Ping0.cc建立TCP连接的超时时间，0表示只受 -timeout 约束")
+	flag.DurationVar(&readTimeout, "read-timeout", 0, "发送请求后等待响应头的超时时间，0表示只受 -timeout 约束")
+	flag.StringVar(&sessionFile, "session-file", "", "访问密钥的持久化文件，连续多次运行时复用已通过验证的会话")
+	flag.StringVar(&sessionRedis, "session-redis", "", "在Redis中共享访问密钥，如 redis://:password@10.0.0.5:6379/0，多个服务器副本共用同一组密钥，只需一个副本完成握手")
+	flag.StringVar(&knownScripts, "known-script-hashes", "", "已知可用的JavaScript文件内容SHA-256，多个以逗号分隔；初始页面引用的脚本不在其中时，错误信息和 /stats 中标记为未知版本")
+	flag.StringVar(&jsPathFile, "js-path-file", "", "初始页面中脚本路径的记录文件，连续多次运行时也能发现路径变化（通常预示密钥算法更新）")
+	flag.StringVar(&cookieFile, "cookie-file", "", "cookie jar的持久化文件，保存站点设置的全部cookie，连续多次运行时复用")
+	flag.StringVar(&dumpDir, "dump-dir", "", "解析失败或密钥被拒绝时，将初始页面和最终页面的原始HTML及请求信息保存到该目录")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "", "OTLP/HTTP追踪接收端地址（如 http://localhost:4318），指定后将查询过程的追踪区间导出到该地址")
+	flag.StringVar(&otlpHeaders, "otlp-headers", "", "导出追踪时附带的请求头，格式为key=value，多个以逗号分隔（如 Authorization=Bearer xxx）")
+	flag.StringVar(&asnDB, "asn-db", "", "ASN注册数据文件路径，指定后查询结果会补充ASN的名称、国家和所属RIR")
+	flag.BoolVar(&asnUpdate, "asn-update", false, "从RIR下载最新的ASN注册数据并保存到 -asn-db 指定的文件")
+	flag.StringVar(&maxmindDB, "maxmind", "", "MaxMind mmdb数据库路径（如GeoLite2-City.mmdb,GeoLite2-ASN.mmdb），指定后用于补充和交叉验证查询结果")
+	flag.BoolVar(&useIPAPI, "ipapi", false, "使用ip-api.com补充和交叉验证查询结果")
+	flag.BoolVar(&useRIPEstat, "ripestat", false, "使用RIPEstat补充和交叉验证查询结果")
+	flag.BoolVar(&useFallback, "fallback", false, "Ping0.cc无法访问或验证失败时，返回 -maxmind 数据库生成的降级结果（source为fallback）而不是错误")
+	flag.StringVar(&baseURL, "base-url", constants.BaseURL, "Ping0服务的基础URL")
+	flag.StringVar(&mirrors, "mirrors", "", "镜像站点的基础URL，多个以逗号分隔；主站无法访问时依次切换，主站恢复后自动切回")
+	flag.StringVar(&userAgent, "ua", constants.UserAgent, "HTTP请求的User-Agent头，优先于 -profile 中的User-Agent")
+	flag.StringVar(&headerProfile, "profile", "", "浏览器请求头配置: "+strings.Join(client.ProfileNames(), "、")+"，设置一组相互一致的User-Agent和Sec-Ch-Ua等请求头")
+	flag.BoolVar(&headerJitter, "jitter", false, "在真实范围内随机变化每次查询的浏览器版本号、Accept-Language顺序和缓存相关请求头，降低长期运行时被识别的可能")
+	flag.IntVar(&maxIdleConns, "max-idle-conns", config.DefaultMaxIdleConns, "与Ping0.cc之间保持的最大空闲连接数")
+	flag.DurationVar(&idleConnTimeout, "idle-conn-timeout", config.DefaultIdleConnTimeout, "空闲连接保持的时间")
+	flag.DurationVar(&tlsTimeout, "tls-handshake-timeout", config.DefaultTLSHandshakeTimeout, "TLS握手的超时时间")
+	flag.StringVar(&httpVersion, "http-version", config.HTTPVersionAuto, "HTTP协议版本: auto（站点支持时使用HTTP/2）、1.1、2")
+	flag.BoolVar(&noKeepAlives, "disable-keepalives", false, "禁用连接复用，每个请求都建立新连接")
+	flag.StringVar(&proxy, "proxy", "", "代理地址，如 http://127.0.0.1:8080 或 socks5://127.0.0.1:1080，不提供则使用HTTP_PROXY等环境变量")
 
-	// 解析命令行参数
-	flag.Parse()
+	// 解析命令行参数，参数无效时以exitUsage退出，而不是flag包默认的退出码2
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	if err := flag.CommandLine.Parse(os.Args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			os.Exit(exitOK)
+		}
+		os.Exit(exitUsage)
+	}
 }
 
 // main 函数是程序的入口点，处理命令行参数并执行相应功能
@@ -58,17 +263,65 @@ func main() {
 		return
 	}
 
+	// 子命令，不需要查询配置
+	switch flag.Arg(0) {
+	case "":
+	case "schema":
+		runSchemaCommand()
+		return
+	case "service":
+		runServiceCommand(flag.Arg(1))
+		return
+	case "diff":
+		runDiffCommand(flag.Args()[1:])
+		return
+	case "compare":
+		runCompareCommand(flag.Args()[1:])
+		return
+	case "selectors":
+		os.Stdout.Write(parser.DefaultSelectors())
+		return
+	case "verify-algo":
+		runVerifyAlgoCommand(flag.Args()[1:])
+		return
+	case "stats":
+		runStatsCommand(flag.Args()[1:])
+		return
+	case "report":
+		runReportCommand(flag.Args()[1:])
+		return
+	default:
+		fmt.Printf("错误: 未知的子命令: %s（支持 schema、service、diff、compare、selectors、verify-algo、stats、report）\n", flag.Arg(0))
+		os.Exit(exitUsage)
+	}
+
 	// 验证参数组合是否合法
 	validateCommandLineOptions()
 
-	// 将命令行参数应用到全局配置
-	applyCommandLineOptions()
+	// 根据命令行参数构建运行配置
+	cfg := buildConfig()
 
 	// 根据运行模式执行不同功能
-	if constants.ServerMode {
-		runServerMode()
+	if asnUpdate {
+		runASNUpdateMode(cfg)
+	} else if cfg.ServerMode {
+		runServerMode(cfg)
+	} else if ipFile != "" {
+		runBatchMode(cfg)
+	} else if host != "" {
+		runHostMode(cfg)
+	} else if historyIP != "" {
+		runHistoryMode(cfg)
+	} else if monitorFile != "" {
+		runMonitorMode(cfg)
+	} else if watchInterval > 0 {
+		runWatchMode(cfg)
+	} else if keysOnly {
+		runKeysOnlyMode(cfg)
+	} else if parseFile != "" {
+		runParseFileMode(cfg)
 	} else {
-		runQueryMode()
+		runQueryMode(cfg)
 	}
 }
 
@@ -80,109 +333,749 @@ func validateCommandLineOptions() {
 		fmt.Println("用法示例:")
 		fmt.Println("  服务器模式: pong0 -c -p 8080 -k your_api_key")
 		fmt.Println("  查询模式: pong0 -ip 1.1.1.1")
-		os.Exit(1)
+		os.Exit(exitUsage)
 	}
 
-	// 检查 -p 和 -k 参数是否在没有 -c 参数的情况下使用
-	if !serverMode && (port != "8080" || apiKey != "") {
-		fmt.Println("错误: -p 和 -k 参数只能在服务器模式(-c)下使用")
+	// 检查 -p、-k、限流和退出等待参数是否在没有 -c 参数的情况下使用
+	if !serverMode && (port != "8080" || apiKey != "" || apiKeysFile != "" || adminKey != "" || signingKey != "" || tlsCert != "" || tlsKey != "" || clientCA != "" || rateLimit != 0 || globalRateLimit != 0 || rateRedis != "" || trustedProxies != "" ||
+		concurrency != 0 || queueDepth != config.DefaultQueueDepth ||
+		shutdownTimeout != config.DefaultShutdownTimeout || maxQueryTimeout != config.DefaultMaxQueryTimeout || cacheSoftTTL != 0 ||
+		jobRetention != config.DefaultJobRetention || sessionPool != 0 || poolRefresh != config.DefaultSessionPoolRefresh ||
+		docs || accessLogPath != "" || accessLogFormat != server.AccessLogCombined || auditLog != "" ||
+		auditRetention != 0 || historyRetain != 0) {
+		fmt.Println("错误: -p、-k、-keys、-admin-key、-signing-key、-tls-cert、-tls-key、-client-ca、-rate、-rate-global、-rate-redis、-trusted-proxies、-concurrency、-queue、-shutdown-timeout、-max-query-timeout、-cache-soft-ttl、-job-retention、-history-retention、-session-pool、-session-pool-refresh、-docs、-audit-log、-audit-retention 和 -access-log 系列参数只能在服务器模式(-c)下使用")
 		fmt.Println("用法示例:")
 		fmt.Println("  服务器模式: pong0 -c -p 8080 -k your_api_key")
 		fmt.Println("  查询模式: pong0 -ip 1.1.1.1")
-		os.Exit(1)
+		os.Exit(exitUsage)
+	}
+
+	// 检查 -file 参数是否与 -c 或 -ip 参数同时使用
+	if ipFile != "" && (serverMode || ip != "") {
+		fmt.Println("错误: -file 参数不能与 -c 或 -ip 参数同时使用")
+		fmt.Println("用法示例:")
+		fmt.Println("  批量查询模式: pong0 -file ips.txt")
+		os.Exit(exitUsage)
+	}
+
+	// 检查 -host 参数是否与 -c、-ip 或 -file 参数同时使用
+	if host != "" && (serverMode || ip != "" || ipFile != "") {
+		fmt.Println("错误: -host 参数不能与 -c、-ip 或 -file 参数同时使用")
+		fmt.Println("用法示例:")
+		fmt.Println("  主机名查询模式: pong0 -host example.com")
+		os.Exit(exitUsage)
 	}
-}
 
-// applyCommandLineOptions 将命令行参数应用到全局配置
-func applyCommandLineOptions() {
-	if verbose {
-		constants.Verbose = true
+	// 检查 -history 参数是否与其他模式同时使用
+	if historyIP != "" && (serverMode || ip != "" || ipFile != "" || host != "") {
+		fmt.Println("错误: -history 参数不能与 -c、-ip、-file 或 -host 参数同时使用")
+		fmt.Println("用法示例:")
+		fmt.Println("  历史记录模式: pong0 -db history.db -history 1.1.1.1")
+		os.Exit(exitUsage)
+	}
+
+	// 检查 -monitor 参数是否与其他模式同时使用
+	if monitorFile != "" && (serverMode || ip != "" || ipFile != "" || host != "" || historyIP != "") {
+		fmt.Println("错误: -monitor 参数不能与 -c、-ip、-file、-host 或 -history 参数同时使用")
+		fmt.Println("用法示例:")
+		fmt.Println("  监控模式: pong0 -monitor ips.txt -interval 10m -webhook https://example.com/hook")
+		os.Exit(exitUsage)
+	}
+
+	// 检查 -interval 参数是否在没有 -monitor 或 -c 参数的情况下使用
+	if monitorFile == "" && !serverMode && monitorInterval != config.DefaultMonitorInterval {
+		fmt.Println("错误: -interval 参数只能在监控模式(-monitor)或API服务器模式(-c)下使用")
+		fmt.Println("用法示例:")
+		fmt.Println("  监控模式: pong0 -monitor ips.txt -interval 10m -webhook https://example.com/hook")
+		fmt.Println("  API服务器模式: pong0 -c -interval 1m")
+		os.Exit(exitUsage)
+	}
+
+	// 检查 -webhook 参数是否在监控模式和API服务器模式之外使用
+	if monitorFile == "" && !serverMode && webhook != "" {
+		fmt.Println("错误: -webhook 参数只能在监控模式(-monitor)或API服务器模式(-c)下使用")
+		fmt.Println("用法示例:")
+		fmt.Println("  监控模式: pong0 -monitor ips.txt -interval 10m -webhook https://example.com/hook")
+		fmt.Println("  API服务器模式: pong0 -c -webhook https://example.com/hook")
+		os.Exit(exitUsage)
+	}
+
+	// 检查 -watch 参数是否与其他模式同时使用
+	if watchInterval > 0 && (serverMode || ipFile != "" || host != "" || historyIP != "" || monitorFile != "") {
+		fmt.Println("错误: -watch 参数不能与 -c、-file、-host、-history 或 -monitor 参数同时使用")
+		fmt.Println("用法示例:")
+		fmt.Println("  定时自检模式: pong0 -watch 5m -changes-only -watch-out ip.log")
+		os.Exit(exitUsage)
 	}
 
-	if serverMode {
-		constants.ServerMode = true
+	// 检查 -watch 参数的值以及 -watch-out 和 -changes-only 参数是否在没有 -watch 参数的情况下使用
+	if watchInterval < 0 || (watchInterval == 0 && (watchOutput != "" || changesOnly)) {
+		fmt.Println("错误: -watch 参数必须是正的时间间隔，-watch-out 和 -changes-only 参数只能在定时自检模式(-watch)下使用")
+		fmt.Println("用法示例:")
+		fmt.Println("  定时自检模式: pong0 -watch 5m -changes-only -watch-out ip.log")
+		os.Exit(exitUsage)
 	}
 
-	if manualX1Value != "" {
-		constants.ManualX1Value = manualX1Value
+	// 检查 -watch 参数是否与非JSON输出格式同时使用
+	if watchInterval > 0 && outputFormat != formatJSON {
+		fmt.Println("错误: 定时自检模式(-watch)每次查询输出一行JSON记录，不能与 -o 参数指定的非JSON格式同时使用")
+		os.Exit(exitUsage)
 	}
 
-	if manualDiffValue != "" {
-		constants.ManualDiffValue = manualDiffValue
+	// 检查 -keys-only 参数是否与其他模式同时使用
+	if keysOnly && (serverMode || ip != "" || ipFile != "" || host != "" || historyIP != "" || monitorFile != "" || watchInterval > 0) {
+		fmt.Println("错误: -keys-only 参数不能与 -c、-ip、-file、-host、-history、-monitor 或 -watch 参数同时使用")
+		fmt.Println("用法示例:")
+		fmt.Println("  仅计算密钥模式: pong0 -keys-only")
+		os.Exit(exitUsage)
 	}
 
-	if apiKey != "" {
-		constants.APIKey = apiKey
+	// 检查 -parse-file 参数是否与其他模式同时使用
+	if parseFile != "" && (serverMode || ip != "" || ipFile != "" || host != "" || historyIP != "" || monitorFile != "" || watchInterval > 0 || keysOnly) {
+		fmt.Println("错误: -parse-file 参数不能与 -c、-ip、-file、-host、-history、-monitor、-watch 或 -keys-only 参数同时使用")
+		fmt.Println("用法示例:")
+		fmt.Println("  离线解析模式: pong0 -parse-file page.html")
+		os.Exit(exitUsage)
 	}
 
-	if ip != "" {
-		constants.QueryIP = ip
+	// 检查 -asn-update 参数是否与其他模式同时使用
+	if asnUpdate && (serverMode || ip != "" || ipFile != "" || host != "" || historyIP != "" || monitorFile != "" || watchInterval > 0 || keysOnly || parseFile != "") {
+		fmt.Println("错误: -asn-update 参数不能与 -c、-ip、-file、-host、-history、-monitor、-watch、-keys-only 或 -parse-file 参数同时使用")
+		fmt.Println("用法示例:")
+		fmt.Println("  更新ASN数据: pong0 -asn-db asn.txt -asn-update")
+		os.Exit(exitUsage)
+	}
+
+	// 检查 -max-risk 参数，只在查询、批量查询和主机名查询模式下使用
+	if maxRisk != -1 && (maxRisk < 0 || maxRisk > 100) {
+		fmt.Println("错误: -max-risk 参数必须在0到100之间")
+		os.Exit(exitUsage)
+	}
+	if maxRisk >= 0 && (serverMode || historyIP != "" || monitorFile != "" || watchInterval > 0 || keysOnly || parseFile != "" || asnUpdate) {
+		fmt.Println("错误: -max-risk 参数只能在查询模式、批量查询模式(-file)或主机名查询模式(-host)下使用")
+		fmt.Println("用法示例:")
+		fmt.Println("  pong0 -ip 1.1.1.1 -max-risk 50 || echo \"IP信誉不合格\"")
+		os.Exit(exitUsage)
+	}
+
+	// 检查 -tag 参数，API服务器的每个请求通过tag查询参数指定自己的标签
+	if queryTag != "" && (serverMode || historyIP != "" || monitorFile != "" || keysOnly || parseFile != "" || asnUpdate) {
+		fmt.Println("错误: -tag 参数只能在查询模式、批量查询模式(-file)、主机名查询模式(-host)或定时查询模式(-watch)下使用")
+		fmt.Println("用法示例:")
+		fmt.Println("  pong0 -file proxies.txt -db history.db -tag proxy-batch-2024-06")
+		os.Exit(exitUsage)
+	}
+	if err := store.CheckTag(queryTag); err != nil {
+		fmt.Printf("错误: -tag 参数无效: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	// 检查输出格式是否受支持
+	if err := validateOutputFormat(outputFormat); err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	// 检查 -no-header 参数是否与CSV输出格式一起使用
+	if noHeader && outputFormat != formatCSV {
+		fmt.Println("错误: -no-header 参数只能与 -o csv 一起使用")
+		fmt.Println("用法示例:")
+		fmt.Println("  pong0 -file ips.txt -o csv -fields ip,risk_value,ip_type -no-header >> results.csv")
+		os.Exit(exitUsage)
+	}
+
+	// 检查 -q 和 -fields 参数，两者只影响命令行输出
+	if quiet && verbose {
+		fmt.Println("错误: -q 参数不能与 -all 参数同时使用")
+		os.Exit(exitUsage)
+	}
+	if (quiet || outputFields != "") && serverMode {
+		fmt.Println("错误: -q 和 -fields 参数不能在服务器模式(-c)下使用")
+		os.Exit(exitUsage)
+	}
+
+	// 检查磁盘缓存参数，服务器模式使用内存缓存，通过nocache查询参数跳过
+	if (cacheDir != "" || noCache) && serverMode {
+		fmt.Println("错误: -cache-dir 和 -no-cache 参数不能在服务器模式(-c)下使用，API调用方可以使用nocache查询参数")
+		os.Exit(exitUsage)
+	}
+	if err := parseOutputFields(outputFields); err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	// 检查 -ndjson 参数是否与非JSON输出格式同时使用
+	if ndjson && outputFormat != formatJSON {
+		fmt.Println("错误: -ndjson 参数不能与 -o 参数指定的非JSON格式同时使用")
+		os.Exit(exitUsage)
+	}
+
+	// 检查 -ndjson 参数是否在没有 -file 或 -host 参数的情况下使用
+	if ndjson && ipFile == "" && host == "" {
+		fmt.Println("错误: -ndjson 参数只能在批量查询模式(-file)或主机名查询模式(-host)下使用")
+		fmt.Println("用法示例:")
+		fmt.Println("  批量查询模式: pong0 -file ips.txt -ndjson")
+		os.Exit(exitUsage)
+	}
+
+	// 检查 -workers 和 -delay 参数，只在批量查询或主机名查询模式下使用
+	if queryWorkers < 1 || queryWorkers > maxQueryWorkers {
+		fmt.Printf("错误: -workers 参数必须在1到%d之间\n", maxQueryWorkers)
+		os.Exit(exitUsage)
+	}
+	if queryDelay < 0 {
+		fmt.Println("错误: -delay 参数不能为负数")
+		os.Exit(exitUsage)
+	}
+	if (queryWorkers != 1 || queryDelay > 0) && ipFile == "" && host == "" {
+		fmt.Println("错误: -workers 和 -delay 参数只能在批量查询模式(-file)或主机名查询模式(-host)下使用")
+		fmt.Println("用法示例:")
+		fmt.Println("  批量查询模式: pong0 -file ips.txt -workers 4 -delay 500ms")
+		os.Exit(exitUsage)
+	}
+
+	// 检查 -sink 参数是否在批量查询、主机名查询或定时自检模式下使用
+	if sinkSpec != "" && ipFile == "" && host == "" && watchInterval == 0 {
+		fmt.Println("错误: -sink 参数只能在批量查询模式(-file)、主机名查询模式(-host)或定时自检模式(-watch)下使用")
+		fmt.Println("用法示例:")
+		fmt.Println("  批量查询模式: pong0 -file ips.txt -sink results.ndjson")
+		fmt.Println("  定时自检模式: pong0 -watch 5m -sink \"file:///var/log/pong0/ip.ndjson?daily=true\"")
+		os.Exit(exitUsage)
+	}
+
+	// 检查 -sink 参数是否与 -watch-out 或非JSON输出格式同时使用
+	if sinkSpec != "" && (watchOutput != "" || outputFormat != formatJSON) {
+		fmt.Println("错误: -sink 参数总是写入NDJSON记录，不能与 -watch-out 或 -o 参数指定的非JSON格式同时使用")
+		os.Exit(exitUsage)
 	}
 }
 
-// runServerMode 在服务器模式下运行程序
-func runServerMode() {
-	// 设置服务器模式
-	constants.ServerMode = true
+// openSink 打开-sink（或-watch-out）指定的输出目标，失败时以exitUsage退出
+func openSink(spec string) sink.Sink {
+	out, err := sink.Open(spec)
+	if err != nil {
+		fmt.Printf("错误: 打开输出目标失败: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	return out
+}
+
+// buildConfig 根据配置文件、环境变量和命令行参数构建运行配置
+// 优先级从低到高依次为：默认值、配置文件、环境变量、命令行参数，
+// 只有显式指定的命令行参数才会覆盖前面的配置。
+func buildConfig() *config.Config {
+	path := configPath
+	if path == "" {
+		path = os.Getenv("PONG0_CONFIG")
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		fmt.Printf("错误: 加载配置失败: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	cfg.Stats = core.NewStats()
+	cfg.ServerMode = serverMode
+	cfg.ManualX1Value = manualX1Value
+	cfg.ManualDiffValue = manualDiffValue
+
+	// 覆盖显式指定的命令行参数
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "all":
+			cfg.Verbose = verbose
+		case "p":
+			cfg.APIPort = port
+		case "k":
+			cfg.APIKey = apiKey
+		case "keys":
+			cfg.APIKeysFile = apiKeysFile
+		case "admin-key":
+			cfg.AdminKey = adminKey
+		case "signing-key":
+			cfg.SigningKey = signingKey
+		case "tls-cert":
+			cfg.TLSCert = tlsCert
+		case "tls-key":
+			cfg.TLSKey = tlsKey
+		case "client-ca":
+			cfg.ClientCA = clientCA
+		case "rate":
+			cfg.RateLimit = rateLimit
+		case "rate-global":
+			cfg.GlobalRateLimit = globalRateLimit
+		case "rate-redis":
+			cfg.RateRedis = rateRedis
+		case "trusted-proxies":
+			cfg.TrustedProxies = trustedProxies
+		case "concurrency":
+			cfg.Concurrency = concurrency
+		case "queue":
+			cfg.QueueDepth = queueDepth
+		case "session-pool":
+			cfg.SessionPoolSize = sessionPool
+		case "session-pool-refresh":
+			cfg.SessionPoolRefresh = poolRefresh
+		case "proxy":
+			cfg.Proxy = proxy
+		case "base-url":
+			cfg.BaseURL = baseURL
+		case "mirrors":
+			cfg.Mirrors = mirrors
+		case "ua":
+			cfg.UserAgent = userAgent
+		case "profile":
+			cfg.HeaderProfile = headerProfile
+		case "jitter":
+			cfg.HeaderJitter = headerJitter
+		case "max-idle-conns":
+			cfg.MaxIdleConns = maxIdleConns
+		case "idle-conn-timeout":
+			cfg.IdleConnTimeout = idleConnTimeout
+		case "tls-handshake-timeout":
+			cfg.TLSHandshakeTimeout = tlsTimeout
+		case "http-version":
+			cfg.HTTPVersion = httpVersion
+		case "disable-keepalives":
+			cfg.DisableKeepAlives = noKeepAlives
+		case "pow-max":
+			cfg.PowMaxIterations = powMax
+		case "algo":
+			cfg.KeyAlgorithm = keyAlgorithm
+		case "algo-fallback":
+			cfg.AlgorithmFallback = algoFallback
+		case "selectors":
+			cfg.SelectorsFile = selectorsFile
+		case "parse-mode":
+			cfg.ParseMode = parseMode
+		case "timeout":
+			cfg.Timeout = timeout
+		case "connect-timeout":
+			cfg.ConnectTimeout = connectTimeout
+		case "read-timeout":
+			cfg.ReadTimeout = readTimeout
+		case "shutdown-timeout":
+			cfg.ShutdownTimeout = shutdownTimeout
+		case "max-query-timeout":
+			cfg.MaxQueryTimeout = maxQueryTimeout
+		case "cache-ttl":
+			cfg.CacheTTL = cacheTTL
+		case "cache-soft-ttl":
+			cfg.CacheSoftTTL = cacheSoftTTL
+		case "job-retention":
+			cfg.JobRetention = jobRetention
+		case "cache-dir":
+			cfg.CacheDir = cacheDir
+		case "docs":
+			cfg.Docs = docs
+		case "access-log":
+			cfg.AccessLog = accessLogPath
+		case "access-log-format":
+			cfg.AccessLogFormat = accessLogFormat
+		case "audit-log":
+			cfg.AuditLog = auditLog
+		case "audit-retention":
+			cfg.AuditRetention = auditRetention
+		case "history-retention":
+			cfg.HistoryRetention = historyRetain
+		case "session-file":
+			cfg.SessionFile = sessionFile
+		case "session-redis":
+			cfg.SessionRedis = sessionRedis
+		case "js-path-file":
+			cfg.JSPathFile = jsPathFile
+		case "known-script-hashes":
+			cfg.KnownScriptHashes = knownScripts
+		case "cookie-file":
+			cfg.CookieFile = cookieFile
+		case "dump-dir":
+			cfg.DumpDir = dumpDir
+		case "otlp-endpoint":
+			cfg.OTLPEndpoint = otlpEndpoint
+		case "otlp-headers":
+			cfg.OTLPHeaders = otlpHeaders
+		case "asn-db":
+			cfg.ASNDB = asnDB
+		case "maxmind":
+			cfg.MaxMindDB = maxmindDB
+		case "ipapi":
+			cfg.IPAPI = useIPAPI
+		case "ripestat":
+			cfg.RIPEstat = useRIPEstat
+		case "fallback":
+			cfg.Fallback = useFallback
+		case "resolver":
+			cfg.Resolver = dnsServer
+		case "rdns":
+			cfg.RDNS = rdns
+		case "db":
+			cfg.HistoryDB = historyDB
+		case "interval":
+			cfg.MonitorInterval = monitorInterval
+		case "webhook":
+			cfg.Webhook = webhook
+		case "log-level":
+			cfg.LogLevel = logLevel
+		case "log-format":
+			cfg.LogFormat = logFormat
+		case "lang":
+			cfg.Lang = lang
+		case "no-branding":
+			cfg.NoBranding = noBranding
+		}
+	})
+
+	// 检查访问日志格式是否受支持
+	if cfg.AccessLogFormat != server.AccessLogCombined && cfg.AccessLogFormat != server.AccessLogJSON {
+		fmt.Printf("错误: 不支持的访问日志格式: %s（可选 combined、json）\n", cfg.AccessLogFormat)
+		os.Exit(exitUsage)
+	}
+
+	// 检查输出语言是否受支持
+	if err := i18n.Validate(cfg.Lang); err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	// 检查浏览器请求头配置是否存在
+	if _, ok := client.HeaderProfiles[cfg.HeaderProfile]; cfg.HeaderProfile != "" && !ok {
+		fmt.Printf("错误: 未知的请求头配置: %s（可选 %s）\n", cfg.HeaderProfile, strings.Join(client.ProfileNames(), "、"))
+		os.Exit(exitUsage)
+	}
+
+	// 检查结果缓存的后台刷新时间，不小于最长缓存时间时后台刷新永远不会发生
+	if cfg.CacheSoftTTL > 0 && cfg.CacheSoftTTL >= cfg.CacheTTL {
+		fmt.Println("错误: -cache-soft-ttl 必须小于 -cache-ttl")
+		os.Exit(exitUsage)
+	}
+
+	// 检查可信代理列表
+	if _, err := server.ParseTrustedProxies(cfg.TrustedProxies); err != nil {
+		fmt.Printf("错误: -trusted-proxies 参数无效: %v\n", err)
+		fmt.Println("用法示例:")
+		fmt.Println("  pong0 -c -trusted-proxies 10.0.0.0/8,127.0.0.1")
+		os.Exit(exitUsage)
+	}
+
+	// 检查保留时间参数
+	if cfg.HistoryRetention < 0 || cfg.AuditRetention < 0 {
+		fmt.Println("错误: -history-retention 和 -audit-retention 不能小于0")
+		os.Exit(exitUsage)
+	}
+
+	// 检查会话池参数
+	if cfg.SessionPoolSize < 0 || cfg.SessionPoolSize > client.MaxSessionPoolSize {
+		fmt.Printf("错误: -session-pool 参数必须在0到%d之间\n", client.MaxSessionPoolSize)
+		os.Exit(exitUsage)
+	}
+	if cfg.SessionPoolSize > 0 && cfg.SessionPoolRefresh < client.MinSessionPoolRefresh {
+		fmt.Printf("错误: -session-pool-refresh 不能小于 %s\n", client.MinSessionPoolRefresh)
+		os.Exit(exitUsage)
+	}
+
+	// 检查密钥生成算法是否存在
+	if _, err := parser.SelectAlgorithm(cfg.KeyAlgorithm, ""); err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	// 检查解析模式是否受支持
+	if cfg.ParseMode != "" && cfg.ParseMode != config.ParseModeLenient && cfg.ParseMode != config.ParseModeStrict {
+		fmt.Printf("错误: 不支持的解析模式: %s（可选 lenient、strict）\n", cfg.ParseMode)
+		os.Exit(exitUsage)
+	}
+
+	// 加载自定义的CSS选择器，未出现的项使用内置的定义
+	if cfg.SelectorsFile != "" {
+		sel, err := parser.LoadSelectors(cfg.SelectorsFile)
+		if err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(exitUsage)
+		}
+		parser.SetSelectors(sel)
+	}
+
+	// 创建结构化日志记录器，日志输出到标准错误，避免与查询结果混在一起
+	level := cfg.LogLevel
+	if level == "" && cfg.Verbose {
+		level = "debug"
+	}
+	if level == "" && quiet {
+		level = "error"
+	}
+	log, err := logger.New(os.Stderr, level, cfg.LogFormat)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	cfg.Logger = log
+
+	// 服务器模式下限制同时发往Ping0.cc的查询数量
+	if cfg.ServerMode && cfg.Concurrency > 0 {
+		cfg.Queue = core.NewQueue(cfg.Concurrency, cfg.QueueDepth)
+	}
+
+	// 服务器模式下加载多个API密钥
+	if cfg.ServerMode && cfg.APIKeysFile != "" {
+		keys, err := auth.Load(cfg.APIKeysFile)
+		if err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(exitUsage)
+		}
+		cfg.APIKeys = keys
+	}
+
+	// 服务器模式下在Redis中保存限流计数，多个副本共同遵守同一份配额
+	if cfg.ServerMode && cfg.RateRedis != "" {
+		if cfg.RateLimit <= 0 && cfg.GlobalRateLimit <= 0 {
+			fmt.Println("错误: -rate-redis 需要同时使用 -rate 或 -rate-global")
+			fmt.Println("用法示例:")
+			fmt.Println("  pong0 -c -rate-global 60 -rate-redis redis://10.0.0.5:6379/0")
+			os.Exit(exitUsage)
+		}
+		opts, err := redis.ParseURL(cfg.RateRedis)
+		if err != nil {
+			fmt.Printf("错误: 无效的Redis地址: %v\n", err)
+			os.Exit(exitUsage)
+		}
+		rdb := redis.NewClient(opts)
+		if err := rdb.Ping(context.Background()).Err(); err != nil {
+			rdb.Close()
+			fmt.Printf("错误: 连接Redis失败: %v\n", err)
+			os.Exit(exitUsage)
+		}
+		cfg.RateStore = rdb
+	}
 
-	// 设置API服务器端口
-	if port != "" {
-		constants.APIPort = port
+	// 服务器中的panic除记录日志外，配置了DSN时同时上报Sentry
+	if cfg.ServerMode && cfg.SentryDSN != "" {
+		err := sentry.Init(sentry.ClientOptions{
+			Dsn:              cfg.SentryDSN,
+			Release:          "pong0@" + constants.Version,
+			AttachStacktrace: true,
+		})
+		if err != nil {
+			fmt.Printf("错误: 无效的Sentry DSN: %v\n", err)
+			os.Exit(exitUsage)
+		}
+		cfg.Sentry = sentry.CurrentHub()
 	}
 
-	if constants.Verbose {
-		fmt.Printf("启动API服务器，监听端口 %s...\n", constants.APIPort)
+	// 命令行查询启用缓存时使用磁盘缓存，连续多次运行之间共享结果
+	if cfg.CacheTTL > 0 && !cfg.ServerMode {
+		dir := cfg.CacheDir
+		if dir == "" {
+			var err error
+			if dir, err = diskcache.DefaultDir(); err != nil {
+				fmt.Printf("错误: 无法确定缓存目录，请通过 -cache-dir 指定: %v\n", err)
+				os.Exit(exitUsage)
+			}
+		}
+		resultCache = diskcache.New(dir, cfg.CacheTTL)
+	}
+
+	// 加载ASN注册数据，更新数据时文件可能还不存在
+	if cfg.ASNDB != "" && !asnUpdate {
+		registry, err := asn.Load(cfg.ASNDB)
+		if err != nil {
+			fmt.Printf("错误: %v\n", err)
+			fmt.Println("可以使用 -asn-update 参数下载ASN注册数据")
+			os.Exit(exitUsage)
+		}
+		cfg.ASNRegistry = registry
+	}
+
+	// 创建附加数据源，顺序即补充缺失字段时的优先级
+	if cfg.MaxMindDB != "" {
+		mm, err := providers.OpenMaxMind(strings.Split(cfg.MaxMindDB, ",")...)
+		if err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(exitUsage)
+		}
+		cfg.Providers = append(cfg.Providers, mm)
+		if cfg.Fallback {
+			cfg.FallbackProvider = mm
+		}
+	} else if cfg.Fallback {
+		fmt.Println("错误: -fallback 需要通过 -maxmind 参数或配置文件指定MaxMind数据库")
+		fmt.Println("用法示例:")
+		fmt.Println("  降级查询: pong0 -ip 1.1.1.1 -maxmind GeoLite2-City.mmdb -fallback")
+		os.Exit(exitUsage)
+	}
+	if cfg.IPAPI || cfg.RIPEstat {
+		httpClient := &http.Client{Timeout: cfg.RequestTimeout()}
+		if cfg.IPAPI {
+			cfg.Providers = append(cfg.Providers, providers.NewIPAPI(httpClient, cfg.UserAgent))
+		}
+		if cfg.RIPEstat {
+			cfg.Providers = append(cfg.Providers, providers.NewRIPEstat(httpClient, cfg.UserAgent))
+		}
+	}
+
+	// 打开审计日志，只有API服务器记录审计日志
+	if cfg.ServerMode && cfg.AuditLog != "" {
+		auditLog, err := audit.Open(cfg.AuditLog)
+		if err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(exitFailure)
+		}
+		cfg.Audit = auditLog
+	}
+
+	// 打开历史记录数据库
+	if queryTag != "" && cfg.HistoryDB == "" {
+		fmt.Println("错误: -tag 参数需要通过 -db 参数或配置文件指定历史记录数据库")
+		os.Exit(exitUsage)
+	}
+	if cfg.HistoryDB != "" {
+		history, err := store.Open(cfg.HistoryDB)
+		if err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(exitFailure)
+		}
+		cfg.History = history
+	}
+
+	// 启用分布式追踪，查询结束后由各模式负责导出剩余的区间
+	if cfg.OTLPEndpoint != "" {
+		headers, err := tracing.ParseHeaders(cfg.OTLPHeaders)
+		if err != nil {
+			fmt.Printf("错误: -otlp-headers %v\n", err)
+			os.Exit(exitUsage)
+		}
+		provider, err := tracing.New(cfg.OTLPEndpoint, headers, "pong0", constants.Version)
+		if err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(exitUsage)
+		}
+		cfg.TracerProvider = provider
+		// 导出失败由otel报告给全局的错误处理器，记录到日志而不是直接写到标准错误
+		log := cfg.Log("tracing")
+		otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+			log.Warn("导出追踪区间失败", "error", err)
+		}))
+	}
+
+	// 配置了镜像站点时，按站点的可用状态选择查询使用的基础URL
+	if cfg.Mirrors != "" {
+		pool, err := client.NewMirrorPool(cfg)
+		if err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(exitUsage)
+		}
+		cfg.Upstreams = pool
+	}
+
+	// 所有查询共享同一个传输层，复用与Ping0.cc之间的连接
+	transport, err := client.NewTransport(cfg)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	cfg.Transport = transport
+
+	// 在多次查询之间复用已被接受的访问密钥，服务器模式下启用会话池时预先准备多组密钥，
+	// 配置了Redis时多个副本共享同一组密钥
+	switch {
+	case cfg.SessionRedis != "":
+		if cfg.ServerMode && cfg.SessionPoolSize > 0 {
+			fmt.Println("错误: -session-redis 不能与 -session-pool 同时使用，会话池中的密钥只保存在各副本的内存中")
+			os.Exit(exitUsage)
+		}
+		store, err := client.NewRedisSessionStore(cfg)
+		if err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(exitUsage)
+		}
+		cfg.Sessions = store
+	case cfg.ServerMode && cfg.SessionPoolSize > 0:
+		cfg.Sessions = client.NewSessionPool(cfg)
+	default:
+		cfg.Sessions = client.NewSessionManager(cfg)
+	}
+
+	return cfg
+}
+
+// runServerMode 在服务器模式下运行程序
+func runServerMode(cfg *config.Config) {
+	if cfg.Verbose {
+		fmt.Printf("启动API服务器，监听端口 %s...\n", cfg.APIPort)
 	}
 
 	// 启动服务器并处理错误
-	if err := server.StartServer(); err != nil {
+	if err := server.StartServer(cfg); err != nil {
 		fmt.Printf("启动服务器失败: %v\n", err)
 		os.Exit(1)
 	}
+
+	releaseServer(cfg)
+}
+
+// flushTraces 导出尚未发送的追踪区间，最多等待5秒
+// 程序退出前必须调用，否则最后一批区间会随进程一起丢失。
+func flushTraces(cfg *config.Config) {
+	if cfg.TracerProvider == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := cfg.TracerProvider.Shutdown(ctx); err != nil {
+		cfg.Log("tracing").Warn("导出剩余的追踪区间超时", "error", err)
+	}
 }
 
 // runQueryMode 在查询模式下运行程序
-func runQueryMode() {
+func runQueryMode(cfg *config.Config) {
 	// 输出详细信息头
-	if constants.Verbose {
+	if cfg.Verbose {
 		fmt.Println("-------------------------------------")
 		fmt.Println("Pong0 Pong0 Pong0")
 		fmt.Println("-------------------------------------")
-		if constants.QueryIP != "" {
-			fmt.Printf("查询IP: %s\n", constants.QueryIP)
+		if ip != "" {
+			fmt.Printf("查询IP: %s\n", ip)
 		} else {
 			fmt.Println("查询当前IP")
 		}
 	}
 
 	// 执行查询，获取IP信息
-	ipInfo, err := core.ProcessIPInfo(constants.QueryIP)
+	ipInfo, err := lookupIP(context.Background(), cfg, ip)
+	flushTraces(cfg)
+	if cfg.Verbose {
+		printStageStats(cfg)
+	}
 	if err != nil {
-		if constants.Verbose {
+		if cfg.Verbose {
 			fmt.Printf("获取IP信息失败: %v\n", err)
+		} else if quiet {
+			fmt.Fprintf(os.Stderr, "获取IP信息失败: %v\n", err)
 		} else {
-			// 输出带Princess字段的错误信息JSON
-			errorJSON := map[string]string{
-				"error":    err.Error(),
-				"princess": "https://linux.do/u/amna",
-			}
-			jsonData, _ := json.MarshalIndent(errorJSON, "", "  ")
-			fmt.Println(string(jsonData))
+			// 按指定格式输出带Princess字段的错误信息
+			errorResult := models.WithPrincess(map[string]string{
+				"error": err.Error(),
+			}, cfg.Branding())
+			writeOutput(os.Stdout, outputFormat, []interface{}{errorResult}, true)
 		}
-		os.Exit(1)
+		os.Exit(exitCodeFor(err))
 	}
 
 	// 输出结果
-	if constants.Verbose {
+	if cfg.Verbose {
+		printParseWarnings(ipInfo)
 		fmt.Println("-------------------------------------")
 	}
 
-	// 确保IPInfo中有Princess字段
-	if ipInfo.Princess == "" {
-		ipInfo.Princess = "https://linux.do/u/amna"
+	// 按配置设置Princess字段
+	ipInfo.Princess = models.Princess(cfg.Branding())
+
+	// 按指定格式输出结果
+	if err := writeOutput(os.Stdout, outputFormat, []interface{}{ipInfo}, true); err != nil {
+		fmt.Printf("输出结果失败: %v\n", err)
+		os.Exit(1)
 	}
 
-	// 输出JSON结果
-	jsonData, _ := json.MarshalIndent(ipInfo, "", "  ")
-	fmt.Println(string(jsonData))
+	if riskExceeded(ipInfo) {
+		os.Exit(exitRisky)
+	}
 }
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"ping0/internal/config"
+	"ping0/internal/monitor"
+)
+
+// runMonitorMode 在监控模式下运行程序
+// 按配置的间隔定期查询列表中的IP，风控值、IP类型或原生IP变化时每行输出一个JSON事件，
+// 并POST到配置的Webhook地址，收到SIGINT或SIGTERM信号后退出
+func runMonitorMode(cfg *config.Config) {
+	ips, err := readIPList(monitorFile)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(exitFailure)
+	}
+	if len(ips) == 0 {
+		fmt.Println("错误: 监控列表中没有IP")
+		os.Exit(exitUsage)
+	}
+
+	if cfg.Verbose {
+		fmt.Println("-------------------------------------")
+		fmt.Println("Pong0 Pong0 Pong0")
+		fmt.Println("-------------------------------------")
+		fmt.Printf("监控 %d 个IP，间隔 %s\n", len(ips), cfg.MonitorInterval)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	monitor.New(cfg, ips).Run(ctx, func(event monitor.Event) {
+		jsonData, _ := json.Marshal(event)
+		fmt.Println(string(jsonData))
+	})
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+
+	"ping0/internal/output"
+)
+
+// 支持的输出格式
+const (
+	formatJSON  = "json"  // 格式化的JSON（默认）
+	formatYAML  = "yaml"  // YAML文档
+	formatCSV   = "csv"   // 带表头的CSV，适合脚本处理
+	formatTable = "table" // 对齐的终端表格，适合人工阅读
+)
+
+// validateOutputFormat 检查输出格式是否受支持
+func validateOutputFormat(format string) error {
+	switch format {
+	case formatJSON, formatYAML, formatCSV, formatTable:
+		return nil
+	default:
+		return fmt.Errorf("不支持的输出格式: %s（可选 json、yaml、csv、table）", format)
+	}
+}
+
+// writeOutput 按指定格式输出查询结果
+// 单条结果（如单IP查询）和多条结果（如批量查询）的输出形式不同：
+// JSON和YAML分别输出对象和数组；CSV都输出表头加数据行；
+// 表格在单条结果时纵向显示字段和值，多条结果时横向显示。
+//
+// 参数:
+//   - w: 输出目标
+//   - format: 输出格式
+//   - values: 要输出的结果列表
+//   - single: 是否按单条结果输出
+//
+// 返回:
+//   - error: 如果序列化失败则返回相应错误
+func writeOutput(w io.Writer, format string, values []interface{}, single bool) error {
+	if quiet || len(selectedFields) > 0 {
+		shaped := make([]interface{}, 0, len(values))
+		for _, v := range values {
+			rec, err := shapeResult(v)
+			if err != nil {
+				return err
+			}
+			shaped = append(shaped, rec)
+		}
+		values = shaped
+	}
+
+	if format == formatJSON {
+		var v interface{} = values
+		if single && len(values) == 1 {
+			v = values[0]
+		}
+		var data []byte
+		var err error
+		if quiet {
+			data, err = json.Marshal(v)
+		} else {
+			data, err = json.MarshalIndent(v, "", "  ")
+		}
+		if err != nil {
+			return fmt.Errorf("转换为JSON失败: %w", err)
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	}
+
+	records := make([]output.Record, 0, len(values))
+	for _, v := range values {
+		rec, err := output.ToRecord(v)
+		if err != nil {
+			return err
+		}
+		records = append(records, rec)
+	}
+
+	switch format {
+	case formatYAML:
+		return writeYAML(w, records, single)
+	case formatCSV:
+		return output.WriteCSV(w, values, output.CSVOptions{NoHeader: noHeader})
+	case formatTable:
+		if single && len(records) == 1 {
+			return writeVerticalTable(w, records[0])
+		}
+		return writeTable(w, records)
+	default:
+		return validateOutputFormat(format)
+	}
+}
+
+// selectedFields -fields参数指定的字段，为空时输出全部字段
+var selectedFields []string
+
+// parseOutputFields 解析-fields参数，字段名以逗号分隔，忽略空白和空字段
+func parseOutputFields(value string) error {
+	selectedFields = nil
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	selectedFields = output.ParseColumns(value)
+	if len(selectedFields) == 0 {
+		return fmt.Errorf("-fields 参数没有指定任何字段: %q", value)
+	}
+	return nil
+}
+
+// shapeResult 按-q和-fields参数裁剪一条结果
+// 指定了字段时按参数中的顺序只保留这些字段，结果中不存在的字段跳过；失败结果的error字段总是保留，
+// 以免批量查询中失败的记录变成只有IP的空记录。只使用-q时保留princess之外的全部字段。
+func shapeResult(v interface{}) (output.Record, error) {
+	rec, err := output.ToRecord(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(selectedFields) == 0 {
+		shaped := make(output.Record, 0, len(rec))
+		for _, f := range rec {
+			if f.Key != "princess" {
+				shaped = append(shaped, f)
+			}
+		}
+		return shaped, nil
+	}
+
+	shaped := make(output.Record, 0, len(selectedFields)+1)
+	for _, name := range selectedFields {
+		if value, ok := rec.Lookup(name); ok {
+			shaped = append(shaped, output.Field{Key: name, Value: value})
+		}
+	}
+	if value, ok := rec.Lookup("error"); ok {
+		if _, selected := shaped.Lookup("error"); !selected {
+			shaped = append(shaped, output.Field{Key: "error", Value: value})
+		}
+	}
+	return shaped, nil
+}
+
+// writeYAML 以YAML格式输出记录
+func writeYAML(w io.Writer, records []output.Record, single bool) error {
+	var node *yaml.Node
+	if single && len(records) == 1 {
+		node = toYAMLNode(records[0])
+	} else {
+		node = &yaml.Node{Kind: yaml.SequenceNode}
+		for _, rec := range records {
+			node.Content = append(node.Content, toYAMLNode(rec))
+		}
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return fmt.Errorf("转换为YAML失败: %w", err)
+	}
+	return enc.Close()
+}
+
+// toYAMLNode 将解码后的值转换为YAML节点，保持字段顺序
+func toYAMLNode(v interface{}) *yaml.Node {
+	switch t := v.(type) {
+	case output.Record:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for _, f := range t {
+			node.Content = append(node.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: f.Key},
+				toYAMLNode(f.Value))
+		}
+		return node
+	case []interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, item := range t {
+			node.Content = append(node.Content, toYAMLNode(item))
+		}
+		return node
+	case nil:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(t.String(), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: t.String()}
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: output.CellString(t)}
+	default:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: output.CellString(t)}
+	}
+}
+
+// writeVerticalTable 以“字段 值”两列的形式输出单条记录
+func writeVerticalTable(w io.Writer, rec output.Record) error {
+	rows := make([][]string, 0, len(rec))
+	for _, f := range rec {
+		rows = append(rows, []string{f.Key, output.CellString(f.Value)})
+	}
+	return writeAligned(w, nil, rows)
+}
+
+// writeTable 以表头加数据行的形式输出多条记录
+func writeTable(w io.Writer, records []output.Record) error {
+	cols := output.Columns(records)
+	rows := make([][]string, 0, len(records))
+	for _, rec := range records {
+		row := make([]string, len(cols))
+		for i, col := range cols {
+			if v, ok := rec.Lookup(col); ok {
+				row[i] = output.CellString(v)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return writeAligned(w, cols, rows)
+}
+
+// writeAligned 按终端显示宽度对齐输出表格
+// 中文等全角字符占两个显示宽度，text/tabwriter按字符数对齐会错位，因此单独计算宽度。
+func writeAligned(w io.Writer, header []string, rows [][]string) error {
+	all := rows
+	if header != nil {
+		all = append([][]string{header}, rows...)
+	}
+
+	var widths []int
+	for _, row := range all {
+		for i, cell := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if cw := displayWidth(cell); cw > widths[i] {
+				widths[i] = cw
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	writeRow := func(row []string) {
+		var line strings.Builder
+		for i, cell := range row {
+			line.WriteString(cell)
+			if i < len(row)-1 {
+				line.WriteString(strings.Repeat(" ", widths[i]-displayWidth(cell)+2))
+			}
+		}
+		buf.WriteString(strings.TrimRight(line.String(), " "))
+		buf.WriteByte('\n')
+	}
+
+	if header != nil {
+		writeRow(header)
+		sep := make([]string, len(header))
+		for i := range header {
+			sep[i] = strings.Repeat("-", widths[i])
+		}
+		writeRow(sep)
+	}
+	for _, row := range rows {
+		writeRow(row)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// displayWidth 返回字符串在终端中的显示宽度，东亚全角字符按两个宽度计算
+func displayWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		if isWide(r) {
+			width += 2
+		} else {
+			width++
+		}
+	}
+	return width
+}
+
+// isWide 判断字符是否为全角字符
+func isWide(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hangul, unicode.Hiragana, unicode.Katakana) ||
+		(r >= 0x3000 && r <= 0x303F) || // CJK标点
+		(r >= 0xFF00 && r <= 0xFF60) || // 全角ASCII
+		(r >= 0xFFE0 && r <= 0xFFE6)
+}
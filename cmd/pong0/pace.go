@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	perrors "ping0/internal/errors"
+)
+
+const (
+	// maxQueryWorkers 批量查询允许的最大并发数，避免短时间内向Ping0.cc发出过多请求
+	maxQueryWorkers = 32
+	// minBackoffDelay 遇到限流或验证失败后请求间隔的最小值
+	minBackoffDelay = time.Second
+	// maxBackoffDelay 自适应退避时请求间隔的上限
+	maxBackoffDelay = time.Minute
+)
+
+// pacer 控制批量查询中相邻两次查询的开始间隔
+// 所有工作协程共享同一个pacer，间隔默认为-delay指定的值。遇到Ping0.cc限流（429）或验证失败时
+// 间隔加倍（至少minBackoffDelay，最多maxBackoffDelay），之后每次查询成功都将间隔减半，直到恢复为-delay指定的值。
+type pacer struct {
+	base time.Duration
+	log  *slog.Logger
+
+	mu       sync.Mutex
+	interval time.Duration // 当前的查询间隔
+	next     time.Time     // 下一次查询最早的开始时间
+}
+
+// newPacer 创建查询间隔控制器
+//
+// 参数:
+//   - delay: 相邻两次查询的最小间隔，为0时只在遇到限流后才等待
+//   - log: 间隔变化时输出日志
+//
+// 返回:
+//   - *pacer: 查询间隔控制器
+func newPacer(delay time.Duration, log *slog.Logger) *pacer {
+	return &pacer{base: delay, log: log, interval: delay}
+}
+
+// wait 等待到轮到下一次查询，并为其后的查询预留当前间隔
+func (p *pacer) wait() {
+	p.mu.Lock()
+	now := time.Now()
+	at := p.next
+	if at.Before(now) {
+		at = now
+	}
+	p.next = at.Add(p.interval)
+	p.mu.Unlock()
+
+	time.Sleep(time.Until(at))
+}
+
+// observe 根据查询结果调整查询间隔
+//
+// 参数:
+//   - err: 查询返回的错误，限流和验证失败时增大间隔，成功时逐步恢复
+func (p *pacer) observe(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err != nil {
+		if !errors.Is(err, perrors.ErrRateLimited) && !errors.Is(err, perrors.ErrChallengeFailed) {
+			return
+		}
+		interval := min(max(p.interval*2, minBackoffDelay), maxBackoffDelay)
+		if interval != p.interval {
+			p.log.Warn("上游限流或验证失败，增大查询间隔", "interval", interval, "error", err)
+		}
+		p.interval = interval
+		// 已预留的查询也推迟，让上游有时间恢复
+		if next := time.Now().Add(interval); next.After(p.next) {
+			p.next = next
+		}
+		return
+	}
+
+	if p.interval > p.base {
+		interval := p.interval / 2
+		if interval < minBackoffDelay || interval < p.base {
+			interval = p.base
+		}
+		p.interval = interval
+		p.log.Info("查询成功，减小查询间隔", "interval", interval)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"ping0/internal/config"
+	"ping0/internal/models"
+	"ping0/internal/parser"
+)
+
+// runParseFileMode 在离线解析模式下运行程序
+// 解析保存在磁盘上的HTML页面并按-o指定的格式输出结果，不进行任何网络请求
+func runParseFileMode(cfg *config.Config) {
+	ipInfo, err := parser.ParseFile(cfg, parseFile)
+	if err != nil {
+		if cfg.Verbose {
+			fmt.Printf("解析HTML文件失败: %v\n", err)
+		} else {
+			errorResult := models.WithPrincess(map[string]string{
+				"error": err.Error(),
+			}, cfg.Branding())
+			writeOutput(os.Stdout, outputFormat, []interface{}{errorResult}, true)
+		}
+		os.Exit(exitCodeFor(err))
+	}
+
+	if cfg.Verbose {
+		printParseWarnings(ipInfo)
+	}
+	if err := writeOutput(os.Stdout, outputFormat, []interface{}{ipInfo}, true); err != nil {
+		fmt.Printf("输出结果失败: %v\n", err)
+		os.Exit(exitFailure)
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"flag"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"ping0/internal/models"
+)
+
+const (
+	// reportLowRiskMax 报告中视为低风险的最大风控值，对应Ping0.cc的“极度纯净”和“纯净”
+	reportLowRiskMax = 25
+	// reportMediumRiskMax 报告中视为中风险的最大风控值，对应“中性”和“轻微风险”，更高的视为高风险
+	reportMediumRiskMax = 50
+)
+
+//go:embed report.html
+var reportHTML string
+
+// reportTemplate report子命令生成HTML报告使用的模板
+var reportTemplate = template.Must(template.New("report").Parse(reportHTML))
+
+// reportLand 报告地图中陆地的粗略轮廓，每个多边形依次为各顶点的经度和纬度
+// 只保留大洲和主要岛屿的大致形状，用于让读者辨认IP所在的区域，不追求精确。
+var reportLand = [][]float64{
+	// 北美洲
+	{-168, 66, -162, 70, -156, 71.5, -141, 70, -128, 70, -115, 68, -95, 72, -82, 73, -80, 63, -94, 59, -86, 55, -79, 55,
+		-77, 60, -69, 59, -61, 56, -56, 52, -60, 47, -66, 44, -70, 42, -74, 40, -76, 35, -81, 31, -80, 25, -82, 27, -84, 30,
+		-90, 29, -97, 27, -97, 22, -94, 18, -90, 21, -87, 21, -88, 16, -83, 15, -83, 10, -79, 9, -77, 8, -80, 7, -85, 10,
+		-88, 13, -92, 15, -96, 16, -105, 20, -109, 23, -112, 28, -114, 31, -117, 33, -121, 35, -124, 40, -124, 46, -124, 49,
+		-128, 51, -134, 57, -141, 60, -148, 61, -152, 59, -158, 57, -164, 55, -158, 59, -162, 60, -165, 63},
+	// 格陵兰
+	{-73, 78, -60, 82, -30, 83, -20, 80, -20, 72, -25, 70, -40, 65, -43, 60, -50, 64, -55, 70, -60, 76},
+	// 古巴
+	{-85, 22, -74, 20, -77, 20, -82, 23},
+	// 南美洲
+	{-77, 8, -72, 12, -64, 10.5, -60, 8, -52, 5, -50, 0, -44, -2, -35, -5, -35, -9, -39, -15, -41, -22, -48, -26, -53, -34,
+		-58, -38, -62, -39, -65, -42, -65, -47, -68, -50, -68, -54, -72, -54, -75, -50, -73, -42, -72, -30, -71, -18, -76, -14,
+		-81, -6, -80, -2, -80, 1, -78, 3},
+	// 非洲
+	{-17, 21, -13, 28, -9, 32, -6, 36, 10, 37, 11, 33, 20, 31, 25, 32, 32, 31, 35, 28, 38, 22, 43, 12, 51, 12, 47, 5, 40, -3,
+		40, -10, 40, -16, 35, -24, 32, -29, 27, -34, 19, -35, 17, -29, 12, -17, 13, -9, 9, -1, 9, 4, 4, 6, -4, 5, -8, 4,
+		-13, 8, -17, 14},
+	// 马达加斯加
+	{44, -25, 47, -25, 50, -15, 49, -12, 44, -17},
+	// 欧亚大陆
+	{-9, 43, -9, 37, -6, 36, -2, 37, 0, 39, 3, 42, 6, 43, 9, 44, 12, 42, 16, 38, 18, 40, 13, 45, 19, 42, 22, 37, 26, 38,
+		26, 40, 29, 41, 36, 36, 35, 33, 35, 31, 34, 28, 39, 22, 43, 13, 45, 13, 52, 16, 57, 19, 59, 22, 56, 26, 51, 25,
+		49, 29, 54, 27, 57, 25, 62, 25, 67, 25, 70, 21, 73, 17, 77, 8, 80, 13, 80, 16, 87, 21, 91, 22, 94, 17, 98, 16,
+		98, 8, 101, 3, 104, 1, 103, 6, 101, 13, 105, 9, 109, 12, 108, 17, 106, 20, 110, 21, 117, 23, 121, 28, 122, 31,
+		120, 35, 119, 37, 122, 37, 121, 39, 118, 39, 121, 41, 125, 40, 127, 35, 129, 35, 129, 38, 131, 43, 140, 48,
+		141, 53, 137, 54, 140, 58, 152, 59, 157, 61, 162, 58, 163, 61, 177, 62, 180, 65, 180, 69, 170, 70, 160, 69.5,
+		150, 71, 140, 72, 130, 71, 113, 74, 105, 77.5, 95, 76, 87, 74, 80, 73, 70, 73, 67, 69, 60, 70, 55, 68, 45, 68,
+		44, 66, 40, 67, 33, 69, 25, 71, 15, 68, 12, 65, 5, 62, 5, 58, 8, 58, 11, 59, 13, 56, 11, 55, 9, 57, 8, 54, 4, 52,
+		2, 51, -2, 48, -5, 48, -1, 46, -2, 43},
+	// 大不列颠岛、爱尔兰岛、冰岛
+	{-5, 50, 1, 51, 2, 53, -2, 56, -2, 58, -5, 58.5, -6, 56, -3, 55, -5, 52},
+	{-10, 52, -6, 52, -6, 55, -8, 55},
+	{-24, 64, -22, 66, -15, 66.5, -13, 65, -18, 63.5},
+	// 日本
+	{130, 31, 135, 34, 140, 35, 142, 39, 141, 42, 140, 41, 136, 37, 131, 34},
+	{140, 42, 145, 43, 142, 45.5},
+	// 东南亚岛屿和新几内亚
+	{120, 18, 122, 18, 124, 12, 126, 7, 122, 7, 120, 14},
+	{95, 5, 98, 4, 106, -6, 102, -4},
+	{109, 2, 117, 7, 119, 1, 116, -4, 110, -3},
+	{105, -6, 114, -7, 114, -8.5, 106, -7},
+	{131, -1, 141, -3, 148, -8, 150, -10, 143, -9, 138, -8, 132, -3},
+	// 澳大利亚、新西兰
+	{114, -22, 114, -26, 115, -34, 118, -35, 124, -34, 131, -31, 138, -35, 141, -38, 147, -39, 150, -37, 153, -31,
+		153, -25, 146, -19, 142, -11, 141, -17, 136, -15, 137, -12, 131, -11, 126, -14, 122, -18},
+	{172, -34, 178, -38, 175, -41, 170, -46, 167, -46, 172, -41},
+}
+
+// reportEntry 报告中的一个IP
+type reportEntry struct {
+	IP           string
+	Error        string // 查询失败时的错误信息，此时其他字段为空
+	Location     string
+	ASN          string
+	ASNOwner     string
+	Organization string
+	IPType       string
+	NativeIP     string
+	RiskValue    string
+	RiskLabel    string
+	Level        string  // 风险等级，同时用作表格行和地图圆点的CSS类名: low、medium、high、unknown
+	Mapped       bool    // 是否有经纬度，没有时不在地图中标出
+	X, Y         float64 // 地图中的坐标，即经度和纬度的相反数
+}
+
+// reportData 填充reportTemplate的数据
+type reportData struct {
+	Title     string
+	Generated string
+	Version   string
+	Entries   []reportEntry
+
+	Low, Medium, High, Unknown, Failed int
+	LowMax, MediumMax                  int
+	Unmapped                           int // 查询成功但没有经纬度的IP数量
+
+	Land      string // 陆地轮廓的SVG路径
+	Graticule string // 经纬网的SVG路径
+}
+
+// runReportCommand 执行report子命令，查询文件中的IP并生成可独立打开的HTML报告
+// 用法:
+//
+//	pong0 [查询参数] report -file ips.txt -out report.html [-title 标题]
+//
+// 报告包含按风险等级着色的结果表格和标出各IP经纬度的地图，样式和地图都内嵌在文件中，
+// 不引用任何外部资源，可以直接通过邮件或聊天工具发给不熟悉命令行的同事。查询依次进行，
+// 遇到限流时自动增大间隔；查询失败的IP在表格中单独列出，全部查询都失败时不生成报告并以非零状态码退出。
+//
+// 参数:
+//   - args: report之后的参数
+func runReportCommand(args []string) {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	file := fs.String("file", "", "IP列表文件路径，每行一个IP，空行和#开头的行会被忽略")
+	out := fs.String("out", "report.html", "报告输出路径，为-时输出到标准输出")
+	title := fs.String("title", "IP查询报告", "报告标题")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			os.Exit(exitOK)
+		}
+		os.Exit(exitUsage)
+	}
+	if fs.NArg() > 0 || *file == "" || *out == "" {
+		fmt.Println("错误: report 子命令需要 -file 指定IP列表文件，且不接受位置参数")
+		fmt.Println("用法示例:")
+		fmt.Println("  pong0 report -file ips.txt -out report.html")
+		fmt.Println("  pong0 report -file ips.txt -out - -title \"出口IP审计\" > report.html")
+		os.Exit(exitUsage)
+	}
+	ips, err := readIPList(*file)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	if len(ips) == 0 {
+		fmt.Printf("错误: IP列表文件 %s 中没有IP\n", *file)
+		os.Exit(exitUsage)
+	}
+	validateCommandLineOptions()
+	cfg := buildConfig()
+	log := cfg.Log("report")
+
+	infos := make([]*models.IPInfo, len(ips))
+	errs := make([]error, len(ips))
+	failed := 0
+	exitCode := exitOK
+	p := newPacer(0, log)
+	for i, ip := range ips {
+		p.wait()
+		infos[i], errs[i] = lookupIP(context.Background(), cfg, ip)
+		p.observe(errs[i])
+		if errs[i] != nil {
+			failed++
+			log.Warn("查询失败", "ip", ip, "error", errs[i])
+			// 所有失败属于同一类别时使用该类别的退出码，否则使用通用失败退出码
+			if code := exitCodeFor(errs[i]); exitCode == exitOK || exitCode == code {
+				exitCode = code
+			} else {
+				exitCode = exitFailure
+			}
+		}
+	}
+	flushTraces(cfg)
+	if failed == len(ips) {
+		fmt.Fprintf(os.Stderr, "全部 %d 个IP查询失败，未生成报告\n", failed)
+		os.Exit(exitCode)
+	}
+
+	data := buildReport(*title, ips, infos, errs)
+	if *out == "-" {
+		err = reportTemplate.Execute(os.Stdout, data)
+	} else {
+		err = writeReportFile(*out, data)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "生成报告失败: %v\n", err)
+		os.Exit(exitFailure)
+	}
+	if *out != "-" {
+		fmt.Fprintf(os.Stderr, "已生成报告 %s（%d 个IP，%d 个查询失败）\n", *out, len(ips), failed)
+	}
+}
+
+// writeReportFile 将报告写入文件，先写入同目录下的临时文件再重命名，避免生成失败时留下不完整的报告
+func writeReportFile(path string, data reportData) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".pong0-report-*.html")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := reportTemplate.Execute(tmp, data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("渲染报告失败: %w", err)
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("设置报告文件权限失败: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入报告失败: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("保存报告失败: %w", err)
+	}
+	return nil
+}
+
+// buildReport 将查询结果整理为报告数据
+//
+// 参数:
+//   - title: 报告标题
+//   - ips: 文件中的IP，报告按此顺序列出
+//   - infos: 与ips一一对应的查询结果，查询失败的为nil
+//   - errs: 与ips一一对应的查询错误
+//
+// 返回:
+//   - reportData: 填充reportTemplate的数据
+func buildReport(title string, ips []string, infos []*models.IPInfo, errs []error) reportData {
+	data := reportData{
+		Title:     title,
+		Generated: time.Now().Format("2006-01-02 15:04:05 MST"),
+		Version:   Version,
+		Entries:   make([]reportEntry, 0, len(ips)),
+		LowMax:    reportLowRiskMax,
+		MediumMax: reportMediumRiskMax,
+		Land:      svgPolygons(reportLand),
+		Graticule: svgGraticule(),
+	}
+	for i, ip := range ips {
+		if errs[i] != nil {
+			data.Entries = append(data.Entries, reportEntry{IP: ip, Error: errs[i].Error()})
+			data.Failed++
+			continue
+		}
+		info := infos[i]
+		e := reportEntry{
+			IP:           ip,
+			Location:     info.IPLocation,
+			ASN:          info.ASN,
+			ASNOwner:     info.ASNOwner,
+			Organization: info.Organization,
+			IPType:       info.IPType,
+			NativeIP:     info.NativeIP,
+			RiskValue:    info.RiskValue,
+			RiskLabel:    info.RiskLabel,
+			Level:        riskLevel(info),
+			// 经纬度都为0表示没有位置信息，与providers中的约定一致
+			Mapped: info.Lat != 0 || info.Lon != 0,
+			X:      info.Lon,
+			Y:      -info.Lat,
+		}
+		switch e.Level {
+		case "low":
+			data.Low++
+		case "medium":
+			data.Medium++
+		case "high":
+			data.High++
+		default:
+			data.Unknown++
+		}
+		if !e.Mapped {
+			data.Unmapped++
+		}
+		data.Entries = append(data.Entries, e)
+	}
+	return data
+}
+
+// riskLevel 按风控值将查询结果划分为low、medium、high三个等级，没有风控值时返回unknown
+func riskLevel(info *models.IPInfo) string {
+	switch {
+	case info.RiskValue == "":
+		return "unknown"
+	case info.RiskScore <= reportLowRiskMax:
+		return "low"
+	case info.RiskScore <= reportMediumRiskMax:
+		return "medium"
+	default:
+		return "high"
+	}
+}
+
+// svgPolygons 将经纬度多边形转换为SVG路径，x为经度，y为纬度的相反数
+func svgPolygons(polygons [][]float64) string {
+	var b strings.Builder
+	for _, poly := range polygons {
+		for i := 0; i+1 < len(poly); i += 2 {
+			if i == 0 {
+				b.WriteByte('M')
+			} else {
+				b.WriteByte('L')
+			}
+			b.WriteString(strconv.FormatFloat(poly[i], 'f', -1, 64))
+			b.WriteByte(',')
+			b.WriteString(strconv.FormatFloat(-poly[i+1], 'f', -1, 64))
+		}
+		b.WriteByte('Z')
+	}
+	return b.String()
+}
+
+// svgGraticule 返回每30度一条的经纬网SVG路径，范围与地图的viewBox一致
+func svgGraticule() string {
+	var b strings.Builder
+	for lon := -180; lon <= 180; lon += 30 {
+		fmt.Fprintf(&b, "M%d,-85V60", lon)
+	}
+	for lat := -60; lat <= 60; lat += 30 {
+		fmt.Fprintf(&b, "M-180,%dH180", -lat)
+	}
+	return b.String()
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"ping0/internal/models"
+)
+
+// runSchemaCommand 执行schema子命令，将查询结果（IPInfo）的JSON Schema输出到标准输出
+// 用法: pong0 schema > ipinfo.schema.json
+func runSchemaCommand() {
+	schema, err := models.IPInfoSchemaJSON()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "生成JSON Schema失败: %v\n", err)
+		os.Exit(exitFailure)
+	}
+	fmt.Println(string(schema))
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ping0/internal/client"
+	"ping0/internal/config"
+)
+
+// 系统服务的名称和说明
+const (
+	serviceName        = "pong0"
+	serviceDisplayName = "Pong0"
+	serviceDescription = "Pong0 IP信息查询API服务器"
+)
+
+// runServiceCommand 执行service子命令，将API服务器安装为系统服务（Linux上为systemd，Windows上为Windows服务）
+// 用法:
+//
+//	pong0 [服务器参数] service install    安装并启动服务，服务以这些参数运行API服务器
+//	pong0 service uninstall               停止并卸载服务
+//	pong0 [服务器参数] service run        以服务方式运行API服务器，由服务管理器调用
+//
+// 参数:
+//   - action: 子命令的操作，install、uninstall或run
+func runServiceCommand(action string) {
+	switch action {
+	case "install":
+		// 服务总是以服务器模式运行，安装前按服务器模式检查参数，避免装好后才发现无法启动
+		serverMode = true
+		validateCommandLineOptions()
+
+		exe, args, err := serviceCommandLine()
+		if err != nil {
+			fmt.Printf("错误: 无法确定程序路径: %v\n", err)
+			os.Exit(exitFailure)
+		}
+		if err := installService(exe, args); err != nil {
+			fmt.Printf("错误: 安装服务失败: %v\n", err)
+			os.Exit(exitFailure)
+		}
+		fmt.Printf("已安装并启动服务 %s: %s %s\n", serviceName, exe, strings.Join(args, " "))
+	case "uninstall":
+		if err := uninstallService(); err != nil {
+			fmt.Printf("错误: 卸载服务失败: %v\n", err)
+			os.Exit(exitFailure)
+		}
+		fmt.Printf("已卸载服务 %s\n", serviceName)
+	case "run":
+		serverMode = true
+		validateCommandLineOptions()
+		runService(buildConfig())
+	default:
+		fmt.Println("错误: service 子命令需要指定操作: install、uninstall 或 run")
+		fmt.Println("用法示例:")
+		fmt.Println("  安装服务: pong0 -p 8080 -k your_api_key service install")
+		fmt.Println("  卸载服务: pong0 service uninstall")
+		os.Exit(exitUsage)
+	}
+}
+
+// serviceCommandLine 返回服务启动时执行的程序路径和参数
+// 参数为本次命令行中service之前的全部参数，再加上 service run；
+// 相对路径的参数（如 -config）在服务中会相对于服务管理器的工作目录解析，需要使用绝对路径。
+//
+// 返回:
+//   - string: 当前程序的绝对路径
+//   - []string: 服务的启动参数
+//   - error: 如果无法确定程序路径则返回相应错误
+func serviceCommandLine() (string, []string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", nil, err
+	}
+	if exe, err = filepath.Abs(exe); err != nil {
+		return "", nil, err
+	}
+
+	args := append([]string{}, os.Args[1:len(os.Args)-flag.NArg()]...)
+	return exe, append(args, "service", "run"), nil
+}
+
+// releaseServer 在API服务器正常关闭后释放资源
+// 历史记录数据库和审计日志在服务器关闭后再关闭，确保进行中的写入已完成；最后发送尚未上报的Sentry事件并导出剩余的追踪区间。
+func releaseServer(cfg *config.Config) {
+	switch sessions := cfg.Sessions.(type) {
+	case *client.SessionPool:
+		sessions.Close()
+	case *client.RedisSessionStore:
+		sessions.Close()
+	}
+	if cfg.RateStore != nil {
+		cfg.RateStore.Close()
+	}
+	if cfg.History != nil {
+		cfg.History.Close()
+	}
+	if cfg.Audit != nil {
+		cfg.Audit.Close()
+	}
+	if cfg.Sentry != nil {
+		cfg.Sentry.Flush(5 * time.Second)
+	}
+	flushTraces(cfg)
+}
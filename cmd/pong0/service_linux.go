@@ -0,0 +1,156 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"ping0/internal/config"
+	"ping0/internal/server"
+)
+
+// unitPath systemd单元文件的路径
+const unitPath = "/etc/systemd/system/" + serviceName + ".service"
+
+// unitTemplate systemd单元文件模板，Type=notify使systemd在服务器开始监听端口后才认为服务已启动
+const unitTemplate = `[Unit]
+Description=%s
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=notify
+ExecStart=%s
+Restart=on-failure
+RestartSec=5s
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// installService 写入systemd单元文件，并设置为开机启动、立即启动
+//
+// 参数:
+//   - exe: 程序的绝对路径
+//   - args: 服务的启动参数
+//
+// 返回:
+//   - error: 如果服务已安装、写入单元文件失败或systemctl执行失败则返回相应错误
+func installService(exe string, args []string) error {
+	if _, err := os.Stat(unitPath); err == nil {
+		return fmt.Errorf("服务已安装（%s），请先执行 pong0 service uninstall", unitPath)
+	}
+
+	words := []string{systemdQuote(exe)}
+	for _, arg := range args {
+		words = append(words, systemdQuote(arg))
+	}
+	unit := fmt.Sprintf(unitTemplate, serviceDescription, strings.Join(words, " "))
+	if err := os.WriteFile(unitPath, []byte(unit), 0o644); err != nil {
+		return err
+	}
+
+	// 没有systemd时不留下无用的单元文件
+	if err := systemctl("daemon-reload"); err != nil {
+		os.Remove(unitPath)
+		return err
+	}
+	return systemctl("enable", "--now", serviceName)
+}
+
+// uninstallService 停止服务、取消开机启动并删除单元文件
+func uninstallService() error {
+	if _, err := os.Stat(unitPath); err != nil {
+		return fmt.Errorf("服务未安装（%s 不存在）", unitPath)
+	}
+	if err := systemctl("disable", "--now", serviceName); err != nil {
+		return err
+	}
+	if err := os.Remove(unitPath); err != nil {
+		return err
+	}
+	return systemctl("daemon-reload")
+}
+
+// systemctl 执行systemctl命令，失败时在错误中附带命令的输出
+func systemctl(args ...string) error {
+	out, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// systemdQuote 按单元文件的语法转义ExecStart中的一个参数
+// %和$在单元文件中有特殊含义，需要写成%%和$$；包含空白或引号的参数用双引号括起来。
+func systemdQuote(s string) string {
+	s = strings.ReplaceAll(s, "%", "%%")
+	s = strings.ReplaceAll(s, "$", "$$")
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\") {
+		return s
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// runService 以systemd服务方式运行API服务器
+// 开始监听端口后通过sd_notify通知systemd服务已就绪，收到SIGTERM后通知systemd正在停止，再优雅退出。
+// 不是由systemd启动时（没有NOTIFY_SOCKET环境变量）与 -c 相同。
+func runService(cfg *config.Config) {
+	log := cfg.Log("service")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		if err := sdNotify("STOPPING=1"); err != nil {
+			log.Warn("通知systemd失败", "error", err)
+		}
+	}()
+
+	ready := func() {
+		if err := sdNotify("READY=1"); err != nil {
+			log.Warn("通知systemd失败", "error", err)
+		}
+	}
+	if err := server.Serve(ctx, cfg, ready); err != nil {
+		fmt.Printf("启动服务器失败: %v\n", err)
+		os.Exit(1)
+	}
+	releaseServer(cfg)
+}
+
+// sdNotify 向systemd发送服务状态，实现sd_notify协议，没有NOTIFY_SOCKET环境变量时不做任何事
+//
+// 参数:
+//   - state: 状态，如 READY=1、STOPPING=1
+//
+// 返回:
+//   - error: 如果无法连接或写入通知套接字则返回相应错误
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	// 以@开头的是抽象命名空间的套接字
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
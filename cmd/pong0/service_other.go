@@ -0,0 +1,27 @@
+//go:build !linux && !windows
+
+package main
+
+import (
+	"fmt"
+
+	"ping0/internal/config"
+)
+
+// errServiceUnsupported 当前系统没有支持的服务管理器
+var errServiceUnsupported = fmt.Errorf("当前系统不支持安装服务，仅支持Linux（systemd）和Windows")
+
+// installService 当前系统不支持安装服务
+func installService(exe string, args []string) error {
+	return errServiceUnsupported
+}
+
+// uninstallService 当前系统不支持卸载服务
+func uninstallService() error {
+	return errServiceUnsupported
+}
+
+// runService 没有服务管理器需要通知，与 -c 相同
+func runService(cfg *config.Config) {
+	runServerMode(cfg)
+}
@@ -0,0 +1,131 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+
+	"ping0/internal/config"
+	"ping0/internal/server"
+)
+
+// installService 创建自动启动的Windows服务并立即启动
+// 服务异常退出后由服务控制管理器在5秒后重启。
+//
+// 参数:
+//   - exe: 程序的绝对路径
+//   - args: 服务的启动参数
+//
+// 返回:
+//   - error: 如果服务已存在或创建、启动服务失败则返回相应错误
+func installService(exe string, args []string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("连接服务控制管理器失败（需要管理员权限）: %w", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		return fmt.Errorf("服务 %s 已存在，请先执行 pong0 service uninstall", serviceName)
+	}
+
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: serviceDisplayName,
+		Description: serviceDescription,
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	restart := []mgr.RecoveryAction{{Type: mgr.ServiceRestart, Delay: 5 * time.Second}}
+	if err := s.SetRecoveryActions(restart, uint32((24 * time.Hour).Seconds())); err != nil {
+		return fmt.Errorf("设置服务的恢复操作失败: %w", err)
+	}
+	return s.Start()
+}
+
+// uninstallService 停止并删除Windows服务
+func uninstallService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("连接服务控制管理器失败（需要管理员权限）: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("服务 %s 未安装", serviceName)
+	}
+	defer s.Close()
+
+	// 服务已停止时Control会返回错误，不影响删除
+	s.Control(svc.Stop)
+	return s.Delete()
+}
+
+// runService 以Windows服务方式运行API服务器，不是由服务控制管理器启动时与 -c 相同
+func runService(cfg *config.Config) {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		fmt.Printf("错误: 无法判断是否作为服务运行: %v\n", err)
+		os.Exit(exitFailure)
+	}
+	if !isService {
+		runServerMode(cfg)
+		return
+	}
+
+	if err := svc.Run(serviceName, &windowsService{cfg: cfg}); err != nil {
+		cfg.Log("service").Error("运行服务失败", "error", err)
+		os.Exit(1)
+	}
+	releaseServer(cfg)
+}
+
+// windowsService 响应服务控制管理器的请求
+type windowsService struct {
+	cfg *config.Config
+}
+
+// Execute 运行API服务器，收到停止或关机请求时优雅退出
+func (w *windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Serve(ctx, w.cfg, func() {
+			status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+		})
+	}()
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				w.cfg.Log("service").Error("服务器异常退出", "error", err)
+				return false, 1
+			}
+			return false, 0
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				cancel()
+			}
+		}
+	}
+}
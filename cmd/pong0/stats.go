@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"ping0/internal/client"
+	"ping0/internal/config"
+	"ping0/internal/models"
+	"ping0/internal/stats"
+)
+
+// printStageStats 在详细模式下输出本次运行中查询流程各阶段的耗时和成功率，以及已下载的脚本指纹
+// 结果来自磁盘缓存等没有访问Ping0.cc的情况下不输出。
+func printStageStats(cfg *config.Config) {
+	snap := cfg.Stats.Snapshot()
+	if len(snap.Stages) == 0 {
+		return
+	}
+
+	rows := make([][]string, 0, len(snap.Stages))
+	for _, st := range snap.Stages {
+		rows = append(rows, []string{
+			st.Stage,
+			st.Kind,
+			fmt.Sprint(st.Count),
+			fmt.Sprintf("%.0f%%", st.SuccessRate*100),
+			fmt.Sprintf("%.2f", st.AvgMs),
+			fmt.Sprintf("%.2f", st.MaxMs),
+		})
+	}
+
+	fmt.Println("-------------------------------------")
+	fmt.Println("各阶段耗时:")
+	writeAligned(os.Stdout, []string{"阶段", "类型", "次数", "成功率", "平均(ms)", "最长(ms)"}, rows)
+
+	for _, fp := range client.ScriptFingerprints(cfg) {
+		fmt.Println(fp.String())
+	}
+}
+
+// printParseWarnings 输出解析结果页面时发现的问题和解析质量
+// 降级结果不是解析页面得到的，没有解析质量，不输出任何内容。
+func printParseWarnings(info *models.IPInfo) {
+	if info.ParseQuality == nil {
+		return
+	}
+	fmt.Println("-------------------------------------")
+	fmt.Printf("解析质量: %d%%\n", *info.ParseQuality)
+	for _, w := range info.Warnings {
+		fmt.Printf("解析警告 [%s] %s\n", w.Code, w)
+	}
+}
+
+// serverStats GET /stats的响应中stats子命令使用的部分
+type serverStats struct {
+	stats.Snapshot
+	Usage   stats.UsageSnapshot         `json:"usage"`
+	Scripts []*client.ScriptFingerprint `json:"scripts"`
+}
+
+// runStatsCommand 执行stats子命令，读取运行中的API服务器的统计
+// 用法:
+//
+//	pong0 stats [-server http://127.0.0.1:8080] [-top 10] [-admin-key KEY]
+//
+// 服务器地址默认为本机上配置文件中的port（或PONG0_PORT环境变量）指定的端口。提供管理员密钥（默认使用配置文件中的admin_key）时
+// 还会输出最近一小时查询最多的IP和每个API密钥的查询次数。默认输出对齐的文本，指定 -o json 时输出服务器返回的JSON。
+//
+// 参数:
+//   - args: stats之后的参数
+func runStatsCommand(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	server := fs.String("server", "", "API服务器地址，默认为 http://127.0.0.1:<端口>")
+	top := fs.Int("top", stats.DefaultTopN, "列出查询最多的IP数量")
+	key := fs.String("admin-key", "", "管理员密钥，默认使用配置文件中的admin_key或PONG0_ADMIN_KEY环境变量")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			os.Exit(exitOK)
+		}
+		os.Exit(exitUsage)
+	}
+	if fs.NArg() > 0 || *top <= 0 {
+		fmt.Println("错误: stats 子命令不接受位置参数，-top 必须大于0")
+		fmt.Println("用法示例:")
+		fmt.Println("  本机服务器: pong0 stats")
+		fmt.Println("  远程服务器: pong0 stats -server https://pong0.internal:8080 -top 20 -admin-key ADMIN_KEY")
+		os.Exit(exitUsage)
+	}
+	validateCommandLineOptions()
+
+	cfg := buildConfig()
+	if *server == "" {
+		*server = "http://127.0.0.1:" + cfg.APIPort
+	}
+	if *key == "" {
+		*key = cfg.AdminKey
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(*server, "/")+"/stats?top="+strconv.Itoa(*top), nil)
+	if err != nil {
+		fmt.Printf("错误: 无效的服务器地址: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	if *key != "" {
+		req.Header.Set("X-Admin-Key", *key)
+	}
+	resp, err := (&http.Client{Timeout: cfg.RequestTimeout()}).Do(req)
+	if err != nil {
+		fmt.Printf("错误: 连接API服务器失败: %v\n", err)
+		os.Exit(exitNetwork)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Printf("错误: 读取API服务器响应失败: %v\n", err)
+		os.Exit(exitNetwork)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &apiErr) != nil || apiErr.Error == "" {
+			apiErr.Error = resp.Status
+		}
+		fmt.Printf("错误: API服务器返回错误: %s\n", apiErr.Error)
+		os.Exit(exitFailure)
+	}
+
+	if outputFormatSet() && outputFormat == formatJSON {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, body, "", "  "); err == nil {
+			fmt.Println(strings.TrimSpace(buf.String()))
+			return
+		}
+	}
+
+	var st serverStats
+	if err := json.Unmarshal(body, &st); err != nil {
+		fmt.Printf("错误: 无法解析API服务器的统计: %v\n", err)
+		os.Exit(exitFailure)
+	}
+	writeServerStats(os.Stdout, &st)
+}
+
+// writeServerStats 以对齐的文本输出API服务器的统计：查询用量、错误类别、查询最多的IP、API密钥和各阶段耗时
+func writeServerStats(w io.Writer, st *serverStats) {
+	u := st.Usage
+	fmt.Fprintf(w, "统计开始时间: %s\n", st.Since.Local().Format(time.DateTime))
+	fmt.Fprintf(w, "最近%d分钟: 查询 %d 次，失败 %d 次，错误率 %.1f%%\n", u.WindowSeconds/60, u.Queries, u.Failures, u.ErrorRate*100)
+
+	if len(u.Errors) > 0 {
+		rows := make([][]string, 0, len(u.Errors))
+		for _, e := range u.Errors {
+			rows = append(rows, []string{e.Code, fmt.Sprint(e.Count), fmt.Sprintf("%.1f%%", e.Rate*100)})
+		}
+		fmt.Fprintln(w, "-------------------------------------")
+		fmt.Fprintln(w, "错误类别:")
+		writeAligned(w, []string{"类别", "次数", "占比"}, rows)
+	}
+	for _, section := range []struct {
+		title, column string
+		counts        []stats.Count
+	}{
+		{"查询最多的IP:", "IP", u.TopIPs},
+		{"API密钥:", "密钥", u.Keys},
+	} {
+		if len(section.counts) == 0 {
+			continue
+		}
+		rows := make([][]string, 0, len(section.counts))
+		for _, c := range section.counts {
+			rows = append(rows, []string{c.Name, fmt.Sprint(c.Count)})
+		}
+		fmt.Fprintln(w, "-------------------------------------")
+		fmt.Fprintln(w, section.title)
+		writeAligned(w, []string{section.column, "次数"}, rows)
+	}
+
+	if len(st.Stages) > 0 {
+		rows := make([][]string, 0, len(st.Stages))
+		for _, s := range st.Stages {
+			rows = append(rows, []string{
+				s.Stage,
+				s.Kind,
+				fmt.Sprint(s.Count),
+				fmt.Sprintf("%.0f%%", s.SuccessRate*100),
+				fmt.Sprintf("%.2f", s.AvgMs),
+				fmt.Sprintf("%.2f", s.P95Ms),
+			})
+		}
+		fmt.Fprintln(w, "-------------------------------------")
+		fmt.Fprintln(w, "各阶段耗时:")
+		writeAligned(w, []string{"阶段", "类型", "次数", "成功率", "平均(ms)", "P95(ms)"}, rows)
+	}
+	for _, fp := range st.Scripts {
+		fmt.Fprintln(w, fp.String())
+	}
+}
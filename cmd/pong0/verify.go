@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"ping0/internal/client"
+	"ping0/internal/parser"
+	"ping0/internal/verify"
+)
+
+// runVerifyAlgoCommand 执行verify-algo子命令，用随机x1值对比Go算法与Ping0.cc的JavaScript生成的访问密钥
+// 用法:
+//
+//	pong0 [查询参数] verify-algo [-n 20] [-difficulty 00]            下载当前初始页面引用的脚本并对比
+//	pong0 [查询参数] verify-algo [-n 20] [-difficulty 00] main.js    对比保存的脚本
+//
+// 脚本在进程内的JavaScript引擎中以模拟的浏览器环境运行，读取其设置的js1key和pow cookie。
+// Go算法由 -algo 指定，未指定时按脚本路径（或文件名）自动选择。
+// 默认输出对齐的文本，指定 -o json 时输出JSON；有样本不一致时以验证失败的退出码退出。
+//
+// 参数:
+//   - args: verify-algo之后的参数
+func runVerifyAlgoCommand(args []string) {
+	fs := flag.NewFlagSet("verify-algo", flag.ContinueOnError)
+	samples := fs.Int("n", verify.DefaultSamples, "随机x1值的数量")
+	difficulty := fs.String("difficulty", verify.DefaultDifficulty, "计算POW使用的difficulty，较长时JS中的计算可能很慢")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			os.Exit(exitOK)
+		}
+		os.Exit(exitUsage)
+	}
+	if fs.NArg() > 1 || *samples <= 0 {
+		fmt.Println("错误: verify-algo 子命令最多接受一个脚本文件，-n 必须大于0")
+		fmt.Println("用法示例:")
+		fmt.Println("  对比当前脚本: pong0 verify-algo")
+		fmt.Println("  对比保存的脚本: pong0 verify-algo -n 50 main.js")
+		os.Exit(exitUsage)
+	}
+	validateCommandLineOptions()
+
+	cfg := buildConfig()
+	ctx := context.Background()
+
+	var source string
+	var content []byte
+	if fs.NArg() == 1 {
+		source = fs.Arg(0)
+		data, err := os.ReadFile(source)
+		if err != nil {
+			fmt.Printf("错误: 读取脚本失败: %v\n", err)
+			os.Exit(exitUsage)
+		}
+		content = data
+	} else {
+		session, err := client.NewSession(cfg)
+		if err != nil {
+			fmt.Printf("错误: 创建会话失败: %v\n", err)
+			os.Exit(exitFailure)
+		}
+		params, err := session.GetInitialPage(ctx, nil)
+		if err != nil {
+			fmt.Printf("错误: 获取初始页面失败: %v\n", err)
+			os.Exit(exitCodeFor(err))
+		}
+		source = params.JSPath
+		if content, err = session.DownloadScript(ctx, params.JSPath); err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(exitCodeFor(err))
+		}
+	}
+
+	alg, err := parser.SelectAlgorithm(cfg.KeyAlgorithm, source)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	report, err := verify.Run(ctx, cfg, alg, source, content, verify.Options{
+		Samples:    *samples,
+		Difficulty: *difficulty,
+	})
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(exitFailure)
+	}
+
+	if outputFormatSet() && outputFormat == formatJSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err == nil {
+			fmt.Println(string(data))
+		}
+	} else {
+		writeVerifyReport(os.Stdout, report)
+	}
+	if report.Divergences > 0 {
+		os.Exit(exitChallenge)
+	}
+}
+
+// writeVerifyReport 以对齐的文本输出对比结果，每个样本一行，最后一行为汇总
+func writeVerifyReport(w io.Writer, report *verify.Report) {
+	fmt.Fprintf(w, "算法: %s\n", report.Algorithm)
+	fmt.Fprintf(w, "脚本: %s (sha256=%s)\n", report.Script, report.ScriptSHA256)
+
+	rows := make([][]string, 0, len(report.Samples))
+	for _, s := range report.Samples {
+		result := "一致"
+		switch {
+		case s.Error != "":
+			result = "错误: " + s.Error
+		case !s.Match:
+			result = "不一致"
+		}
+		rows = append(rows, []string{s.X1, s.GoJs1key, s.JSJs1key, s.GoPow, s.JSPow, result})
+	}
+	writeAligned(w, []string{"x1", "js1key(Go)", "js1key(JS)", "pow(Go)", "pow(JS)", "结果"}, rows)
+
+	total := len(report.Samples)
+	fmt.Fprintf(w, "%d/%d 个样本一致\n", total-report.Divergences, total)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"ping0/internal/config"
+	"ping0/internal/core"
+	"ping0/internal/models"
+	"ping0/internal/monitor"
+	"ping0/internal/store"
+)
+
+// runWatchMode 在定时自检模式下运行程序
+// 按-watch指定的间隔重复查询本机IP（或-ip指定的IP），每次查询向-sink指定的输出目标写入一行带查询时间的JSON记录，
+// 启用-changes-only时只在IP或其风控值、IP类型、原生IP变化时输出，收到SIGINT或SIGTERM信号后退出
+func runWatchMode(cfg *config.Config) {
+	spec := sinkSpec
+	if watchOutput != "" {
+		spec = watchOutput
+	}
+	out := openSink(spec)
+	defer func() {
+		if err := out.Close(); err != nil {
+			cfg.Log("watch").Warn("关闭输出目标失败", "error", err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(core.WithTag(context.Background(), queryTag), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log := cfg.Log("watch")
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	var last *models.IPInfo
+	for {
+		queriedAt := time.Now()
+		ipInfo, err := core.ProcessIPInfo(ctx, cfg, ip)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Warn("定时查询失败", "error", err)
+		} else if changesOnly && ipInfo.Source == core.SourceFallback {
+			// 降级结果缺少风控值等字段，与正常结果比较总会视为变化
+			log.Warn("定时查询返回降级结果，跳过比较", "reason", ipInfo.FallbackReason)
+		} else {
+			if !changesOnly || last == nil || ipChanged(last, ipInfo) {
+				jsonData, _ := json.Marshal(store.Record{QueriedAt: queriedAt, Info: ipInfo})
+				if err := out.Write(jsonData); err != nil {
+					log.Warn("写入查询记录失败", "error", err)
+				}
+			}
+			last = ipInfo
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ipChanged 判断两次查询之间IP本身或其被追踪的属性是否发生了变化
+// 动态IP重新拨号后IP会变化，此时即使属性相同也视为变化。
+func ipChanged(prev, cur *models.IPInfo) bool {
+	return prev.IP != cur.IP || len(monitor.Diff(prev, cur)) > 0
+}
@@ -0,0 +1,317 @@
+// Package asn implements an offline ASN registry used to enrich lookup results.
+// The registry is loaded from a local file combining the NRO delegation
+// statistics (registry and country of every allocated ASN) with the RIPE
+// asn.txt list (AS names). Download fetches both sources and writes such a
+// file, so lookups never depend on the network at query time.
+package asn
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 默认的数据来源
+const (
+	// DelegatedStatsURL NRO汇总的五个RIR的分配统计，提供ASN所属的RIR和国家
+	DelegatedStatsURL = "https://ftp.ripe.net/pub/stats/ripencc/nro-stats/latest/nro-delegated-stats"
+	// NamesURL RIPE维护的ASN名称列表，每行形如"13335 CLOUDFLARENET, US"
+	NamesURL = "https://ftp.ripe.net/ripe/asnames/asn.txt"
+)
+
+// Info 一个ASN在注册数据中的信息
+type Info struct {
+	Number   int    `json:"number"`             // ASN编号
+	Name     string `json:"name,omitempty"`     // AS名称
+	Country  string `json:"country,omitempty"`  // 注册国家/地区代码
+	Registry string `json:"registry,omitempty"` // 分配该ASN的RIR，如arin、ripencc、apnic
+}
+
+// allocation 分配统计中的一段连续ASN
+type allocation struct {
+	start, end int
+	country    string
+	registry   string
+}
+
+// Registry 可以按编号查询的ASN注册数据，加载后只读，可以被多个goroutine并发使用
+type Registry struct {
+	allocations []allocation   // 按起始编号排序
+	names       map[int]string // ASN编号到名称
+	countries   map[int]string // asn.txt中记录的国家，分配统计中没有该ASN时使用
+}
+
+// Load 从文件加载ASN注册数据
+// 文件中的每一行可以是分配统计格式（registry|cc|asn|start|count|date|status），
+// 也可以是asn.txt格式（编号 名称, 国家），两种格式可以混合出现在同一个文件中。
+//
+// 参数:
+//   - path: 数据文件路径，通常由Download生成
+//
+// 返回:
+//   - *Registry: 加载的注册数据
+//   - error: 如果文件无法读取或不包含任何ASN则返回相应错误
+func Load(path string) (*Registry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开ASN数据文件失败: %w", err)
+	}
+	defer f.Close()
+
+	r, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("读取ASN数据文件 %s 失败: %w", path, err)
+	}
+	return r, nil
+}
+
+// Parse 从r中读取ASN注册数据，格式见Load
+func Parse(r io.Reader) (*Registry, error) {
+	reg := &Registry{
+		names:     make(map[int]string),
+		countries: make(map[int]string),
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.Contains(line, "|") {
+			if a, ok := parseAllocation(line); ok {
+				reg.allocations = append(reg.allocations, a)
+			}
+			continue
+		}
+		if number, name, country, ok := parseName(line); ok {
+			reg.names[number] = name
+			if country != "" {
+				reg.countries[number] = country
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(reg.allocations) == 0 && len(reg.names) == 0 {
+		return nil, fmt.Errorf("未找到任何ASN记录")
+	}
+
+	sort.Slice(reg.allocations, func(i, j int) bool {
+		return reg.allocations[i].start < reg.allocations[j].start
+	})
+	return reg, nil
+}
+
+// parseAllocation 解析分配统计中的一行，只保留已分配的ASN记录
+// 版本行、汇总行以及IPv4/IPv6记录都会被忽略。
+func parseAllocation(line string) (allocation, bool) {
+	fields := strings.Split(line, "|")
+	if len(fields) < 7 || fields[2] != "asn" {
+		return allocation{}, false
+	}
+	if status := fields[6]; status != "allocated" && status != "assigned" {
+		return allocation{}, false
+	}
+
+	start, err := strconv.Atoi(fields[3])
+	if err != nil {
+		return allocation{}, false
+	}
+	count, err := strconv.Atoi(fields[4])
+	if err != nil || count < 1 {
+		return allocation{}, false
+	}
+
+	return allocation{
+		start:    start,
+		end:      start + count - 1,
+		country:  strings.ToUpper(fields[1]),
+		registry: strings.ToLower(fields[0]),
+	}, true
+}
+
+// parseName 解析asn.txt中的一行，如"13335 CLOUDFLARENET, US"
+func parseName(line string) (number int, name, country string, ok bool) {
+	num, rest, found := strings.Cut(line, " ")
+	if !found {
+		return 0, "", "", false
+	}
+	number, err := strconv.Atoi(num)
+	if err != nil {
+		return 0, "", "", false
+	}
+
+	name = strings.TrimSpace(rest)
+	if i := strings.LastIndex(name, ", "); i >= 0 && len(name)-i-2 == 2 {
+		country = strings.ToUpper(name[i+2:])
+		name = name[:i]
+	}
+	return number, name, country, true
+}
+
+// Len 返回注册数据中已知名称或分配信息的ASN记录数量
+func (r *Registry) Len() int {
+	return len(r.allocations) + len(r.names)
+}
+
+// Lookup 查询ASN的注册信息
+//
+// 参数:
+//   - number: ASN编号
+//
+// 返回:
+//   - *Info: ASN的注册信息
+//   - bool: 注册数据中是否有该ASN
+func (r *Registry) Lookup(number int) (*Info, bool) {
+	info := &Info{Number: number}
+	found := false
+
+	i := sort.Search(len(r.allocations), func(i int) bool {
+		return r.allocations[i].end >= number
+	})
+	if i < len(r.allocations) && r.allocations[i].start <= number {
+		info.Country = r.allocations[i].country
+		info.Registry = r.allocations[i].registry
+		found = true
+	}
+
+	if name, ok := r.names[number]; ok {
+		info.Name = name
+		if info.Country == "" {
+			info.Country = r.countries[number]
+		}
+		found = true
+	}
+
+	if !found {
+		return nil, false
+	}
+	return info, true
+}
+
+// ParseNumber 将"AS13335"形式的ASN转换为编号，前缀不区分大小写且可以省略
+//
+// 参数:
+//   - s: ASN字符串
+//
+// 返回:
+//   - int: ASN编号
+//   - bool: 是否为有效的ASN
+func ParseNumber(s string) (int, bool) {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && strings.EqualFold(s[:2], "AS") {
+		s = s[2:]
+	}
+	number, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return int(number), true
+}
+
+// Download 下载分配统计和ASN名称列表，合并后写入path
+// 分配统计中只保留ASN记录以减小文件体积。写入先落到临时文件再重命名，
+// 下载失败时不会破坏已有的数据文件。
+//
+// 参数:
+//   - ctx: 请求上下文
+//   - client: 下载使用的HTTP客户端
+//   - path: 数据文件路径
+//
+// 返回:
+//   - int: 写入的ASN记录数量
+//   - error: 如果下载或写入失败则返回相应错误
+func Download(ctx context.Context, client *http.Client, path string) (int, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return 0, fmt.Errorf("创建ASN数据目录失败: %w", err)
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	w := bufio.NewWriter(tmp)
+	total := 0
+	for _, src := range []struct {
+		url  string
+		keep func(line string) bool
+	}{
+		{DelegatedStatsURL, func(line string) bool {
+			_, ok := parseAllocation(line)
+			return ok
+		}},
+		{NamesURL, func(line string) bool {
+			_, _, _, ok := parseName(line)
+			return ok
+		}},
+	} {
+		n, err := fetchLines(ctx, client, src.url, w, src.keep)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+
+	if err := w.Flush(); err != nil {
+		return 0, fmt.Errorf("写入ASN数据失败: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("写入ASN数据失败: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, fmt.Errorf("保存ASN数据文件失败: %w", err)
+	}
+	return total, nil
+}
+
+// fetchLines 下载url并把keep返回true的行写入w
+func fetchLines(ctx context.Context, client *http.Client, url string, w io.Writer, keep func(string) bool) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("创建请求失败: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("下载 %s 失败: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("下载 %s 失败: 状态码 %d", url, resp.StatusCode)
+	}
+
+	n := 0
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !keep(line) {
+			continue
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return 0, fmt.Errorf("写入ASN数据失败: %w", err)
+		}
+		n++
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("下载 %s 失败: %w", url, err)
+	}
+	return n, nil
+}
@@ -0,0 +1,103 @@
+// Package audit implements an append-only audit log of the queries handled by
+// the Pong0 API server. Each entry records who made the request (peer address,
+// forwarded client chain and API key name), which IPs were queried, when, and the resulting HTTP status.
+// Entries are written to a JSON Lines file, a SQLite database or a PostgreSQL
+// database and can be read back newest first with cursor-based pagination.
+package audit
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultLimit 读取审计日志时默认返回的最大条数
+const DefaultLimit = 100
+
+// MaxLimit 读取审计日志时一次最多返回的条数
+const MaxLimit = 1000
+
+// Entry 一条审计记录
+type Entry struct {
+	ID        int64     `json:"id"`                   // 记录编号，从1开始递增
+	Time      time.Time `json:"time"`                 // 收到请求的时间
+	Client    string    `json:"client"`               // TCP连接的对端地址，经过反向代理时为代理的地址
+	Forwarded string    `json:"forwarded,omitempty"`  // 请求中的X-Forwarded-For（没有时为X-Real-IP），由客户端或代理填写，未经验证
+	Key       string    `json:"key,omitempty"`        // 使用的API密钥名称或客户端证书（cert:名称）
+	Method    string    `json:"method"`               // 请求方法
+	Path      string    `json:"path"`                 // 请求路径和查询参数
+	QueriedIP string    `json:"queried_ip,omitempty"` // 查询的IP，批量查询时以逗号分隔
+	Status    int       `json:"status"`               // 响应状态码
+	RequestID string    `json:"request_id,omitempty"` // 请求ID
+}
+
+// Query 读取审计日志的条件
+type Query struct {
+	Cursor int64  // 只返回ID小于Cursor的记录，不大于0时从最新的记录开始
+	Limit  int    // 最多返回的条数，不大于0时使用DefaultLimit
+	IP     string // 只返回查询了该IP的记录，批量查询中包含该IP的记录也会返回
+	Key    string // 只返回使用该API密钥的记录
+}
+
+// Log 只能追加的审计日志
+// 实现可以被多个goroutine并发使用。
+type Log interface {
+	// Append 追加一条记录，ID由审计日志分配，写入后回填到entry中
+	Append(ctx context.Context, entry *Entry) error
+	// List 按ID从大到小（从新到旧）返回符合条件的记录
+	List(ctx context.Context, q Query) ([]Entry, error)
+	// Prune 删除时间早于before的记录，返回删除的条数；这是唯一允许删除记录的操作，用于按保留时间清理
+	Prune(ctx context.Context, before time.Time) (int64, error)
+	// Close 关闭审计日志
+	Close() error
+}
+
+// Open 打开（必要时创建）审计日志
+// 以 postgres:// 或 postgresql:// 开头时写入PostgreSQL数据库，扩展名为 .db、.sqlite 或 .sqlite3 的文件按SQLite数据库打开，
+// 其他文件按JSON Lines格式追加写入。
+//
+// 参数:
+//   - path: 审计日志路径或PostgreSQL连接地址
+//
+// 返回:
+//   - Log: 打开的审计日志
+//   - error: 如果无法打开或初始化则返回相应错误
+func Open(path string) (Log, error) {
+	if isPostgresDSN(path) {
+		return openPostgres(path)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".db", ".sqlite", ".sqlite3":
+		return openSQLite(path)
+	default:
+		return openFile(path)
+	}
+}
+
+// matches 判断记录是否符合查询条件（不包括Cursor和Limit）
+func (q Query) matches(e *Entry) bool {
+	if q.Key != "" && e.Key != q.Key {
+		return false
+	}
+	if q.IP == "" {
+		return true
+	}
+	for _, ip := range strings.Split(e.QueriedIP, ",") {
+		if ip == q.IP {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize 返回将Limit限制在1到MaxLimit之间的查询条件
+func (q Query) normalize() Query {
+	if q.Limit <= 0 {
+		q.Limit = DefaultLimit
+	}
+	if q.Limit > MaxLimit {
+		q.Limit = MaxLimit
+	}
+	return q
+}
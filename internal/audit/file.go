@@ -0,0 +1,190 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// fileLog JSON Lines格式的审计日志，每行一条记录
+// 文件只以追加方式打开，除按保留时间清理外不会轮转或改写已有内容。
+type fileLog struct {
+	path string
+
+	mu     sync.Mutex
+	file   *os.File
+	nextID int64
+}
+
+// openFile 打开（必要时创建）JSON Lines格式的审计日志，从已有的最后一条记录继续编号
+func openFile(path string) (*fileLog, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("创建审计日志目录失败: %w", err)
+		}
+	}
+
+	l := &fileLog{path: path, nextID: 1}
+	err := l.scan(func(e *Entry) {
+		if e.ID >= l.nextID {
+			l.nextID = e.ID + 1
+		}
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("打开审计日志失败: %w", err)
+	}
+	l.file = file
+	return l, nil
+}
+
+// Append 追加一条记录
+func (l *fileLog) Append(ctx context.Context, entry *Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry.ID = l.nextID
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("序列化审计记录失败: %w", err)
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("写入审计日志失败: %w", err)
+	}
+	l.nextID++
+	return nil
+}
+
+// List 从头读取文件，保留符合条件的最新的Limit条记录
+func (l *fileLog) List(ctx context.Context, q Query) ([]Entry, error) {
+	q = q.normalize()
+
+	// 读取期间不阻塞写入：只读取到开始读取时已完整写入的记录
+	l.mu.Lock()
+	last := l.nextID - 1
+	l.mu.Unlock()
+
+	var entries []Entry
+	err := l.scan(func(e *Entry) {
+		if e.ID > last || (q.Cursor > 0 && e.ID >= q.Cursor) || !q.matches(e) {
+			return
+		}
+		entries = append(entries, *e)
+		if len(entries) > q.Limit {
+			entries = entries[1:]
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 文件中从旧到新排列，返回时从新到旧
+	result := make([]Entry, len(entries))
+	for i, e := range entries {
+		result[len(entries)-1-i] = e
+	}
+	return result, nil
+}
+
+// Prune 删除时间早于before的记录
+// 保留的记录写入临时文件后替换原文件，记录的ID不变；期间的写入等待清理完成。没有需要删除的记录时不改写文件。
+func (l *fileLog) Prune(ctx context.Context, before time.Time) (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	tmp := l.path + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return 0, fmt.Errorf("清理审计日志失败: %w", err)
+	}
+	defer os.Remove(tmp)
+	defer out.Close()
+
+	w := bufio.NewWriter(out)
+	var pruned int64
+	var writeErr error
+	err = l.scan(func(e *Entry) {
+		if e.Time.Before(before) {
+			pruned++
+			return
+		}
+		line, err := json.Marshal(e)
+		if err == nil {
+			_, err = w.Write(append(line, '\n'))
+		}
+		if err != nil && writeErr == nil {
+			writeErr = err
+		}
+	})
+	if err == nil {
+		err = writeErr
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		return 0, fmt.Errorf("清理审计日志失败: %w", err)
+	}
+	if pruned == 0 {
+		return 0, nil
+	}
+
+	if err := out.Close(); err != nil {
+		return 0, fmt.Errorf("清理审计日志失败: %w", err)
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return 0, fmt.Errorf("清理审计日志失败: %w", err)
+	}
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return 0, fmt.Errorf("重新打开审计日志失败: %w", err)
+	}
+	l.file.Close()
+	l.file = file
+	return pruned, nil
+}
+
+// Close 关闭文件
+func (l *fileLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// scan 依次读取文件中的每条记录
+// 末尾不完整的一行（写入过程中进程退出）被忽略，其他无法解析的行视为错误。
+func (l *fileLog) scan(fn func(e *Entry)) error {
+	file, err := os.Open(l.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for lineNo := 1; ; lineNo++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// 没有换行符结尾的内容是未写完的记录
+			return nil
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return fmt.Errorf("解析审计日志 %s 第%d行失败: %w", l.path, lineNo, err)
+		}
+		fn(&e)
+	}
+}
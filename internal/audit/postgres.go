@@ -0,0 +1,151 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // 以pgx名称注册的PostgreSQL驱动
+)
+
+// postgresSchema 审计日志在PostgreSQL中的表结构，打开数据库时自动创建
+// 与SQLite相同，触发器拒绝修改和删除已有记录，保证表只能追加；
+// 唯一的例外是Prune在同一事务中通过pong0.audit_prune_before设置的时间之前的记录。
+// forwarded列是后来增加的，通过ALTER TABLE添加到旧的表中。
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS audit_log (
+	id         BIGSERIAL PRIMARY KEY,
+	time       BIGINT    NOT NULL,
+	client     TEXT      NOT NULL,
+	key_name   TEXT      NOT NULL DEFAULT '',
+	method     TEXT      NOT NULL,
+	path       TEXT      NOT NULL,
+	queried_ip TEXT      NOT NULL DEFAULT '',
+	status     INTEGER   NOT NULL,
+	request_id TEXT      NOT NULL DEFAULT ''
+);
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS forwarded TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_audit_log_key ON audit_log (key_name, id);
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP = 'DELETE' AND OLD.time < coalesce(nullif(current_setting('pong0.audit_prune_before', true), ''), '0')::bigint THEN
+		RETURN OLD;
+	END IF;
+	RAISE EXCEPTION 'audit_log is append-only';
+END
+$$ LANGUAGE plpgsql;
+DO $$
+BEGIN
+	CREATE TRIGGER audit_log_append_only BEFORE UPDATE OR DELETE ON audit_log
+		FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+EXCEPTION WHEN duplicate_object THEN
+	NULL;
+END
+$$;
+`
+
+// postgresLog 基于PostgreSQL的审计日志，多个服务器副本可以写入同一个表
+type postgresLog struct {
+	db *sql.DB
+}
+
+// isPostgresDSN 判断是否是PostgreSQL连接地址（postgres://或postgresql://开头）
+func isPostgresDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")
+}
+
+// openPostgres 连接PostgreSQL数据库并创建审计日志表
+func openPostgres(dsn string) (*postgresLog, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("无效的PostgreSQL连接地址: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if _, err := db.ExecContext(ctx, postgresSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("初始化审计日志失败: %w", err)
+	}
+	return &postgresLog{db: db}, nil
+}
+
+// Append 追加一条记录
+func (l *postgresLog) Append(ctx context.Context, entry *Entry) error {
+	err := l.db.QueryRowContext(ctx,
+		`INSERT INTO audit_log (time, client, forwarded, key_name, method, path, queried_ip, status, request_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`,
+		entry.Time.UnixMilli(), entry.Client, entry.Forwarded, entry.Key, entry.Method, entry.Path, entry.QueriedIP, entry.Status, entry.RequestID).Scan(&entry.ID)
+	if err != nil {
+		return fmt.Errorf("写入审计日志失败: %w", err)
+	}
+	return nil
+}
+
+// List 按ID从大到小返回符合条件的记录
+// 批量查询的queried_ip以逗号分隔，按IP过滤时在两端补上逗号后比较，IP中的字符不会被当作LIKE通配符。
+func (l *postgresLog) List(ctx context.Context, q Query) ([]Entry, error) {
+	q = q.normalize()
+
+	cursor := q.Cursor
+	if cursor <= 0 {
+		cursor = 1<<63 - 1
+	}
+	rows, err := l.db.QueryContext(ctx,
+		`SELECT id, time, client, forwarded, key_name, method, path, queried_ip, status, request_id FROM audit_log
+		WHERE id < $1
+			AND ($2 = '' OR key_name = $2)
+			AND ($3 = '' OR strpos(',' || queried_ip || ',', ',' || $3 || ',') > 0)
+		ORDER BY id DESC LIMIT $4`,
+		cursor, q.Key, q.IP, q.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("读取审计日志失败: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []Entry{}
+	for rows.Next() {
+		var e Entry
+		var t int64
+		if err := rows.Scan(&e.ID, &t, &e.Client, &e.Forwarded, &e.Key, &e.Method, &e.Path, &e.QueriedIP, &e.Status, &e.RequestID); err != nil {
+			return nil, fmt.Errorf("读取审计日志失败: %w", err)
+		}
+		e.Time = time.UnixMilli(t)
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取审计日志失败: %w", err)
+	}
+	return entries, nil
+}
+
+// Prune 删除时间早于before的记录
+// set_config只对当前事务生效，触发器据此放行同一事务中过期记录的删除。
+func (l *postgresLog) Prune(ctx context.Context, before time.Time) (int64, error) {
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("清理审计日志失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	cutoff := before.UnixMilli()
+	if _, err := tx.ExecContext(ctx, `SELECT set_config('pong0.audit_prune_before', $1, true)`, strconv.FormatInt(cutoff, 10)); err != nil {
+		return 0, fmt.Errorf("清理审计日志失败: %w", err)
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM audit_log WHERE time < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("清理审计日志失败: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("清理审计日志失败: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// Close 关闭数据库连接
+func (l *postgresLog) Close() error {
+	return l.db.Close()
+}
@@ -0,0 +1,155 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite" // 纯Go实现的SQLite驱动，无需cgo
+)
+
+// sqliteSchema 审计日志的表结构，打开数据库时自动创建
+// 触发器拒绝修改和删除已有记录，保证表只能追加。
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS audit_log (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	time       INTEGER NOT NULL,
+	client     TEXT    NOT NULL,
+	key_name   TEXT    NOT NULL DEFAULT '',
+	method     TEXT    NOT NULL,
+	path       TEXT    NOT NULL,
+	queried_ip TEXT    NOT NULL DEFAULT '',
+	status     INTEGER NOT NULL,
+	request_id TEXT    NOT NULL DEFAULT '',
+	forwarded  TEXT    NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_audit_log_key ON audit_log (key_name, id);
+CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;
+` + sqliteNoDelete
+
+// sqliteNoDelete 拒绝删除记录的触发器，按保留时间清理时在同一事务中暂时删除
+const sqliteNoDelete = `
+CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;
+`
+
+// sqliteLog 基于SQLite的审计日志
+type sqliteLog struct {
+	db *sql.DB
+}
+
+// openSQLite 打开（必要时创建）SQLite审计日志
+func openSQLite(path string) (*sqliteLog, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("创建审计日志目录失败: %w", err)
+		}
+	}
+
+	// busy_timeout避免服务器并发写入时立即返回SQLITE_BUSY
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("打开审计日志失败: %w", err)
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("初始化审计日志失败: %w", err)
+	}
+
+	// forwarded列是后来增加的，旧的审计日志中没有这一列；添加列不会触发拒绝修改的触发器
+	var n int
+	err = db.QueryRow(`SELECT count(*) FROM pragma_table_info('audit_log') WHERE name = 'forwarded'`).Scan(&n)
+	if err == nil && n == 0 {
+		_, err = db.Exec(`ALTER TABLE audit_log ADD COLUMN forwarded TEXT NOT NULL DEFAULT ''`)
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("升级审计日志结构失败: %w", err)
+	}
+	return &sqliteLog{db: db}, nil
+}
+
+// Append 追加一条记录
+func (l *sqliteLog) Append(ctx context.Context, entry *Entry) error {
+	res, err := l.db.ExecContext(ctx,
+		`INSERT INTO audit_log (time, client, forwarded, key_name, method, path, queried_ip, status, request_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.Time.UnixMilli(), entry.Client, entry.Forwarded, entry.Key, entry.Method, entry.Path, entry.QueriedIP, entry.Status, entry.RequestID)
+	if err != nil {
+		return fmt.Errorf("写入审计日志失败: %w", err)
+	}
+	if entry.ID, err = res.LastInsertId(); err != nil {
+		return fmt.Errorf("写入审计日志失败: %w", err)
+	}
+	return nil
+}
+
+// List 按ID从大到小返回符合条件的记录
+// 批量查询的queried_ip以逗号分隔，按IP过滤时在两端补上逗号后匹配。
+func (l *sqliteLog) List(ctx context.Context, q Query) ([]Entry, error) {
+	q = q.normalize()
+
+	cursor := q.Cursor
+	if cursor <= 0 {
+		cursor = 1<<63 - 1
+	}
+	rows, err := l.db.QueryContext(ctx,
+		`SELECT id, time, client, forwarded, key_name, method, path, queried_ip, status, request_id FROM audit_log
+		WHERE id < ?
+			AND (? = '' OR key_name = ?)
+			AND (? = '' OR ',' || queried_ip || ',' LIKE '%,' || ? || ',%')
+		ORDER BY id DESC LIMIT ?`,
+		cursor, q.Key, q.Key, q.IP, q.IP, q.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("读取审计日志失败: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []Entry{}
+	for rows.Next() {
+		var e Entry
+		var t int64
+		if err := rows.Scan(&e.ID, &t, &e.Client, &e.Forwarded, &e.Key, &e.Method, &e.Path, &e.QueriedIP, &e.Status, &e.RequestID); err != nil {
+			return nil, fmt.Errorf("读取审计日志失败: %w", err)
+		}
+		e.Time = time.UnixMilli(t)
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取审计日志失败: %w", err)
+	}
+	return entries, nil
+}
+
+// Prune 删除时间早于before的记录
+// 在一个事务中先删除拒绝删除的触发器，删除过期记录后重新创建，其他连接在此期间看不到没有触发器的表。
+func (l *sqliteLog) Prune(ctx context.Context, before time.Time) (int64, error) {
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("清理审计日志失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DROP TRIGGER IF EXISTS audit_log_no_delete`); err != nil {
+		return 0, fmt.Errorf("清理审计日志失败: %w", err)
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM audit_log WHERE time < ?`, before.UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("清理审计日志失败: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, sqliteNoDelete); err != nil {
+		return 0, fmt.Errorf("清理审计日志失败: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("清理审计日志失败: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// Close 关闭数据库
+func (l *sqliteLog) Close() error {
+	return l.db.Close()
+}
@@ -0,0 +1,189 @@
+// Package auth implements multi-key authentication for the Pong0 API server.
+// Each API key has a name, an optional daily quota and an optional list of
+// client addresses allowed to use it, so that one server instance can be shared
+// between several teams.
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"ping0/internal/models"
+)
+
+// Key 一个API密钥及其限制
+type Key struct {
+	Name       string   `yaml:"name"`        // 密钥名称，用于日志和区分使用方
+	Key        string   `yaml:"key"`         // 密钥值，客户端通过 Authorization: Bearer 头发送
+	DailyQuota int      `yaml:"daily_quota"` // 每天（UTC）允许的查询次数，0表示不限制
+	AllowedIPs []string `yaml:"allowed_ips"` // 允许使用该密钥的客户端IP或CIDR网段，为空时不限制
+	Redact     []string `yaml:"redact"`      // 响应中清空值的字段（JSON字段名），字段名列在redacted_fields中
+	Omit       []string `yaml:"omit"`        // 从响应中完全移除的字段（JSON字段名）
+
+	nets []*net.IPNet // 解析后的AllowedIPs
+}
+
+// Keyring 保存全部API密钥及其当天的用量
+// 用量只保存在内存中，服务器重启后重新计数。
+type Keyring struct {
+	keys map[string]*Key
+
+	mu    sync.Mutex
+	day   string         // 当前用量所属的日期（UTC）
+	usage map[string]int // 每个密钥当天已使用的查询次数
+	now   func() time.Time
+}
+
+// NewKeyring 创建密钥集合，并检查密钥的有效性
+//
+// 参数:
+//   - keys: 密钥列表
+//
+// 返回:
+//   - *Keyring: 新创建的密钥集合
+//   - error: 如果密钥为空、重复、AllowedIPs无法解析或Redact、Omit中有未知字段则返回相应错误
+func NewKeyring(keys []*Key) (*Keyring, error) {
+	k := &Keyring{
+		keys:  make(map[string]*Key, len(keys)),
+		usage: make(map[string]int),
+		now:   time.Now,
+	}
+
+	for i, key := range keys {
+		if key.Key == "" {
+			return nil, fmt.Errorf("第 %d 个API密钥的key为空", i+1)
+		}
+		if key.Name == "" {
+			key.Name = fmt.Sprintf("key-%d", i+1)
+		}
+		if _, ok := k.keys[key.Key]; ok {
+			return nil, fmt.Errorf("API密钥 %s 的key与其他密钥重复", key.Name)
+		}
+		if key.DailyQuota < 0 {
+			return nil, fmt.Errorf("API密钥 %s 的daily_quota不能为负数", key.Name)
+		}
+
+		key.nets = nil
+		for _, allowed := range key.AllowedIPs {
+			ipNet, err := parseNet(allowed)
+			if err != nil {
+				return nil, fmt.Errorf("API密钥 %s 的allowed_ips无效: %w", key.Name, err)
+			}
+			key.nets = append(key.nets, ipNet)
+		}
+		if err := models.CheckFields(key.Redact); err != nil {
+			return nil, fmt.Errorf("API密钥 %s 的redact无效: %w", key.Name, err)
+		}
+		if err := models.CheckFields(key.Omit); err != nil {
+			return nil, fmt.Errorf("API密钥 %s 的omit无效: %w", key.Name, err)
+		}
+
+		k.keys[key.Key] = key
+	}
+
+	return k, nil
+}
+
+// parseNet 将IP地址或CIDR网段解析为网段，单个IP视为只包含该地址的网段
+func parseNet(s string) (*net.IPNet, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		_, ipNet, err := net.ParseCIDR(s)
+		return ipNet, err
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("无法解析IP地址: %s", s)
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// Len 返回密钥数量
+func (k *Keyring) Len() int {
+	return len(k.keys)
+}
+
+// Lookup 根据密钥值查找密钥
+//
+// 参数:
+//   - token: 客户端发送的密钥值
+//
+// 返回:
+//   - *Key: 找到的密钥，不存在时返回nil
+func (k *Keyring) Lookup(token string) *Key {
+	if token == "" {
+		return nil
+	}
+	// 逐个以固定时间比较全部密钥，找到后也不提前返回，避免通过响应时间猜测密钥
+	var found *Key
+	for value, key := range k.keys {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(value)) == 1 {
+			found = key
+		}
+	}
+	return found
+}
+
+// Allows 检查客户端IP是否在密钥允许的范围内
+//
+// 参数:
+//   - clientIP: 客户端IP地址
+//
+// 返回:
+//   - bool: 未设置AllowedIPs或客户端IP在允许的网段内时返回true
+func (key *Key) Allows(clientIP string) bool {
+	if len(key.nets) == 0 {
+		return true
+	}
+
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range key.nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Use 尝试为密钥消耗n次当天的查询配额，配额不足时不消耗
+//
+// 参数:
+//   - key: 要消耗配额的密钥
+//   - n: 本次请求包含的查询次数
+//
+// 返回:
+//   - bool: 是否允许本次请求
+//   - time.Duration: 不允许时，距离配额重置（下一个UTC零点）的时间
+func (k *Keyring) Use(key *Key, n int) (bool, time.Duration) {
+	if key.DailyQuota == 0 {
+		return true, 0
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := k.now().UTC()
+	if day := now.Format("2006-01-02"); day != k.day {
+		k.day = day
+		k.usage = make(map[string]int)
+	}
+
+	if k.usage[key.Key]+n > key.DailyQuota {
+		midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+		return false, midnight.Sub(now)
+	}
+
+	k.usage[key.Key] += n
+	return true, 0
+}
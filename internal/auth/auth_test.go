@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeyAllows(t *testing.T) {
+	k, err := NewKeyring([]*Key{
+		{Name: "open", Key: "k-open"},
+		{Name: "office", Key: "k-office", AllowedIPs: []string{"203.0.113.7", "10.0.0.0/8", "2001:db8::/32"}},
+	})
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+
+	open := k.Lookup("k-open")
+	if !open.Allows("198.51.100.1") || !open.Allows("not-an-ip") {
+		t.Error("未设置allowed_ips的密钥应允许任意客户端")
+	}
+
+	office := k.Lookup("k-office")
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"203.0.113.7", true},
+		{"203.0.113.8", false},
+		{"10.1.2.3", true},
+		{"11.0.0.1", false},
+		{"::ffff:10.1.2.3", true},
+		{"2001:db8::1", true},
+		{"2001:db9::1", false},
+		{"", false},
+		{"10.1.2.3:443", false},
+	}
+	for _, tt := range tests {
+		if got := office.Allows(tt.ip); got != tt.want {
+			t.Errorf("Allows(%q) = %v, 期望 %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestNewKeyringInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []*Key
+	}{
+		{"空key", []*Key{{Name: "a"}}},
+		{"重复key", []*Key{{Key: "x"}, {Key: "x"}}},
+		{"负数配额", []*Key{{Key: "x", DailyQuota: -1}}},
+		{"无效网段", []*Key{{Key: "x", AllowedIPs: []string{"10.0.0.0/33"}}}},
+		{"无效地址", []*Key{{Key: "x", AllowedIPs: []string{"10.0.0"}}}},
+		{"未知字段", []*Key{{Key: "x", Redact: []string{"no_such_field"}}}},
+	}
+	for _, tt := range tests {
+		if _, err := NewKeyring(tt.keys); err == nil {
+			t.Errorf("%s: 期望返回错误", tt.name)
+		}
+	}
+}
+
+func TestKeyringUseQuota(t *testing.T) {
+	k, err := NewKeyring([]*Key{
+		{Name: "limited", Key: "k-limited", DailyQuota: 3},
+		{Name: "other", Key: "k-other", DailyQuota: 3},
+		{Name: "unlimited", Key: "k-unlimited"},
+	})
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+
+	now := time.Date(2024, 5, 1, 23, 59, 30, 0, time.UTC)
+	k.now = func() time.Time { return now }
+
+	limited := k.Lookup("k-limited")
+	if ok, _ := k.Use(limited, 2); !ok {
+		t.Fatal("第一次使用应当允许")
+	}
+	// 超出配额的请求不消耗配额
+	ok, retry := k.Use(limited, 2)
+	if ok {
+		t.Fatal("超出配额的请求应当拒绝")
+	}
+	if retry != 30*time.Second {
+		t.Errorf("重置时间 = %v, 期望 30s", retry)
+	}
+	if ok, _ := k.Use(limited, 1); !ok {
+		t.Error("剩余的配额应当可用")
+	}
+	if ok, _ := k.Use(limited, 1); ok {
+		t.Error("配额用完后应当拒绝")
+	}
+
+	// 各密钥的用量互不影响
+	if ok, _ := k.Use(k.Lookup("k-other"), 3); !ok {
+		t.Error("其他密钥的配额不应被占用")
+	}
+	if ok, _ := k.Use(k.Lookup("k-unlimited"), 1000); !ok {
+		t.Error("不限配额的密钥应当始终允许")
+	}
+
+	// 过了UTC零点后用量重新计数
+	now = now.Add(time.Minute)
+	if ok, _ := k.Use(limited, 3); !ok {
+		t.Error("新的一天应当重置配额")
+	}
+	if ok, _ := k.Use(limited, 1); ok {
+		t.Error("新的一天的配额用完后应当拒绝")
+	}
+}
+
+func TestKeyringUseLocalTime(t *testing.T) {
+	k, err := NewKeyring([]*Key{{Key: "k", DailyQuota: 1}})
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	key := k.Lookup("k")
+
+	// 配额按UTC日期重置，与本地时区无关：东八区的次日凌晨仍是UTC的同一天
+	shanghai := time.FixedZone("CST", 8*3600)
+	now := time.Date(2024, 5, 1, 20, 0, 0, 0, shanghai)
+	k.now = func() time.Time { return now }
+
+	if ok, _ := k.Use(key, 1); !ok {
+		t.Fatal("第一次使用应当允许")
+	}
+	now = time.Date(2024, 5, 2, 7, 0, 0, 0, shanghai)
+	ok, retry := k.Use(key, 1)
+	if ok {
+		t.Error("UTC日期未变，配额不应重置")
+	}
+	if retry != time.Hour {
+		t.Errorf("重置时间 = %v, 期望 1h", retry)
+	}
+	now = now.Add(time.Hour)
+	if ok, _ := k.Use(key, 1); !ok {
+		t.Error("UTC零点后配额应当重置")
+	}
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	_ "modernc.org/sqlite" // 纯Go实现的SQLite驱动，无需cgo
+)
+
+// keysFile API密钥文件的结构
+type keysFile struct {
+	Keys []*Key `yaml:"keys"`
+}
+
+// Load 从YAML文件或SQLite数据库加载API密钥
+// 扩展名为 .db、.sqlite 或 .sqlite3 的文件按SQLite数据库读取api_keys表，其他文件按YAML解析。
+//
+// 参数:
+//   - path: 密钥文件路径
+//
+// 返回:
+//   - *Keyring: 加载的密钥集合
+//   - error: 如果文件无法读取、格式错误或不包含任何密钥则返回相应错误
+func Load(path string) (*Keyring, error) {
+	var keys []*Key
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".db", ".sqlite", ".sqlite3":
+		keys, err = loadSQLite(path)
+	default:
+		keys, err = loadYAML(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("API密钥文件 %s 中没有任何密钥", path)
+	}
+	return NewKeyring(keys)
+}
+
+// loadYAML 从YAML文件读取密钥列表
+func loadYAML(path string) ([]*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取API密钥文件失败: %w", err)
+	}
+
+	var f keysFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("解析API密钥文件 %s 失败: %w", path, err)
+	}
+	return f.Keys, nil
+}
+
+// loadSQLite 从SQLite数据库的api_keys表读取密钥列表
+// 表结构为 api_keys(name TEXT, key TEXT, daily_quota INTEGER, allowed_ips TEXT)，
+// allowed_ips中的多个IP或网段以逗号分隔。表中还可以有可选的redact和omit列（TEXT），
+// 其中的多个字段名同样以逗号分隔。
+func loadSQLite(path string) ([]*Key, error) {
+	// 数据库必须已经存在，避免路径写错时静默创建一个空数据库
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("打开API密钥数据库失败: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("打开API密钥数据库失败: %w", err)
+	}
+	defer db.Close()
+
+	// redact和omit列是后来增加的，旧的数据库中没有这两列
+	policy := `'', ''`
+	var n int
+	err = db.QueryRow(`SELECT count(*) FROM pragma_table_info('api_keys') WHERE name IN ('redact', 'omit')`).Scan(&n)
+	if err != nil {
+		return nil, fmt.Errorf("读取API密钥失败: %w", err)
+	}
+	if n == 2 {
+		policy = `redact, omit`
+	}
+
+	rows, err := db.Query(`SELECT name, key, daily_quota, allowed_ips, ` + policy + ` FROM api_keys`)
+	if err != nil {
+		return nil, fmt.Errorf("读取API密钥失败: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []*Key
+	for rows.Next() {
+		var name, allowed, redact, omit sql.NullString
+		var quota sql.NullInt64
+		key := &Key{}
+		if err := rows.Scan(&name, &key.Key, &quota, &allowed, &redact, &omit); err != nil {
+			return nil, fmt.Errorf("读取API密钥失败: %w", err)
+		}
+		key.Name = name.String
+		key.DailyQuota = int(quota.Int64)
+		key.AllowedIPs = splitList(allowed.String)
+		key.Redact = splitList(redact.String)
+		key.Omit = splitList(omit.String)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取API密钥失败: %w", err)
+	}
+	return keys, nil
+}
+
+// splitList 将逗号分隔的列表拆分为去除空白的非空元素
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
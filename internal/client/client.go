@@ -5,229 +5,202 @@ package client
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
-	"strings"
-	"time"
 
-	"ping0/internal/constants"
+	"ping0/internal/config"
+	perrors "ping0/internal/errors"
 	"ping0/internal/parser"
-
-	"github.com/PuerkitoBio/goquery"
 )
 
-// 全局HTTP客户端实例，用于在整个应用程序中复用
-var httpClient *http.Client
+// Session 表示与Ping0.cc之间的一次独立会话
+// 每个Session拥有自己的HTTP客户端和cookie jar，互不共享状态，
+// 因此多个查询可以各自创建Session并安全地并发执行。
+type Session struct {
+	cfg        *config.Config // 运行时配置
+	httpClient *http.Client   // 会话专用的HTTP客户端
+	headers    HeaderProfile  // 请求使用的浏览器请求头
+	log        *slog.Logger   // 带组件标签的日志记录器
+	responses  []Response     // 配置了DumpDir时记录的响应
+
+	savedJs1key string // 从cookie文件加载的js1key
+	savedPow    string // 从cookie文件加载的pow
+}
 
-// init 初始化HTTP客户端，配置cookie存储和超时设置
-func init() {
+// NewSession 创建一个新的会话，配置独立的cookie存储和超时设置
+// 配置中有共享的传输层时复用其中的连接，否则为会话单独创建传输层；
+// 配置了CookieFile时，cookie jar的初始内容从该文件加载。
+//
+// 参数:
+//   - cfg: 运行时配置
+//
+// 返回:
+//   - *Session: 新创建的会话
+//   - error: 如果创建cookie jar失败则返回相应错误
+func NewSession(cfg *config.Config) (*Session, error) {
 	// 创建cookie jar以管理会话cookie
 	jar, err := cookiejar.New(nil)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("创建cookie jar失败: %w", err)
 	}
 
-	// 初始化全局HTTP客户端，设置cookie jar和超时时间
-	httpClient = &http.Client{
-		Jar:     jar,
-		Timeout: 10 * time.Second,
+	// 优先使用共享的传输层复用连接，未配置时为本次会话单独创建
+	transport := cfg.Transport
+	if transport == nil {
+		transport, err = NewTransport(cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.TracerProvider != nil {
+		transport = tracedTransport{tracer: cfg.Tracer(), next: transport}
+	}
+
+	// 启用请求头随机化时，每个会话使用不同的请求头
+	headers := profileFor(cfg)
+	if cfg.HeaderJitter {
+		headers = jitterProfile(headers)
 	}
+
+	s := &Session{
+		cfg:     cfg,
+		log:     cfg.Log("client"),
+		headers: headers,
+		httpClient: &http.Client{
+			Jar:       jar,
+			Timeout:   cfg.RequestTimeout(),
+			Transport: transport,
+		},
+	}
+
+	// 加载上次运行保存的cookie，文件无效时从空的cookie jar开始
+	if cfg.CookieFile != "" {
+		if err := s.loadCookies(); err != nil {
+			s.log.Warn("加载cookie文件失败", "path", cfg.CookieFile, "error", err)
+		}
+	}
+	return s, nil
+}
+
+// newProxyFunc 根据配置创建代理选择函数
+// 如果配置了代理地址则所有请求都通过该代理发送，
+// 否则使用HTTP_PROXY、HTTPS_PROXY、NO_PROXY等标准环境变量。
+//
+// 参数:
+//   - cfg: 运行时配置
+//
+// 返回:
+//   - func(*http.Request) (*url.URL, error): 供http.Transport使用的代理函数
+//   - error: 如果代理地址无效则返回相应错误
+func newProxyFunc(cfg *config.Config) (func(*http.Request) (*url.URL, error), error) {
+	if cfg.Proxy == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+
+	proxyURL, err := url.Parse(cfg.Proxy)
+	if err != nil {
+		return nil, fmt.Errorf("无效的代理地址: %w", err)
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("不支持的代理协议: %s（支持http、https、socks5）", proxyURL.Scheme)
+	}
+
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("无效的代理地址: 缺少主机名")
+	}
+
+	cfg.Log("client").Debug("使用代理", "scheme", proxyURL.Scheme, "host", proxyURL.Host)
+
+	return http.ProxyURL(proxyURL), nil
 }
 
 // GetInitialPage 获取初始页面并提取关键参数
 // 该函数向Ping0.cc发送初始请求，并从响应中提取x1参数、difficulty参数和JavaScript路径，
-// 这些参数对于后续请求是必需的。
+// 这些参数对于后续请求是必需的。手动指定的参数替换页面中的对应值，初始页面仍然会被请求，以获得会话cookie。
+//
+// 参数:
+//   - ctx: 请求上下文，取消后请求会立即中止
+//   - override: 手动指定的x1值和difficulty值（见parser.ResolveChallengeParams），为nil时全部来自页面
 //
 // 返回:
-//   - string: 提取的x1值，用于生成访问密钥
-//   - string: 提取的difficulty值，用于生成访问密钥
-//   - string: JavaScript文件路径，用于解析生成密钥的算法
+//   - *parser.ChallengeParams: 用于生成访问密钥的x1值、difficulty值和JavaScript路径
 //   - error: 如果请求失败或解析失败则返回相应错误
-func GetInitialPage() (string, string, string, error) {
-	// 如果在服务器模式下，每次创建新的HTTP客户端，避免会话状态问题
-	if constants.ServerMode {
-		resetHTTPClient()
-	}
+func (s *Session) GetInitialPage(ctx context.Context, override *parser.ChallengeParams) (*parser.ChallengeParams, error) {
+	cfg := s.cfg
+	log := s.log
 
 	// 创建带超时的上下文
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, cfg.RequestTimeout())
 	defer cancel()
 
 	// 创建初始请求
-	req, err := http.NewRequestWithContext(ctx, "GET", constants.BaseURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", cfg.BaseURL, nil)
 	if err != nil {
-		return "", "", "", fmt.Errorf("创建请求失败: %w", err)
+		return nil, fmt.Errorf("创建请求失败: %w", err)
 	}
 
 	// 设置请求头
-	req.Header.Set("User-Agent", constants.UserAgent)
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7")
-	req.Header.Set("Accept-Language", "zh-CN,zh;q=0.9,en;q=0.8")
-	req.Header.Set("Cache-Control", "no-cache")
-	req.Header.Set("Connection", "keep-alive")
-	req.Header.Set("Pragma", "no-cache")
-	req.Header.Set("Sec-Ch-Ua", `"Chromium";v="122", "Not(A:Brand";v="24", "Google Chrome";v="122"`)
-	req.Header.Set("Sec-Ch-Ua-Mobile", "?0")
-	req.Header.Set("Sec-Ch-Ua-Platform", `"Windows"`)
-	req.Header.Set("Sec-Fetch-Dest", "document")
-	req.Header.Set("Sec-Fetch-Mode", "navigate")
-	req.Header.Set("Sec-Fetch-Site", "none")
-	req.Header.Set("Sec-Fetch-User", "?1")
-	req.Header.Set("Upgrade-Insecure-Requests", "1")
-
-	if constants.Verbose {
-		log.Printf("请求初始页面: %s", constants.BaseURL)
-		log.Printf("请求头:")
-		for k, v := range req.Header {
-			log.Printf("- %s: %s", k, v)
-		}
-	}
+	setBrowserHeaders(req, s.headers)
+
+	log.Debug("请求初始页面", "url", cfg.BaseURL, "headers", req.Header)
 
 	// 发送请求
-	resp, err := httpClient.Do(req)
+	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return "", "", "", fmt.Errorf("请求失败: %w", err)
+		return nil, classifyRequestError(fmt.Errorf("请求失败: %w", err))
 	}
 	defer resp.Body.Close()
 
-	if constants.Verbose {
-		log.Printf("响应状态码: %d", resp.StatusCode)
-		log.Printf("响应头:")
-		for k, v := range resp.Header {
-			log.Printf("- %s: %s", k, v)
-		}
+	log.Debug("收到初始页面响应", "status", resp.StatusCode, "headers", resp.Header)
+
+	if err := checkStatus(resp); err != nil {
+		return nil, err
 	}
 
 	// 读取响应内容
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", "", "", fmt.Errorf("读取响应失败: %w", err)
+		return nil, classifyRequestError(fmt.Errorf("读取响应失败: %w", err))
 	}
+	s.record(ResponseInitial, resp, body)
 
-	if constants.Verbose {
-		log.Printf("响应内容长度: %d", len(body))
-	}
-
-	// 如果提供了手动x1值，直接返回
-	if constants.ManualX1Value != "" {
-		if constants.Verbose {
-			log.Printf("使用手动指定的x1值: %s\n", constants.ManualX1Value)
-		}
+	log.Debug("读取初始页面完成", "length", len(body))
 
-		// 获取手动指定的difficulty值或使用默认值（x1的前3位）
-		difficultyValue := constants.ManualDiffValue
-		if difficultyValue == "" {
-			difficultyValue = constants.ManualX1Value[:3]
-			if constants.Verbose {
-				log.Printf("未指定difficulty值，使用x1值的前3个字符作为默认值: %s\n", difficultyValue)
-			}
-		} else {
-			if constants.Verbose {
-				log.Printf("使用手动指定的difficulty值: %s\n", difficultyValue)
-			}
-		}
-
-		return constants.ManualX1Value, difficultyValue, "/js/main.js", nil
+	if override != nil {
+		log.Debug("使用手动指定的验证参数", "x1", override.X1, "difficulty", override.Difficulty)
 	}
 
-	// 使用goquery解析HTML
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(body)))
+	// 提取x1值、difficulty值和JS路径
+	params, err := parser.ResolveChallengeParams(string(body), override)
 	if err != nil {
-		return "", "", "", fmt.Errorf("解析HTML失败: %w", err)
-	}
-
-	// 提取x1值和difficulty值
-	var x1Value, difficultyValue string
-	doc.Find("script").Each(func(i int, s *goquery.Selection) {
-		content := s.Text()
-		if strings.Contains(content, "window.x1") {
-			// 使用字符串函数提取x1值
-			x1Start := strings.Index(content, "window.x1 = '") + 13
-			if x1Start == 12 { // not found
-				x1Start = strings.Index(content, `window.x1 = "`) + 13
-			}
-			if x1Start > 12 { // found
-				x1End := strings.Index(content[x1Start:], "'")
-				if x1End == -1 {
-					x1End = strings.Index(content[x1Start:], `"`)
-				}
-				if x1End > 0 {
-					x1Value = content[x1Start : x1Start+x1End]
-					if constants.Verbose {
-						log.Printf("找到x1值: %s", x1Value)
-					}
-				}
-			}
-		}
-		if strings.Contains(content, "window.difficulty") {
-			// 使用字符串函数提取difficulty值
-			diffStart := strings.Index(content, "window.difficulty = '") + 21
-			if diffStart == 20 { // not found
-				diffStart = strings.Index(content, `window.difficulty = "`) + 21
-			}
-			if diffStart > 20 { // found
-				diffEnd := strings.Index(content[diffStart:], "'")
-				if diffEnd == -1 {
-					diffEnd = strings.Index(content[diffStart:], `"`)
-				}
-				if diffEnd > 0 {
-					difficultyValue = content[diffStart : diffStart+diffEnd]
-					if constants.Verbose {
-						log.Printf("找到difficulty值: %s", difficultyValue)
-					}
-				}
-			}
-		}
-	})
-
-	if x1Value == "" {
-		if constants.Verbose {
-			// 打印响应内容的前200个字符作为预览
+		// 记录响应内容的前200个字符作为预览
+		if log.Enabled(ctx, slog.LevelDebug) {
 			preview := string(body)
 			if len(preview) > 200 {
 				preview = preview[:200] + "..."
 			}
-			log.Printf("无法找到x1值，响应内容预览: %s", preview)
+			log.Debug("无法提取验证参数", "error", err, "preview", preview)
 		}
-		return "", "", "", fmt.Errorf("未找到x1值")
+		return nil, err
 	}
+	log.Debug("提取到验证参数", "x1", params.X1, "difficulty", params.Difficulty, "js_path", params.JSPath)
 
-	if difficultyValue == "" {
-		if constants.Verbose {
-			log.Printf("未找到difficulty值，使用x1值的前3个字符作为默认值")
-		}
-		// 使用x1值的前3个字符作为默认difficulty值
-		if len(x1Value) >= 3 {
-			difficultyValue = x1Value[:3]
-		} else {
-			return "", "", "", fmt.Errorf("无法设置默认difficulty值")
-		}
+	// 手动指定x1值时页面可能没有脚本路径，只记录页面中确实出现的路径
+	if override == nil || override.X1 == "" {
+		observeJSPath(cfg, log, params.JSPath)
+		s.prefetchScript(params.JSPath)
 	}
 
-	// 查找js路径
-	jsPath := "/js/main.js"
-	doc.Find("script[src]").Each(func(i int, s *goquery.Selection) {
-		src, exists := s.Attr("src")
-		if exists && strings.Contains(src, "main.js") {
-			jsPath = src
-			if constants.Verbose {
-				log.Printf("找到JS路径: %s", jsPath)
-			}
-		}
-	})
-
-	if jsPath == "" {
-		if constants.Verbose {
-			log.Printf("使用默认的JS路径: /js/main.js")
-		}
-		jsPath = "/js/main.js"
-	}
-
-	return x1Value, difficultyValue, jsPath, nil
+	return params, nil
 }
 
 // GetFinalPage 获取最终页面
@@ -235,29 +208,30 @@ func GetInitialPage() (string, string, string, error) {
 // 获取包含IP信息的最终页面。
 //
 // 参数:
+//   - ctx: 请求上下文，取消后请求会立即中止
+//   - queryIP: 要查询的IP地址，为空时查询当前IP
 //   - keys: 包含js1key和pow值的结构体
 //
 // 返回:
 //   - string: 获取的HTML内容
 //   - error: 如果请求失败则返回相应错误
-func GetFinalPage(keys *parser.Keys) (string, error) {
+func (s *Session) GetFinalPage(ctx context.Context, queryIP string, keys *parser.Keys) (string, error) {
+	cfg := s.cfg
+	log := s.log
+
 	// 创建带超时的上下文
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, cfg.RequestTimeout())
 	defer cancel()
 
 	// 构建请求URL
-	reqURL := constants.BaseURL
-	if constants.QueryIP != "" {
+	reqURL := cfg.BaseURL
+	if queryIP != "" {
 		// 如果指定了IP，使用/ip/路径
-		reqURL = fmt.Sprintf("%s/ip/%s", constants.BaseURL, constants.QueryIP)
-		if constants.Verbose {
-			log.Printf("使用特定IP查询URL: %s", reqURL)
-		}
+		reqURL = fmt.Sprintf("%s/ip/%s", cfg.BaseURL, queryIP)
+		log.Debug("使用特定IP查询URL", "url", reqURL)
 	} else {
 		// 未指定IP，直接使用基础URL
-		if constants.Verbose {
-			log.Printf("使用当前IP查询URL: %s", reqURL)
-		}
+		log.Debug("使用当前IP查询URL", "url", reqURL)
 	}
 
 	// 创建请求
@@ -267,32 +241,14 @@ func GetFinalPage(keys *parser.Keys) (string, error) {
 	}
 
 	// 设置请求头
-	req.Header.Set("User-Agent", constants.UserAgent)
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7")
-	req.Header.Set("Accept-Language", "zh-CN,zh;q=0.9,en;q=0.8")
-	req.Header.Set("Cache-Control", "no-cache")
-	req.Header.Set("Connection", "keep-alive")
-	req.Header.Set("Pragma", "no-cache")
-	req.Header.Set("Sec-Ch-Ua", `"Chromium";v="122", "Not(A:Brand";v="24", "Google Chrome";v="122"`)
-	req.Header.Set("Sec-Ch-Ua-Mobile", "?0")
-	req.Header.Set("Sec-Ch-Ua-Platform", `"Windows"`)
-	req.Header.Set("Sec-Fetch-Dest", "document")
-	req.Header.Set("Sec-Fetch-Mode", "navigate")
-	req.Header.Set("Sec-Fetch-Site", "none")
-	req.Header.Set("Sec-Fetch-User", "?1")
-	req.Header.Set("Upgrade-Insecure-Requests", "1")
-	req.Header.Set("Referer", constants.BaseURL)
-
-	if constants.Verbose {
-		log.Printf("请求头:")
-		for k, v := range req.Header {
-			log.Printf("- %s: %s", k, v)
-		}
-	}
+	setBrowserHeaders(req, s.headers)
+	req.Header.Set("Referer", cfg.BaseURL)
+
+	log.Debug("请求最终页面", "url", reqURL, "headers", req.Header)
 
 	// 设置cookie：同时设置js1key和pow
-	u, _ := url.Parse(constants.BaseURL)
-	httpClient.Jar.SetCookies(u, []*http.Cookie{
+	u, _ := url.Parse(cfg.BaseURL)
+	s.httpClient.Jar.SetCookies(u, []*http.Cookie{
 		{
 			Name:  "js1key",
 			Value: keys.Js1key,
@@ -303,95 +259,65 @@ func GetFinalPage(keys *parser.Keys) (string, error) {
 		},
 	})
 
-	if constants.Verbose {
-		log.Printf("设置Cookie: js1key=%s, pow=%s", keys.Js1key, keys.Pow)
-		cookies := httpClient.Jar.Cookies(u)
-		log.Printf("当前所有Cookie:")
-		for _, cookie := range cookies {
-			log.Printf("- %s=%s", cookie.Name, cookie.Value)
-		}
-	}
+	log.Debug("设置Cookie", "js1key", keys.Js1key, "pow", keys.Pow, "cookies", s.httpClient.Jar.Cookies(u))
 
 	// 发送请求
-	resp, err := httpClient.Do(req)
+	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("请求失败: %w", err)
+		return "", classifyRequestError(fmt.Errorf("请求失败: %w", err))
 	}
 	defer resp.Body.Close()
 
-	if constants.Verbose {
-		log.Printf("响应状态码: %d", resp.StatusCode)
-		log.Printf("响应头:")
-		for k, v := range resp.Header {
-			log.Printf("- %s: %s", k, v)
-		}
+	log.Debug("收到最终页面响应", "status", resp.StatusCode, "headers", resp.Header)
+
+	if err := checkStatus(resp); err != nil {
+		return "", err
 	}
 
 	// 读取响应内容
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("读取响应失败: %w", err)
+		return "", classifyRequestError(fmt.Errorf("读取响应失败: %w", err))
 	}
+	s.record(ResponseFinal, resp, body)
 
-	if constants.Verbose {
-		log.Printf("响应内容长度: %d", len(body))
-		if len(body) > 0 {
-			// 打印前100个字符作为预览
-			preview := string(body)
-			if len(preview) > 100 {
-				preview = preview[:100] + "..."
-			}
-			log.Printf("响应内容预览: %s", preview)
+	if log.Enabled(ctx, slog.LevelDebug) {
+		// 记录前100个字符作为预览
+		preview := string(body)
+		if len(preview) > 100 {
+			preview = preview[:100] + "..."
 		}
+		log.Debug("读取最终页面完成", "length", len(body), "preview", preview)
 	}
 
 	return string(body), nil
 }
 
-// extractX1Value 从HTML中提取x1值
-func extractX1Value(html string) string {
-	// 查找x1值
-	start := strings.Index(html, `var x1 = "`)
-	if start == -1 {
-		return ""
+// checkStatus 检查上游响应的状态码
+// 403和451表示请求被拒绝（通常是出口IP被封禁），429表示请求过于频繁，
+// 其他4xx和5xx状态码作为普通错误返回。
+func checkStatus(resp *http.Response) error {
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return perrors.Wrap(perrors.ErrRateLimited, fmt.Errorf("上游返回状态码 %d", resp.StatusCode))
+	case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusUnavailableForLegalReasons:
+		return perrors.Wrap(perrors.ErrUpstreamBlocked, fmt.Errorf("上游返回状态码 %d", resp.StatusCode))
+	case resp.StatusCode >= 400:
+		return fmt.Errorf("上游返回状态码 %d", resp.StatusCode)
 	}
-	start += 10 // len(`var x1 = "`)
-	end := strings.Index(html[start:], `"`)
-	if end == -1 {
-		return ""
-	}
-	return html[start : start+end]
-}
-
-// extractJSPath 从HTML中提取js路径
-func extractJSPath(html string) string {
-	// 查找js路径
-	start := strings.Index(html, `src="/js/main.js?v=`)
-	if start == -1 {
-		return ""
-	}
-	start += 5 // len(`src="`)
-	end := strings.Index(html[start:], `"`)
-	if end == -1 {
-		return ""
-	}
-	return html[start : start+end]
+	return nil
 }
 
-// 重置HTTP客户端，用于在API模式下每次请求前调用
-func resetHTTPClient() {
-	jar, err := cookiejar.New(nil)
-	if err != nil {
-		log.Printf("创建新的cookie jar失败: %v", err)
-		return
-	}
-
-	httpClient = &http.Client{
-		Jar:     jar,
-		Timeout: 10 * time.Second,
-	}
-
-	if constants.Verbose {
-		log.Printf("已重置HTTP客户端")
+// classifyRequestError 为请求错误标记类别
+// 超时标记为ErrTimeout，调用方主动取消的请求保持原样，其余标记为ErrNetwork。
+func classifyRequestError(err error) error {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		return perrors.Wrap(perrors.ErrTimeout, err)
+	case errors.Is(err, context.Canceled):
+		return err
+	default:
+		return perrors.Wrap(perrors.ErrNetwork, err)
 	}
 }
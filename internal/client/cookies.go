@@ -0,0 +1,120 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// cookieFile cookie持久化文件的内容
+type cookieFile struct {
+	BaseURL string        `json:"base_url"` // 保存cookie时使用的基础URL，切换站点后cookie不再加载
+	SavedAt time.Time     `json:"saved_at"` // 保存时间
+	Cookies []savedCookie `json:"cookies"`  // 站点设置的全部cookie，包括js1key和pow
+}
+
+// savedCookie 保存的单个cookie
+type savedCookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// loadCookies 将持久化文件中的cookie加载到会话的cookie jar
+// 只加载与当前基础URL一致且未超过SessionTTL的cookie；文件不存在时不返回错误。
+func (s *Session) loadCookies() error {
+	data, err := os.ReadFile(s.cfg.CookieFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var file cookieFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("解析cookie文件失败: %w", err)
+	}
+	if file.BaseURL != s.cfg.BaseURL || len(file.Cookies) == 0 {
+		return nil
+	}
+	if s.cfg.SessionTTL > 0 && time.Since(file.SavedAt) > s.cfg.SessionTTL {
+		s.log.Debug("cookie文件已过期", "saved_at", file.SavedAt)
+		return nil
+	}
+
+	u, err := url.Parse(s.cfg.BaseURL)
+	if err != nil {
+		return err
+	}
+	cookies := make([]*http.Cookie, 0, len(file.Cookies))
+	for _, c := range file.Cookies {
+		cookies = append(cookies, &http.Cookie{Name: c.Name, Value: c.Value})
+		switch c.Name {
+		case "js1key":
+			s.savedJs1key = c.Value
+		case "pow":
+			s.savedPow = c.Value
+		}
+	}
+	s.httpClient.Jar.SetCookies(u, cookies)
+
+	s.log.Debug("从cookie文件加载cookie", "path", s.cfg.CookieFile, "count", len(cookies), "saved_at", file.SavedAt)
+	return nil
+}
+
+// SavedKeys 返回从cookie文件加载的访问密钥
+//
+// 返回:
+//   - string: js1key
+//   - string: pow
+//   - bool: cookie文件中是否同时有js1key和pow
+func (s *Session) SavedKeys() (string, string, bool) {
+	if s.savedJs1key == "" || s.savedPow == "" {
+		return "", "", false
+	}
+	return s.savedJs1key, s.savedPow, true
+}
+
+// SaveCookies 将会话cookie jar中当前站点的cookie写入持久化文件
+// 先写入临时文件再重命名，并发查询同时保存时文件总是完整的，以最后完成的查询为准。
+//
+// 返回:
+//   - error: 如果写入失败则返回相应错误
+func (s *Session) SaveCookies() error {
+	u, err := url.Parse(s.cfg.BaseURL)
+	if err != nil {
+		return err
+	}
+
+	file := cookieFile{BaseURL: s.cfg.BaseURL, SavedAt: time.Now()}
+	for _, c := range s.httpClient.Jar.Cookies(u) {
+		file.Cookies = append(file.Cookies, savedCookie{Name: c.Name, Value: c.Value})
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := s.cfg.CookieFile
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
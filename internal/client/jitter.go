@@ -0,0 +1,70 @@
+package client
+
+import (
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 可以在真实范围内浮动的浏览器版本号
+var (
+	chromeVersionRe  = regexp.MustCompile(`Chrome/(\d+)\.0\.0\.0`)
+	firefoxVersionRe = regexp.MustCompile(`rv:(\d+)\.0\) Gecko/20100101 Firefox/(\d+)\.0`)
+	safariVersionRe  = regexp.MustCompile(`Version/(\d+)\.(\d+)`)
+)
+
+// jitterProfile 返回随机变化后的请求头，用于降低长期运行时被识别为同一客户端的可能
+// 变化都在真实浏览器会出现的范围内：Chrome和Firefox的主版本号在前后两个版本之间浮动
+// （Sec-Ch-Ua与User-Agent保持一致），Safari的次版本号在0到4之间浮动；Accept-Language中
+// 首选语言之外的语言随机排序；一半的会话模拟刷新页面，发送Cache-Control和Pragma头。
+// 变化以会话为单位，同一次查询的多个请求使用相同的请求头。
+func jitterProfile(profile HeaderProfile) HeaderProfile {
+	if m := chromeVersionRe.FindStringSubmatch(profile.UserAgent); m != nil {
+		old, _ := strconv.Atoi(m[1])
+		major := strconv.Itoa(old + rand.Intn(5) - 2)
+		profile.UserAgent = chromeVersionRe.ReplaceAllString(profile.UserAgent, "Chrome/"+major+".0.0.0")
+		profile.SecChUa = strings.ReplaceAll(profile.SecChUa, `v="`+m[1]+`"`, `v="`+major+`"`)
+	}
+	if m := firefoxVersionRe.FindStringSubmatch(profile.UserAgent); m != nil {
+		old, _ := strconv.Atoi(m[1])
+		major := strconv.Itoa(old + rand.Intn(5) - 2)
+		profile.UserAgent = firefoxVersionRe.ReplaceAllString(profile.UserAgent, "rv:"+major+".0) Gecko/20100101 Firefox/"+major+".0")
+	}
+	if m := safariVersionRe.FindStringSubmatch(profile.UserAgent); m != nil {
+		profile.UserAgent = safariVersionRe.ReplaceAllString(profile.UserAgent, "Version/"+m[1]+"."+strconv.Itoa(rand.Intn(5)))
+	}
+
+	profile.AcceptLanguage = shuffleLanguages(profile.AcceptLanguage)
+	profile.Reload = rand.Intn(2) == 0
+	return profile
+}
+
+// shuffleLanguages 保持首选语言不变，随机排列其余语言，并按新顺序重新分配原有的q值
+// 如"zh-CN,zh;q=0.9,en;q=0.8"可能变为"zh-CN,en;q=0.9,zh;q=0.8"。
+func shuffleLanguages(acceptLanguage string) string {
+	parts := strings.Split(acceptLanguage, ",")
+	if len(parts) < 3 {
+		return acceptLanguage
+	}
+
+	rest := parts[1:]
+	langs := make([]string, len(rest))
+	weights := make([]string, len(rest))
+	for i, part := range rest {
+		lang, weight, _ := strings.Cut(part, ";")
+		langs[i] = lang
+		weights[i] = weight
+	}
+	rand.Shuffle(len(langs), func(i, j int) {
+		langs[i], langs[j] = langs[j], langs[i]
+	})
+
+	for i := range rest {
+		rest[i] = langs[i]
+		if weights[i] != "" {
+			rest[i] += ";" + weights[i]
+		}
+	}
+	return strings.Join(parts, ",")
+}
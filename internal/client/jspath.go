@@ -0,0 +1,212 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"ping0/internal/config"
+	"ping0/internal/metrics"
+	"ping0/internal/models"
+)
+
+// JSPathChangedEvent 脚本路径变化事件的类型，也是Webhook载荷中event字段的值
+const JSPathChangedEvent = "js_path_changed"
+
+// JSPathChange 初始页面中计算密钥的脚本路径发生变化的事件，也是发送给Webhook的JSON载荷
+// 路径中通常带有版本号（如 /js/main.js?v=20240101），路径变化往往出现在密钥算法更新之前。
+type JSPathChange struct {
+	Event          string    `json:"event"`              // 固定为js_path_changed
+	BaseURL        string    `json:"base_url"`           // 发现变化的站点
+	Previous       string    `json:"previous"`           // 之前记录的脚本路径
+	Current        string    `json:"current"`            // 本次初始页面中的脚本路径
+	PreviousSeenAt time.Time `json:"previous_seen_at"`   // 之前的路径最后一次出现的时间
+	DetectedAt     time.Time `json:"detected_at"`        // 发现变化的时间
+	Princess       string    `json:"princess,omitempty"` // 固定添加的Princess字段
+}
+
+// seenJSPath 一个站点最近一次出现的脚本路径
+type seenJSPath struct {
+	Path   string    `json:"path"`
+	SeenAt time.Time `json:"seen_at"`
+}
+
+// jsPathTracker 按站点记录初始页面中的脚本路径，同一进程中的全部会话共用
+// 配置了JSPathFile时第一次使用前从文件加载，路径变化时写回文件，命令行每次运行之间也能发现变化。
+type jsPathTracker struct {
+	mu     sync.Mutex
+	file   string                // 已加载的记录文件，变化时重新加载
+	loaded bool                  // file是否已加载
+	seen   map[string]seenJSPath // 站点地址到最近一次脚本路径的映射
+}
+
+// jsPaths 进程内的脚本路径记录
+var jsPaths = &jsPathTracker{seen: make(map[string]seenJSPath)}
+
+// observeJSPath 记录初始页面中的脚本路径，与之前记录的路径不同时输出警告、增加计数，
+// 并在配置了Webhook时在后台发送通知。第一次见到某个站点时只记录，不视为变化。
+//
+// 参数:
+//   - cfg: 运行配置，提供站点地址、JSPathFile和Webhook
+//   - log: 日志记录器
+//   - path: 本次初始页面中的脚本路径
+func observeJSPath(cfg *config.Config, log *slog.Logger, path string) {
+	change, err := jsPaths.observe(cfg.BaseURL, cfg.JSPathFile, path, time.Now())
+	if err != nil {
+		log.Debug("无法保存脚本路径记录", "file", cfg.JSPathFile, "error", err)
+	}
+	if change == nil {
+		return
+	}
+	change.Princess = models.Princess(cfg.Branding())
+
+	metrics.JSPathChanges.Inc()
+	log.Warn("初始页面中的脚本路径已变化，Ping0.cc可能即将更新密钥算法",
+		"base_url", change.BaseURL, "previous", change.Previous, "current", change.Current,
+		"previous_seen_at", change.PreviousSeenAt.Format(time.RFC3339))
+
+	if cfg.Webhook != "" {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.RequestTimeout())
+			defer cancel()
+			if err := sendJSPathChange(ctx, cfg, change); err != nil {
+				log.Warn("发送脚本路径变化通知失败", "error", err)
+			}
+		}()
+	}
+}
+
+// observe 记录站点的脚本路径，路径变化时返回变化事件
+//
+// 参数:
+//   - baseURL: 站点地址
+//   - file: 记录文件，为空时只在内存中记录
+//   - path: 本次的脚本路径
+//   - now: 本次的时间
+//
+// 返回:
+//   - *JSPathChange: 路径变化时的事件，没有变化或第一次记录时为nil
+//   - error: 加载或保存记录文件失败时返回相应错误，内存中的记录不受影响
+func (t *jsPathTracker) observe(baseURL, file, path string, now time.Time) (*JSPathChange, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var loadErr error
+	if file != "" && (!t.loaded || t.file != file) {
+		loadErr = t.load(file)
+		t.file, t.loaded = file, true
+	}
+
+	prev, ok := t.seen[baseURL]
+	t.seen[baseURL] = seenJSPath{Path: path, SeenAt: now}
+
+	var change *JSPathChange
+	if ok && prev.Path != path {
+		change = &JSPathChange{
+			Event:          JSPathChangedEvent,
+			BaseURL:        baseURL,
+			Previous:       prev.Path,
+			Current:        path,
+			PreviousSeenAt: prev.SeenAt,
+			DetectedAt:     now,
+		}
+	}
+
+	// 只在第一次记录和路径变化时写文件，避免每次握手都写磁盘
+	if file == "" || (ok && change == nil) {
+		return change, loadErr
+	}
+	if err := t.save(file); err != nil {
+		return change, err
+	}
+	return change, loadErr
+}
+
+// load 从记录文件加载脚本路径，文件不存在时视为没有记录；内存中已有的记录优先
+func (t *jsPathTracker) load(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var saved map[string]seenJSPath
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("解析脚本路径记录失败: %w", err)
+	}
+	for baseURL, seen := range saved {
+		if _, ok := t.seen[baseURL]; !ok {
+			t.seen[baseURL] = seen
+		}
+	}
+	return nil
+}
+
+// save 将全部站点的脚本路径写入记录文件，先写临时文件再重命名
+func (t *jsPathTracker) save(file string) error {
+	data, err := json.MarshalIndent(t.seen, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// sendJSPathChange 将脚本路径变化事件以JSON格式POST到Webhook地址
+//
+// 参数:
+//   - ctx: 请求上下文
+//   - cfg: 运行配置，提供Webhook地址和User-Agent
+//   - change: 要发送的变化事件
+//
+// 返回:
+//   - error: 如果请求失败或Webhook返回非2xx状态码则返回相应错误
+func sendJSPathChange(ctx context.Context, cfg *config.Config, change *JSPathChange) error {
+	body, err := json.Marshal(change)
+	if err != nil {
+		return fmt.Errorf("转换为JSON失败: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", cfg.Webhook, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("创建Webhook请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", cfg.UserAgent)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求Webhook失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Webhook返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package client
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"ping0/internal/config"
+	perrors "ping0/internal/errors"
+)
+
+const (
+	// mirrorCooldown 站点第一次被判定为不可用后暂停使用的时间，连续失败时成倍增加
+	mirrorCooldown = 30 * time.Second
+
+	// mirrorMaxCooldown 站点暂停使用的最长时间，到期后会再次尝试
+	mirrorMaxCooldown = 10 * time.Minute
+)
+
+// mirror 一个候选站点及其可用状态
+type mirror struct {
+	baseURL   string
+	failures  int       // 连续失败次数
+	downUntil time.Time // 在此之前不主动选择该站点
+}
+
+// MirrorPool 在主站和镜像站点之间按可用状态选择基础URL
+// 站点按配置顺序排列，主站在最前。Pick总是返回第一个可用的站点，因此主站恢复后会自动切回；
+// 站点连续失败时暂停使用的时间成倍增加，最长为mirrorMaxCooldown；所有站点都不可用时，
+// 返回最早恢复的站点。MirrorPool实现了config.UpstreamSelector接口，可以被多个goroutine并发使用。
+type MirrorPool struct {
+	log *slog.Logger
+
+	mu      sync.Mutex
+	mirrors []*mirror
+}
+
+// NewMirrorPool 根据配置中的BaseURL和Mirrors创建站点池
+//
+// 参数:
+//   - cfg: 运行时配置，使用其中的BaseURL和Mirrors
+//
+// 返回:
+//   - *MirrorPool: 新创建的站点池
+//   - error: 如果某个URL无效则返回相应错误
+func NewMirrorPool(cfg *config.Config) (*MirrorPool, error) {
+	p := &MirrorPool{log: cfg.Log("client")}
+	seen := make(map[string]bool)
+	for _, raw := range append([]string{cfg.BaseURL}, strings.Split(cfg.Mirrors, ",")...) {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		baseURL, err := normalizeBaseURL(raw)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[baseURL] {
+			seen[baseURL] = true
+			p.mirrors = append(p.mirrors, &mirror{baseURL: baseURL})
+		}
+	}
+	if len(p.mirrors) == 0 {
+		return nil, fmt.Errorf("没有可用的站点URL")
+	}
+	return p, nil
+}
+
+// normalizeBaseURL 检查基础URL并去掉末尾的斜杠
+func normalizeBaseURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("无效的站点URL: %s", raw)
+	}
+	return strings.TrimRight(raw, "/"), nil
+}
+
+// Pick 返回当前应使用的基础URL
+func (p *MirrorPool) Pick() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	earliest := p.mirrors[0]
+	for _, m := range p.mirrors {
+		if !now.Before(m.downUntil) {
+			return m.baseURL
+		}
+		if m.downUntil.Before(earliest.downUntil) {
+			earliest = m
+		}
+	}
+	return earliest.baseURL
+}
+
+// Report 报告一次查询结果
+// 查询成功时清除站点的失败记录；只有站点无法访问、超时或拒绝访问时才将站点标记为不可用，
+// 验证失败、解析失败等与站点可达性无关的错误不影响站点状态。
+//
+// 参数:
+//   - baseURL: 查询使用的基础URL
+//   - err: 查询结果，nil表示成功
+func (p *MirrorPool) Report(baseURL string, err error) {
+	if err != nil && !IsUpstreamFailure(err) {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, m := range p.mirrors {
+		if m.baseURL != baseURL {
+			continue
+		}
+		if err == nil {
+			if m.failures > 0 {
+				p.log.Info("站点已恢复", "base_url", baseURL)
+			}
+			m.failures = 0
+			m.downUntil = time.Time{}
+			return
+		}
+
+		m.failures++
+		cooldown := mirrorMaxCooldown
+		if m.failures <= 5 {
+			cooldown = min(mirrorCooldown<<(m.failures-1), mirrorMaxCooldown)
+		}
+		m.downUntil = time.Now().Add(cooldown)
+		p.log.Warn("站点不可用，暂停使用", "base_url", baseURL, "failures", m.failures, "cooldown", cooldown, "error", err)
+		return
+	}
+}
+
+// IsUpstreamFailure 判断查询错误是否说明站点本身不可用（无法连接、超时或拒绝访问）
+// 这类错误可以通过切换到其他站点解决。
+func IsUpstreamFailure(err error) bool {
+	switch perrors.Class(err) {
+	case perrors.ErrNetwork, perrors.ErrTimeout, perrors.ErrUpstreamBlocked:
+		return true
+	default:
+		return false
+	}
+}
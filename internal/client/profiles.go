@@ -0,0 +1,121 @@
+package client
+
+import (
+	"net/http"
+	"sort"
+
+	"ping0/internal/config"
+	"ping0/internal/constants"
+)
+
+// HeaderProfile 一组相互一致的浏览器请求头
+// User-Agent、Accept系列和客户端提示（Sec-Ch-Ua）头必须来自同一种浏览器和平台，
+// 否则很容易被识别为脚本请求。
+type HeaderProfile struct {
+	UserAgent      string // User-Agent头
+	Accept         string // Accept头
+	AcceptLanguage string // Accept-Language头
+	SecChUa        string // Sec-Ch-Ua头，为空时不发送客户端提示头（Safari和Firefox不发送）
+	Mobile         bool   // Sec-Ch-Ua-Mobile是否为?1
+	Platform       string // Sec-Ch-Ua-Platform头，不带引号
+	Reload         bool   // 是否模拟刷新页面，发送Cache-Control和Pragma头
+}
+
+// chromeAccept Chrome导航请求的Accept头
+const chromeAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7"
+
+// chromeSecChUa Chrome 122的Sec-Ch-Ua头
+const chromeSecChUa = `"Chromium";v="122", "Not(A:Brand";v="24", "Google Chrome";v="122"`
+
+// HeaderProfiles 内置的请求头配置，键为-profile参数使用的名称
+var HeaderProfiles = map[string]HeaderProfile{
+	"chrome-win": {
+		UserAgent:      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/122.0.0.0 Safari/537.36",
+		Accept:         chromeAccept,
+		AcceptLanguage: "zh-CN,zh;q=0.9,en;q=0.8",
+		SecChUa:        chromeSecChUa,
+		Platform:       "Windows",
+		Reload:         true,
+	},
+	"chrome-mac": {
+		UserAgent:      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/122.0.0.0 Safari/537.36",
+		Accept:         chromeAccept,
+		AcceptLanguage: "zh-CN,zh;q=0.9,en;q=0.8",
+		SecChUa:        chromeSecChUa,
+		Platform:       "macOS",
+		Reload:         true,
+	},
+	"safari-mac": {
+		UserAgent:      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.3 Safari/605.1.15",
+		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+		AcceptLanguage: "zh-CN,zh-Hans;q=0.9",
+		Reload:         true,
+	},
+	"firefox-win": {
+		UserAgent:      "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:123.0) Gecko/20100101 Firefox/123.0",
+		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8",
+		AcceptLanguage: "zh-CN,zh;q=0.8,zh-TW;q=0.7,zh-HK;q=0.5,en-US;q=0.3,en;q=0.2",
+		Reload:         true,
+	},
+	"android": {
+		UserAgent:      "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/122.0.0.0 Mobile Safari/537.36",
+		Accept:         chromeAccept,
+		AcceptLanguage: "zh-CN,zh;q=0.9,en;q=0.8",
+		SecChUa:        chromeSecChUa,
+		Mobile:         true,
+		Platform:       "Android",
+		Reload:         true,
+	},
+}
+
+// ProfileNames 返回按名称排序的内置请求头配置名称
+func ProfileNames() []string {
+	names := make([]string, 0, len(HeaderProfiles))
+	for name := range HeaderProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// profileFor 返回配置对应的请求头
+// 未指定HeaderProfile时沿用chrome-win的请求头和配置中的User-Agent；
+// 指定了HeaderProfile时使用其中的User-Agent，除非通过-ua等方式设置了非默认的User-Agent。
+func profileFor(cfg *config.Config) HeaderProfile {
+	profile, ok := HeaderProfiles[cfg.HeaderProfile]
+	if !ok {
+		profile = HeaderProfiles["chrome-win"]
+		profile.UserAgent = cfg.UserAgent
+		return profile
+	}
+	if cfg.UserAgent != "" && cfg.UserAgent != constants.UserAgent {
+		profile.UserAgent = cfg.UserAgent
+	}
+	return profile
+}
+
+// setBrowserHeaders 为导航请求设置浏览器请求头
+func setBrowserHeaders(req *http.Request, profile HeaderProfile) {
+	req.Header.Set("User-Agent", profile.UserAgent)
+	req.Header.Set("Accept", profile.Accept)
+	req.Header.Set("Accept-Language", profile.AcceptLanguage)
+	req.Header.Set("Connection", "keep-alive")
+	if profile.Reload {
+		req.Header.Set("Cache-Control", "no-cache")
+		req.Header.Set("Pragma", "no-cache")
+	}
+	if profile.SecChUa != "" {
+		mobile := "?0"
+		if profile.Mobile {
+			mobile = "?1"
+		}
+		req.Header.Set("Sec-Ch-Ua", profile.SecChUa)
+		req.Header.Set("Sec-Ch-Ua-Mobile", mobile)
+		req.Header.Set("Sec-Ch-Ua-Platform", `"`+profile.Platform+`"`)
+	}
+	req.Header.Set("Sec-Fetch-Dest", "document")
+	req.Header.Set("Sec-Fetch-Mode", "navigate")
+	req.Header.Set("Sec-Fetch-Site", "none")
+	req.Header.Set("Sec-Fetch-User", "?1")
+	req.Header.Set("Upgrade-Insecure-Requests", "1")
+}
@@ -0,0 +1,46 @@
+package client
+
+import (
+	"net/http"
+	"time"
+)
+
+// 记录的响应所属的查询步骤
+const (
+	ResponseInitial = "initial" // 初始页面
+	ResponseFinal   = "final"   // 最终页面
+)
+
+// Response 会话中收到的一个HTTP响应
+// 仅在配置了DumpDir时记录，用于解析失败时保存可复现的现场。
+type Response struct {
+	Step       string      `json:"step"`        // 所属步骤，ResponseInitial或ResponseFinal
+	Method     string      `json:"method"`      // 请求方法
+	URL        string      `json:"url"`         // 请求URL
+	Status     int         `json:"status"`      // 响应状态码
+	Header     http.Header `json:"header"`      // 响应头
+	ReceivedAt time.Time   `json:"received_at"` // 收到响应的时间
+	Body       []byte      `json:"-"`           // 响应内容
+}
+
+// record 在配置了DumpDir时记录一个响应
+func (s *Session) record(step string, resp *http.Response, body []byte) {
+	if s.cfg.DumpDir == "" {
+		return
+	}
+	s.responses = append(s.responses, Response{
+		Step:       step,
+		Method:     resp.Request.Method,
+		URL:        resp.Request.URL.String(),
+		Status:     resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		ReceivedAt: time.Now(),
+		Body:       body,
+	})
+}
+
+// Responses 返回本会话中记录的全部响应，按收到的顺序排列
+// 未配置DumpDir时总是返回空列表。
+func (s *Session) Responses() []Response {
+	return s.responses
+}
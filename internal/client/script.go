@@ -0,0 +1,341 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ping0/internal/config"
+	"ping0/internal/parser"
+)
+
+// maxScriptSize 下载JavaScript文件时读取的最大字节数，超过时视为异常响应
+const maxScriptSize = 8 << 20
+
+// ScriptFingerprint 初始页面引用的JavaScript文件的内容指纹
+// 文件名或版本号不变而内容变化时，只有内容哈希能说明Ping0.cc更换了脚本。
+type ScriptFingerprint struct {
+	BaseURL    string     `json:"base_url"`              // 引用该脚本的站点
+	Path       string     `json:"path"`                  // 初始页面中的脚本路径
+	SHA256     string     `json:"sha256"`                // 脚本内容的SHA-256，小写十六进制
+	Size       int        `json:"size"`                  // 脚本的字节数
+	Known      bool       `json:"known"`                 // 是否为已知可用的脚本
+	Algorithm  string     `json:"algorithm,omitempty"`   // 已知脚本对应的算法版本，来自配置的哈希时为空
+	FetchedAt  time.Time  `json:"fetched_at"`            // 下载时间
+	VerifiedAt *time.Time `json:"verified_at,omitempty"` // 使用该脚本生成的密钥第一次被接受的时间
+}
+
+// String 返回用于错误信息和日志的简短说明，如"脚本 /js/main.js sha256=ab12…（未知版本）"
+func (f *ScriptFingerprint) String() string {
+	state := "未知版本"
+	switch {
+	case f.Known && f.Algorithm != "":
+		state = "已知版本，算法 " + f.Algorithm
+	case f.Known:
+		state = "已知版本"
+	}
+	return fmt.Sprintf("脚本 %s sha256=%s（%s）", f.Path, f.SHA256, state)
+}
+
+// scriptEntry 一个脚本的指纹，下载完成前done未关闭
+type scriptEntry struct {
+	done    chan struct{}
+	fp      *ScriptFingerprint
+	err     error
+	pending *verifiedScript // 下载完成前收到的确认，下载成功后记入verified
+}
+
+// verifiedScript 使用某个脚本生成的密钥被接受的记录
+type verifiedScript struct {
+	algorithm string
+	at        time.Time
+}
+
+// scriptFingerprints 进程内已下载的脚本指纹，按站点和路径区分，每个脚本只下载一次；
+// verified按内容哈希记录已确认可用的脚本，重新下载后仍然有效
+var scriptFingerprints = struct {
+	mu       sync.Mutex
+	entries  map[string]*scriptEntry
+	verified map[string]verifiedScript
+}{entries: make(map[string]*scriptEntry), verified: make(map[string]verifiedScript)}
+
+// FingerprintScript 返回初始页面引用的JavaScript文件的内容指纹
+// 同一站点的同一路径在进程内只下载一次，并发调用等待同一次下载；下载失败时不保存结果，下次调用重新下载。
+// 指纹中的Known根据已注册算法的ScriptHashes、配置的KnownScriptHashes和进程内确认过的哈希判断。
+//
+// 参数:
+//   - ctx: 请求上下文
+//   - jsPath: 初始页面中的脚本路径，可以是相对路径或完整URL
+//
+// 返回:
+//   - *ScriptFingerprint: 脚本的指纹
+//   - error: 如果下载失败则返回相应错误
+func (s *Session) FingerprintScript(ctx context.Context, jsPath string) (*ScriptFingerprint, error) {
+	key := s.cfg.BaseURL + " " + jsPath
+	e, owner := claimScript(key)
+	if owner {
+		s.fillScript(ctx, key, jsPath, e)
+	}
+
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	return withKnownState(s.cfg, e.fp), nil
+}
+
+// claimScript 返回脚本的指纹记录，没有记录时创建一个，调用方负责下载
+//
+// 返回:
+//   - *scriptEntry: 脚本的指纹记录
+//   - bool: 记录是否为本次新建，为true时调用方必须调用fillScript
+func claimScript(key string) (*scriptEntry, bool) {
+	scriptFingerprints.mu.Lock()
+	defer scriptFingerprints.mu.Unlock()
+
+	if e, ok := scriptFingerprints.entries[key]; ok {
+		return e, false
+	}
+	e := &scriptEntry{done: make(chan struct{})}
+	scriptFingerprints.entries[key] = e
+	return e, true
+}
+
+// fillScript 下载脚本，保存指纹并通知等待的调用方；下载失败时删除记录，下次调用重新下载
+func (s *Session) fillScript(ctx context.Context, key, jsPath string, e *scriptEntry) {
+	fp, err := s.downloadScript(ctx, jsPath)
+
+	scriptFingerprints.mu.Lock()
+	e.fp, e.err = fp, err
+	if err != nil {
+		delete(scriptFingerprints.entries, key)
+	} else if e.pending != nil {
+		if _, ok := scriptFingerprints.verified[fp.SHA256]; !ok {
+			scriptFingerprints.verified[fp.SHA256] = *e.pending
+		}
+	}
+	close(e.done)
+	scriptFingerprints.mu.Unlock()
+
+	if err != nil {
+		s.log.Debug("下载脚本计算指纹失败", "path", jsPath, "error", err)
+		return
+	}
+	if fp = withKnownState(s.cfg, fp); fp.Known {
+		s.log.Debug("脚本指纹", "path", jsPath, "sha256", fp.SHA256, "algorithm", fp.Algorithm)
+	} else {
+		s.log.Warn("初始页面引用的脚本不是已知版本，Ping0.cc可能已更新密钥算法", "path", jsPath, "sha256", fp.SHA256, "size", fp.Size)
+	}
+}
+
+// RefreshScriptFingerprint 丢弃进程内保存的指纹并重新下载脚本
+// 脚本路径不变而内容被替换时，只有重新下载才能发现，适合在访问密钥被拒绝后调用。
+//
+// 参数:
+//   - ctx: 请求上下文
+//   - jsPath: 初始页面中的脚本路径
+//
+// 返回:
+//   - *ScriptFingerprint: 重新下载的脚本的指纹
+//   - error: 如果下载失败则返回相应错误
+func (s *Session) RefreshScriptFingerprint(ctx context.Context, jsPath string) (*ScriptFingerprint, error) {
+	key := s.cfg.BaseURL + " " + jsPath
+
+	scriptFingerprints.mu.Lock()
+	if e, ok := scriptFingerprints.entries[key]; ok {
+		select {
+		case <-e.done:
+			delete(scriptFingerprints.entries, key)
+		default:
+			// 正在下载，等待这次下载的结果即可
+		}
+	}
+	scriptFingerprints.mu.Unlock()
+
+	return s.FingerprintScript(ctx, jsPath)
+}
+
+// prefetchScript 在后台下载初始页面引用的脚本并计算指纹，进程内已有指纹时不重复下载
+// 记录在返回前创建，之后的MarkScriptVerified即使早于下载完成也不会丢失。
+// 浏览器打开初始页面时同样会加载该脚本，下载它不会让请求显得异常。
+func (s *Session) prefetchScript(jsPath string) {
+	key := s.cfg.BaseURL + " " + jsPath
+	if e, owner := claimScript(key); owner {
+		go s.fillScript(context.Background(), key, jsPath, e)
+	}
+}
+
+// downloadScript 下载脚本并计算其SHA-256
+func (s *Session) downloadScript(ctx context.Context, jsPath string) (*ScriptFingerprint, error) {
+	body, err := s.DownloadScript(ctx, jsPath)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(body)
+	return &ScriptFingerprint{
+		BaseURL:   s.cfg.BaseURL,
+		Path:      jsPath,
+		SHA256:    hex.EncodeToString(sum[:]),
+		Size:      len(body),
+		FetchedAt: time.Now(),
+	}, nil
+}
+
+// DownloadScript 下载初始页面引用的JavaScript文件
+// 请求使用会话的请求头和cookie，与浏览器加载页面中的脚本相同。
+//
+// 参数:
+//   - ctx: 请求上下文
+//   - jsPath: 初始页面中的脚本路径，可以是相对路径或完整URL
+//
+// 返回:
+//   - []byte: 脚本内容
+//   - error: 如果请求失败、状态码异常或脚本超过8MB则返回相应错误
+func (s *Session) DownloadScript(ctx context.Context, jsPath string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.RequestTimeout())
+	defer cancel()
+
+	base, err := url.Parse(s.cfg.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("无效的站点地址: %w", err)
+	}
+	ref, err := url.Parse(jsPath)
+	if err != nil {
+		return nil, fmt.Errorf("无效的脚本路径 %q: %w", jsPath, err)
+	}
+	scriptURL := base.ResolveReference(ref).String()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", scriptURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	setBrowserHeaders(req, s.headers)
+	req.Header.Set("Accept", "*/*")
+	req.Header.Set("Referer", s.cfg.BaseURL)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, classifyRequestError(fmt.Errorf("下载脚本失败: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp); err != nil {
+		return nil, fmt.Errorf("下载脚本失败: %w", err)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxScriptSize+1))
+	if err != nil {
+		return nil, classifyRequestError(fmt.Errorf("读取脚本失败: %w", err))
+	}
+	if len(body) > maxScriptSize {
+		return nil, fmt.Errorf("脚本超过 %d 字节", maxScriptSize)
+	}
+	return body, nil
+}
+
+// MarkScriptVerified 记录使用该脚本生成的访问密钥已被Ping0.cc接受，之后内容相同的脚本视为已知版本
+// 脚本正在下载时在下载完成后记录，没有下载过该脚本时不做任何事。
+//
+// 参数:
+//   - cfg: 运行配置，提供站点地址
+//   - jsPath: 初始页面中的脚本路径
+//   - algorithm: 生成被接受的密钥使用的算法版本
+func MarkScriptVerified(cfg *config.Config, jsPath, algorithm string) {
+	scriptFingerprints.mu.Lock()
+	defer scriptFingerprints.mu.Unlock()
+
+	e, ok := scriptFingerprints.entries[cfg.BaseURL+" "+jsPath]
+	if !ok {
+		return
+	}
+	v := verifiedScript{algorithm: algorithm, at: time.Now()}
+	select {
+	case <-e.done:
+	default:
+		if e.pending == nil {
+			e.pending = &v
+		}
+		return
+	}
+	if e.err != nil {
+		return
+	}
+	if _, ok := scriptFingerprints.verified[e.fp.SHA256]; !ok {
+		scriptFingerprints.verified[e.fp.SHA256] = v
+	}
+}
+
+// ScriptFingerprints 返回进程内已下载的全部脚本指纹，按站点和路径排序
+//
+// 参数:
+//   - cfg: 运行配置，用于判断配置的已知哈希
+//
+// 返回:
+//   - []ScriptFingerprint: 脚本指纹列表，没有下载过脚本时为空
+func ScriptFingerprints(cfg *config.Config) []ScriptFingerprint {
+	scriptFingerprints.mu.Lock()
+	defer scriptFingerprints.mu.Unlock()
+
+	keys := make([]string, 0, len(scriptFingerprints.entries))
+	for key := range scriptFingerprints.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var result []ScriptFingerprint
+	for _, key := range keys {
+		e := scriptFingerprints.entries[key]
+		select {
+		case <-e.done:
+		default:
+			continue
+		}
+		if e.err == nil {
+			result = append(result, *knownState(cfg, *e.fp))
+		}
+	}
+	return result
+}
+
+// withKnownState 复制指纹并判断是否为已知版本
+func withKnownState(cfg *config.Config, fp *ScriptFingerprint) *ScriptFingerprint {
+	scriptFingerprints.mu.Lock()
+	defer scriptFingerprints.mu.Unlock()
+	return knownState(cfg, *fp)
+}
+
+// knownState 判断指纹是否为已知版本：已注册算法登记的哈希、进程内确认过的哈希或配置的哈希
+// 调用方需持有scriptFingerprints.mu。
+func knownState(cfg *config.Config, fp ScriptFingerprint) *ScriptFingerprint {
+	if v, ok := scriptFingerprints.verified[fp.SHA256]; ok {
+		at := v.at
+		fp.VerifiedAt = &at
+		fp.Known, fp.Algorithm = true, v.algorithm
+	}
+	if version, ok := parser.ScriptAlgorithm(fp.SHA256); ok {
+		fp.Known, fp.Algorithm = true, version
+		return &fp
+	}
+	if fp.Known {
+		return &fp
+	}
+	for _, h := range strings.Split(cfg.KnownScriptHashes, ",") {
+		if strings.EqualFold(strings.TrimSpace(h), fp.SHA256) {
+			fp.Known = true
+			return &fp
+		}
+	}
+	return &fp
+}
@@ -0,0 +1,164 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"ping0/internal/config"
+)
+
+// sessionState 一组被接受的访问密钥及其来源信息
+type sessionState struct {
+	BaseURL    string    `json:"base_url"`    // 获取密钥时使用的基础URL，切换站点后密钥不再有效
+	Js1key     string    `json:"js1key"`      // js1key cookie的值
+	Pow        string    `json:"pow"`         // pow cookie的值
+	ObtainedAt time.Time `json:"obtained_at"` // 密钥被接受的时间
+}
+
+// SessionManager 在多次查询之间复用已被接受的js1key和pow cookie
+// 服务器模式下所有请求共享同一个SessionManager，只有密钥过期或被拒绝时
+// 才需要重新获取初始页面和计算POW。配置了SessionFile时，密钥还会持久化到文件，
+// 使命令行程序在连续多次运行之间也能复用。
+// SessionManager实现了config.SessionStore接口，可以被多个goroutine并发使用。
+type SessionManager struct {
+	baseURL string        // 当前配置的基础URL
+	path    string        // 持久化文件路径，为空时只在内存中保存
+	ttl     time.Duration // 密钥的最长复用时间，0表示不限制
+	log     *slog.Logger  // 带组件标签的日志记录器
+
+	mu    sync.Mutex
+	state *sessionState // 当前保存的密钥，为nil表示没有可用密钥
+}
+
+// NewSessionManager 创建一个会话管理器
+// 如果配置了持久化文件且文件中保存了同一站点的密钥，会直接加载这些密钥；
+// 文件不存在或内容无效时从空状态开始，不会返回错误。
+//
+// 参数:
+//   - cfg: 运行时配置，使用其中的SessionFile、SessionTTL和BaseURL
+//
+// 返回:
+//   - *SessionManager: 新创建的会话管理器
+func NewSessionManager(cfg *config.Config) *SessionManager {
+	m := &SessionManager{
+		baseURL: cfg.BaseURL,
+		path:    cfg.SessionFile,
+		ttl:     cfg.SessionTTL,
+		log:     cfg.Log("client"),
+	}
+
+	if m.path != "" {
+		if err := m.load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+			m.log.Warn("加载会话文件失败，将重新获取密钥", "path", m.path, "error", err)
+		}
+	}
+
+	return m
+}
+
+// Get 返回当前可复用的访问密钥，密钥已过期时会将其丢弃
+func (m *SessionManager) Get(ctx context.Context) (string, string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.state == nil {
+		return "", "", false
+	}
+	if m.ttl > 0 && time.Since(m.state.ObtainedAt) > m.ttl {
+		m.log.Debug("复用的密钥已过期", "obtained_at", m.state.ObtainedAt)
+		m.clear()
+		return "", "", false
+	}
+	return m.state.Js1key, m.state.Pow, true
+}
+
+// Put 保存一组刚被接受的访问密钥，配置了持久化文件时同时写入文件
+func (m *SessionManager) Put(js1key, pow string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.state = &sessionState{
+		BaseURL:    m.baseURL,
+		Js1key:     js1key,
+		Pow:        pow,
+		ObtainedAt: time.Now(),
+	}
+
+	if m.path != "" {
+		if err := m.save(); err != nil {
+			m.log.Warn("保存会话文件失败", "path", m.path, "error", err)
+		}
+	}
+}
+
+// Invalidate 丢弃被拒绝的访问密钥
+// 并发查询可能已经保存了新的密钥，此时不做任何处理，避免丢弃有效的密钥。
+func (m *SessionManager) Invalidate(js1key, pow string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.state != nil && m.state.Js1key == js1key && m.state.Pow == pow {
+		m.clear()
+	}
+}
+
+// clear 清除内存和文件中的密钥，调用方需持有锁
+func (m *SessionManager) clear() {
+	m.state = nil
+	if m.path != "" {
+		if err := os.Remove(m.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			m.log.Warn("删除会话文件失败", "path", m.path, "error", err)
+		}
+	}
+}
+
+// load 从持久化文件中加载密钥，只接受与当前基础URL一致且未过期的密钥
+func (m *SessionManager) load() error {
+	data, err := os.ReadFile(m.path)
+	if err != nil {
+		return err
+	}
+
+	var state sessionState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("解析会话文件失败: %w", err)
+	}
+
+	if state.BaseURL != m.baseURL || state.Js1key == "" || state.Pow == "" {
+		return nil
+	}
+	if m.ttl > 0 && time.Since(state.ObtainedAt) > m.ttl {
+		return nil
+	}
+
+	m.state = &state
+	m.log.Debug("从会话文件加载密钥", "path", m.path, "obtained_at", state.ObtainedAt)
+	return nil
+}
+
+// save 将当前密钥写入持久化文件
+// 先写入临时文件再重命名，避免并发运行的进程读到写了一半的文件。
+func (m *SessionManager) save() error {
+	data, err := json.MarshalIndent(m.state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if dir := filepath.Dir(m.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
+
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.path)
+}
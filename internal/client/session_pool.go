@@ -0,0 +1,250 @@
+package client
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"ping0/internal/config"
+	"ping0/internal/parser"
+)
+
+// 会话池参数的取值范围
+const (
+	MaxSessionPoolSize    = 64               // 会话池的最大容量
+	MinSessionPoolRefresh = 30 * time.Second // 刷新间隔的最小值，避免后台不停地向Ping0.cc发起握手
+)
+
+// pooledKeys 会话池中的一组访问密钥
+type pooledKeys struct {
+	baseURL    string // 获取密钥时使用的基础URL，密钥只对该站点有效
+	js1key     string
+	pow        string
+	obtainedAt time.Time
+}
+
+// SessionPool 维护多组预先完成握手和POW计算的访问密钥，供服务器模式的并发查询轮流使用
+// 后台协程在启动时填满会话池，之后定期替换超过刷新间隔的密钥，密钥被拒绝后立即补充，
+// API查询因此通常只需请求最终页面。多组密钥分摊了请求，单组密钥被拒绝时其余查询不受影响。
+// 配置了镜像站点时，后台协程向当前选中的站点预热，每组密钥记录获取它的站点，
+// 查询只使用同一站点的密钥，切换站点后其他站点的密钥会被优先替换。
+// 会话池只保存在内存中，不使用SessionFile。
+// SessionPool实现了config.SiteSessionStore接口，可以被多个goroutine并发使用。
+type SessionPool struct {
+	cfg     *config.Config
+	size    int           // 会话池容量
+	refresh time.Duration // 密钥的刷新间隔
+	log     *slog.Logger  // 带组件标签的日志记录器
+
+	mu   sync.Mutex
+	keys []pooledKeys // 当前可用的密钥，最多size组
+	next int          // 下一次Get返回的密钥下标
+
+	wake   chan struct{} // 密钥被丢弃后通知后台协程补充
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewSessionPool 创建会话池并启动后台预热协程，不再使用时需要调用Close
+//
+// 参数:
+//   - cfg: 运行时配置，使用其中的SessionPoolSize、SessionPoolRefresh、BaseURL和Upstreams，预热请求与查询使用相同的代理和请求头设置
+//
+// 返回:
+//   - *SessionPool: 新创建的会话池
+func NewSessionPool(cfg *config.Config) *SessionPool {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &SessionPool{
+		cfg:     cfg,
+		size:    cfg.SessionPoolSize,
+		refresh: cfg.SessionPoolRefreshTime(),
+		log:     cfg.Log("client"),
+		wake:    make(chan struct{}, 1),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go p.run(ctx)
+	return p
+}
+
+// Get 轮流返回会话池中BaseURL的访问密钥，没有该站点的密钥时ok为false
+func (p *SessionPool) Get(ctx context.Context) (string, string, bool) {
+	return p.get(p.cfg.BaseURL)
+}
+
+// Put 保存一组刚被BaseURL接受的访问密钥
+func (p *SessionPool) Put(js1key, pow string) {
+	p.put(p.cfg.BaseURL, js1key, pow)
+}
+
+// Invalidate 丢弃被BaseURL拒绝的访问密钥，并通知后台协程补充
+func (p *SessionPool) Invalidate(js1key, pow string) {
+	p.invalidate(p.cfg.BaseURL, js1key, pow)
+}
+
+// ForBaseURL 返回只读写指定站点密钥的视图，供向镜像站点发起的查询使用
+func (p *SessionPool) ForBaseURL(baseURL string) config.SessionStore {
+	return siteSessions{pool: p, baseURL: baseURL}
+}
+
+// Close 停止后台预热协程，正在进行的预热请求会被取消
+func (p *SessionPool) Close() {
+	p.cancel()
+	<-p.done
+}
+
+// siteSessions 会话池中一个站点的密钥，实现config.SessionStore
+type siteSessions struct {
+	pool    *SessionPool
+	baseURL string
+}
+
+func (s siteSessions) Get(ctx context.Context) (string, string, bool) { return s.pool.get(s.baseURL) }
+
+func (s siteSessions) Put(js1key, pow string) { s.pool.put(s.baseURL, js1key, pow) }
+
+func (s siteSessions) Invalidate(js1key, pow string) { s.pool.invalidate(s.baseURL, js1key, pow) }
+
+// get 从上次返回的位置开始，轮流返回指定站点的访问密钥，跳过其他站点的密钥
+func (p *SessionPool) get(baseURL string) (string, string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := range p.keys {
+		k := p.keys[(p.next+i)%len(p.keys)]
+		if k.baseURL == baseURL {
+			p.next += i + 1
+			return k.js1key, k.pow, true
+		}
+	}
+	return "", "", false
+}
+
+// put 保存一组刚被接受的访问密钥
+// 会话池未满时直接加入，已满时优先替换其他站点的密钥，其次替换最早获取的一组。
+func (p *SessionPool) put(baseURL, js1key, pow string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.add(pooledKeys{baseURL: baseURL, js1key: js1key, pow: pow, obtainedAt: time.Now()})
+}
+
+// invalidate 丢弃被拒绝的访问密钥，并通知后台协程补充
+func (p *SessionPool) invalidate(baseURL, js1key, pow string) {
+	p.mu.Lock()
+	n := len(p.keys)
+	p.keys = slices.DeleteFunc(p.keys, func(k pooledKeys) bool {
+		return k.baseURL == baseURL && k.js1key == js1key && k.pow == pow
+	})
+	removed := len(p.keys) < n
+	p.mu.Unlock()
+
+	if removed {
+		select {
+		case p.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// add 加入一组密钥，调用方需持有锁
+// 会话池已满时优先替换其他站点的密钥，没有时替换最早获取的一组。
+func (p *SessionPool) add(k pooledKeys) {
+	if len(p.keys) < p.size {
+		p.keys = append(p.keys, k)
+		return
+	}
+	if i := slices.IndexFunc(p.keys, func(old pooledKeys) bool { return old.baseURL != k.baseURL }); i >= 0 {
+		p.keys[i] = k
+		return
+	}
+	oldest := 0
+	for i := range p.keys {
+		if p.keys[i].obtainedAt.Before(p.keys[oldest].obtainedAt) {
+			oldest = i
+		}
+	}
+	p.keys[oldest] = k
+}
+
+// site 返回预热使用的站点：配置了镜像站点时为当前选中的站点，否则为BaseURL
+func (p *SessionPool) site() string {
+	if p.cfg.Upstreams != nil {
+		return p.cfg.Upstreams.Pick()
+	}
+	return p.cfg.BaseURL
+}
+
+// run 后台预热协程：填满会话池，之后定期替换过期的密钥
+// 检查间隔为刷新间隔的十分之一（至少1秒），预热依次进行，避免同时向Ping0.cc发出大量握手请求。
+func (p *SessionPool) run(ctx context.Context) {
+	defer close(p.done)
+
+	ticker := time.NewTicker(max(p.refresh/10, time.Second))
+	defer ticker.Stop()
+	for {
+		p.fill(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-p.wake:
+		}
+	}
+}
+
+// fill 补充缺少的密钥并替换超过刷新间隔或属于其他站点的密钥，预热失败时等待下一次检查再重试
+func (p *SessionPool) fill(ctx context.Context) {
+	for ctx.Err() == nil {
+		baseURL := p.site()
+		p.mu.Lock()
+		need := len(p.keys) < p.size
+		for _, k := range p.keys {
+			if k.baseURL != baseURL || time.Since(k.obtainedAt) >= p.refresh {
+				need = true
+			}
+		}
+		p.mu.Unlock()
+		if !need {
+			return
+		}
+
+		keys, err := p.warm(ctx, baseURL)
+		if err != nil {
+			if ctx.Err() == nil {
+				p.log.Warn("预热会话失败", "base_url", baseURL, "error", err)
+			}
+			return
+		}
+
+		// 会话池已满时替换其他站点的密钥或最早获取的一组，也就是超过刷新间隔的密钥
+		p.mu.Lock()
+		p.add(keys)
+		count := len(p.keys)
+		p.mu.Unlock()
+		p.log.Debug("预热会话完成", "base_url", baseURL, "pool", count)
+	}
+}
+
+// warm 向指定站点获取初始页面并计算一组新的访问密钥
+// 密钥在第一次使用时才会被Ping0.cc验证，被拒绝后由Invalidate从会话池中移除。
+func (p *SessionPool) warm(ctx context.Context, baseURL string) (pooledKeys, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.RequestTimeout())
+	defer cancel()
+
+	cfg := p.cfg.WithBaseURL(baseURL)
+	session, err := NewSession(cfg)
+	if err != nil {
+		return pooledKeys{}, err
+	}
+	params, err := session.GetInitialPage(ctx, parser.ManualChallengeParams(cfg))
+	if err != nil {
+		return pooledKeys{}, err
+	}
+	keys, err := parser.GenerateKey(ctx, cfg, params.JSPath, params.X1, params.Difficulty)
+	if err != nil {
+		return pooledKeys{}, err
+	}
+	return pooledKeys{baseURL: baseURL, js1key: keys.Js1key, pow: keys.Pow, obtainedAt: time.Now()}, nil
+}
@@ -0,0 +1,173 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"ping0/internal/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// redisKeyPrefix Redis中Pong0使用的键的前缀
+	redisKeyPrefix = "pong0:"
+
+	// redisPollInterval 其他副本正在获取密钥时，检查密钥是否已保存的间隔
+	redisPollInterval = 200 * time.Millisecond
+
+	// redisTimeout 保存和删除密钥的超时时间，这些命令不随查询取消
+	redisTimeout = 3 * time.Second
+)
+
+// invalidateScript 只在Redis中保存的仍是被拒绝的密钥时才删除，避免删除其他副本刚保存的新密钥
+// 通过EVALSHA执行，Redis中没有缓存该脚本时自动退回到EVAL。
+var invalidateScript = redis.NewScript(`
+local v = redis.call('GET', KEYS[1])
+if v then
+	local s = cjson.decode(v)
+	if s.js1key == ARGV[1] and s.pow == ARGV[2] then
+		return redis.call('DEL', KEYS[1])
+	end
+end
+return 0`)
+
+// RedisSessionStore 在Redis中保存已被接受的访问密钥，供多个副本共享
+// 多个服务器副本配置同一个Redis时，任一副本获取的密钥其他副本都可以直接复用，被拒绝时也只需一个副本重新握手：
+// 没有可用密钥时，第一个发现的副本在Redis中加锁并完成握手和POW计算，其他副本在锁的有效期内等待它保存的密钥，
+// 避免所有副本同时向Ping0.cc发起握手而触发限流。
+// 密钥按基础URL分别保存，过期时间为SessionTTL。Redis不可用时按没有可用密钥处理，每个副本各自完成握手。
+// RedisSessionStore实现了config.SessionStore接口，可以被多个goroutine并发使用。
+type RedisSessionStore struct {
+	client  *redis.Client
+	baseURL string
+	key     string        // 保存密钥的键
+	lock    string        // 获取密钥时加锁的键
+	ttl     time.Duration // 密钥的最长复用时间，0表示不限制
+	wait    time.Duration // 锁的有效期，也是等待其他副本获取密钥的最长时间
+	log     *slog.Logger
+}
+
+// NewRedisSessionStore 连接配置的Redis并创建共享的访问密钥存储，不再使用时需要调用Close
+//
+// 参数:
+//   - cfg: 运行时配置，使用其中的SessionRedis、SessionTTL和BaseURL，等待时间为单个上游请求的超时时间
+//
+// 返回:
+//   - *RedisSessionStore: 新创建的存储
+//   - error: 如果Redis地址无效或无法连接则返回相应错误
+func NewRedisSessionStore(cfg *config.Config) (*RedisSessionStore, error) {
+	opts, err := redis.ParseURL(cfg.SessionRedis)
+	if err != nil {
+		return nil, fmt.Errorf("无效的Redis地址: %w", err)
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("连接Redis失败: %w", err)
+	}
+
+	key := redisKeyPrefix + "session:" + cfg.BaseURL
+	return &RedisSessionStore{
+		client:  client,
+		baseURL: cfg.BaseURL,
+		key:     key,
+		lock:    key + ":lock",
+		ttl:     cfg.SessionTTL,
+		wait:    cfg.RequestTimeout(),
+		log:     cfg.Log("client"),
+	}, nil
+}
+
+// Get 返回Redis中保存的访问密钥
+// 没有可用密钥时尝试加锁：加锁成功的副本返回false并由调用方完成握手，随后的Put释放锁；
+// 锁已被其他副本持有时等待其保存密钥，等待超时或ctx被取消后同样返回false。
+func (r *RedisSessionStore) Get(ctx context.Context) (string, string, bool) {
+	ctx, cancel := context.WithTimeout(ctx, r.wait)
+	defer cancel()
+
+	js1key, pow, ok := r.load(ctx)
+	if ok {
+		return js1key, pow, true
+	}
+
+	locked, err := r.client.SetNX(ctx, r.lock, strconv.FormatInt(time.Now().UnixNano(), 10), r.wait).Result()
+	if err != nil || locked {
+		return "", "", false
+	}
+
+	r.log.Debug("其他副本正在获取访问密钥，等待共享的密钥")
+	ticker := time.NewTicker(redisPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			r.log.Debug("等待共享的访问密钥超时或查询已取消，停止等待")
+			return "", "", false
+		case <-ticker.C:
+		}
+		if js1key, pow, ok := r.load(ctx); ok {
+			return js1key, pow, true
+		}
+		// 持有锁的副本获取失败后锁会过期，此时不再等待
+		if err := r.client.Get(ctx, r.lock).Err(); errors.Is(err, redis.Nil) {
+			return "", "", false
+		}
+	}
+}
+
+// load 读取Redis中保存的密钥，Redis不可用或内容无效时返回false
+func (r *RedisSessionStore) load(ctx context.Context) (string, string, bool) {
+	data, err := r.client.Get(ctx, r.key).Result()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			r.log.Warn("从Redis读取访问密钥失败", "error", err)
+		}
+		return "", "", false
+	}
+
+	var state sessionState
+	if err := json.Unmarshal([]byte(data), &state); err != nil || state.Js1key == "" || state.Pow == "" {
+		r.log.Warn("Redis中保存的访问密钥无效", "key", r.key)
+		return "", "", false
+	}
+	return state.Js1key, state.Pow, true
+}
+
+// Put 将刚被接受的访问密钥保存到Redis，并释放获取密钥时加的锁
+func (r *RedisSessionStore) Put(js1key, pow string) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	data, err := json.Marshal(sessionState{BaseURL: r.baseURL, Js1key: js1key, Pow: pow, ObtainedAt: time.Now()})
+	if err != nil {
+		return
+	}
+	if err := r.client.Set(ctx, r.key, data, r.ttl).Err(); err != nil {
+		r.log.Warn("保存访问密钥到Redis失败", "error", err)
+		return
+	}
+	if err := r.client.Del(ctx, r.lock).Err(); err != nil {
+		r.log.Debug("释放Redis锁失败", "error", err)
+	}
+}
+
+// Invalidate 从Redis中删除被拒绝的访问密钥，Redis中已是其他副本保存的新密钥时不做任何处理
+func (r *RedisSessionStore) Invalidate(js1key, pow string) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	if err := invalidateScript.Run(ctx, r.client, []string{r.key}, js1key, pow).Err(); err != nil {
+		r.log.Warn("从Redis删除访问密钥失败", "error", err)
+	}
+}
+
+// Close 关闭与Redis的连接
+func (r *RedisSessionStore) Close() error {
+	return r.client.Close()
+}
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"ping0/internal/config"
+	"ping0/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewTransport 根据配置创建与Ping0.cc通信使用的传输层
+// 服务器模式和批量查询中，所有会话共享同一个传输层以复用TCP和TLS连接，
+// 每个会话仍然使用独立的cookie jar，因此复用连接不会在查询之间共享cookie。
+//
+// 参数:
+//   - cfg: 运行时配置，使用其中的代理、HTTP连接配置以及连接和读取的超时时间
+//
+// 返回:
+//   - http.RoundTripper: 可以被多个会话并发使用的传输层
+//   - error: 如果代理地址或HTTP协议版本无效则返回相应错误
+func NewTransport(cfg *config.Config) (http.RoundTripper, error) {
+	proxyFunc, err := newProxyFunc(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxyFunc
+	transport.MaxIdleConns = cfg.MaxIdleConns
+	transport.MaxIdleConnsPerHost = cfg.MaxIdleConns
+	transport.IdleConnTimeout = cfg.IdleConnTimeout
+	transport.TLSHandshakeTimeout = cfg.TLSHandshakeTimeout
+	transport.DisableKeepAlives = cfg.DisableKeepAlives
+	transport.ResponseHeaderTimeout = cfg.ReadTimeout
+	if cfg.ConnectTimeout > 0 {
+		dialer := &net.Dialer{Timeout: cfg.ConnectTimeout, KeepAlive: 30 * time.Second}
+		transport.DialContext = dialer.DialContext
+	}
+
+	switch cfg.HTTPVersion {
+	case "", config.HTTPVersionAuto:
+		return transport, nil
+	case config.HTTPVersion1:
+		// 非nil的空TLSNextProto会关闭HTTP/2协商
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+		return transport, nil
+	case config.HTTPVersion2:
+		transport.ForceAttemptHTTP2 = true
+		return requireHTTP2{transport}, nil
+	default:
+		return nil, fmt.Errorf("不支持的HTTP协议版本: %s（支持auto、1.1、2）", cfg.HTTPVersion)
+	}
+}
+
+// requireHTTP2 拒绝没有使用HTTP/2的响应
+// net/http在站点不支持HTTP/2时会静默回退到HTTP/1.1，强制HTTP/2时需要在响应中检查。
+type requireHTTP2 struct {
+	next http.RoundTripper
+}
+
+// RoundTrip 发送请求，响应不是HTTP/2时关闭响应并返回错误
+func (t requireHTTP2) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.ProtoMajor != 2 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("站点没有使用HTTP/2（实际为 %s）", resp.Proto)
+	}
+	return resp, nil
+}
+
+// tracedTransport 为每个发往上游站点的请求记录一个客户端区间
+// 不向Ping0.cc发送traceparent头：第三方站点不参与追踪，多出的请求头反而让请求更容易被识别为脚本。
+type tracedTransport struct {
+	tracer trace.Tracer
+	next   http.RoundTripper
+}
+
+// RoundTrip 发送请求并记录区间
+func (t tracedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	_, span := t.tracer.Start(req.Context(), "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.full", req.URL.String()),
+			attribute.String("server.address", req.URL.Hostname()),
+		))
+	defer span.End()
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		tracing.SetError(span, err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		tracing.SetError(span, fmt.Errorf("HTTP %d", resp.StatusCode))
+	}
+	return resp, nil
+}
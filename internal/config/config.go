@@ -0,0 +1,377 @@
+// Package config defines the runtime configuration for the Pong0 application.
+// A Config value is created once by the caller (CLI, API server or library user)
+// and passed explicitly to the core, client and parser packages, so that
+// concurrent lookups never share mutable global state.
+package config
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"ping0/internal/asn"
+	"ping0/internal/audit"
+	"ping0/internal/auth"
+	"ping0/internal/constants"
+	"ping0/internal/i18n"
+	"ping0/internal/logfile"
+	"ping0/internal/logger"
+	"ping0/internal/providers"
+	"ping0/internal/stats"
+	"ping0/internal/store"
+	"ping0/internal/tracing"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/redis/go-redis/v9"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// DefaultPowMaxIterations 是POW计算的默认最大迭代次数
+const DefaultPowMaxIterations = 10000000
+
+// DefaultTimeout 是单个上游请求或一次POW计算的默认超时时间
+const DefaultTimeout = 10 * time.Second
+
+// DefaultShutdownTimeout 是服务器收到退出信号后等待进行中请求完成的默认时间
+const DefaultShutdownTimeout = 30 * time.Second
+
+// DefaultMaxQueryTimeout 是API调用方通过timeout参数可以设置的默认最长查询时间
+const DefaultMaxQueryTimeout = 60 * time.Second
+
+// 与Ping0.cc之间HTTP连接的默认参数，与net/http的默认传输层一致
+const (
+	DefaultMaxIdleConns        = 100
+	DefaultIdleConnTimeout     = 90 * time.Second
+	DefaultTLSHandshakeTimeout = 10 * time.Second
+)
+
+// HTTP协议版本选项
+const (
+	HTTPVersionAuto = "auto" // 站点支持时使用HTTP/2，否则使用HTTP/1.1
+	HTTPVersion1    = "1.1"  // 只使用HTTP/1.1
+	HTTPVersion2    = "2"    // 只接受HTTP/2响应
+)
+
+// 解析模式选项
+const (
+	ParseModeLenient = "lenient" // 返回已找到的字段，缺少的字段记录在missing_fields中
+	ParseModeStrict  = "strict"  // 任一应有的字段缺失时解析失败
+)
+
+// DefaultSessionTTL 是访问密钥复用的默认最长有效期
+const DefaultSessionTTL = 30 * time.Minute
+
+// DefaultSessionPoolRefresh 是会话池中访问密钥的默认刷新间隔
+const DefaultSessionPoolRefresh = 10 * time.Minute
+
+// DefaultQueueDepth 是限制查询并发时默认允许排队等待的查询数量
+const DefaultQueueDepth = 100
+
+// DefaultMonitorInterval 是监控模式下两轮查询之间的默认间隔
+const DefaultMonitorInterval = 10 * time.Minute
+
+// DefaultJobRetention 是服务器保留已完成的批量查询任务结果的默认时间
+const DefaultJobRetention = 10 * time.Minute
+
+// SessionStore 保存已被Ping0.cc接受的访问密钥（js1key和pow cookie），
+// 使后续查询可以跳过初始页面和POW计算，直接请求最终页面。
+// 实现必须可以被多个goroutine并发调用。
+type SessionStore interface {
+	// Get 返回当前可复用的访问密钥，没有可用密钥时ok为false
+	// 需要等待其他副本获取密钥的实现在ctx被取消时停止等待。
+	Get(ctx context.Context) (js1key, pow string, ok bool)
+	// Put 保存一组刚被接受的访问密钥
+	Put(js1key, pow string)
+	// Invalidate 丢弃被拒绝的访问密钥，当前保存的已是其他密钥时不做任何处理
+	Invalidate(js1key, pow string)
+}
+
+// SiteSessionStore 按站点分别保存访问密钥的SessionStore
+// WithBaseURL切换到镜像站点时通过ForBaseURL得到该站点的密钥，而不是停用密钥复用。
+type SiteSessionStore interface {
+	SessionStore
+	// ForBaseURL 返回只读写指定站点密钥的SessionStore
+	ForBaseURL(baseURL string) SessionStore
+}
+
+// UpstreamQueue 限制同时发往Ping0.cc的查询数量
+// 实现必须可以被多个goroutine并发调用。
+type UpstreamQueue interface {
+	// Acquire 获取一个查询名额，查询结束后必须调用返回的release函数
+	Acquire(ctx context.Context) (release func(), err error)
+}
+
+// UpstreamSelector 在主站和镜像站点之间选择查询使用的基础URL，并根据查询结果记录各站点的可用状态
+// 实现必须可以被多个goroutine并发调用。
+type UpstreamSelector interface {
+	// Pick 返回当前应使用的基础URL
+	Pick() string
+	// Report 报告一次使用baseURL的查询结果，err为nil表示查询成功
+	Report(baseURL string, err error)
+}
+
+// Config 存储一次运行（或一个服务器实例）所需的全部配置
+// 查询过程中不会修改Config，同一个实例可以被多个并发查询安全地共享。
+type Config struct {
+	// 命令行参数和运行时配置
+	Verbose         bool   // 是否显示详细日志信息
+	ManualX1Value   string // 手动指定的x1值，用于调试或绕过自动获取
+	ManualDiffValue string // 手动指定的difficulty值，用于调试或绕过自动获取
+	ServerMode      bool   // 是否以HTTP服务器模式运行
+	APIPort         string // HTTP服务器监听的端口号
+	APIKey          string // API验证密钥，用于限制API访问
+	APIKeysFile     string // 多个API密钥的配置文件（YAML或SQLite），每个密钥可以设置每日配额和允许的客户端IP
+	AdminKey        string // 管理员密钥，通过X-Admin-Key请求头提供后才能在POST /query中手动指定x1和difficulty、读取审计日志，为空时不允许
+	SigningKey      string // 响应签名密钥，设置后JSON查询结果带有HMAC-SHA256签名（signature字段），为空时不签名
+	TLSCert         string // 服务器的TLS证书文件（PEM），与TLSKey同时设置时以HTTPS提供服务
+	TLSKey          string // 服务器的TLS私钥文件（PEM）
+	ClientCA        string // 验证客户端证书的CA证书文件（PEM，可包含多个证书），设置后启用mTLS，需要同时设置TLSCert和TLSKey
+	RateLimit       int    // 每个客户端IP每分钟允许的查询次数，0表示不限制
+	GlobalRateLimit int    // 服务器每分钟允许的查询总次数，0表示不限制
+	RateRedis       string // 保存限流计数的Redis地址（redis://或rediss://），设置后RateLimit和GlobalRateLimit由全部副本共同遵守，为空时每个副本单独计数
+	TrustedProxies  string // 可信的反向代理，IP或CIDR网段以逗号分隔，只有来自这些地址的请求才根据X-Forwarded-For确定客户端IP，为空时一律使用连接的对端地址
+	Concurrency     int    // 同时发往Ping0.cc的最大查询数量，0表示不限制
+	QueueDepth      int    // 达到并发上限后允许排队等待的查询数量
+
+	ShutdownTimeout time.Duration // 服务器优雅退出时等待进行中请求完成的最长时间，0表示一直等待
+	MaxQueryTimeout time.Duration // API调用方通过timeout参数可以设置的最长查询时间，不大于0时使用默认值
+	Docs            bool          // 是否在/docs提供Swagger UI页面
+	CacheTTL        time.Duration // 服务器缓存查询结果的最长时间，0表示不缓存
+	CacheSoftTTL    time.Duration // 超过该时间的缓存结果在返回的同时后台刷新，0表示不刷新
+	JobRetention    time.Duration // 批量查询任务完成后保留结果的时间，不大于0时使用默认值
+	CacheDir        string        // 命令行查询结果的磁盘缓存目录，为空时使用用户缓存目录下的pong0
+	APIKeys         *auth.Keyring // 已加载的多密钥配置，由调用方根据APIKeysFile加载
+	RateStore       *redis.Client // 已连接的限流Redis客户端，由调用方根据RateRedis创建
+	SentryDSN       string        // 上报服务器panic的Sentry DSN，为空时只记录日志
+	Sentry          *sentry.Hub   // 已初始化的Sentry hub，由调用方根据SentryDSN通过sentry.Init创建，为nil时不上报
+
+	// Middleware 嵌入方添加的中间件，按顺序加入每个API路由的中间件链，
+	// 位于panic恢复和指标统计之内、CORS和API密钥验证之外
+	Middleware []func(http.Handler) http.Handler
+
+	// 访问日志配置
+	AccessLog        string // 访问日志文件路径，为空时不记录访问日志
+	AccessLogFormat  string // 访问日志格式，combined或json
+	AccessLogMaxSize int    // 单个访问日志文件的最大大小（MB），超过后轮转
+	AccessLogBackups int    // 保留的历史访问日志文件数量
+
+	// 审计日志配置
+	AuditLog       string        // 审计日志路径，扩展名为.db、.sqlite或.sqlite3时为SQLite数据库，postgres://开头时为PostgreSQL数据库，其他为JSON Lines文件，为空时不记录
+	Audit          audit.Log     // 已打开的审计日志，由调用方根据AuditLog打开
+	AuditRetention time.Duration // 服务器模式下审计日志的保留时间，更早的记录在后台定期删除，0表示永久保留
+
+	// 密钥计算相关配置
+	PowMaxIterations  int    // POW计算的最大迭代次数，不大于0时使用默认值
+	KeyAlgorithm      string // 密钥生成算法版本，为空或auto时根据JavaScript路径自动选择
+	AlgorithmFallback bool   // 密钥被拒绝时是否依次尝试其他已注册的算法版本
+
+	// 解析配置
+	SelectorsFile string // 解析结果页面使用的CSS选择器定义文件，为空时使用内置的定义
+	ParseMode     string // 解析模式，strict或lenient，为空时使用lenient
+
+	// 日志配置
+	LogLevel   string       // 日志级别，为空时由Verbose决定
+	LogFormat  string       // 日志输出格式
+	Lang       string       // 标签值（IP类型、风控等级等）的输出语言，zh或en
+	NoBranding bool         // 是否从输出中去掉固定添加的Princess字段
+	Logger     *slog.Logger // 结构化日志记录器，为nil时丢弃所有日志
+
+	// HTTP服务相关配置
+	BaseURL        string        // Ping0服务的基础URL
+	Mirrors        string        // 镜像站点的基础URL，多个以逗号分隔，主站不可用时依次切换
+	UserAgent      string        // HTTP请求的User-Agent头
+	HeaderProfile  string        // 浏览器请求头配置名称（如chrome-win），为空时使用UserAgent和Chrome的请求头
+	HeaderJitter   bool          // 是否在真实范围内随机变化每次查询的浏览器版本号、Accept-Language顺序等请求头
+	Proxy          string        // 代理地址，支持http、https、socks5协议，为空时使用环境变量中的代理设置
+	Timeout        time.Duration // 单个上游请求或一次POW计算的超时时间，不大于0时使用默认值
+	ConnectTimeout time.Duration // 建立TCP连接的超时时间，0表示只受Timeout约束
+	ReadTimeout    time.Duration // 发送请求后等待响应头的超时时间，0表示只受Timeout约束
+	Resolver       string        // 解析主机名和反向DNS使用的DNS服务器，为空时使用系统解析器
+	RDNS           bool          // 是否查询IP的反向DNS（PTR）记录
+
+	// HTTP连接配置
+	MaxIdleConns        int               // 保持的最大空闲连接数，所有请求都发往同一站点，因此同时作为单个主机的上限
+	IdleConnTimeout     time.Duration     // 空闲连接保持的时间
+	TLSHandshakeTimeout time.Duration     // TLS握手的超时时间
+	HTTPVersion         string            // HTTP协议版本，auto、1.1或2
+	DisableKeepAlives   bool              // 是否禁用连接复用，每个请求都建立新连接
+	Transport           http.RoundTripper // 所有查询共享的传输层，为nil时每个会话单独创建，由调用方根据以上配置创建
+
+	// 站点选择，为nil时总是使用BaseURL，由调用方根据BaseURL和Mirrors创建
+	Upstreams UpstreamSelector
+
+	// 会话复用配置
+	Queue        UpstreamQueue // 查询并发限制，为nil时不限制
+	Sessions     SessionStore  // 访问密钥复用存储，为nil时每次查询都重新完成握手和POW计算
+	SessionFile  string        // 访问密钥的持久化文件，为空时只在内存中复用
+	SessionRedis string        // 共享访问密钥的Redis地址（redis://或rediss://），多个副本共用同一组密钥，为空时不使用
+	SessionTTL   time.Duration // 访问密钥的最长复用时间，0表示直到被拒绝前一直复用
+	CookieFile   string        // cookie jar的持久化文件，保存站点设置的全部cookie，为空时不保存
+
+	// 会话池配置，仅服务器模式使用
+	SessionPoolSize    int           // 预先完成握手的访问密钥数量，0表示不使用会话池
+	SessionPoolRefresh time.Duration // 会话池中访问密钥的刷新间隔，不大于0时使用默认值
+
+	// 调试配置
+	DumpDir    string // 解析失败时保存原始HTML响应的目录，为空时不保存
+	JSPathFile string // 初始页面中脚本路径的记录文件，路径变化时发出警告，为空时只在进程内记录
+
+	// 已知可用的JavaScript文件内容SHA-256，多个以逗号分隔；下载的脚本不在其中且不是已注册算法登记的版本时视为未知脚本
+	KnownScriptHashes string
+
+	// 分布式追踪配置
+	OTLPEndpoint   string                   // OTLP/HTTP追踪接收端地址（如 http://localhost:4318），为空时不追踪
+	OTLPHeaders    string                   // 导出追踪时附带的请求头，格式为key=value，多个以逗号分隔
+	TracerProvider *sdktrace.TracerProvider // 已创建的追踪器提供者，为nil时不记录区间，由调用方根据OTLPEndpoint创建
+
+	// Stats 查询流程各阶段的耗时和成功率统计，由调用方通过core.NewStats创建，为nil时不统计
+	Stats *stats.Registry
+
+	// ASN注册数据配置
+	ASNDB       string        // ASN注册数据文件路径，为空时不补充ASN注册信息
+	ASNRegistry *asn.Registry // 已加载的ASN注册数据，由调用方根据ASNDB加载
+
+	// 附加数据源配置
+	MaxMindDB string               // MaxMind mmdb数据库路径，多个数据库以逗号分隔，为空时不使用
+	IPAPI     bool                 // 是否使用ip-api.com数据源
+	RIPEstat  bool                 // 是否使用RIPEstat数据源
+	Providers []providers.Provider // 已创建的附加数据源，按优先级排列，由调用方根据以上配置创建
+
+	// 降级配置
+	Fallback         bool               // Ping0.cc无法访问或验证失败时是否返回MaxMind数据库的降级结果
+	FallbackProvider providers.Provider // 生成降级结果的数据源，为nil时不降级，由调用方根据Fallback和MaxMindDB创建
+
+	// 历史记录配置
+	HistoryDB        string        // 历史记录数据库，SQLite文件路径或PostgreSQL连接地址（postgres://），服务器模式下同时保存已完成的批量查询任务，为空时不保存
+	History          store.Store   // 已打开的历史记录存储，由调用方根据HistoryDB打开
+	HistoryRetention time.Duration // 服务器模式下历史记录的保留时间，更早的记录在后台定期删除，0表示永久保留
+
+	// 监控配置
+	Webhook         string        // IP属性变化和初始页面中的脚本路径变化时接收通知的Webhook地址，为空时不发送通知
+	MonitorInterval time.Duration // 监控模式下两轮查询之间的间隔
+}
+
+// New 创建一个使用默认值的Config实例
+func New() *Config {
+	return &Config{
+		APIPort:             "8080",
+		PowMaxIterations:    DefaultPowMaxIterations,
+		LogFormat:           logger.FormatText,
+		Lang:                i18n.LangZH,
+		Timeout:             DefaultTimeout,
+		ShutdownTimeout:     DefaultShutdownTimeout,
+		MaxQueryTimeout:     DefaultMaxQueryTimeout,
+		AccessLogFormat:     "combined",
+		AccessLogMaxSize:    logfile.DefaultMaxSizeMB,
+		AccessLogBackups:    logfile.DefaultMaxBackups,
+		SessionTTL:          DefaultSessionTTL,
+		SessionPoolRefresh:  DefaultSessionPoolRefresh,
+		MonitorInterval:     DefaultMonitorInterval,
+		JobRetention:        DefaultJobRetention,
+		QueueDepth:          DefaultQueueDepth,
+		MaxIdleConns:        DefaultMaxIdleConns,
+		IdleConnTimeout:     DefaultIdleConnTimeout,
+		TLSHandshakeTimeout: DefaultTLSHandshakeTimeout,
+		HTTPVersion:         HTTPVersionAuto,
+		BaseURL:             constants.BaseURL,
+		UserAgent:           constants.UserAgent,
+	}
+}
+
+// Log 返回带有组件标签的日志记录器
+//
+// 参数:
+//   - component: 组件名称，如 client、parser、core、server
+//
+// 返回:
+//   - *slog.Logger: 附加了component属性的日志记录器
+func (c *Config) Log(component string) *slog.Logger {
+	if c.Logger == nil {
+		return logger.Discard().With("component", component)
+	}
+	return c.Logger.With("component", component)
+}
+
+// RequestTimeout 返回单个上游请求或一次POW计算的超时时间
+func (c *Config) RequestTimeout() time.Duration {
+	if c.Timeout <= 0 {
+		return DefaultTimeout
+	}
+	return c.Timeout
+}
+
+// Tracer 返回创建区间使用的追踪器，未启用追踪时返回不记录任何区间的追踪器
+func (c *Config) Tracer() trace.Tracer {
+	if c.TracerProvider == nil {
+		return noop.Tracer{}
+	}
+	return c.TracerProvider.Tracer(tracing.ScopeName)
+}
+
+// Branding 返回输出中是否包含固定添加的Princess字段，即NoBranding取反
+// 传给models.Princess和models.WithPrincess。
+func (c *Config) Branding() bool {
+	return !c.NoBranding
+}
+
+// WithBaseURL 返回使用另一个基础URL的配置副本，用于向镜像站点发起查询
+// 已保存的访问密钥只对获取它们的站点有效，因此基础URL与BaseURL不同时，副本不复用访问密钥，
+// 除非Sessions实现了SiteSessionStore，此时副本使用其中该站点的密钥。
+//
+// 参数:
+//   - baseURL: 本次查询使用的基础URL
+//
+// 返回:
+//   - *Config: baseURL与BaseURL相同时返回c本身，否则返回副本
+func (c *Config) WithBaseURL(baseURL string) *Config {
+	if baseURL == c.BaseURL {
+		return c
+	}
+	clone := *c
+	clone.BaseURL = baseURL
+	clone.Sessions = nil
+	if s, ok := c.Sessions.(SiteSessionStore); ok {
+		clone.Sessions = s.ForBaseURL(baseURL)
+	}
+	return &clone
+}
+
+// ForRequest 返回日志附带ctx中请求ID的配置副本，ctx中没有请求ID时返回c本身
+// 查询开始时调用一次，之后core、client和parser通过Log得到的日志记录器都会附带request_id属性，
+// 同一次查询的各个步骤的日志因此可以关联起来。
+func (c *Config) ForRequest(ctx context.Context) *Config {
+	id := logger.RequestID(ctx)
+	if id == "" || c.Logger == nil {
+		return c
+	}
+	clone := *c
+	clone.Logger = c.Logger.With("request_id", id)
+	return &clone
+}
+
+// QueryTimeoutLimit 返回API调用方通过timeout参数可以设置的最长查询时间
+func (c *Config) QueryTimeoutLimit() time.Duration {
+	if c.MaxQueryTimeout <= 0 {
+		return DefaultMaxQueryTimeout
+	}
+	return c.MaxQueryTimeout
+}
+
+// SessionPoolRefreshTime 返回会话池中访问密钥的刷新间隔
+func (c *Config) SessionPoolRefreshTime() time.Duration {
+	if c.SessionPoolRefresh <= 0 {
+		return DefaultSessionPoolRefresh
+	}
+	return c.SessionPoolRefresh
+}
+
+// JobRetentionTime 返回批量查询任务完成后保留结果的时间
+func (c *Config) JobRetentionTime() time.Duration {
+	if c.JobRetention <= 0 {
+		return DefaultJobRetention
+	}
+	return c.JobRetention
+}
@@ -0,0 +1,535 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFileName 是用户主目录下默认配置文件的名称
+const DefaultFileName = ".pong0.yaml"
+
+// EnvPrefix 是配置相关环境变量的前缀
+const EnvPrefix = "PONG0_"
+
+// fileConfig 配置文件的结构
+// 所有字段都是指针，以便区分“未设置”和“设置为零值”。
+type fileConfig struct {
+	Port              *string `yaml:"port"`                  // API服务器端口
+	APIKey            *string `yaml:"api_key"`               // API访问密钥
+	APIKeysFile       *string `yaml:"api_keys_file"`         // 多个API密钥的配置文件
+	AdminKey          *string `yaml:"admin_key"`             // 管理员密钥
+	SigningKey        *string `yaml:"signing_key"`           // 响应签名密钥
+	TLSCert           *string `yaml:"tls_cert"`              // 服务器的TLS证书文件
+	TLSKey            *string `yaml:"tls_key"`               // 服务器的TLS私钥文件
+	ClientCA          *string `yaml:"client_ca"`             // 验证客户端证书的CA证书文件
+	Proxy             *string `yaml:"proxy"`                 // 代理地址
+	BaseURL           *string `yaml:"base_url"`              // Ping0服务的基础URL
+	Mirrors           *string `yaml:"mirrors"`               // 镜像站点的基础URL，多个以逗号分隔
+	UserAgent         *string `yaml:"user_agent"`            // HTTP请求的User-Agent头
+	HeaderProfile     *string `yaml:"header_profile"`        // 浏览器请求头配置名称
+	HeaderJitter      *bool   `yaml:"header_jitter"`         // 是否随机变化请求头
+	Timeout           *string `yaml:"timeout"`               // 单个上游请求的超时时间，如 10s
+	ConnectTimeout    *string `yaml:"connect_timeout"`       // 建立TCP连接的超时时间，如 5s
+	ReadTimeout       *string `yaml:"read_timeout"`          // 等待响应头的超时时间，如 8s
+	Shutdown          *string `yaml:"shutdown_timeout"`      // 服务器优雅退出的等待时间，如 30s
+	MaxQueryTimeout   *string `yaml:"max_query_timeout"`     // API调用方可以设置的最长查询时间，如 60s
+	CacheTTL          *string `yaml:"cache_ttl"`             // 服务器缓存查询结果的最长时间，如 10m
+	CacheSoftTTL      *string `yaml:"cache_soft_ttl"`        // 超过该时间的缓存结果在后台刷新，如 2m
+	JobRetention      *string `yaml:"job_retention"`         // 批量查询任务完成后保留结果的时间，如 1h
+	CacheDir          *string `yaml:"cache_dir"`             // 命令行查询结果的磁盘缓存目录
+	Verbose           *bool   `yaml:"verbose"`               // 是否显示详细日志
+	LogLevel          *string `yaml:"log_level"`             // 日志级别
+	LogFormat         *string `yaml:"log_format"`            // 日志格式
+	Lang              *string `yaml:"lang"`                  // 标签值的输出语言
+	NoBranding        *bool   `yaml:"no_branding"`           // 是否去掉输出中的Princess字段
+	Rate              *int    `yaml:"rate"`                  // 每个客户端IP每分钟允许的查询次数
+	RateGlobal        *int    `yaml:"rate_global"`           // 服务器每分钟允许的查询总次数
+	RateRedis         *string `yaml:"rate_redis"`            // 保存限流计数的Redis地址
+	TrustedProxies    *string `yaml:"trusted_proxies"`       // 可信的反向代理，IP或CIDR网段以逗号分隔
+	Concurrency       *int    `yaml:"concurrency"`           // 同时发往Ping0.cc的最大查询数量
+	QueueDepth        *int    `yaml:"queue_depth"`           // 达到并发上限后允许排队等待的查询数量
+	Docs              *bool   `yaml:"docs"`                  // 是否提供Swagger UI页面
+	AccessLog         *string `yaml:"access_log"`            // 访问日志文件路径
+	AccessLogFormat   *string `yaml:"access_log_format"`     // 访问日志格式
+	AccessLogMaxSize  *int    `yaml:"access_log_max_size"`   // 单个访问日志文件的最大大小（MB）
+	AccessLogBackups  *int    `yaml:"access_log_backups"`    // 保留的历史访问日志文件数量
+	AuditLog          *string `yaml:"audit_log"`             // 审计日志路径
+	SentryDSN         *string `yaml:"sentry_dsn"`            // 上报服务器panic的Sentry DSN
+	PowMax            *int    `yaml:"pow_max"`               // POW计算的最大迭代次数
+	Algorithm         *string `yaml:"algorithm"`             // 密钥生成算法版本
+	AlgorithmFallback *bool   `yaml:"algorithm_fallback"`    // 密钥被拒绝时是否尝试其他算法版本
+	SelectorsFile     *string `yaml:"selectors_file"`        // 解析结果页面使用的CSS选择器定义文件
+	ParseMode         *string `yaml:"parse_mode"`            // 解析模式（strict、lenient）
+	SessionFile       *string `yaml:"session_file"`          // 访问密钥的持久化文件
+	SessionRedis      *string `yaml:"session_redis"`         // 共享访问密钥的Redis地址
+	JSPathFile        *string `yaml:"js_path_file"`          // 初始页面中脚本路径的记录文件
+	KnownScriptHashes *string `yaml:"known_script_hashes"`   // 已知可用的JavaScript文件SHA-256，多个以逗号分隔
+	CookieFile        *string `yaml:"cookie_file"`           // cookie jar的持久化文件
+	SessionTTL        *string `yaml:"session_ttl"`           // 访问密钥的最长复用时间，如 30m
+	SessionPool       *int    `yaml:"session_pool"`          // 服务器模式下预先完成握手的访问密钥数量
+	PoolRefresh       *string `yaml:"session_pool_refresh"`  // 会话池中访问密钥的刷新间隔，如 10m
+	Resolver          *string `yaml:"resolver"`              // 解析主机名使用的DNS服务器
+	MaxIdleConns      *int    `yaml:"max_idle_conns"`        // 保持的最大空闲连接数
+	IdleConnTimeout   *string `yaml:"idle_conn_timeout"`     // 空闲连接保持的时间，如 90s
+	TLSHandshake      *string `yaml:"tls_handshake_timeout"` // TLS握手的超时时间，如 10s
+	HTTPVersion       *string `yaml:"http_version"`          // HTTP协议版本（auto、1.1、2）
+	DisableKeepAlives *bool   `yaml:"disable_keepalives"`    // 是否禁用连接复用
+	RDNS              *bool   `yaml:"rdns"`                  // 是否查询反向DNS记录
+	HistoryDB         *string `yaml:"history_db"`            // 历史记录数据库路径或PostgreSQL连接地址
+	HistoryRetention  *string `yaml:"history_retention"`     // 历史记录的保留时间，如 720h
+	AuditRetention    *string `yaml:"audit_retention"`       // 审计日志的保留时间，如 2160h
+	DumpDir           *string `yaml:"dump_dir"`              // 解析失败时保存原始HTML响应的目录
+	OTLPEndpoint      *string `yaml:"otlp_endpoint"`         // OTLP/HTTP追踪接收端地址
+	OTLPHeaders       *string `yaml:"otlp_headers"`          // 导出追踪时附带的请求头
+	ASNDB             *string `yaml:"asn_db"`                // ASN注册数据文件路径
+	MaxMindDB         *string `yaml:"maxmind_db"`            // MaxMind mmdb数据库路径，多个以逗号分隔
+	IPAPI             *bool   `yaml:"ipapi"`                 // 是否使用ip-api.com数据源
+	RIPEstat          *bool   `yaml:"ripestat"`              // 是否使用RIPEstat数据源
+	Fallback          *bool   `yaml:"fallback"`              // Ping0.cc不可用时是否返回降级结果
+	Webhook           *string `yaml:"webhook"`               // IP属性变化时接收通知的Webhook地址
+	MonitorInterval   *string `yaml:"monitor_interval"`      // 监控模式的查询间隔，如 10m
+}
+
+// DefaultFilePath 返回默认配置文件路径（~/.pong0.yaml）
+// 无法确定用户主目录时返回空字符串
+func DefaultFilePath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, DefaultFileName)
+}
+
+// Load 按优先级加载配置：默认值 < 配置文件 < 环境变量
+// 命令行参数的优先级最高，由调用方在Load之后覆盖。
+//
+// 参数:
+//   - path: 配置文件路径，为空时尝试读取默认配置文件（不存在则忽略）
+//
+// 返回:
+//   - *Config: 加载后的配置
+//   - error: 如果配置文件或环境变量无效则返回相应错误
+func Load(path string) (*Config, error) {
+	cfg := New()
+
+	explicit := path != ""
+	if !explicit {
+		path = DefaultFilePath()
+	}
+
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			// 默认配置文件不存在时静默忽略，显式指定的文件必须存在
+			if explicit || !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// loadFile 从YAML配置文件中读取配置
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取配置文件失败: %w", err)
+	}
+
+	var fc fileConfig
+	if err := yaml.Unmarshal(data, &fc); err != nil {
+		return fmt.Errorf("解析配置文件 %s 失败: %w", path, err)
+	}
+
+	setString(&c.APIPort, fc.Port)
+	setString(&c.APIKey, fc.APIKey)
+	setString(&c.APIKeysFile, fc.APIKeysFile)
+	setString(&c.AdminKey, fc.AdminKey)
+	setString(&c.SigningKey, fc.SigningKey)
+	setString(&c.TLSCert, fc.TLSCert)
+	setString(&c.TLSKey, fc.TLSKey)
+	setString(&c.ClientCA, fc.ClientCA)
+	setString(&c.Proxy, fc.Proxy)
+	setString(&c.BaseURL, fc.BaseURL)
+	setString(&c.Mirrors, fc.Mirrors)
+	setString(&c.UserAgent, fc.UserAgent)
+	setString(&c.HeaderProfile, fc.HeaderProfile)
+	setString(&c.LogLevel, fc.LogLevel)
+	setString(&c.LogFormat, fc.LogFormat)
+	setString(&c.Lang, fc.Lang)
+	setString(&c.AccessLog, fc.AccessLog)
+	setString(&c.AccessLogFormat, fc.AccessLogFormat)
+	setString(&c.AuditLog, fc.AuditLog)
+	setString(&c.SessionFile, fc.SessionFile)
+	setString(&c.RateRedis, fc.RateRedis)
+	setString(&c.TrustedProxies, fc.TrustedProxies)
+	setString(&c.SessionRedis, fc.SessionRedis)
+	setString(&c.JSPathFile, fc.JSPathFile)
+	setString(&c.KnownScriptHashes, fc.KnownScriptHashes)
+	setString(&c.CookieFile, fc.CookieFile)
+	setString(&c.Resolver, fc.Resolver)
+	setString(&c.HTTPVersion, fc.HTTPVersion)
+	setString(&c.HistoryDB, fc.HistoryDB)
+	setString(&c.DumpDir, fc.DumpDir)
+	setString(&c.SentryDSN, fc.SentryDSN)
+	setString(&c.OTLPEndpoint, fc.OTLPEndpoint)
+	setString(&c.OTLPHeaders, fc.OTLPHeaders)
+	setString(&c.ASNDB, fc.ASNDB)
+	setString(&c.MaxMindDB, fc.MaxMindDB)
+	setString(&c.Webhook, fc.Webhook)
+	setString(&c.KeyAlgorithm, fc.Algorithm)
+	setString(&c.SelectorsFile, fc.SelectorsFile)
+	setString(&c.ParseMode, fc.ParseMode)
+	setString(&c.CacheDir, fc.CacheDir)
+	if err := setDuration(&c.Timeout, fc.Timeout, "timeout"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.ConnectTimeout, fc.ConnectTimeout, "connect_timeout"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.ReadTimeout, fc.ReadTimeout, "read_timeout"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.ShutdownTimeout, fc.Shutdown, "shutdown_timeout"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.MaxQueryTimeout, fc.MaxQueryTimeout, "max_query_timeout"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.CacheTTL, fc.CacheTTL, "cache_ttl"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.CacheSoftTTL, fc.CacheSoftTTL, "cache_soft_ttl"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.JobRetention, fc.JobRetention, "job_retention"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.HistoryRetention, fc.HistoryRetention, "history_retention"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.AuditRetention, fc.AuditRetention, "audit_retention"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.IdleConnTimeout, fc.IdleConnTimeout, "idle_conn_timeout"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.TLSHandshakeTimeout, fc.TLSHandshake, "tls_handshake_timeout"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.SessionTTL, fc.SessionTTL, "session_ttl"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.SessionPoolRefresh, fc.PoolRefresh, "session_pool_refresh"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.MonitorInterval, fc.MonitorInterval, "monitor_interval"); err != nil {
+		return err
+	}
+	if fc.Verbose != nil {
+		c.Verbose = *fc.Verbose
+	}
+	if fc.Concurrency != nil {
+		c.Concurrency = *fc.Concurrency
+	}
+	if fc.QueueDepth != nil {
+		c.QueueDepth = *fc.QueueDepth
+	}
+	if fc.SessionPool != nil {
+		c.SessionPoolSize = *fc.SessionPool
+	}
+	if fc.Docs != nil {
+		c.Docs = *fc.Docs
+	}
+	if fc.AlgorithmFallback != nil {
+		c.AlgorithmFallback = *fc.AlgorithmFallback
+	}
+	if fc.RDNS != nil {
+		c.RDNS = *fc.RDNS
+	}
+	if fc.HeaderJitter != nil {
+		c.HeaderJitter = *fc.HeaderJitter
+	}
+	if fc.MaxIdleConns != nil {
+		c.MaxIdleConns = *fc.MaxIdleConns
+	}
+	if fc.DisableKeepAlives != nil {
+		c.DisableKeepAlives = *fc.DisableKeepAlives
+	}
+	if fc.IPAPI != nil {
+		c.IPAPI = *fc.IPAPI
+	}
+	if fc.RIPEstat != nil {
+		c.RIPEstat = *fc.RIPEstat
+	}
+	if fc.Fallback != nil {
+		c.Fallback = *fc.Fallback
+	}
+	if fc.NoBranding != nil {
+		c.NoBranding = *fc.NoBranding
+	}
+	if fc.Rate != nil {
+		c.RateLimit = *fc.Rate
+	}
+	if fc.RateGlobal != nil {
+		c.GlobalRateLimit = *fc.RateGlobal
+	}
+	if fc.AccessLogMaxSize != nil {
+		c.AccessLogMaxSize = *fc.AccessLogMaxSize
+	}
+	if fc.AccessLogBackups != nil {
+		c.AccessLogBackups = *fc.AccessLogBackups
+	}
+	if fc.PowMax != nil {
+		c.PowMaxIterations = *fc.PowMax
+	}
+
+	return nil
+}
+
+// loadEnv 从PONG0_前缀的环境变量中读取配置
+func (c *Config) loadEnv() error {
+	// 同时支持容器平台（如Cloud Run、Heroku）通过PORT环境变量指定的监听端口，PONG0_PORT优先
+	if v := strings.TrimSpace(os.Getenv("PORT")); v != "" {
+		c.APIPort = v
+	}
+	envString(&c.APIPort, "PORT")
+	envString(&c.APIKey, "API_KEY")
+	envString(&c.APIKeysFile, "API_KEYS_FILE")
+	envString(&c.AdminKey, "ADMIN_KEY")
+	envString(&c.SigningKey, "SIGNING_KEY")
+	envString(&c.TLSCert, "TLS_CERT")
+	envString(&c.TLSKey, "TLS_KEY")
+	envString(&c.ClientCA, "CLIENT_CA")
+	envString(&c.Proxy, "PROXY")
+	envString(&c.BaseURL, "BASE_URL")
+	envString(&c.Mirrors, "MIRRORS")
+	envString(&c.UserAgent, "USER_AGENT")
+	envString(&c.HeaderProfile, "HEADER_PROFILE")
+	envString(&c.LogLevel, "LOG_LEVEL")
+	envString(&c.LogFormat, "LOG_FORMAT")
+	envString(&c.Lang, "LANG")
+	envString(&c.AccessLog, "ACCESS_LOG")
+	envString(&c.AccessLogFormat, "ACCESS_LOG_FORMAT")
+	envString(&c.AuditLog, "AUDIT_LOG")
+	envString(&c.SessionFile, "SESSION_FILE")
+	envString(&c.RateRedis, "RATE_REDIS")
+	envString(&c.TrustedProxies, "TRUSTED_PROXIES")
+	envString(&c.SessionRedis, "SESSION_REDIS")
+	envString(&c.JSPathFile, "JS_PATH_FILE")
+	envString(&c.KnownScriptHashes, "KNOWN_SCRIPT_HASHES")
+	envString(&c.CookieFile, "COOKIE_FILE")
+	envString(&c.CacheDir, "CACHE_DIR")
+	envString(&c.Resolver, "RESOLVER")
+	envString(&c.HTTPVersion, "HTTP_VERSION")
+	envString(&c.HistoryDB, "HISTORY_DB")
+	envString(&c.DumpDir, "DUMP_DIR")
+	// 同时支持OpenTelemetry的标准环境变量，PONG0_前缀的环境变量优先
+	if v := strings.TrimSpace(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")); v != "" {
+		c.OTLPEndpoint = v
+	}
+	if v := strings.TrimSpace(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")); v != "" {
+		c.OTLPHeaders = v
+	}
+	envString(&c.OTLPEndpoint, "OTLP_ENDPOINT")
+	envString(&c.OTLPHeaders, "OTLP_HEADERS")
+	// 同时支持Sentry SDK使用的标准环境变量
+	if v := strings.TrimSpace(os.Getenv("SENTRY_DSN")); v != "" {
+		c.SentryDSN = v
+	}
+	envString(&c.SentryDSN, "SENTRY_DSN")
+	envString(&c.ASNDB, "ASN_DB")
+	envString(&c.MaxMindDB, "MAXMIND_DB")
+	envString(&c.Webhook, "WEBHOOK")
+	envString(&c.KeyAlgorithm, "ALGORITHM")
+	envString(&c.SelectorsFile, "SELECTORS_FILE")
+	envString(&c.ParseMode, "PARSE_MODE")
+
+	if err := envDuration(&c.Timeout, "TIMEOUT"); err != nil {
+		return err
+	}
+	if err := envDuration(&c.ConnectTimeout, "CONNECT_TIMEOUT"); err != nil {
+		return err
+	}
+	if err := envDuration(&c.ReadTimeout, "READ_TIMEOUT"); err != nil {
+		return err
+	}
+	if err := envDuration(&c.ShutdownTimeout, "SHUTDOWN_TIMEOUT"); err != nil {
+		return err
+	}
+	if err := envDuration(&c.MaxQueryTimeout, "MAX_QUERY_TIMEOUT"); err != nil {
+		return err
+	}
+	if err := envDuration(&c.CacheTTL, "CACHE_TTL"); err != nil {
+		return err
+	}
+	if err := envDuration(&c.CacheSoftTTL, "CACHE_SOFT_TTL"); err != nil {
+		return err
+	}
+	if err := envDuration(&c.JobRetention, "JOB_RETENTION"); err != nil {
+		return err
+	}
+	if err := envDuration(&c.HistoryRetention, "HISTORY_RETENTION"); err != nil {
+		return err
+	}
+	if err := envDuration(&c.AuditRetention, "AUDIT_RETENTION"); err != nil {
+		return err
+	}
+	if err := envDuration(&c.IdleConnTimeout, "IDLE_CONN_TIMEOUT"); err != nil {
+		return err
+	}
+	if err := envDuration(&c.TLSHandshakeTimeout, "TLS_HANDSHAKE_TIMEOUT"); err != nil {
+		return err
+	}
+	if err := envDuration(&c.SessionTTL, "SESSION_TTL"); err != nil {
+		return err
+	}
+	if err := envDuration(&c.SessionPoolRefresh, "SESSION_POOL_REFRESH"); err != nil {
+		return err
+	}
+	if err := envDuration(&c.MonitorInterval, "MONITOR_INTERVAL"); err != nil {
+		return err
+	}
+	if err := envBool(&c.Verbose, "VERBOSE"); err != nil {
+		return err
+	}
+	if err := envBool(&c.Docs, "DOCS"); err != nil {
+		return err
+	}
+	if err := envBool(&c.AlgorithmFallback, "ALGORITHM_FALLBACK"); err != nil {
+		return err
+	}
+	if err := envBool(&c.RDNS, "RDNS"); err != nil {
+		return err
+	}
+	if err := envBool(&c.HeaderJitter, "HEADER_JITTER"); err != nil {
+		return err
+	}
+	if err := envBool(&c.DisableKeepAlives, "DISABLE_KEEPALIVES"); err != nil {
+		return err
+	}
+	if err := envInt(&c.MaxIdleConns, "MAX_IDLE_CONNS"); err != nil {
+		return err
+	}
+	if err := envBool(&c.IPAPI, "IPAPI"); err != nil {
+		return err
+	}
+	if err := envBool(&c.RIPEstat, "RIPESTAT"); err != nil {
+		return err
+	}
+	if err := envBool(&c.Fallback, "FALLBACK"); err != nil {
+		return err
+	}
+	if err := envBool(&c.NoBranding, "NO_BRANDING"); err != nil {
+		return err
+	}
+	if err := envInt(&c.RateLimit, "RATE"); err != nil {
+		return err
+	}
+	if err := envInt(&c.GlobalRateLimit, "RATE_GLOBAL"); err != nil {
+		return err
+	}
+	if err := envInt(&c.Concurrency, "CONCURRENCY"); err != nil {
+		return err
+	}
+	if err := envInt(&c.QueueDepth, "QUEUE_DEPTH"); err != nil {
+		return err
+	}
+	if err := envInt(&c.SessionPoolSize, "SESSION_POOL"); err != nil {
+		return err
+	}
+	if err := envInt(&c.AccessLogMaxSize, "ACCESS_LOG_MAX_SIZE"); err != nil {
+		return err
+	}
+	if err := envInt(&c.AccessLogBackups, "ACCESS_LOG_BACKUPS"); err != nil {
+		return err
+	}
+	return envInt(&c.PowMaxIterations, "POW_MAX")
+}
+
+// setString 在配置文件设置了值时覆盖目标字段
+func setString(dst *string, v *string) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+// setDuration 在配置文件设置了值时解析并覆盖时间字段
+func setDuration(dst *time.Duration, v *string, key string) error {
+	if v == nil {
+		return nil
+	}
+	d, err := time.ParseDuration(*v)
+	if err != nil {
+		return fmt.Errorf("配置文件中的%s无效: %w", key, err)
+	}
+	*dst = d
+	return nil
+}
+
+// lookupEnv 读取带前缀的环境变量，空值视为未设置
+func lookupEnv(name string) (string, bool) {
+	v, ok := os.LookupEnv(EnvPrefix + name)
+	v = strings.TrimSpace(v)
+	return v, ok && v != ""
+}
+
+// envString 在环境变量存在时覆盖字符串字段
+func envString(dst *string, name string) {
+	if v, ok := lookupEnv(name); ok {
+		*dst = v
+	}
+}
+
+// envDuration 在环境变量存在时覆盖时间字段
+func envDuration(dst *time.Duration, name string) error {
+	v, ok := lookupEnv(name)
+	if !ok {
+		return nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("环境变量 %s%s 无效: %w", EnvPrefix, name, err)
+	}
+	*dst = d
+	return nil
+}
+
+// envBool 在环境变量存在时覆盖布尔字段
+func envBool(dst *bool, name string) error {
+	v, ok := lookupEnv(name)
+	if !ok {
+		return nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("环境变量 %s%s 无效: %w", EnvPrefix, name, err)
+	}
+	*dst = b
+	return nil
+}
+
+// envInt 在环境变量存在时覆盖整数字段
+func envInt(dst *int, name string) error {
+	v, ok := lookupEnv(name)
+	if !ok {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("环境变量 %s%s 无效: %w", EnvPrefix, name, err)
+	}
+	*dst = n
+	return nil
+}
@@ -3,87 +3,445 @@
 package core
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"time"
 
 	"ping0/internal/client"
-	"ping0/internal/constants"
+	"ping0/internal/config"
+	"ping0/internal/logger"
+	"ping0/internal/metrics"
 	"ping0/internal/models"
 	"ping0/internal/parser"
+	"ping0/internal/providers"
+	"ping0/internal/stats"
+	"ping0/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 查询流程的步骤名称，用于按步骤统计错误
+const (
+	StepInitialPage = "initial_page" // 获取初始页面
+	StepKeyGen      = "key_gen"      // 生成访问密钥
+	StepFinalPage   = "final_page"   // 获取最终页面
+	StepChallenge   = "challenge"    // 访问密钥被拒绝
+	StepParse       = "parse"        // 解析IP信息
 )
 
+// NewStats 创建记录查询流程各阶段耗时和成功率的统计注册表，供config.Config.Stats使用
+// 初始页面和最终页面是发往上游站点的请求，生成密钥（POW计算）和解析是本地计算，
+// 对比两类阶段的耗时可以判断查询变慢的原因在上游还是在本地。
+//
+// 返回:
+//   - *stats.Registry: 新的统计注册表
+func NewStats() *stats.Registry {
+	return stats.New(
+		stats.Stage{Name: StepInitialPage, Upstream: true},
+		stats.Stage{Name: StepKeyGen},
+		stats.Stage{Name: StepFinalPage, Upstream: true},
+		stats.Stage{Name: StepParse},
+	)
+}
+
 // ProcessIPInfo 处理获取IP信息的完整流程
 // 该函数协调整个IP信息检索和解析过程的工作流程：
 // 1. 获取初始页面并提取关键参数
 // 2. 生成必要的访问密钥
 // 3. 获取并解析包含IP信息的最终页面
+// 配置了镜像站点时，当前站点无法访问会立即换用下一个可用的站点重试；
+// 配置了降级数据源时，Ping0.cc无法访问或验证失败会返回本地数据库生成的降级结果，而不是错误。
 //
 // 参数:
+//   - ctx: 控制整个查询流程的上下文，取消后正在进行的请求和密钥计算会尽快退出；
+//     带有请求ID（见logger.WithRequestID）时，查询过程中的每条日志都附带该ID
+//   - cfg: 运行时配置，查询过程中不会被修改，可在并发查询间共享
 //   - queryIP: 要查询的IP地址，如果为空则查询当前IP
 //
 // 返回:
 //   - *models.IPInfo: 包含IP详细信息的结构体
 //   - error: 如果过程中出现错误则返回对应错误信息
-func ProcessIPInfo(queryIP string) (*models.IPInfo, error) {
-	// 设置当前查询的IP
-	constants.QueryIP = queryIP
+func ProcessIPInfo(ctx context.Context, cfg *config.Config, queryIP string) (*models.IPInfo, error) {
+	cfg = cfg.ForRequest(ctx)
+	ctx, span := cfg.Tracer().Start(ctx, "pong0.lookup")
+	defer span.End()
+	span.SetAttributes(attribute.String("pong0.query_ip", queryIP))
+	if id := logger.RequestID(ctx); id != "" {
+		span.SetAttributes(attribute.String("pong0.request_id", id))
+	}
+
+	ipInfo, err := lookupUpstreams(ctx, cfg, queryIP)
+	if err != nil && shouldFallback(cfg, queryIP, err) {
+		ipInfo, err = fallback(ctx, cfg, queryIP, err)
+	}
+	if err != nil {
+		tracing.SetError(span, err)
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.String("pong0.ip", ipInfo.IP))
+	if ipInfo.Source != "" {
+		span.SetAttributes(attribute.String("pong0.fallback_source", ipInfo.Source))
+	}
+	return ipInfo, nil
+}
+
+// lookupUpstreams 依次向可用的站点发起查询，直到查询成功、失败原因与站点无关或所有站点都已尝试过
+// 未配置镜像站点时等同于lookup。参数和返回值与ProcessIPInfo相同。
+func lookupUpstreams(ctx context.Context, cfg *config.Config, queryIP string) (*models.IPInfo, error) {
+	if cfg.Upstreams == nil {
+		return lookup(ctx, cfg, queryIP)
+	}
+
+	tried := make(map[string]bool)
+	for {
+		baseURL := cfg.Upstreams.Pick()
+		ipInfo, err := lookup(ctx, cfg.WithBaseURL(baseURL), queryIP)
+		// 调用方取消或超时导致的失败不能说明站点不可用
+		if ctx.Err() != nil {
+			return ipInfo, err
+		}
+		cfg.Upstreams.Report(baseURL, err)
+		tried[baseURL] = true
+
+		if err == nil || !client.IsUpstreamFailure(err) {
+			return ipInfo, err
+		}
+		if next := cfg.Upstreams.Pick(); tried[next] {
+			return nil, err
+		}
+		cfg.Log("core").Warn("站点查询失败，切换到下一个站点", "base_url", baseURL, "error", err)
+	}
+}
+
+// lookup 向Ping0.cc完成一次查询，参数和返回值与ProcessIPInfo相同
+func lookup(ctx context.Context, cfg *config.Config, queryIP string) (*models.IPInfo, error) {
+	log := cfg.Log("core")
+
+	// 限制同时发往Ping0.cc的查询数量，没有空闲名额时排队等待
+	if cfg.Queue != nil {
+		release, err := cfg.Queue.Acquire(ctx)
+		if err != nil {
+			log.Debug("查询未能获取名额", "ip", queryIP, "error", err)
+			return nil, err
+		}
+		defer release()
+	}
 
 	// 记录开始时间，用于性能分析
 	startTime := time.Now()
-	if constants.Verbose {
-		log.Printf("开始查询IP信息: %s", queryIP)
+	log.Debug("开始查询IP信息", "ip", queryIP)
+
+	// 每次查询使用独立的会话，保证并发查询之间互不影响
+	session, err := client.NewSession(cfg)
+	if err != nil {
+		recordFailure(StepInitialPage, startTime)
+		return nil, fmt.Errorf("创建会话失败: %w", err)
 	}
 
-	// 步骤1: 获取初始页面，提取x1值、difficulty值和JavaScript路径
-	stepStartTime := time.Now()
-	x1Value, difficultyValue, jsPath, err := client.GetInitialPage()
+	// 优先复用之前被接受的访问密钥，跳过初始页面和POW计算
+	if finalHtml, keys, ok := reuseSession(ctx, cfg, session, queryIP); ok {
+		return finishLookup(ctx, cfg, session, queryIP, finalHtml, keys, startTime)
+	}
+
+	finalHtml, keys, err := handshake(ctx, cfg, session, queryIP, startTime)
 	if err != nil {
-		return nil, fmt.Errorf("Step 1 失败: %w", err)
+		return nil, err
 	}
-	if constants.Verbose {
-		log.Printf("成功获取x1值: %s", x1Value)
-		log.Printf("成功获取difficulty值: %s", difficultyValue)
-		log.Printf("JS路径: %s", jsPath)
-		log.Printf("Step 1 完成，耗时: %s", time.Since(stepStartTime))
+
+	// 步骤3: 解析HTML获取IP信息
+	return finishLookup(ctx, cfg, session, queryIP, finalHtml, keys, startTime)
+}
+
+// handshake 完成握手流程（获取初始页面、生成访问密钥）并获取最终页面
+// 密钥被拒绝时（启用算法回退时先尝试其他算法版本）返回错误；被接受的密钥保存到cfg.Sessions供后续查询复用。
+//
+// 参数:
+//   - ctx: 请求上下文
+//   - cfg: 运行时配置
+//   - session: 本次查询使用的会话
+//   - queryIP: 要查询的IP地址
+//   - startTime: 查询开始时间，失败时用于记录指标
+//
+// 返回:
+//   - string: 最终页面的HTML内容
+//   - *parser.Keys: 被接受的访问密钥
+//   - error: 如果任一步骤失败则返回相应错误
+func handshake(ctx context.Context, cfg *config.Config, session *client.Session, queryIP string, startTime time.Time) (string, *parser.Keys, error) {
+	log := cfg.Log("core")
+
+	// 步骤1: 获取初始页面，提取x1值、difficulty值和JavaScript路径，手动指定的值优先
+	stepStartTime := time.Now()
+	params, err := session.GetInitialPage(ctx, challengeOverride(ctx, cfg))
+	cfg.Stats.Record(StepInitialPage, time.Since(stepStartTime), err)
+	if err != nil {
+		recordFailure(StepInitialPage, startTime)
+		return "", nil, fmt.Errorf("Step 1 失败: %w", err)
 	}
+	x1Value, difficultyValue, jsPath := params.X1, params.Difficulty, params.JSPath
+	log.Debug("Step 1 完成", "x1", x1Value, "difficulty", difficultyValue, "js_path", jsPath, "elapsed", time.Since(stepStartTime))
 
 	// 步骤2: 生成访问密钥并获取包含IP信息的最终页面
 	stepStartTime = time.Now()
-	keys, err := parser.GenerateKey(jsPath, x1Value, difficultyValue)
+	_, powSpan := cfg.Tracer().Start(ctx, "pong0.key_gen", trace.WithAttributes(attribute.String("pong0.difficulty", difficultyValue)))
+	keys, err := parser.GenerateKey(ctx, cfg, jsPath, x1Value, difficultyValue)
+	tracing.SetError(powSpan, err)
+	powSpan.End()
+	cfg.Stats.Record(StepKeyGen, time.Since(stepStartTime), err)
+	if err != nil {
+		recordFailure(StepKeyGen, startTime)
+		return "", nil, fmt.Errorf("Step 2 失败: %w", err)
+	}
+	log.Debug("成功生成keys", "js1key", keys.Js1key, "pow", keys.Pow)
+
+	finishFinalPage := cfg.Stats.Start(StepFinalPage)
+	finalHtml, err := session.GetFinalPage(ctx, queryIP, keys)
+	finishFinalPage(err)
 	if err != nil {
-		return nil, fmt.Errorf("Step 2 失败: %w", err)
+		recordFailure(StepFinalPage, startTime)
+		return "", nil, fmt.Errorf("Step 2 失败: %w", err)
+	}
+
+	// 验证密钥是否被接受：被拒绝时服务器会再次返回验证页面
+	if parser.IsChallengePage(finalHtml) {
+		log.Warn("访问密钥被拒绝", "algorithm", keys.Algorithm, "js_path", jsPath)
+		finalHtml, keys, err = retryWithFallback(ctx, cfg, session, queryIP, keys.Algorithm, x1Value, difficultyValue)
+		if err != nil {
+			recordFailure(StepChallenge, startTime)
+			err = fmt.Errorf("Step 2 失败: %w（算法 %s，%s）", err, keys.Algorithm, scriptNote(ctx, cfg, session, jsPath))
+			dumpResponses(cfg, session, queryIP, StepChallenge, err)
+			return "", nil, err
+		}
 	}
-	if constants.Verbose {
-		log.Printf("成功生成keys: js1key=%s, pow=%s", keys.Js1key, keys.Pow)
+	log.Debug("Step 2 完成", "length", len(finalHtml), "elapsed", time.Since(stepStartTime))
+
+	// 保存被接受的密钥供后续查询复用，并把当前脚本记为已知可用的版本
+	if cfg.Sessions != nil {
+		cfg.Sessions.Put(keys.Js1key, keys.Pow)
 	}
+	client.MarkScriptVerified(cfg, jsPath, keys.Algorithm)
+	return finalHtml, keys, nil
+}
 
-	finalHtml, err := client.GetFinalPage(keys)
+// scriptNote 返回密钥被拒绝时错误信息中对脚本的说明
+// 重新下载脚本并给出内容哈希以及是否为已知版本，便于确认Ping0.cc是否更换了脚本；下载失败时只给出脚本路径。
+func scriptNote(ctx context.Context, cfg *config.Config, session *client.Session, jsPath string) string {
+	fp, err := session.RefreshScriptFingerprint(ctx, jsPath)
 	if err != nil {
-		return nil, fmt.Errorf("Step 2 失败: %w", err)
+		cfg.Log("core").Debug("下载脚本计算指纹失败", "path", jsPath, "error", err)
+		return "JS路径 " + jsPath
 	}
-	if constants.Verbose {
-		log.Printf("成功获取最终页面，长度: %d", len(finalHtml))
-		log.Printf("Step 2 完成，耗时: %s", time.Since(stepStartTime))
+	return fp.String()
+}
+
+// finishLookup 解析最终页面并完成一次成功查询的收尾工作（记录指标、补充反向DNS、附加数据源和ASN注册信息、保存cookie和历史记录）
+//
+// 参数:
+//   - ctx: 请求上下文
+//   - cfg: 运行时配置
+//   - session: 本次查询使用的会话，解析失败时从中取出原始响应保存到DumpDir
+//   - queryIP: 要查询的IP地址
+//   - finalHtml: 最终页面的HTML内容
+//   - keys: 获取最终页面使用的访问密钥
+//   - startTime: 查询开始时间
+//
+// 返回:
+//   - *models.IPInfo: 解析出的IP信息
+//   - error: 如果解析失败则返回相应错误
+func finishLookup(ctx context.Context, cfg *config.Config, session *client.Session, queryIP, finalHtml string, keys *parser.Keys, startTime time.Time) (*models.IPInfo, error) {
+	log := cfg.Log("core")
+
+	stepStartTime := time.Now()
+	ipInfo, err := parser.ParseIPInfo(cfg, finalHtml)
+	cfg.Stats.Record(StepParse, time.Since(stepStartTime), err)
+
+	// 页面中有未渲染的模板占位符说明验证尚未通过：丢弃这组密钥，重新握手后再解析一次
+	if errors.Is(err, parser.ErrUnrenderedPage) {
+		log.Warn("最终页面没有渲染，重新握手后重试", "error", err)
+		if cfg.Sessions != nil {
+			cfg.Sessions.Invalidate(keys.Js1key, keys.Pow)
+		}
+		finalHtml, keys, err = handshake(ctx, cfg, session, queryIP, startTime)
+		if err != nil {
+			return nil, err
+		}
+		stepStartTime = time.Now()
+		ipInfo, err = parser.ParseIPInfo(cfg, finalHtml)
+		cfg.Stats.Record(StepParse, time.Since(stepStartTime), err)
 	}
 
-	// 步骤3: 解析HTML获取IP信息
-	stepStartTime = time.Now()
-	ipInfo, err := parser.ParseIPInfo(finalHtml)
 	if err != nil {
-		if constants.Verbose {
-			log.Printf("解析IP信息失败: %v", err)
+		log.Debug("解析IP信息失败", "error", err)
+		step := StepParse
+		if errors.Is(err, parser.ErrUnrenderedPage) {
+			step = StepChallenge
+			if cfg.Sessions != nil {
+				cfg.Sessions.Invalidate(keys.Js1key, keys.Pow)
+			}
 		}
-		return nil, fmt.Errorf("Step 3 失败: %v", err)
+		recordFailure(step, startTime)
+		err = fmt.Errorf("Step 3 失败: %w", err)
+		dumpResponses(cfg, session, queryIP, step, err)
+		return nil, err
 	}
-	if constants.Verbose {
-		log.Printf("解析IP信息完成，耗时: %s", time.Since(stepStartTime))
-		log.Printf("总耗时: %s", time.Since(startTime))
+	log.Debug("Step 3 完成", "elapsed", time.Since(stepStartTime), "total", time.Since(startTime))
+	ipInfo.QueriedAt = time.Now().UTC().Format(time.RFC3339)
+
+	metrics.Lookups.WithLabelValues("success").Inc()
+	metrics.LookupDuration.Observe(time.Since(startTime).Seconds())
+
+	// 查询反向DNS记录
+	if cfg.RDNS {
+		lookupPTR(ctx, cfg, ipInfo)
 	}
 
-	// 清除本次查询状态，为下一次查询准备
-	constants.QueryIP = ""
-	constants.ManualX1Value = ""
+	// 使用附加数据源补充并交叉验证结果
+	if len(cfg.Providers) > 0 {
+		enrichCtx, cancel := context.WithTimeout(ctx, cfg.RequestTimeout())
+		providers.Enrich(enrichCtx, cfg.Providers, ipInfo, log)
+		cancel()
+	}
+
+	// 使用本地ASN注册数据补充名称、国家和RIR
+	if cfg.ASNRegistry != nil && ipInfo.ASNNumber > 0 {
+		if info, ok := cfg.ASNRegistry.Lookup(ipInfo.ASNNumber); ok {
+			ipInfo.ASNRegistry = info
+		} else {
+			log.Debug("ASN注册数据中没有该ASN", "asn", ipInfo.ASNNumber)
+		}
+	}
+
+	// 保存cookie供下次运行复用
+	if cfg.CookieFile != "" {
+		if err := session.SaveCookies(); err != nil {
+			log.Warn("保存cookie文件失败", "path", cfg.CookieFile, "error", err)
+		}
+	}
+
+	// 保存历史记录，失败时只记录日志，不影响本次查询结果
+	if cfg.History != nil {
+		if err := cfg.History.Save(ctx, ipInfo, startTime, Tag(ctx)); err != nil {
+			log.Warn("保存历史记录失败", "ip", ipInfo.IP, "error", err)
+		}
+	}
 
 	return ipInfo, nil
 }
+
+// retryWithFallback 在密钥被拒绝后依次尝试其他已注册的算法版本
+// 未启用算法回退时直接返回ErrAlgorithmChanged。
+//
+// 参数:
+//   - ctx: 请求上下文
+//   - cfg: 运行时配置
+//   - session: 本次查询使用的会话
+//   - queryIP: 要查询的IP地址
+//   - rejected: 生成被拒绝密钥的算法版本
+//   - x1Value: 从初始页面提取的x1值
+//   - difficultyValue: 从初始页面提取的difficulty值
+//
+// 返回:
+//   - string: 最终页面的HTML内容
+//   - *parser.Keys: 被接受的密钥；失败时返回仅包含被拒绝算法版本的Keys，供错误信息使用
+//   - error: 所有算法都被拒绝时返回包装了ErrAlgorithmChanged的错误
+func retryWithFallback(ctx context.Context, cfg *config.Config, session *client.Session, queryIP, rejected, x1Value, difficultyValue string) (string, *parser.Keys, error) {
+	failed := &parser.Keys{Algorithm: rejected}
+	if !cfg.AlgorithmFallback {
+		return "", failed, parser.ErrAlgorithmChanged
+	}
+
+	log := cfg.Log("core")
+	for _, alg := range parser.FallbackAlgorithms(rejected) {
+		keys, err := parser.GenerateKeyWith(ctx, cfg, alg, x1Value, difficultyValue)
+		if err != nil {
+			log.Debug("回退算法生成密钥失败", "algorithm", alg.Version, "error", err)
+			continue
+		}
+
+		finalHtml, err := session.GetFinalPage(ctx, queryIP, keys)
+		if err != nil {
+			return "", failed, err
+		}
+		if !parser.IsChallengePage(finalHtml) {
+			log.Warn("回退算法的密钥被接受，请考虑更新默认算法", "algorithm", alg.Version, "rejected", rejected)
+			return finalHtml, keys, nil
+		}
+		log.Debug("回退算法的密钥同样被拒绝", "algorithm", alg.Version)
+	}
+
+	return "", failed, parser.ErrAlgorithmChanged
+}
+
+// reuseSession 尝试使用已保存的访问密钥（进程内或cookie文件中）直接获取最终页面
+// 密钥被拒绝（返回验证页面）时会丢弃已保存的密钥；无论被拒绝还是请求失败，
+// 都由调用方回退到完整的握手流程。
+//
+// 参数:
+//   - ctx: 请求上下文
+//   - cfg: 运行时配置
+//   - session: 本次查询使用的会话
+//   - queryIP: 要查询的IP地址
+//
+// 返回:
+//   - string: 最终页面的HTML内容
+//   - *parser.Keys: 复用的访问密钥
+//   - bool: 是否成功复用了已保存的密钥
+func reuseSession(ctx context.Context, cfg *config.Config, session *client.Session, queryIP string) (string, *parser.Keys, bool) {
+	// 手动指定验证参数时用于调试握手流程，不复用密钥
+	if challengeOverride(ctx, cfg) != nil || !sessionReuseAllowed(ctx) {
+		return "", nil, false
+	}
+
+	// 优先使用进程内保存的密钥，其次使用cookie文件中的密钥
+	var js1key, pow string
+	ok, fromCookieFile := false, false
+	if cfg.Sessions != nil {
+		js1key, pow, ok = cfg.Sessions.Get(ctx)
+	}
+	if !ok {
+		js1key, pow, ok = session.SavedKeys()
+		fromCookieFile = ok
+	}
+	if !ok {
+		return "", nil, false
+	}
+
+	log := cfg.Log("core")
+	stepStartTime := time.Now()
+	keys := &parser.Keys{Js1key: js1key, Pow: pow}
+	finalHtml, err := session.GetFinalPage(ctx, queryIP, keys)
+	cfg.Stats.Record(StepFinalPage, time.Since(stepStartTime), err)
+	if err != nil {
+		// 请求失败不一定是密钥的问题，保留密钥，交给完整流程重试
+		log.Debug("复用密钥请求最终页面失败，回退到完整流程", "error", err)
+		return "", nil, false
+	}
+	if parser.IsChallengePage(finalHtml) {
+		log.Debug("复用的密钥已被拒绝，重新握手")
+		if cfg.Sessions != nil && !fromCookieFile {
+			cfg.Sessions.Invalidate(js1key, pow)
+		}
+		return "", nil, false
+	}
+
+	// cookie文件中的密钥仍然有效，进程内的后续查询也复用它们
+	if fromCookieFile && cfg.Sessions != nil {
+		cfg.Sessions.Put(js1key, pow)
+	}
+
+	log.Debug("复用密钥获取最终页面完成", "length", len(finalHtml), "elapsed", time.Since(stepStartTime))
+	return finalHtml, keys, true
+}
+
+// recordFailure 记录一次失败查询的指标
+//
+// 参数:
+//   - step: 失败的步骤名称
+//   - startTime: 查询开始时间
+func recordFailure(step string, startTime time.Time) {
+	metrics.Lookups.WithLabelValues("error").Inc()
+	metrics.LookupErrors.WithLabelValues(step).Inc()
+	metrics.LookupDuration.Observe(time.Since(startTime).Seconds())
+}
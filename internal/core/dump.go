@@ -0,0 +1,89 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ping0/internal/client"
+	"ping0/internal/config"
+	"ping0/internal/constants"
+)
+
+// dumpEntry meta.json中一个响应的描述
+type dumpEntry struct {
+	client.Response
+	File string `json:"file"` // 保存响应内容的文件名
+}
+
+// dumpMeta 保存在meta.json中的请求信息
+type dumpMeta struct {
+	QueryIP   string      `json:"query_ip"`   // 查询的IP，为空表示查询当前IP
+	Step      string      `json:"step"`       // 失败的步骤
+	Error     string      `json:"error"`      // 失败原因
+	Version   string      `json:"version"`    // 程序版本
+	CreatedAt time.Time   `json:"created_at"` // 保存时间
+	Responses []dumpEntry `json:"responses"`  // 按收到顺序排列的响应
+}
+
+// dumpFileName 将查询IP转换为可以用作目录名的形式，IPv6地址中的冒号在部分系统上不能出现在文件名中
+var dumpFileName = strings.NewReplacer(":", "_", "/", "_", "\\", "_")
+
+// dumpResponses 查询失败时把会话中记录的原始响应和请求信息保存到cfg.DumpDir
+// 每次失败保存到一个独立的子目录，包含按顺序编号的HTML文件和描述请求信息的meta.json。
+// 保存失败只记录日志，不影响查询返回的错误。
+//
+// 参数:
+//   - cfg: 运行时配置
+//   - session: 本次查询使用的会话
+//   - queryIP: 要查询的IP地址
+//   - step: 失败的步骤，如StepParse
+//   - lookupErr: 查询失败的原因
+func dumpResponses(cfg *config.Config, session *client.Session, queryIP, step string, lookupErr error) {
+	responses := session.Responses()
+	if cfg.DumpDir == "" || len(responses) == 0 {
+		return
+	}
+	log := cfg.Log("core")
+
+	name := queryIP
+	if name == "" {
+		name = "current"
+	}
+	now := time.Now()
+	dir := filepath.Join(cfg.DumpDir, now.Format("20060102-150405.000")+"-"+dumpFileName.Replace(name))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Warn("创建原始响应保存目录失败", "dir", dir, "error", err)
+		return
+	}
+
+	meta := dumpMeta{
+		QueryIP:   queryIP,
+		Step:      step,
+		Error:     lookupErr.Error(),
+		Version:   constants.Version,
+		CreatedAt: now,
+	}
+	for i, resp := range responses {
+		file := fmt.Sprintf("%02d-%s.html", i+1, resp.Step)
+		if err := os.WriteFile(filepath.Join(dir, file), resp.Body, 0o644); err != nil {
+			log.Warn("保存原始响应失败", "file", file, "error", err)
+			return
+		}
+		meta.Responses = append(meta.Responses, dumpEntry{Response: resp, File: file})
+	}
+
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, "meta.json"), data, 0o644)
+	}
+	if err != nil {
+		log.Warn("保存请求信息失败", "dir", dir, "error", err)
+		return
+	}
+
+	log.Warn("已保存原始响应，可附在问题报告中", "dir", dir)
+}
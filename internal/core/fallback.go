@@ -0,0 +1,80 @@
+package core
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"ping0/internal/config"
+	perrors "ping0/internal/errors"
+	"ping0/internal/metrics"
+	"ping0/internal/models"
+)
+
+// SourceFallback 降级结果的source字段值，表示结果来自本地数据库而不是Ping0.cc
+const SourceFallback = "fallback"
+
+// shouldFallback 判断查询失败后是否应返回降级结果
+// 只有配置了降级数据源、查询的是指定IP，且失败原因是Ping0.cc无法访问或验证失败时才降级；
+// 解析失败、本服务繁忙、调用方取消等情况仍然返回错误。查询当前IP时无法离线得知出口IP，因此不降级。
+func shouldFallback(cfg *config.Config, queryIP string, err error) bool {
+	if cfg.FallbackProvider == nil || queryIP == "" || perrors.Is(err, context.Canceled) {
+		return false
+	}
+	switch perrors.Class(err) {
+	case perrors.ErrNetwork, perrors.ErrTimeout, perrors.ErrUpstreamBlocked, perrors.ErrChallengeFailed:
+		return true
+	default:
+		return false
+	}
+}
+
+// fallback 使用降级数据源生成IP信息
+// 降级结果只包含本地数据库能提供的位置和ASN字段，风控值、IP类型等Ping0.cc特有的字段为空，
+// source字段为SourceFallback，fallback_reason字段记录Ping0.cc查询失败的原因。
+//
+// 参数:
+//   - ctx: 请求上下文
+//   - cfg: 运行时配置
+//   - queryIP: 要查询的IP地址
+//   - cause: Ping0.cc查询失败的原因
+//
+// 返回:
+//   - *models.IPInfo: 降级的IP信息
+//   - error: 如果降级数据源也查询失败，返回原始错误
+func fallback(ctx context.Context, cfg *config.Config, queryIP string, cause error) (*models.IPInfo, error) {
+	log := cfg.Log("core")
+
+	src, err := cfg.FallbackProvider.Lookup(ctx, queryIP)
+	if err != nil {
+		log.Warn("降级数据源查询失败", "ip", queryIP, "error", err)
+		return nil, cause
+	}
+
+	ipInfo := models.NewIPInfo()
+	ipInfo.Princess = models.Princess(cfg.Branding())
+	ipInfo.IP = queryIP
+	ipInfo.CountryCode = src.CountryCode
+	ipInfo.Country = src.Country
+	ipInfo.Region = src.Region
+	ipInfo.City = src.City
+	ipInfo.Lat = src.Lat
+	ipInfo.Lon = src.Lon
+	if src.Lat != 0 || src.Lon != 0 {
+		ipInfo.Latitude = strconv.FormatFloat(src.Lat, 'f', -1, 64)
+		ipInfo.Longitude = strconv.FormatFloat(src.Lon, 'f', -1, 64)
+	}
+	if src.ASNNumber != 0 {
+		ipInfo.ASNNumber = src.ASNNumber
+		ipInfo.ASN = "AS" + strconv.Itoa(src.ASNNumber)
+	}
+	ipInfo.ASNOwner = src.ASNOwner
+	ipInfo.Organization = src.Organization
+	ipInfo.Source = SourceFallback
+	ipInfo.FallbackReason = cause.Error()
+	ipInfo.QueriedAt = time.Now().UTC().Format(time.RFC3339)
+
+	metrics.LookupFallbacks.WithLabelValues(cfg.FallbackProvider.Name()).Inc()
+	log.Warn("Ping0.cc查询失败，返回本地数据库的降级结果", "ip", queryIP, "source", cfg.FallbackProvider.Name(), "error", cause)
+	return ipInfo, nil
+}
@@ -0,0 +1,34 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"ping0/internal/config"
+	"ping0/internal/models"
+)
+
+// SaveCachedResult 将来自缓存的查询结果以上下文中的标签保存到历史记录
+// 命中缓存的查询不会访问Ping0.cc，本身不保存历史记录；但带标签的查询需要把同一批次中的每个IP都记录下来，
+// 因此以结果原本的查询时间再保存一条带标签的记录。没有标签或未启用历史记录时不做任何事，保存失败时只记录日志。
+//
+// 参数:
+//   - ctx: 查询上下文
+//   - cfg: 运行时配置
+//   - info: 缓存中的查询结果
+func SaveCachedResult(ctx context.Context, cfg *config.Config, info *models.IPInfo) {
+	tag := Tag(ctx)
+	if tag == "" || cfg.History == nil {
+		return
+	}
+
+	queriedAt, err := time.Parse(time.RFC3339, info.QueriedAt)
+	if err != nil {
+		queriedAt = time.Now()
+	}
+	saved := *info
+	saved.AgeSeconds = nil
+	if err := cfg.History.Save(ctx, &saved, queriedAt, tag); err != nil {
+		cfg.ForRequest(ctx).Log("core").Warn("保存历史记录失败", "ip", info.IP, "error", err)
+	}
+}
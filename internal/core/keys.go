@@ -0,0 +1,100 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"ping0/internal/client"
+	"ping0/internal/config"
+	"ping0/internal/models"
+	"ping0/internal/parser"
+)
+
+// GenerateKeys 只完成查询流程的前半部分：获取初始页面并计算访问密钥，不请求最终页面
+// 不会复用或保存会话中的密钥，每次调用都重新完成握手和POW计算。
+//
+// 参数:
+//   - ctx: 控制请求和密钥计算的上下文
+//   - cfg: 运行时配置
+//
+// 返回:
+//   - *models.KeyInfo: 初始页面中的参数和计算出的密钥
+//   - error: 如果获取初始页面或生成密钥失败则返回相应错误
+func GenerateKeys(ctx context.Context, cfg *config.Config) (*models.KeyInfo, error) {
+	log := cfg.Log("core")
+
+	session, err := client.NewSession(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("创建会话失败: %w", err)
+	}
+
+	stepStartTime := time.Now()
+	params, err := session.GetInitialPage(ctx, challengeOverride(ctx, cfg))
+	if err != nil {
+		return nil, fmt.Errorf("Step 1 失败: %w", err)
+	}
+	x1Value, difficultyValue, jsPath := params.X1, params.Difficulty, params.JSPath
+	log.Debug("Step 1 完成", "x1", x1Value, "difficulty", difficultyValue, "js_path", jsPath, "elapsed", time.Since(stepStartTime))
+
+	stepStartTime = time.Now()
+	keys, err := parser.GenerateKey(ctx, cfg, jsPath, x1Value, difficultyValue)
+	if err != nil {
+		return nil, fmt.Errorf("Step 2 失败: %w", err)
+	}
+	log.Debug("成功生成keys", "js1key", keys.Js1key, "pow", keys.Pow, "elapsed", time.Since(stepStartTime))
+
+	return &models.KeyInfo{
+		X1:         x1Value,
+		Difficulty: difficultyValue,
+		JSPath:     jsPath,
+		Algorithm:  keys.Algorithm,
+		Js1key:     keys.Js1key,
+		Pow:        keys.Pow,
+		Princess:   models.Princess(cfg.Branding()),
+	}, nil
+}
+
+// Warmup 完成一次完整的握手并验证访问密钥是否被接受，供服务器启动时提前发现问题
+// 使用计算出的密钥请求当前IP的最终页面，密钥被拒绝时（启用算法回退时先尝试其他算法版本）
+// 返回包装了parser.ErrAlgorithmChanged的错误；被接受的密钥保存到cfg.Sessions，第一次查询即可直接复用。
+//
+// 参数:
+//   - ctx: 控制请求和密钥计算的上下文
+//   - cfg: 运行时配置
+//
+// 返回:
+//   - *models.KeyInfo: 初始页面中的参数和被接受的密钥
+//   - error: 如果握手、生成密钥失败或密钥被拒绝则返回相应错误
+func Warmup(ctx context.Context, cfg *config.Config) (*models.KeyInfo, error) {
+	info, err := GenerateKeys(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := client.NewSession(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("创建会话失败: %w", err)
+	}
+	keys := &parser.Keys{Js1key: info.Js1key, Pow: info.Pow, Algorithm: info.Algorithm}
+	finalHtml, err := session.GetFinalPage(ctx, "", keys)
+	if err != nil {
+		return nil, fmt.Errorf("Step 2 失败: %w", err)
+	}
+	if parser.IsChallengePage(finalHtml) {
+		cfg.Log("core").Warn("预热时访问密钥被拒绝", "algorithm", keys.Algorithm, "js_path", info.JSPath)
+		_, keys, err = retryWithFallback(ctx, cfg, session, "", keys.Algorithm, info.X1, info.Difficulty)
+		if err != nil {
+			err = fmt.Errorf("Step 2 失败: %w（算法 %s，%s）", err, keys.Algorithm, scriptNote(ctx, cfg, session, info.JSPath))
+			dumpResponses(cfg, session, "", StepChallenge, err)
+			return nil, err
+		}
+		info.Algorithm, info.Js1key, info.Pow = keys.Algorithm, keys.Js1key, keys.Pow
+	}
+
+	if cfg.Sessions != nil {
+		cfg.Sessions.Put(info.Js1key, info.Pow)
+	}
+	client.MarkScriptVerified(cfg, info.JSPath, info.Algorithm)
+	return info, nil
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"context"
+
+	"ping0/internal/config"
+	"ping0/internal/parser"
+)
+
+// noSessionReuseKey 上下文键，标记本次查询不复用已保存的访问密钥
+type noSessionReuseKey struct{}
+
+// WithoutSessionReuse 返回标记了不复用已保存访问密钥的上下文
+// 使用该上下文的查询总是重新完成握手和POW计算，成功后新的密钥仍会被保存，供后续查询复用。
+//
+// 参数:
+//   - ctx: 原始上下文
+//
+// 返回:
+//   - context.Context: 带有标记的上下文
+func WithoutSessionReuse(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noSessionReuseKey{}, true)
+}
+
+// sessionReuseAllowed 判断查询是否可以复用已保存的访问密钥
+func sessionReuseAllowed(ctx context.Context) bool {
+	return ctx.Value(noSessionReuseKey{}) == nil
+}
+
+// challengeParamsKey 上下文键，保存本次查询手动指定的验证参数
+type challengeParamsKey struct{}
+
+// WithChallengeParams 返回为本次查询手动指定x1值和difficulty值的上下文
+// 与-x1、-diff参数的作用相同，但只影响使用该上下文的查询，优先于配置中手动指定的值；
+// 为空的值仍然来自初始页面（见parser.ResolveChallengeParams）。手动指定参数的查询不复用已保存的访问密钥。
+//
+// 参数:
+//   - ctx: 原始上下文
+//   - x1: 手动指定的x1值，为空时使用页面中的值
+//   - difficulty: 手动指定的difficulty值，为空时使用页面中的值（指定了x1时为x1的前3个字符）
+//
+// 返回:
+//   - context.Context: 带有验证参数的上下文，两个值都为空时返回原始上下文
+func WithChallengeParams(ctx context.Context, x1, difficulty string) context.Context {
+	if x1 == "" && difficulty == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, challengeParamsKey{}, &parser.ChallengeParams{X1: x1, Difficulty: difficulty})
+}
+
+// challengeOverride 返回本次查询手动指定的验证参数：优先使用上下文中的值，其次使用配置中的-x1、-diff，都没有时返回nil
+func challengeOverride(ctx context.Context, cfg *config.Config) *parser.ChallengeParams {
+	if params, ok := ctx.Value(challengeParamsKey{}).(*parser.ChallengeParams); ok {
+		return params
+	}
+	return parser.ManualChallengeParams(cfg)
+}
+
+// tagKey 上下文键，保存本次查询附带的标签
+type tagKey struct{}
+
+// WithTag 返回为本次查询附带标签的上下文
+// 标签与查询结果一起保存到历史记录中，便于按批次（如一次代理采购）分组查看和导出，不影响查询本身。
+//
+// 参数:
+//   - ctx: 原始上下文
+//   - tag: 标签，应已通过store.CheckTag检查，为空时返回原始上下文
+//
+// 返回:
+//   - context.Context: 带有标签的上下文
+func WithTag(ctx context.Context, tag string) context.Context {
+	if tag == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, tagKey{}, tag)
+}
+
+// Tag 返回本次查询附带的标签，没有时返回空字符串
+func Tag(ctx context.Context) string {
+	tag, _ := ctx.Value(tagKey{}).(string)
+	return tag
+}
@@ -0,0 +1,75 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"ping0/internal/config"
+	perrors "ping0/internal/errors"
+)
+
+// ErrQueueFull 表示同时进行的查询已达上限，且排队等待的查询也已达上限
+var ErrQueueFull = perrors.Wrap(perrors.ErrOverloaded, errors.New("查询队列已满，请稍后重试"))
+
+// Queue 限制同时发往Ping0.cc的查询数量
+// 最多concurrency个查询同时进行，超出的查询排队等待，排队数量超过depth时立即返回ErrQueueFull。
+// 实现了config.UpstreamQueue接口，可以被多个goroutine并发使用。
+type Queue struct {
+	slots   chan struct{} // 每个元素代表一个正在进行的查询
+	depth   int64         // 允许排队等待的最大查询数量
+	waiting atomic.Int64  // 当前排队等待的查询数量
+}
+
+// NewQueue 创建一个查询队列
+//
+// 参数:
+//   - concurrency: 同时进行的最大查询数量，必须大于0
+//   - depth: 允许排队等待的最大查询数量，小于0时使用config.DefaultQueueDepth，为0时不排队
+//
+// 返回:
+//   - *Queue: 新创建的查询队列
+func NewQueue(concurrency, depth int) *Queue {
+	if depth < 0 {
+		depth = config.DefaultQueueDepth
+	}
+	return &Queue{
+		slots: make(chan struct{}, concurrency),
+		depth: int64(depth),
+	}
+}
+
+// Acquire 获取一个查询名额，没有空闲名额时排队等待
+//
+// 参数:
+//   - ctx: 等待的上下文，取消后停止等待
+//
+// 返回:
+//   - func(): 查询结束后必须调用的释放函数
+//   - error: 队列已满时返回ErrQueueFull，等待期间ctx被取消时返回ctx.Err()
+func (q *Queue) Acquire(ctx context.Context) (func(), error) {
+	// 有空闲名额时直接获取，不占用排队名额
+	select {
+	case q.slots <- struct{}{}:
+		return q.release, nil
+	default:
+	}
+
+	if q.waiting.Add(1) > q.depth {
+		q.waiting.Add(-1)
+		return nil, ErrQueueFull
+	}
+	defer q.waiting.Add(-1)
+
+	select {
+	case q.slots <- struct{}{}:
+		return q.release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// release 释放一个查询名额
+func (q *Queue) release() {
+	<-q.slots
+}
@@ -0,0 +1,37 @@
+package core
+
+import (
+	"context"
+
+	"ping0/internal/config"
+	"ping0/internal/models"
+	"ping0/internal/resolver"
+)
+
+// lookupPTR 查询IP的反向DNS记录并写入ipInfo.PTR
+// Ping0.cc页面不包含主机名信息，因此单独向DNS查询。失败时只记录日志，不影响查询结果。
+//
+// 参数:
+//   - ctx: 请求上下文
+//   - cfg: 运行时配置，使用其中的Resolver和超时时间
+//   - ipInfo: 已解析的IP信息
+func lookupPTR(ctx context.Context, cfg *config.Config, ipInfo *models.IPInfo) {
+	log := cfg.Log("core")
+
+	r, err := resolver.New(cfg.Resolver)
+	if err != nil {
+		log.Warn("创建DNS解析器失败", "error", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.RequestTimeout())
+	defer cancel()
+
+	ptr, err := resolver.LookupPTR(ctx, r, ipInfo.IP)
+	if err != nil {
+		log.Debug("查询反向DNS失败", "ip", ipInfo.IP, "error", err)
+		return
+	}
+	ipInfo.PTR = ptr
+	log.Debug("查询到反向DNS", "ip", ipInfo.IP, "ptr", ptr)
+}
@@ -0,0 +1,132 @@
+// Package diskcache stores lookup results on disk so that repeated command
+// line queries for the same IP within a TTL are answered without any network
+// access. Each result is kept in its own JSON file named after a hash of the
+// cache key.
+package diskcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"ping0/internal/models"
+)
+
+// Cache 保存在磁盘目录中的查询结果缓存
+// 多个进程可以同时使用同一个目录：写入时先写临时文件再重命名，读取到的文件总是完整的。
+type Cache struct {
+	dir string        // 缓存目录
+	ttl time.Duration // 结果的最长使用时间
+}
+
+// entry 缓存文件的内容
+type entry struct {
+	SavedAt time.Time      `json:"saved_at"` // 保存时间
+	Result  *models.IPInfo `json:"result"`   // 查询结果
+}
+
+// DefaultDir 返回默认的缓存目录
+// 即用户缓存目录下的pong0子目录，Linux上遵循XDG_CACHE_HOME（默认 ~/.cache/pong0），
+// macOS上为 ~/Library/Caches/pong0，Windows上为 %LocalAppData%\pong0。
+//
+// 返回:
+//   - string: 默认缓存目录
+//   - error: 如果无法确定用户缓存目录则返回相应错误
+func DefaultDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "pong0"), nil
+}
+
+// New 创建磁盘缓存，目录在第一次写入时创建
+//
+// 参数:
+//   - dir: 缓存目录
+//   - ttl: 结果的最长使用时间
+//
+// 返回:
+//   - *Cache: 新的磁盘缓存
+func New(dir string, ttl time.Duration) *Cache {
+	return &Cache{dir: dir, ttl: ttl}
+}
+
+// Get 读取缓存的结果
+// 文件不存在、无法解析或已过期时视为没有缓存，过期的文件会被删除。
+//
+// 参数:
+//   - key: 缓存键
+//
+// 返回:
+//   - *models.IPInfo: 缓存的结果，AgeSeconds为结果已缓存的秒数
+//   - bool: 是否有可用的结果
+func (c *Cache) Get(key string) (*models.IPInfo, bool) {
+	path := c.path(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil || e.Result == nil {
+		return nil, false
+	}
+	age := time.Since(e.SavedAt)
+	if age > c.ttl || age < 0 {
+		os.Remove(path)
+		return nil, false
+	}
+
+	seconds := int(age.Seconds())
+	e.Result.AgeSeconds = &seconds
+	return e.Result, true
+}
+
+// Put 保存查询结果，降级结果不缓存
+//
+// 参数:
+//   - key: 缓存键
+//   - info: 查询结果
+//
+// 返回:
+//   - error: 如果写入失败则返回相应错误
+func (c *Cache) Put(key string, info *models.IPInfo) error {
+	if info.Source != "" {
+		return nil
+	}
+
+	result := *info
+	result.AgeSeconds = nil
+	data, err := json.Marshal(entry{SavedAt: time.Now(), Result: &result})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(c.dir, 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.dir, "*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(key))
+}
+
+// path 返回缓存键对应的文件路径
+func (c *Cache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:16])+".json")
+}
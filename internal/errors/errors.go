@@ -0,0 +1,120 @@
+// Package errors defines the error classes shared by the Pong0 packages.
+// Lower layers (client, parser, core) wrap their errors with one of the
+// exported sentinels, so that callers such as the API server and the CLI can
+// map failures to HTTP status codes or exit codes with errors.Is, without
+// matching on error strings.
+package errors
+
+import (
+	stderrors "errors"
+)
+
+// 错误类别，使用errors.Is判断错误属于哪一类
+var (
+	// ErrChallengeFailed 无法完成Ping0.cc的验证（缺少x1、POW失败、密钥被拒绝等）
+	ErrChallengeFailed = stderrors.New("验证失败")
+
+	// ErrUpstreamBlocked Ping0.cc拒绝了请求（如返回403），通常意味着出口IP被封禁
+	ErrUpstreamBlocked = stderrors.New("上游拒绝访问")
+
+	// ErrParseFailure 无法从返回的页面中解析出IP信息
+	ErrParseFailure = stderrors.New("解析失败")
+
+	// ErrRateLimited 请求被限流，可能来自Ping0.cc（429）或本服务自身的限流
+	ErrRateLimited = stderrors.New("请求过于频繁")
+
+	// ErrTimeout 请求或计算超时
+	ErrTimeout = stderrors.New("超时")
+
+	// ErrNetwork 无法连接Ping0.cc（DNS解析失败、连接被拒绝、代理错误等）
+	ErrNetwork = stderrors.New("网络错误")
+
+	// ErrOverloaded 本服务同时进行的查询过多，查询没有发往Ping0.cc
+	ErrOverloaded = stderrors.New("服务繁忙")
+)
+
+// classified 为错误附加类别，Error()保持原始错误信息不变
+type classified struct {
+	class error
+	err   error
+}
+
+// Error 返回原始错误信息
+func (c *classified) Error() string {
+	return c.err.Error()
+}
+
+// Unwrap 同时暴露错误类别和原始错误，使errors.Is/As对两者都有效
+func (c *classified) Unwrap() []error {
+	return []error{c.class, c.err}
+}
+
+// Wrap 将err标记为指定类别
+// err为nil时返回nil；err已经属于该类别时原样返回。
+//
+// 参数:
+//   - class: 错误类别，如ErrTimeout
+//   - err: 原始错误
+//
+// 返回:
+//   - error: 既匹配class又匹配err的错误，错误信息与err相同
+func Wrap(class, err error) error {
+	if err == nil || stderrors.Is(err, class) {
+		return err
+	}
+	return &classified{class: class, err: err}
+}
+
+// Class 返回错误所属的类别，不属于任何已知类别时返回nil
+// 一个错误同时属于多个类别时，按ErrTimeout、ErrNetwork、ErrRateLimited、ErrUpstreamBlocked、
+// ErrChallengeFailed、ErrParseFailure、ErrOverloaded的顺序返回第一个匹配的类别。
+func Class(err error) error {
+	for _, class := range []error{ErrTimeout, ErrNetwork, ErrRateLimited, ErrUpstreamBlocked, ErrChallengeFailed, ErrParseFailure, ErrOverloaded} {
+		if stderrors.Is(err, class) {
+			return class
+		}
+	}
+	return nil
+}
+
+// Code 返回错误类别对应的机器可读代码，便于API调用方和脚本判断失败原因
+func Code(err error) string {
+	switch Class(err) {
+	case ErrTimeout:
+		return "timeout"
+	case ErrNetwork:
+		return "network"
+	case ErrRateLimited:
+		return "rate_limited"
+	case ErrUpstreamBlocked:
+		return "upstream_blocked"
+	case ErrChallengeFailed:
+		return "challenge_failed"
+	case ErrParseFailure:
+		return "parse_failure"
+	case ErrOverloaded:
+		return "overloaded"
+	default:
+		return "internal"
+	}
+}
+
+// New 等同于标准库的errors.New
+func New(text string) error {
+	return stderrors.New(text)
+}
+
+// Is 等同于标准库的errors.Is
+func Is(err, target error) bool {
+	return stderrors.Is(err, target)
+}
+
+// As 等同于标准库的errors.As
+func As(err error, target interface{}) bool {
+	return stderrors.As(err, target)
+}
+
+// Unwrap 等同于标准库的errors.Unwrap
+func Unwrap(err error) error {
+	return stderrors.Unwrap(err)
+}
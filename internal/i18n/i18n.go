@@ -0,0 +1,132 @@
+// Package i18n translates the label values scraped from Ping0.cc. The page is
+// only available in Chinese, so IP types, risk labels, ASN/organisation types
+// risk factors and the native IP label are mapped to English for consumers that request it.
+// Values without a known translation are left unchanged.
+package i18n
+
+import (
+	"fmt"
+	"strings"
+
+	"ping0/internal/models"
+)
+
+// 支持的输出语言
+const (
+	LangZH = "zh" // 简体中文，与Ping0.cc页面一致（默认）
+	LangEN = "en" // 英文
+)
+
+// Validate 检查语言是否受支持
+func Validate(lang string) error {
+	switch lang {
+	case LangZH, LangEN:
+		return nil
+	default:
+		return fmt.Errorf("不支持的语言: %s（可选 zh、en）", lang)
+	}
+}
+
+// english 已知标签的英文翻译
+var english = map[string]string{
+	// IP类型
+	"IDC机房IP": "Datacenter IP",
+	"机房IP":    "Datacenter IP",
+	"家庭宽带IP":  "Residential broadband IP",
+	"家宽IP":    "Residential broadband IP",
+	"商业宽带IP":  "Business broadband IP",
+	"企业专线IP":  "Enterprise leased line IP",
+	"手机移动IP":  "Mobile network IP",
+	"移动网络IP":  "Mobile network IP",
+	"教育网IP":   "Education network IP",
+	"校园网IP":   "Campus network IP",
+	"数据中心IP":  "Datacenter IP",
+	"代理IP":    "Proxy IP",
+
+	// 风控等级
+	"极度纯净": "Very clean",
+	"纯净":   "Clean",
+	"中性":   "Neutral",
+	"轻微风险": "Slight risk",
+	"稍高风险": "Elevated risk",
+	"极度风险": "Very high risk",
+	"低风险":  "Low risk",
+	"中风险":  "Medium risk",
+	"高风险":  "High risk",
+
+	// 风控因素的名称和取值
+	"代理检测":  "Proxy detection",
+	"VPN检测": "VPN detection",
+	"Tor检测": "Tor detection",
+	"滥用历史":  "Abuse history",
+	"黑名单":   "Blacklist",
+	"是":     "Yes",
+	"否":     "No",
+	"无":     "None",
+	"有":     "Present",
+
+	// ASN类型和组织类型
+	"机房":  "Datacenter",
+	"家宽":  "Residential",
+	"商业":  "Business",
+	"政府":  "Government",
+	"教育":  "Education",
+	"企业":  "Enterprise",
+	"运营商": "ISP",
+
+	// 原生IP
+	"原生 IP": "Native IP",
+	"原生IP":  "Native IP",
+	"广播 IP": "Broadcast IP",
+	"广播IP":  "Broadcast IP",
+}
+
+// Translate 将ipInfo中已知的标签值翻译为指定语言
+// 多值字段（以分号分隔）逐项翻译；风控值只翻译百分比后的等级文字；风控因素的名称和取值都翻译。
+//
+// 参数:
+//   - ipInfo: 要翻译的IP信息，直接修改
+//   - lang: 目标语言，为空或LangZH时不做任何修改
+func Translate(ipInfo *models.IPInfo, lang string) {
+	if lang != LangEN || ipInfo == nil {
+		return
+	}
+
+	ipInfo.IPType = translateList(ipInfo.IPType)
+	ipInfo.ASNType = translateList(ipInfo.ASNType)
+	ipInfo.OrgType = translateList(ipInfo.OrgType)
+	ipInfo.NativeIP = translate(ipInfo.NativeIP)
+	ipInfo.RiskLabel = translate(ipInfo.RiskLabel)
+
+	if value, label, ok := strings.Cut(ipInfo.RiskValue, " "); ok {
+		ipInfo.RiskValue = value + " " + translate(label)
+	}
+
+	if len(ipInfo.RiskFactors) > 0 {
+		factors := make(map[string]string, len(ipInfo.RiskFactors))
+		for name, value := range ipInfo.RiskFactors {
+			factors[translate(name)] = translate(value)
+		}
+		ipInfo.RiskFactors = factors
+	}
+}
+
+// translate 翻译单个标签，没有已知翻译时原样返回
+func translate(s string) string {
+	if t, ok := english[strings.TrimSpace(s)]; ok {
+		return t
+	}
+	return s
+}
+
+// translateList 逐项翻译以分号分隔的多值字段
+func translateList(s string) string {
+	if s == "" {
+		return s
+	}
+	items := strings.Split(s, ";")
+	for i, item := range items {
+		items[i] = translate(strings.TrimSpace(item))
+	}
+	return strings.Join(items, "; ")
+}
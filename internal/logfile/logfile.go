@@ -0,0 +1,140 @@
+// Package logfile implements a size-based rotating log file. When the current
+// file would grow beyond the configured size it is renamed to path.1, older
+// backups are shifted to path.2, path.3 and so on, and a new file is started.
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DefaultMaxSizeMB 是单个日志文件的默认最大大小（MB）
+const DefaultMaxSizeMB = 100
+
+// DefaultMaxBackups 是默认保留的历史日志文件数量
+const DefaultMaxBackups = 5
+
+// File 按大小轮转的日志文件，可以被多个goroutine并发写入
+type File struct {
+	path       string
+	maxSize    int64 // 单个文件的最大字节数
+	maxBackups int   // 保留的历史文件数量
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Open 打开（必要时创建）日志文件，新内容追加到文件末尾
+//
+// 参数:
+//   - path: 日志文件路径
+//   - maxSizeMB: 单个文件的最大大小（MB），不大于0时使用DefaultMaxSizeMB
+//   - maxBackups: 保留的历史文件数量，小于0时使用DefaultMaxBackups，为0时轮转后直接删除旧文件
+//
+// 返回:
+//   - *File: 打开的日志文件
+//   - error: 如果无法创建目录或打开文件则返回相应错误
+func Open(path string, maxSizeMB, maxBackups int) (*File, error) {
+	if maxSizeMB <= 0 {
+		maxSizeMB = DefaultMaxSizeMB
+	}
+	if maxBackups < 0 {
+		maxBackups = DefaultMaxBackups
+	}
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("创建日志目录失败: %w", err)
+		}
+	}
+
+	f := &File{
+		path:       path,
+		maxSize:    int64(maxSizeMB) * 1024 * 1024,
+		maxBackups: maxBackups,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open 以追加模式打开当前日志文件，调用方需持有锁或在初始化阶段调用
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("打开日志文件失败: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("读取日志文件信息失败: %w", err)
+	}
+
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// Write 写入一条日志，写入后超过最大大小时先轮转
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate 关闭当前文件，依次重命名历史文件并打开新文件，调用方需持有锁
+func (f *File) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("关闭日志文件失败: %w", err)
+	}
+	f.file = nil
+
+	if f.maxBackups == 0 {
+		os.Remove(f.path)
+	} else {
+		os.Remove(backupName(f.path, f.maxBackups))
+		for i := f.maxBackups - 1; i >= 1; i-- {
+			os.Rename(backupName(f.path, i), backupName(f.path, i+1))
+		}
+		if err := os.Rename(f.path, backupName(f.path, 1)); err != nil {
+			return fmt.Errorf("轮转日志文件失败: %w", err)
+		}
+	}
+
+	return f.open()
+}
+
+// backupName 返回第n个历史文件的路径
+func backupName(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// Close 关闭日志文件
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
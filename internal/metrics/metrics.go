@@ -0,0 +1,19 @@
+// Package metrics defines the Prometheus metrics of the Pong0 application.
+// Metrics are registered with the default Prometheus registry through promauto
+// and exposed, together with the Go runtime and process metrics, by Handler.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// DefaultBuckets 查询耗时直方图的默认桶边界（秒）
+var DefaultBuckets = []float64{0.1, 0.25, 0.5, 1, 2, 3, 5, 8, 13, 21}
+
+// Handler 返回以Prometheus文本格式输出所有已注册指标的HTTP处理器
+// 抓取方请求OpenMetrics格式时按OpenMetrics输出。
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
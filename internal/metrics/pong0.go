@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Pong0应用程序使用的指标
+var (
+	// HTTPRequests 按路径和状态码统计的API请求数
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pong0_http_requests_total",
+		Help: "Total number of API requests by path and status code.",
+	}, []string{"path", "code"})
+
+	// Lookups 按结果统计的IP查询次数
+	Lookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pong0_lookups_total",
+		Help: "Total number of IP lookups by result.",
+	}, []string{"result"})
+
+	// LookupErrors 按失败步骤统计的查询错误数
+	LookupErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pong0_lookup_errors_total",
+		Help: "Total number of failed IP lookups by pipeline step.",
+	}, []string{"step"})
+
+	// LookupFallbacks 按降级数据源统计的以降级结果代替错误的查询次数
+	LookupFallbacks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pong0_lookup_fallbacks_total",
+		Help: "Total number of failed IP lookups answered from the fallback database.",
+	}, []string{"source"})
+
+	// ParseWarnings 按字段和警告类型统计的解析警告数，某个字段的警告逐渐增多说明页面结构正在变化
+	ParseWarnings = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pong0_parse_warnings_total",
+		Help: "Total number of result page parse warnings by field and code.",
+	}, []string{"field", "code"})
+
+	// CacheResults 按结果（hit、stale、miss）统计的API服务器结果缓存查找次数
+	CacheResults = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pong0_cache_results_total",
+		Help: "Total number of result cache lookups by outcome.",
+	}, []string{"result"})
+
+	// JSPathChanges 初始页面中计算密钥的脚本路径发生变化的次数
+	JSPathChanges = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pong0_js_path_changes_total",
+		Help: "Total number of detected changes of the key generation script path on the initial page.",
+	})
+
+	// PrunedRows 按表（history、jobs、audit_log）统计的按保留时间清理删除的记录数
+	PrunedRows = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pong0_pruned_rows_total",
+		Help: "Total number of rows deleted by retention pruning by table.",
+	}, []string{"table"})
+
+	// LookupDuration 完整查询流程的耗时分布
+	LookupDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "pong0_lookup_duration_seconds",
+		Help:    "Duration of complete IP lookups in seconds.",
+		Buckets: DefaultBuckets,
+	})
+)
@@ -0,0 +1,34 @@
+package models
+
+// PrincessURL 输出中固定添加的Princess字段的值
+const PrincessURL = "https://linux.do/u/amna"
+
+// Princess 返回Princess字段的值
+// 关闭Princess字段时返回空字符串，带omitempty标签的princess字段因此被省略。
+//
+// 参数:
+//   - branding: 是否包含Princess字段，见config.Config.NoBranding
+//
+// 返回:
+//   - string: 包含时为PrincessURL，否则为空字符串
+func Princess(branding bool) string {
+	if !branding {
+		return ""
+	}
+	return PrincessURL
+}
+
+// WithPrincess 为错误信息等JSON对象添加Princess字段，关闭Princess字段时原样返回
+//
+// 参数:
+//   - m: 要输出的JSON对象
+//   - branding: 是否包含Princess字段，见config.Config.NoBranding
+//
+// 返回:
+//   - map[string]string: 添加了Princess字段的同一个对象
+func WithPrincess(m map[string]string, branding bool) map[string]string {
+	if branding {
+		m["princess"] = PrincessURL
+	}
+	return m
+}
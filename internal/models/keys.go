@@ -0,0 +1,14 @@
+package models
+
+// KeyInfo 完成初始页面请求和密钥计算后得到的验证参数
+// 用于-keys-only模式：调用方可以用js1key和pow cookie自行请求最终页面，
+// 或在Ping0.cc更新算法时对比各个参数排查问题。
+type KeyInfo struct {
+	X1         string `json:"x1"`                 // 初始页面中的x1值
+	Difficulty string `json:"difficulty"`         // 初始页面中的difficulty值
+	JSPath     string `json:"js_path"`            // 初始页面引用的JavaScript路径
+	Algorithm  string `json:"algorithm"`          // 生成密钥使用的算法版本
+	Js1key     string `json:"js1key"`             // js1key cookie的值
+	Pow        string `json:"pow"`                // pow cookie的值
+	Princess   string `json:"princess,omitempty"` // 固定添加的Princess字段
+}
@@ -0,0 +1,17 @@
+package models
+
+// 位置组成部分的类型
+const (
+	LocationCountry  = "country"  // 国家/地区
+	LocationProvince = "province" // 省/州
+	LocationCity     = "city"     // 城市
+	LocationISP      = "isp"      // 运营商
+)
+
+// LocationPart ip_location拆分后的一个组成部分
+// 部分按国家、省/州、城市、运营商的顺序排列，位置中没有的部分省略，
+// 因此调用方应按kind而不是下标取值。
+type LocationPart struct {
+	Kind string `json:"kind"` // 组成部分的类型：country、province、city或isp
+	Name string `json:"name"` // 规范化后的名称（全角字符已转换为半角，空白已合并）
+}
@@ -6,74 +6,159 @@ package models
 import (
 	"encoding/json"
 	"fmt"
+
+	"ping0/internal/asn"
 )
 
 // IPInfo 结构体存储从Ping0.cc服务获取的IP信息
 // 该结构体包含IP地址的完整属性，包括地理位置、网络归属和其他元数据。
 // 所有字段都使用JSON标签进行序列化，便于API响应和数据处理。
 type IPInfo struct {
-	IP           string `json:"ip"`           // IP地址
-	IPLocation   string `json:"ip_location"`  // IP地理位置信息
-	ASN          string `json:"asn"`          // 自治系统编号
-	ASNOwner     string `json:"asn_owner"`    // 自治系统拥有者
-	ASNType      string `json:"asn_type"`     // 自治系统类型（如ISP、教育、商业等）
-	Organization string `json:"organization"` // 组织机构名称
-	OrgType      string `json:"org_type"`     // 组织机构类型
-	Longitude    string `json:"longitude"`    // 经度坐标
-	Latitude     string `json:"latitude"`     // 纬度坐标
-	IPType       string `json:"ip_type"`      // IP类型（如固定IP、动态IP等）
-	RiskValue    string `json:"risk_value"`   // 风险评估值
-	NativeIP     string `json:"native_ip"`    // 原生IP地址（非代理情况下）
-	CountryFlag  string `json:"country_flag"` // 国家/地区旗帜标识
-	Princess     string `json:"princess"`     // 固定添加的Princess字段
+	IP             string            `json:"ip"`                        // IP地址
+	PTR            string            `json:"ptr,omitempty"`             // 反向DNS（PTR）记录，仅在启用反向DNS查询且存在记录时填充
+	IPv4           string            `json:"ipv4,omitempty"`            // 双栈访问者的IPv4地址，仅在查询当前IP且页面同时给出IPv4和IPv6地址时填充
+	IPv6           string            `json:"ipv6,omitempty"`            // 双栈访问者的IPv6地址，仅在查询当前IP且页面同时给出IPv4和IPv6地址时填充
+	IPLocation     string            `json:"ip_location"`               // IP地理位置信息
+	CountryCode    string            `json:"country_code"`              // ISO 3166-1两位国家/地区代码（大写），来自旗帜文件名
+	Country        string            `json:"country"`                   // 国家/地区名称，ip_location的第一部分
+	Region         string            `json:"region"`                    // 省/州，ip_location的第二部分
+	City           string            `json:"city"`                      // 城市，ip_location的第三部分
+	LocationParts  []LocationPart    `json:"location_parts,omitempty"`  // ip_location按国家、省/州、城市、运营商拆分后的规范化组成部分，省略没有的部分
+	ASN            string            `json:"asn"`                       // 自治系统编号
+	ASNNumber      int               `json:"asn_number"`                // 自治系统编号数值，无法解析时为0
+	ASNOwner       string            `json:"asn_owner"`                 // 自治系统拥有者
+	ASNType        string            `json:"asn_type"`                  // 自治系统类型（如ISP、教育、商业等）
+	ASNRegistry    *asn.Info         `json:"asn_registry,omitempty"`    // ASN注册数据中的名称、国家和RIR，仅在配置了ASN数据文件时填充
+	Prefix         string            `json:"prefix,omitempty"`          // IP所属的地址段（CIDR，如8.8.8.0/24），页面中没有列出时省略
+	Organization   string            `json:"organization"`              // 组织机构名称
+	OrgType        string            `json:"org_type"`                  // 组织机构类型
+	Longitude      string            `json:"longitude"`                 // 经度坐标
+	Latitude       string            `json:"latitude"`                  // 纬度坐标
+	Lon            float64           `json:"lon"`                       // 经度数值，无法解析时为0
+	Lat            float64           `json:"lat"`                       // 纬度数值，无法解析时为0
+	IPType         string            `json:"ip_type"`                   // IP类型（如固定IP、动态IP等）
+	RiskValue      string            `json:"risk_value"`                // 风险评估值
+	RiskScore      int               `json:"risk_score"`                // 风控值数值（0-100），无法解析时为0
+	RiskLabel      string            `json:"risk_label"`                // 风控等级文字（如"中性"）
+	RiskFactors    map[string]string `json:"risk_factors,omitempty"`    // 风控值的组成因素（如代理检测、滥用历史），以因素名称为键，页面中没有列出时省略
+	NativeIP       string            `json:"native_ip"`                 // 原生IP地址（非代理情况下）
+	CountryFlag    string            `json:"country_flag"`              // 国家/地区旗帜标识
+	MissingFields  []string          `json:"missing_fields,omitempty"`  // 页面中没有找到的字段，仅在宽松解析模式下有字段缺失时填充
+	ParseQuality   *int              `json:"parse_quality,omitempty"`   // 解析质量（0-100），没有警告的应有字段所占的百分比，仅在解析Ping0.cc页面得到的结果中填充
+	Warnings       []ParseWarning    `json:"warnings,omitempty"`        // 解析页面时发现的问题，没有问题时省略
+	DataUpdated    string            `json:"data_updated,omitempty"`    // Ping0.cc数据的更新时间（RFC3339），页面中没有列出时省略
+	QueriedAt      string            `json:"queried_at,omitempty"`      // 本地完成查询的时间（RFC3339），缓存和保存的结果保留原始的查询时间
+	Source         string            `json:"source,omitempty"`          // 结果来源，Ping0.cc不可用时返回的降级结果为"fallback"
+	FallbackReason string            `json:"fallback_reason,omitempty"` // 降级时Ping0.cc查询失败的原因
+	Sources        []Source          `json:"sources,omitempty"`         // 附加数据源的结果，仅在启用附加数据源时填充
+	AgeSeconds     *int              `json:"age_seconds,omitempty"`     // 结果已缓存的秒数，仅在API服务器返回缓存的结果时填充
+	RequestID      string            `json:"request_id,omitempty"`      // API请求的ID，与服务端日志中的request_id一致，仅在API服务器的响应中填充
+	RedactedFields []string          `json:"redacted_fields,omitempty"` // 按API密钥的脱敏策略清空了值的字段，见Redact
+	Princess       string            `json:"princess,omitempty"`        // 固定添加的Princess字段，配置了NoBranding时为空并省略
+
+	omitted map[string]bool // 按脱敏策略从JSON中移除的字段
 }
 
 // NewIPInfo 创建一个新的IPInfo实例，并设置默认值
 func NewIPInfo() *IPInfo {
 	return &IPInfo{
-		Princess: "https://linux.do/u/amna",
+		Princess: PrincessURL,
 	}
 }
 
-// MarshalJSON 自定义JSON序列化方法，确保Princess字段总是存在
+// MarshalJSON 自定义JSON序列化方法，确保字段顺序固定
+// Princess字段由生成结果的一方按配置填写，为空时省略。
 func (i *IPInfo) MarshalJSON() ([]byte, error) {
-	// 确保Princess字段有值
-	if i.Princess == "" {
-		i.Princess = "https://linux.do/u/amna"
-	}
-
 	// 创建一个匿名结构体，以确保字段顺序和完整性
-	return json.Marshal(struct {
-		IP           string `json:"ip"`
-		IPLocation   string `json:"ip_location"`
-		ASN          string `json:"asn"`
-		ASNOwner     string `json:"asn_owner"`
-		ASNType      string `json:"asn_type"`
-		Organization string `json:"organization"`
-		OrgType      string `json:"org_type"`
-		Longitude    string `json:"longitude"`
-		Latitude     string `json:"latitude"`
-		IPType       string `json:"ip_type"`
-		RiskValue    string `json:"risk_value"`
-		NativeIP     string `json:"native_ip"`
-		CountryFlag  string `json:"country_flag"`
-		Princess     string `json:"princess"`
+	data, err := json.Marshal(struct {
+		IP             string            `json:"ip"`
+		PTR            string            `json:"ptr,omitempty"`
+		IPv4           string            `json:"ipv4,omitempty"`
+		IPv6           string            `json:"ipv6,omitempty"`
+		IPLocation     string            `json:"ip_location"`
+		CountryCode    string            `json:"country_code"`
+		Country        string            `json:"country"`
+		Region         string            `json:"region"`
+		City           string            `json:"city"`
+		LocationParts  []LocationPart    `json:"location_parts,omitempty"`
+		ASN            string            `json:"asn"`
+		ASNNumber      int               `json:"asn_number"`
+		ASNOwner       string            `json:"asn_owner"`
+		ASNType        string            `json:"asn_type"`
+		ASNRegistry    *asn.Info         `json:"asn_registry,omitempty"`
+		Prefix         string            `json:"prefix,omitempty"`
+		Organization   string            `json:"organization"`
+		OrgType        string            `json:"org_type"`
+		Longitude      string            `json:"longitude"`
+		Latitude       string            `json:"latitude"`
+		Lon            float64           `json:"lon"`
+		Lat            float64           `json:"lat"`
+		IPType         string            `json:"ip_type"`
+		RiskValue      string            `json:"risk_value"`
+		RiskScore      int               `json:"risk_score"`
+		RiskLabel      string            `json:"risk_label"`
+		RiskFactors    map[string]string `json:"risk_factors,omitempty"`
+		NativeIP       string            `json:"native_ip"`
+		CountryFlag    string            `json:"country_flag"`
+		MissingFields  []string          `json:"missing_fields,omitempty"`
+		ParseQuality   *int              `json:"parse_quality,omitempty"`
+		Warnings       []ParseWarning    `json:"warnings,omitempty"`
+		DataUpdated    string            `json:"data_updated,omitempty"`
+		QueriedAt      string            `json:"queried_at,omitempty"`
+		Source         string            `json:"source,omitempty"`
+		FallbackReason string            `json:"fallback_reason,omitempty"`
+		Sources        []Source          `json:"sources,omitempty"`
+		AgeSeconds     *int              `json:"age_seconds,omitempty"`
+		RequestID      string            `json:"request_id,omitempty"`
+		RedactedFields []string          `json:"redacted_fields,omitempty"`
+		Princess       string            `json:"princess,omitempty"`
 	}{
-		IP:           i.IP,
-		IPLocation:   i.IPLocation,
-		ASN:          i.ASN,
-		ASNOwner:     i.ASNOwner,
-		ASNType:      i.ASNType,
-		Organization: i.Organization,
-		OrgType:      i.OrgType,
-		Longitude:    i.Longitude,
-		Latitude:     i.Latitude,
-		IPType:       i.IPType,
-		RiskValue:    i.RiskValue,
-		NativeIP:     i.NativeIP,
-		CountryFlag:  i.CountryFlag,
-		Princess:     i.Princess,
+		IP:             i.IP,
+		PTR:            i.PTR,
+		IPv4:           i.IPv4,
+		IPv6:           i.IPv6,
+		IPLocation:     i.IPLocation,
+		CountryCode:    i.CountryCode,
+		Country:        i.Country,
+		Region:         i.Region,
+		City:           i.City,
+		LocationParts:  i.LocationParts,
+		ASN:            i.ASN,
+		ASNNumber:      i.ASNNumber,
+		ASNOwner:       i.ASNOwner,
+		ASNType:        i.ASNType,
+		ASNRegistry:    i.ASNRegistry,
+		Prefix:         i.Prefix,
+		Organization:   i.Organization,
+		OrgType:        i.OrgType,
+		Longitude:      i.Longitude,
+		Latitude:       i.Latitude,
+		Lon:            i.Lon,
+		Lat:            i.Lat,
+		IPType:         i.IPType,
+		RiskValue:      i.RiskValue,
+		RiskScore:      i.RiskScore,
+		RiskLabel:      i.RiskLabel,
+		RiskFactors:    i.RiskFactors,
+		NativeIP:       i.NativeIP,
+		CountryFlag:    i.CountryFlag,
+		MissingFields:  i.MissingFields,
+		ParseQuality:   i.ParseQuality,
+		Warnings:       i.Warnings,
+		DataUpdated:    i.DataUpdated,
+		QueriedAt:      i.QueriedAt,
+		Source:         i.Source,
+		FallbackReason: i.FallbackReason,
+		Sources:        i.Sources,
+		AgeSeconds:     i.AgeSeconds,
+		RequestID:      i.RequestID,
+		RedactedFields: i.RedactedFields,
+		Princess:       i.Princess,
 	})
+	if err != nil || len(i.omitted) == 0 {
+		return data, err
+	}
+	return dropKeys(data, i.omitted)
 }
 
 // ToJSON 将IPInfo结构体转换为格式化的JSON字符串
@@ -81,11 +166,6 @@ func (i *IPInfo) MarshalJSON() ([]byte, error) {
 //   - string: 格式化的JSON字符串
 //   - error: 如果序列化过程中发生错误
 func (i *IPInfo) ToJSON() (string, error) {
-	// 确保Princess字段有值
-	if i.Princess == "" {
-		i.Princess = "https://linux.do/u/amna"
-	}
-
 	jsonData, err := json.MarshalIndent(i, "", "  ")
 	if err != nil {
 		return "", fmt.Errorf("转换为JSON失败: %w", err)
@@ -102,10 +182,5 @@ func (i *IPInfo) Validate() error {
 		return fmt.Errorf("IP字段为空")
 	}
 
-	// 确保Princess字段有值
-	if i.Princess == "" {
-		i.Princess = "https://linux.do/u/amna"
-	}
-
 	return nil
 }
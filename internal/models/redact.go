@@ -0,0 +1,137 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ipInfoFields IPInfo中可以脱敏的字段，以JSON字段名为键，值为结构体字段的下标
+// ip、request_id、princess和redacted_fields本身不能脱敏。
+var ipInfoFields = jsonFields(reflect.TypeOf(IPInfo{}), "ip", "request_id", "princess", "redacted_fields")
+
+// sourceFields Source中以JSON字段名为键的字段下标，脱敏IPInfo时同名的字段一起清空
+var sourceFields = jsonFields(reflect.TypeOf(Source{}), "name", "disagrees", "error")
+
+// jsonFields 返回结构体中以JSON字段名为键的字段下标，跳过exclude中的字段
+func jsonFields(t reflect.Type, exclude ...string) map[string]int {
+	fields := make(map[string]int, t.NumField())
+	for idx := 0; idx < t.NumField(); idx++ {
+		name, _, _ := strings.Cut(t.Field(idx).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = idx
+	}
+	for _, name := range exclude {
+		delete(fields, name)
+	}
+	return fields
+}
+
+// CheckFields 检查字段名是否都是IPInfo中可以脱敏的JSON字段名
+//
+// 参数:
+//   - names: 字段名列表
+//
+// 返回:
+//   - error: 如果包含未知或不能脱敏的字段名则返回相应错误
+func CheckFields(names []string) error {
+	var unknown []string
+	for _, name := range names {
+		if _, ok := ipInfoFields[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("未知或不能脱敏的字段: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// Redact 返回清空了指定字段的副本，原结果不会被修改
+// redact中的字段保留在JSON中但值为零值，并列在redacted_fields中；omit中的字段从JSON中完全移除。
+// Protobuf等不经过JSON的格式中两者都表现为字段值为零值。附加数据源中的同名字段一起清空。
+//
+// 参数:
+//   - redact: 清空值的字段名（JSON字段名）
+//   - omit: 从响应中移除的字段名（JSON字段名）
+//
+// 返回:
+//   - *IPInfo: 脱敏后的结果，两个列表都为空时返回原结果
+func (i *IPInfo) Redact(redact, omit []string) *IPInfo {
+	if len(redact) == 0 && len(omit) == 0 {
+		return i
+	}
+
+	c := *i
+	v := reflect.ValueOf(&c).Elem()
+	names := append(append([]string(nil), redact...), omit...)
+	for _, name := range names {
+		if idx, ok := ipInfoFields[name]; ok {
+			f := v.Field(idx)
+			f.Set(reflect.Zero(f.Type()))
+		}
+	}
+
+	if len(c.Sources) > 0 {
+		c.Sources = append([]Source(nil), c.Sources...)
+		for n := range c.Sources {
+			sv := reflect.ValueOf(&c.Sources[n]).Elem()
+			for _, name := range names {
+				if idx, ok := sourceFields[name]; ok {
+					f := sv.Field(idx)
+					f.Set(reflect.Zero(f.Type()))
+				}
+			}
+		}
+	}
+
+	c.RedactedFields = append([]string(nil), redact...)
+	sort.Strings(c.RedactedFields)
+	c.omitted = nil
+	if len(omit) > 0 {
+		c.omitted = make(map[string]bool, len(omit))
+		for _, name := range omit {
+			c.omitted[name] = true
+		}
+	}
+	return &c
+}
+
+// dropKeys 从JSON对象中移除指定的键，保留其他键的顺序和原始编码
+func dropKeys(data []byte, drop map[string]bool) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := tok.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		if drop[key] {
+			continue
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"encoding/json"
+	"path"
+	"reflect"
+	"strings"
+)
+
+// jsonSchemaDialect 生成的JSON Schema使用的规范版本
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// IPInfoSchema 返回根据IPInfo结构体生成的JSON Schema（draft 2020-12）
+// 字段名和类型来自结构体的json标签和字段类型，没有omitempty的字段总会出现在输出中，因此列为required；
+// 嵌套的结构体（如Source）放在$defs中并通过$ref引用。Schema不限制额外字段，
+// 以后新增的可选字段不会让按旧Schema生成的校验器拒绝新版本的输出。
+//
+// 返回:
+//   - map[string]interface{}: 可以直接序列化为JSON的Schema
+func IPInfoSchema() map[string]interface{} {
+	defs := map[string]interface{}{}
+	schema := structSchema(reflect.TypeOf(IPInfo{}), defs)
+	schema["$schema"] = jsonSchemaDialect
+	schema["title"] = "IPInfo"
+	schema["description"] = "Pong0查询单个IP返回的结果"
+	if len(defs) > 0 {
+		schema["$defs"] = defs
+	}
+	return schema
+}
+
+// IPInfoSchemaJSON 返回格式化的IPInfo JSON Schema
+//
+// 返回:
+//   - []byte: 缩进两个空格的JSON文档
+//   - error: 如果序列化失败则返回相应错误
+func IPInfoSchemaJSON() ([]byte, error) {
+	return json.MarshalIndent(IPInfoSchema(), "", "  ")
+}
+
+// structSchema 生成结构体的object Schema，嵌套的结构体定义写入defs
+func structSchema(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+
+		properties[name] = typeSchema(f.Type, defs)
+		if !strings.Contains(","+opts+",", ",omitempty,") {
+			required = append(required, name)
+		}
+	}
+
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+// typeSchema 生成单个字段类型的Schema
+func typeSchema(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return typeSchema(t.Elem(), defs)
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), defs)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), defs)}
+	case reflect.Struct:
+		// 其他包中的结构体带上包名，避免与本包中的同名结构体冲突（如asn.Info）
+		name := t.Name()
+		if t.PkgPath() != reflect.TypeOf(IPInfo{}).PkgPath() {
+			name = path.Base(t.PkgPath()) + "." + name
+		}
+		if _, ok := defs[name]; !ok {
+			defs[name] = nil // 先占位，防止自引用的结构体无限递归
+			defs[name] = structSchema(t, defs)
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + name}
+	default:
+		return map[string]interface{}{}
+	}
+}
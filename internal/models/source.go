@@ -0,0 +1,19 @@
+package models
+
+// Source 一个附加数据源对查询IP给出的信息
+// 附加数据源用于补充Ping0.cc结果中缺失的字段，并交叉验证国家和ASN。
+// 数据源没有提供的字段为空。
+type Source struct {
+	Name         string   `json:"name"`                   // 数据源名称，如maxmind、ipapi、ripestat
+	CountryCode  string   `json:"country_code,omitempty"` // ISO 3166-1两位国家/地区代码
+	Country      string   `json:"country,omitempty"`      // 国家/地区名称
+	Region       string   `json:"region,omitempty"`       // 省/州
+	City         string   `json:"city,omitempty"`         // 城市
+	Lat          float64  `json:"lat,omitempty"`          // 纬度
+	Lon          float64  `json:"lon,omitempty"`          // 经度
+	ASNNumber    int      `json:"asn_number,omitempty"`   // 自治系统编号
+	ASNOwner     string   `json:"asn_owner,omitempty"`    // 自治系统拥有者
+	Organization string   `json:"organization,omitempty"` // 组织机构名称
+	Disagrees    []string `json:"disagrees,omitempty"`    // 与Ping0.cc结果不一致的字段名
+	Error        string   `json:"error,omitempty"`        // 查询失败时的错误信息
+}
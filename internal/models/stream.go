@@ -0,0 +1,38 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// StreamRecord 流式（NDJSON）输出中的一条记录
+// 序列化时在结果对象的字段之后追加sequence和elapsed_ms字段，
+// 使结果按完成顺序输出时调用方仍能对应到输入中的位置。
+type StreamRecord struct {
+	Sequence int           // 结果在输入列表中的序号，从1开始
+	Elapsed  time.Duration // 本条查询的耗时
+	Result   interface{}   // 查询结果，成功时为*IPInfo，失败时为包含错误信息的对象
+}
+
+// MarshalJSON 将查询结果与sequence、elapsed_ms字段合并为一个JSON对象
+func (r StreamRecord) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(r.Result)
+	if err != nil {
+		return nil, err
+	}
+
+	data = bytes.TrimSpace(data)
+	if len(data) < 2 || data[0] != '{' || data[len(data)-1] != '}' {
+		return nil, fmt.Errorf("流式记录的结果必须是JSON对象")
+	}
+
+	var buf bytes.Buffer
+	buf.Write(data[:len(data)-1])
+	if len(data) > 2 {
+		buf.WriteByte(',')
+	}
+	fmt.Fprintf(&buf, `"sequence":%d,"elapsed_ms":%d}`, r.Sequence, r.Elapsed.Milliseconds())
+	return buf.Bytes(), nil
+}
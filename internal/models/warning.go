@@ -0,0 +1,22 @@
+package models
+
+// 解析警告的类型
+const (
+	WarningMissing     = "missing"     // 页面中没有找到该字段
+	WarningUnparseable = "unparseable" // 找到了字段，但内容无法转换为对应的数值或代码
+	WarningFallback    = "fallback"    // 首选位置没有该字段，值来自备选位置（如页面元素而不是脚本变量）
+)
+
+// ParseWarning 解析结果页面时发现的一个问题
+// 警告不会导致查询失败，但说明页面结构可能已经发生变化。某类警告逐渐增多通常是解析器需要更新的信号，
+// 可以据此调整选择器定义（-selectors），而不必等到字段完全消失。
+type ParseWarning struct {
+	Field   string `json:"field"`   // 相关的字段名，与JSON输出中的字段名一致
+	Code    string `json:"code"`    // 警告类型：missing、unparseable或fallback
+	Message string `json:"message"` // 便于阅读的说明，如"页面中没有风控值区域"
+}
+
+// String 返回警告的说明文字，用于日志和命令行输出
+func (w ParseWarning) String() string {
+	return w.Field + ": " + w.Message
+}
@@ -0,0 +1,275 @@
+// Package monitor implements periodic re-checking of a watchlist of IP
+// addresses. After every round the latest result for each IP is compared with
+// the previous one, and changes of the tracked attributes (risk value, IP type,
+// native IP and location) are reported to the caller and optionally POSTed to
+// a webhook. The watchlist can change while the monitor runs, which lets the
+// API server follow the IPs its WebSocket clients subscribe to.
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"ping0/internal/config"
+	"ping0/internal/core"
+	"ping0/internal/models"
+)
+
+// Change 描述一个被追踪字段的变化
+type Change struct {
+	Field string `json:"field"` // 字段名，与IPInfo的JSON字段名一致
+	Old   string `json:"old"`   // 变化前的值
+	New   string `json:"new"`   // 变化后的值
+}
+
+// Event 一次IP属性变化事件，也是发送给Webhook的JSON载荷
+type Event struct {
+	IP        string         `json:"ip"`                 // 发生变化的IP
+	CheckedAt time.Time      `json:"checked_at"`         // 发现变化的查询时间
+	Changes   []Change       `json:"changes"`            // 变化的字段列表
+	Previous  *models.IPInfo `json:"previous"`           // 上一次的查询结果
+	Current   *models.IPInfo `json:"current"`            // 本次的查询结果
+	Princess  string         `json:"princess,omitempty"` // 固定添加的Princess字段
+}
+
+// trackedField 被追踪的字段及其取值方法
+type trackedField struct {
+	name  string
+	value func(*models.IPInfo) string
+}
+
+// trackedFields 变化时需要通知的字段
+var trackedFields = []trackedField{
+	{"risk_value", func(i *models.IPInfo) string { return i.RiskValue }},
+	{"ip_type", func(i *models.IPInfo) string { return i.IPType }},
+	{"native_ip", func(i *models.IPInfo) string { return i.NativeIP }},
+	{"ip_location", func(i *models.IPInfo) string { return i.IPLocation }},
+}
+
+// Monitor 定期查询监控列表中的IP，并在属性变化时发出通知
+// Watch、Unwatch和Last可以在Run运行期间从其他goroutine调用。
+type Monitor struct {
+	cfg    *config.Config
+	client *http.Client
+	log    *slog.Logger
+
+	// Allow 每次查询前调用，返回false时本轮跳过该IP，用于让监控的查询计入限流配额；为nil时不限制。
+	// 需要在Run之前设置。
+	Allow func(ip string) bool
+
+	mu   sync.Mutex
+	ips  []string
+	last map[string]*models.IPInfo // 每个IP最近一次成功的查询结果
+}
+
+// New 创建一个监控器
+//
+// 参数:
+//   - cfg: 运行配置，查询间隔和Webhook地址从中读取
+//   - ips: 监控的IP列表
+//
+// 返回:
+//   - *Monitor: 新创建的监控器
+func New(cfg *config.Config, ips []string) *Monitor {
+	return &Monitor{
+		cfg:    cfg,
+		ips:    ips,
+		client: &http.Client{Timeout: cfg.RequestTimeout()},
+		log:    cfg.Log("monitor"),
+		last:   make(map[string]*models.IPInfo),
+	}
+}
+
+// Watch 将IP加入监控列表，已在列表中时不做任何事
+// 新加入的IP在下一轮查询时建立比较基准。
+func (m *Monitor) Watch(ip string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !slices.Contains(m.ips, ip) {
+		m.ips = append(m.ips, ip)
+	}
+}
+
+// Unwatch 将IP移出监控列表，并丢弃它的比较基准
+func (m *Monitor) Unwatch(ip string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if i := slices.Index(m.ips, ip); i >= 0 {
+		m.ips = slices.Delete(m.ips, i, i+1)
+	}
+	delete(m.last, ip)
+}
+
+// Last 返回IP最近一次成功的查询结果，还没有查询过时返回nil
+func (m *Monitor) Last(ip string) *models.IPInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.last[ip]
+}
+
+// Run 立即查询一轮，之后按配置的间隔持续查询，直到ctx被取消
+// 每个IP第一次成功查询的结果作为比较基准，不会触发通知。
+//
+// 参数:
+//   - ctx: 控制监控生命周期的上下文
+//   - notify: 发现变化时的回调，可以为nil
+//
+// 返回:
+//   - error: ctx被取消时返回ctx.Err()
+func (m *Monitor) Run(ctx context.Context, notify func(Event)) error {
+	interval := m.cfg.MonitorInterval
+	if interval <= 0 {
+		interval = config.DefaultMonitorInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		m.check(ctx, notify)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// check 依次查询所有IP，并与上一次的结果比较
+func (m *Monitor) check(ctx context.Context, notify func(Event)) {
+	m.mu.Lock()
+	ips := slices.Clone(m.ips)
+	m.mu.Unlock()
+	if len(ips) == 0 {
+		return
+	}
+	m.log.Debug("开始一轮监控查询", "count", len(ips))
+
+	skipped := 0
+	defer func() {
+		if skipped > 0 {
+			m.log.Warn("超出限流配额，本轮跳过部分IP", "skipped", skipped, "count", len(ips))
+		}
+	}()
+
+	for _, ip := range ips {
+		if ctx.Err() != nil {
+			return
+		}
+		if m.Allow != nil && !m.Allow(ip) {
+			skipped++
+			continue
+		}
+
+		checkedAt := time.Now()
+		info, err := core.ProcessIPInfo(ctx, m.cfg, ip)
+		if err != nil {
+			m.log.Warn("监控查询失败", "ip", ip, "error", err)
+			continue
+		}
+
+		// 降级结果没有风控值等Ping0.cc特有的字段，不参与比较，以免产生虚假的变化通知
+		if info.Source == core.SourceFallback {
+			m.log.Warn("监控查询返回降级结果，跳过比较", "ip", ip, "reason", info.FallbackReason)
+			continue
+		}
+
+		m.mu.Lock()
+		prev, seen := m.last[ip]
+		// 查询期间被移出监控列表的IP不再记录
+		watched := slices.Contains(m.ips, ip)
+		if watched {
+			m.last[ip] = info
+		}
+		m.mu.Unlock()
+		if !seen || !watched {
+			continue
+		}
+
+		changes := Diff(prev, info)
+		if len(changes) == 0 {
+			continue
+		}
+
+		event := Event{
+			IP:        ip,
+			CheckedAt: checkedAt,
+			Changes:   changes,
+			Previous:  prev,
+			Current:   info,
+			Princess:  models.Princess(m.cfg.Branding()),
+		}
+		m.log.Info("IP属性发生变化", "ip", ip, "changes", len(changes))
+
+		if notify != nil {
+			notify(event)
+		}
+		if m.cfg.Webhook != "" {
+			if err := m.send(ctx, event); err != nil {
+				m.log.Warn("发送Webhook通知失败", "ip", ip, "error", err)
+			}
+		}
+	}
+}
+
+// Diff 返回两次查询结果之间被追踪字段（风控值、IP类型、原生IP、地理位置）的变化
+//
+// 参数:
+//   - prev: 上一次的查询结果
+//   - cur: 本次的查询结果
+//
+// 返回:
+//   - []Change: 变化的字段列表，没有变化时为空
+func Diff(prev, cur *models.IPInfo) []Change {
+	var changes []Change
+	for _, f := range trackedFields {
+		if old, now := f.value(prev), f.value(cur); old != now {
+			changes = append(changes, Change{Field: f.name, Old: old, New: now})
+		}
+	}
+	return changes
+}
+
+// send 将变化事件以JSON格式POST到Webhook地址
+//
+// 参数:
+//   - ctx: 请求上下文
+//   - event: 要发送的变化事件
+//
+// 返回:
+//   - error: 如果请求失败或Webhook返回非2xx状态码则返回相应错误
+func (m *Monitor) send(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("转换为JSON失败: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", m.cfg.Webhook, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("创建Webhook请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", m.cfg.UserAgent)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求Webhook失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Webhook返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
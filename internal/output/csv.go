@@ -0,0 +1,60 @@
+package output
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+// CSVOptions CSV输出的选项
+type CSVOptions struct {
+	// Columns 按顺序输出的列，为空时输出所有结果中出现过的字段；结果中不存在的列输出为空单元格
+	Columns []string
+	// NoHeader 为true时不输出表头行，便于追加到已有的表格
+	NoHeader bool
+}
+
+// WriteCSV 以CSV格式输出结果
+// 嵌套的对象和数组（如extra字段）以紧凑JSON写入单元格。
+//
+// 参数:
+//   - w: 输出目标
+//   - values: 要输出的结果列表，每个结果的JSON序列化结果必须是对象
+//   - opts: 列和表头选项
+//
+// 返回:
+//   - error: 如果结果无法转换为记录或写入失败则返回相应错误
+func WriteCSV(w io.Writer, values []interface{}, opts CSVOptions) error {
+	records := make([]Record, 0, len(values))
+	for _, v := range values {
+		rec, err := ToRecord(v)
+		if err != nil {
+			return err
+		}
+		records = append(records, rec)
+	}
+
+	cols := opts.Columns
+	if len(cols) == 0 {
+		cols = Columns(records)
+	}
+
+	cw := csv.NewWriter(w)
+	if !opts.NoHeader {
+		if err := cw.Write(cols); err != nil {
+			return err
+		}
+	}
+	for _, rec := range records {
+		row := make([]string, len(cols))
+		for i, col := range cols {
+			if v, ok := rec.Lookup(col); ok {
+				row[i] = CellString(v)
+			}
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
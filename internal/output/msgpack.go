@@ -0,0 +1,77 @@
+package output
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// WriteMsgPack 以MessagePack格式输出结果
+// 结果先转换为与JSON输出相同的结构：对象编码为map（保持字段顺序），整数编码为int，
+// 其他数字编码为float64，字段名和取值与JSON输出完全一致。
+//
+// 参数:
+//   - w: 输出目标
+//   - v: 要输出的结果，可以是对象或数组
+//
+// 返回:
+//   - error: 如果结果无法序列化或写入失败则返回相应错误
+func WriteMsgPack(w io.Writer, v interface{}) error {
+	value, err := toValue(v)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	if err := encodeMsgPack(msgpack.NewEncoder(bw), value); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// EncodeMsgpack 按字段顺序将记录编码为MessagePack map，实现msgpack.CustomEncoder
+func (r Record) EncodeMsgpack(enc *msgpack.Encoder) error {
+	if err := enc.EncodeMapLen(len(r)); err != nil {
+		return err
+	}
+	for _, f := range r {
+		if err := enc.EncodeString(f.Key); err != nil {
+			return err
+		}
+		if err := encodeMsgPack(enc, f.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeMsgPack 编码一个解码后的JSON值
+// json.Number能表示为整数时以最短的形式编码为int，否则编码为float64；其他类型交给msgpack编码。
+func encodeMsgPack(enc *msgpack.Encoder, v interface{}) error {
+	switch t := v.(type) {
+	case json.Number:
+		if n, err := t.Int64(); err == nil {
+			return enc.EncodeInt(n)
+		}
+		f, err := t.Float64()
+		if err != nil {
+			return fmt.Errorf("无效的数字 %s: %w", t, err)
+		}
+		return enc.EncodeFloat64(f)
+	case []interface{}:
+		if err := enc.EncodeArrayLen(len(t)); err != nil {
+			return err
+		}
+		for _, item := range t {
+			if err := encodeMsgPack(enc, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return enc.Encode(v)
+	}
+}
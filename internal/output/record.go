@@ -0,0 +1,205 @@
+// Package output converts lookup results into ordered records and writes them
+// in the non-JSON formats offered to spreadsheets, scripts and legacy
+// integrations (CSV and XML). Results are converted through their JSON
+// encoding, so field names and order always match the JSON output of the
+// command line and the API server.
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Field 表示一条记录中的一个字段，保持原始JSON中的字段顺序
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Record 是按JSON字段顺序排列的一条结果记录
+// 嵌套的对象解码为Record，数组解码为[]interface{}，数字解码为json.Number。
+type Record []Field
+
+// ToRecord 将任意可JSON序列化的值转换为保持字段顺序的记录
+// 通过JSON中转，确保输出的字段名和顺序与JSON输出完全一致。
+//
+// 参数:
+//   - v: 要转换的值，JSON序列化结果必须是对象
+//
+// 返回:
+//   - Record: 转换后的记录
+//   - error: 如果序列化失败或结果不是JSON对象则返回相应错误
+func ToRecord(v interface{}) (Record, error) {
+	if rec, ok := v.(Record); ok {
+		return rec, nil
+	}
+
+	value, err := toValue(v)
+	if err != nil {
+		return nil, err
+	}
+	rec, ok := value.(Record)
+	if !ok {
+		return nil, fmt.Errorf("结果不是JSON对象")
+	}
+	return rec, nil
+}
+
+// toValue 通过JSON中转将任意值转换为Record、[]interface{}、json.Number、string、bool或nil
+func toValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("转换为JSON失败: %w", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	value, err := decodeOrdered(dec)
+	if err != nil {
+		return nil, fmt.Errorf("解析JSON失败: %w", err)
+	}
+	return value, nil
+}
+
+// decodeOrdered 从JSON令牌流中解码一个值，对象解码为Record以保持字段顺序
+func decodeOrdered(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			rec := Record{}
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := decodeOrdered(dec)
+				if err != nil {
+					return nil, err
+				}
+				rec = append(rec, Field{Key: keyTok.(string), Value: value})
+			}
+			_, err = dec.Token() // 读取 '}'
+			return rec, err
+		case '[':
+			list := []interface{}{}
+			for dec.More() {
+				value, err := decodeOrdered(dec)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, value)
+			}
+			_, err = dec.Token() // 读取 ']'
+			return list, err
+		}
+	}
+	return tok, nil
+}
+
+// MarshalJSON 按字段顺序将记录序列化为JSON对象
+func (r Record) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range r {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(f.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Lookup 返回记录中指定字段的值
+func (r Record) Lookup(key string) (interface{}, bool) {
+	for _, f := range r {
+		if f.Key == key {
+			return f.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Columns 返回所有记录中出现过的字段名，按首次出现的顺序排列
+func Columns(records []Record) []string {
+	var cols []string
+	seen := make(map[string]bool)
+	for _, rec := range records {
+		for _, f := range rec {
+			if !seen[f.Key] {
+				seen[f.Key] = true
+				cols = append(cols, f.Key)
+			}
+		}
+	}
+	return cols
+}
+
+// ParseColumns 解析以逗号分隔的字段名列表，忽略空白和空字段
+func ParseColumns(value string) []string {
+	var cols []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			cols = append(cols, name)
+		}
+	}
+	return cols
+}
+
+// CellString 将字段值格式化为单元格文本，嵌套的对象和数组以紧凑JSON表示
+func CellString(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case json.Number:
+		return t.String()
+	case bool:
+		if t {
+			return "true"
+		}
+		return "false"
+	default:
+		data, _ := json.Marshal(toPlain(t))
+		return string(data)
+	}
+}
+
+// toPlain 将Record转换回普通的map，便于嵌套值的JSON序列化
+func toPlain(v interface{}) interface{} {
+	switch t := v.(type) {
+	case Record:
+		m := make(map[string]interface{}, len(t))
+		for _, f := range t {
+			m[f.Key] = toPlain(f.Value)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(t))
+		for i, item := range t {
+			list[i] = toPlain(item)
+		}
+		return list
+	default:
+		return v
+	}
+}
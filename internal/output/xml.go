@@ -0,0 +1,95 @@
+package output
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// WriteXML 以XML文档输出一个结果
+// 字段名作为元素名，嵌套的对象输出为子元素，数组的每一项输出为一个item元素，null输出为空元素；
+// 字段名不是合法的XML名称时输出为 <field name="字段名">。
+//
+// 参数:
+//   - w: 输出目标
+//   - root: 根元素名称
+//   - v: 要输出的结果，JSON序列化结果必须是对象
+//
+// 返回:
+//   - error: 如果结果无法转换为记录或写入失败则返回相应错误
+func WriteXML(w io.Writer, root string, v interface{}) error {
+	rec, err := ToRecord(v)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := encodeXML(enc, root, rec); err != nil {
+		return err
+	}
+	if err := enc.Flush(); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// encodeXML 将一个值输出为名为name的元素
+func encodeXML(enc *xml.Encoder, name string, v interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if !validXMLName(name) {
+		start = xml.StartElement{
+			Name: xml.Name{Local: "field"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "name"}, Value: name}},
+		}
+	}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch t := v.(type) {
+	case Record:
+		for _, f := range t {
+			if err := encodeXML(enc, f.Key, f.Value); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range t {
+			if err := encodeXML(enc, "item", item); err != nil {
+				return err
+			}
+		}
+	default:
+		if text := CellString(t); text != "" {
+			if err := enc.EncodeToken(xml.CharData(text)); err != nil {
+				return err
+			}
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// validXMLName 判断字段名是否可以直接作为XML元素名
+// 只接受ASCII字母、数字、下划线、连字符和点，且不以数字、连字符或点开头，也不以xml开头（保留前缀）。
+func validXMLName(name string) bool {
+	if name == "" || len(name) >= 3 && (name[0]|0x20) == 'x' && (name[1]|0x20) == 'm' && (name[2]|0x20) == 'l' {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', c == '_':
+		case '0' <= c && c <= '9', c == '-', c == '.':
+			if i == 0 {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
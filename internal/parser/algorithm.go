@@ -0,0 +1,183 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"ping0/internal/config"
+	perrors "ping0/internal/errors"
+)
+
+// AlgorithmAuto 表示根据JavaScript路径自动选择密钥生成算法
+const AlgorithmAuto = "auto"
+
+// ErrAlgorithmChanged 表示生成的访问密钥被Ping0.cc拒绝，服务器再次返回了验证页面
+// 这通常意味着Ping0.cc更新了混淆后的JavaScript，需要新增对应版本的算法。
+// 该错误属于ErrChallengeFailed类别。
+var ErrAlgorithmChanged = perrors.Wrap(perrors.ErrChallengeFailed, errors.New("访问密钥被拒绝，Ping0.cc的密钥算法可能已更新"))
+
+// Algorithm 一个版本的密钥生成算法
+// Ping0.cc更换混淆后的JavaScript时，密钥算法通常也会随之变化。
+// 每个版本的算法独立注册，新旧版本可以并存，运行时根据页面引用的JavaScript文件选择。
+type Algorithm struct {
+	// Version 算法版本名称，用于日志和手动指定算法
+	Version string
+
+	// JSHashes 使用该算法的JavaScript文件名哈希（不含扩展名和查询参数），
+	// 如 /static/js/a2296d5c180a52cf01f4b428fb97d804.js 中的 a2296d5c180a52cf01f4b428fb97d804
+	JSHashes []string
+
+	// ScriptHashes 已确认使用该算法的JavaScript文件内容的SHA-256（小写十六进制），
+	// 下载的脚本与之一致时可以确定Ping0.cc没有更换脚本
+	ScriptHashes []string
+
+	// Generate 根据x1和difficulty生成访问密钥
+	Generate func(ctx context.Context, cfg *config.Config, x1Value, difficultyValue string) (*Keys, error)
+}
+
+// 已注册的算法，defaultAlgorithm为无法按哈希匹配时使用的版本（最后注册的默认算法）
+var (
+	algorithmsMu     sync.RWMutex
+	algorithms       = make(map[string]*Algorithm)
+	defaultAlgorithm string
+)
+
+// RegisterAlgorithm 注册一个密钥生成算法
+// 通常在包的init函数中调用。版本名称重复或缺少Generate函数时会panic。
+//
+// 参数:
+//   - alg: 要注册的算法
+//   - isDefault: 是否作为无法按JavaScript哈希匹配时的默认算法
+func RegisterAlgorithm(alg Algorithm, isDefault bool) {
+	algorithmsMu.Lock()
+	defer algorithmsMu.Unlock()
+
+	if alg.Version == "" || alg.Version == AlgorithmAuto {
+		panic(fmt.Sprintf("parser: 无效的算法版本名称 %q", alg.Version))
+	}
+	if alg.Generate == nil {
+		panic("parser: 算法 " + alg.Version + " 缺少Generate函数")
+	}
+	if _, exists := algorithms[alg.Version]; exists {
+		panic("parser: 重复注册算法 " + alg.Version)
+	}
+
+	algorithms[alg.Version] = &alg
+	if isDefault {
+		defaultAlgorithm = alg.Version
+	}
+}
+
+// Algorithms 返回所有已注册的算法版本名称，按名称排序
+func Algorithms() []string {
+	algorithmsMu.RLock()
+	defer algorithmsMu.RUnlock()
+	return algorithmVersions()
+}
+
+// SelectAlgorithm 选择生成密钥使用的算法
+// 指定了版本时直接使用该版本；否则根据JavaScript文件名哈希匹配，
+// 没有匹配的哈希时使用默认算法。
+//
+// 参数:
+//   - version: 算法版本，为空或auto时自动选择
+//   - jsPath: 初始页面引用的JavaScript路径
+//
+// 返回:
+//   - *Algorithm: 选中的算法
+//   - error: 如果指定的版本不存在或没有可用的算法则返回相应错误
+func SelectAlgorithm(version, jsPath string) (*Algorithm, error) {
+	algorithmsMu.RLock()
+	defer algorithmsMu.RUnlock()
+
+	if version != "" && version != AlgorithmAuto {
+		alg, ok := algorithms[version]
+		if !ok {
+			return nil, fmt.Errorf("未知的密钥算法: %s（可选 %s）", version, strings.Join(algorithmVersions(), "、"))
+		}
+		return alg, nil
+	}
+
+	if hash := jsHash(jsPath); hash != "" {
+		for _, alg := range algorithms {
+			for _, h := range alg.JSHashes {
+				if h == hash {
+					return alg, nil
+				}
+			}
+		}
+	}
+
+	alg, ok := algorithms[defaultAlgorithm]
+	if !ok {
+		return nil, fmt.Errorf("没有可用的密钥算法")
+	}
+	return alg, nil
+}
+
+// ScriptAlgorithm 返回JavaScript文件内容的SHA-256所对应的已注册算法版本
+//
+// 参数:
+//   - sum: 脚本内容的SHA-256，小写十六进制
+//
+// 返回:
+//   - string: 登记了该哈希的算法版本
+//   - bool: 是否有算法登记了该哈希
+func ScriptAlgorithm(sum string) (string, bool) {
+	algorithmsMu.RLock()
+	defer algorithmsMu.RUnlock()
+
+	for _, version := range algorithmVersions() {
+		for _, h := range algorithms[version].ScriptHashes {
+			if strings.EqualFold(h, sum) {
+				return version, true
+			}
+		}
+	}
+	return "", false
+}
+
+// FallbackAlgorithms 返回除指定版本之外的所有已注册算法，按版本名称排序
+// 用于当前算法生成的密钥被拒绝时依次尝试其他版本。
+//
+// 参数:
+//   - exclude: 已经尝试过的算法版本
+//
+// 返回:
+//   - []*Algorithm: 可供回退尝试的算法列表
+func FallbackAlgorithms(exclude string) []*Algorithm {
+	algorithmsMu.RLock()
+	defer algorithmsMu.RUnlock()
+
+	var result []*Algorithm
+	for _, version := range algorithmVersions() {
+		if version != exclude {
+			result = append(result, algorithms[version])
+		}
+	}
+	return result
+}
+
+// algorithmVersions 返回已注册的算法版本，调用方需持有读锁
+func algorithmVersions() []string {
+	versions := make([]string, 0, len(algorithms))
+	for version := range algorithms {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// jsHash 从JavaScript路径中提取文件名哈希
+// 如 /static/js/a2296d5c180a52cf01f4b428fb97d804.js?t=1742134555 返回 a2296d5c180a52cf01f4b428fb97d804
+func jsHash(jsPath string) string {
+	if i := strings.IndexAny(jsPath, "?#"); i >= 0 {
+		jsPath = jsPath[:i]
+	}
+	return strings.TrimSuffix(path.Base(jsPath), ".js")
+}
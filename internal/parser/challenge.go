@@ -0,0 +1,126 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"ping0/internal/config"
+	perrors "ping0/internal/errors"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// DefaultJSPath 初始页面中没有找到计算密钥的脚本时使用的JavaScript路径
+const DefaultJSPath = "/js/main.js"
+
+// ChallengeParams 初始页面（验证页面）中计算访问密钥所需的参数
+type ChallengeParams struct {
+	X1         string // window.x1的值
+	Difficulty string // window.difficulty的值，页面中没有时为x1的前3个字符
+	JSPath     string // 计算密钥的JavaScript路径，页面中没有时为DefaultJSPath
+}
+
+// ExtractChallengeParams 从初始页面中提取x1值、difficulty值和JavaScript路径
+// 变量值可以使用单引号或双引号，等号两侧可以有空白。该函数不进行网络请求，
+// 可以直接用于保存的页面样本。
+//
+// 参数:
+//   - htmlContent: 初始页面的HTML内容
+//
+// 返回:
+//   - *ChallengeParams: 提取出的参数
+//   - error: 如果页面中没有x1值或x1值太短无法得到默认的difficulty值，返回ErrChallengeFailed类别的错误
+func ExtractChallengeParams(htmlContent string) (*ChallengeParams, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
+	if err != nil {
+		return nil, fmt.Errorf("解析HTML失败: %w", err)
+	}
+
+	params := &ChallengeParams{JSPath: DefaultJSPath}
+	doc.Find("script").Each(func(i int, s *goquery.Selection) {
+		content := s.Text()
+		if x1, ok := scriptStringVar(content, "window.x1"); ok {
+			params.X1 = x1
+		}
+		if difficulty, ok := scriptStringVar(content, "window.difficulty"); ok {
+			params.Difficulty = difficulty
+		}
+	})
+	if params.X1 == "" {
+		return nil, perrors.Wrap(perrors.ErrChallengeFailed, fmt.Errorf("未找到x1值"))
+	}
+
+	// 页面没有给出difficulty时使用x1值的前3个字符
+	if params.Difficulty == "" {
+		if len(params.X1) < 3 {
+			return nil, perrors.Wrap(perrors.ErrChallengeFailed, fmt.Errorf("无法设置默认difficulty值"))
+		}
+		params.Difficulty = params.X1[:3]
+	}
+
+	doc.Find("script[src]").Each(func(i int, s *goquery.Selection) {
+		if src, ok := s.Attr("src"); ok && strings.Contains(src, "main.js") {
+			params.JSPath = src
+		}
+	})
+	return params, nil
+}
+
+// ManualChallengeParams 返回配置中（-x1、-diff）手动指定的验证参数，都没有指定时返回nil
+// 手动指定的值作为全部查询的默认值，单次查询可以通过core.WithChallengeParams覆盖。
+func ManualChallengeParams(cfg *config.Config) *ChallengeParams {
+	if cfg.ManualX1Value == "" && cfg.ManualDiffValue == "" {
+		return nil
+	}
+	return &ChallengeParams{X1: cfg.ManualX1Value, Difficulty: cfg.ManualDiffValue}
+}
+
+// ResolveChallengeParams 从初始页面中提取验证参数，并用override中非空的x1值和difficulty值替换
+// override指定了x1值时页面中可以没有x1值，JS路径仍然尽量从页面中提取；
+// 只指定了difficulty值时x1值和JS路径来自页面。override为nil时等同于ExtractChallengeParams。
+//
+// 参数:
+//   - htmlContent: 初始页面的HTML内容
+//   - override: 手动指定的验证参数，其中的JSPath不使用
+//
+// 返回:
+//   - *ChallengeParams: 最终使用的参数
+//   - error: 如果既没有指定也无法从页面中提取x1值，或无法得到difficulty值，返回ErrChallengeFailed类别的错误
+func ResolveChallengeParams(htmlContent string, override *ChallengeParams) (*ChallengeParams, error) {
+	if override == nil || override.X1 == "" {
+		params, err := ExtractChallengeParams(htmlContent)
+		if err != nil {
+			return nil, err
+		}
+		if override != nil && override.Difficulty != "" {
+			params.Difficulty = override.Difficulty
+		}
+		return params, nil
+	}
+
+	params := &ChallengeParams{X1: override.X1, Difficulty: override.Difficulty, JSPath: DefaultJSPath}
+	if page, err := ExtractChallengeParams(htmlContent); err == nil {
+		params.JSPath = page.JSPath
+	}
+	if params.Difficulty == "" {
+		if len(params.X1) < 3 {
+			return nil, perrors.Wrap(perrors.ErrChallengeFailed, fmt.Errorf("无法设置默认difficulty值: x1值 %q 少于3个字符", params.X1))
+		}
+		params.Difficulty = params.X1[:3]
+	}
+	return params, nil
+}
+
+// scriptStringVar 从脚本内容中提取以字符串赋值的变量，如window.x1 = '...'
+func scriptStringVar(content, name string) (string, bool) {
+	if !strings.Contains(content, name) {
+		return "", false
+	}
+	re := getOrCompileRegex(fmt.Sprintf(`%s\s*=\s*['"]([^'"]*)['"]`, regexp.QuoteMeta(name)))
+	m := re.FindStringSubmatch(content)
+	if m == nil || m[1] == "" {
+		return "", false
+	}
+	return m[1], true
+}
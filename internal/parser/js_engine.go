@@ -4,61 +4,198 @@
 package parser
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"log/slog"
+	"math"
+	"runtime"
 	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"ping0/internal/constants"
+	"ping0/internal/config"
+	perrors "ping0/internal/errors"
 )
 
-// calculateHashStart uses crypto/sha256 to hash the input string
-// and returns the beginning of the hash as a string.
-// This is equivalent to the calculateHash function in JavaScript.
-func calculateHashStart(input string, length int) (string, error) {
-	hasher := sha256.New()
-	hasher.Write([]byte(input))
-	hashBytes := hasher.Sum(nil)
-	hashHex := hex.EncodeToString(hashBytes)
+func init() {
+	RegisterAlgorithm(Algorithm{
+		Version:  "newjs1keypow",
+		JSHashes: []string{"a2296d5c180a52cf01f4b428fb97d804"},
+		Generate: generateNewJs1keyPow,
+	}, true)
+}
+
+// powBlockSize is the number of consecutive counters a worker checks
+// before claiming the next block of the search space.
+const powBlockSize = 4096
+
+// powProgressInterval is how often calculatePow reports its progress.
+const powProgressInterval = time.Second
+
+// powHopelessFactor is how many times the expected number of iterations may
+// exceed the iteration cap before the search is not started at all. Beyond
+// this the chance of finding a value within the cap is below 1%.
+const powHopelessFactor = 100
 
-	if length > len(hashHex) {
-		length = len(hashHex)
+// powProgress receives the number of counters checked so far and the time
+// spent since calculatePow started.
+type powProgress func(iterations int64, elapsed time.Duration)
+
+// validateDifficulty checks that difficulty can be matched by a SHA-256 hex
+// digest at all. An empty, overlong or non-lowercase-hex prefix would make
+// calculatePow run until the iteration cap without any chance of success.
+//
+// Parameters:
+//   - difficulty: The prefix that the hash should start with
+//
+// Returns:
+//   - error: If difficulty can never match a hex digest
+func validateDifficulty(difficulty string) error {
+	if difficulty == "" {
+		return errors.New("difficulty为空")
+	}
+	if len(difficulty) > sha256.Size*2 {
+		return fmt.Errorf("difficulty长度(%d)超过哈希值长度(%d)", len(difficulty), sha256.Size*2)
 	}
+	for _, c := range difficulty {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return fmt.Errorf("difficulty(%s)包含非十六进制小写字符: %q", difficulty, c)
+		}
+	}
+	return nil
+}
 
-	return hashHex[:length], nil
+// powExpectedIterations returns the average number of counters that must be
+// checked before a hash starts with difficulty, i.e. 16^len(difficulty).
+func powExpectedIterations(difficulty string) float64 {
+	return math.Pow(16, float64(len(difficulty)))
+}
+
+// hashHasPrefix reports whether the hex encoding of sum starts with prefix.
+// This is equivalent to comparing the beginning of the calculateHash result
+// in JavaScript, without allocating the full hex string.
+func hashHasPrefix(sum *[sha256.Size]byte, prefix string) bool {
+	var encoded [sha256.Size * 2]byte
+	hex.Encode(encoded[:], sum[:])
+	if len(prefix) > len(encoded) {
+		return false
+	}
+	return string(encoded[:len(prefix)]) == prefix
 }
 
 // calculatePow calculates a proof-of-work value that produces a hash
 // starting with the specified difficulty prefix.
 //
+// The search space is split into fixed-size blocks that are claimed in
+// increasing order by GOMAXPROCS workers. A block is only skipped once a
+// solution below its start has been found, so the returned value is always
+// the smallest valid counter, exactly as the sequential JavaScript loop would
+// produce. The context is checked between blocks so that a cancelled lookup
+// does not keep burning CPU on the search.
+//
 // Parameters:
+//   - ctx: Context used to abort the search early
 //   - x1: The base string (usually a hex string)
 //   - difficulty: The prefix that the hash should start with
+//   - maxIterations: Upper bound (exclusive) on the counters to try
+//   - progress: Called every powProgressInterval while the search runs, may be nil
 //
 // Returns:
 //   - int: The POW value
-//   - error: If an error occurs during hash calculation
-func calculatePow(x1, difficulty string) (int, error) {
-	counter := 0
-	difficultyLen := len(difficulty)
+//   - error: If no value is found within maxIterations or ctx is cancelled
+func calculatePow(ctx context.Context, x1, difficulty string, maxIterations int, progress powProgress) (int, error) {
+	if maxIterations <= 0 {
+		maxIterations = config.DefaultPowMaxIterations
+	}
 
-	for {
-		input := fmt.Sprintf("%s%d", x1, counter)
-		hash, err := calculateHashStart(input, difficultyLen)
-		if err != nil {
-			return 0, err
-		}
+	var (
+		nextBlock atomic.Int64
+		best      atomic.Int64
+		checked   atomic.Int64
+		wg        sync.WaitGroup
+	)
+	best.Store(math.MaxInt64)
+
+	if progress != nil {
+		started := time.Now()
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			ticker := time.NewTicker(powProgressInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					progress(checked.Load(), time.Since(started))
+				}
+			}
+		}()
+	}
 
-		if hash == difficulty {
-			return counter, nil
-		}
+	workers := runtime.GOMAXPROCS(0)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			input := make([]byte, 0, len(x1)+20)
+			input = append(input, x1...)
+
+			for {
+				if ctx.Err() != nil {
+					return
+				}
+
+				start := nextBlock.Add(1) - 1
+				start *= powBlockSize
+				if start >= int64(maxIterations) || start >= best.Load() {
+					return
+				}
+
+				end := start + powBlockSize
+				if end > int64(maxIterations) {
+					end = int64(maxIterations)
+				}
+
+				// Counted per claimed block, which is precise enough for progress reports
+				checked.Add(end - start)
+
+				for counter := start; counter < end; counter++ {
+					buf := strconv.AppendInt(input, counter, 10)
+					sum := sha256.Sum256(buf)
+					if !hashHasPrefix(&sum, difficulty) {
+						continue
+					}
+
+					// Keep the smallest counter found by any worker
+					for {
+						current := best.Load()
+						if counter >= current || best.CompareAndSwap(current, counter) {
+							break
+						}
+					}
+					break
+				}
+			}
+		}()
+	}
+	wg.Wait()
 
-		counter++
-		// Add a reasonable limit to prevent infinite loops
-		if counter > 100000 {
-			return 0, fmt.Errorf("超过最大迭代次数，无法找到符合条件的POW值")
-		}
+	if err := ctx.Err(); err != nil {
+		return 0, err
 	}
+
+	if result := best.Load(); result != math.MaxInt64 {
+		return int(result), nil
+	}
+
+	return 0, fmt.Errorf("超过最大迭代次数(%d)，无法找到以%s开头的POW值，可以通过-pow-max提高上限", maxIterations, difficulty)
 }
 
 // obf replicates the obfuscation function (_0x34ab46) from the updated newjs1keypow.js
@@ -651,14 +788,18 @@ func calculateJs1Key(x1 string, locationHref string, animated bool) int {
 
 // Keys 表示生成的js1key和pow值
 type Keys struct {
-	Js1key string
-	Pow    string
+	Js1key    string
+	Pow       string
+	Algorithm string // 生成密钥使用的算法版本
 }
 
-// GenerateKey 根据新的算法生成访问密钥
+// GenerateKey 生成访问密钥
 // 该函数会生成两个密钥：js1key和pow，这是访问Ping0.cc服务的必要凭证。
+// 使用的算法由cfg.KeyAlgorithm指定，未指定时根据jsPath自动选择。
 //
 // 参数:
+//   - ctx: 上下文，取消后POW计算会尽快退出
+//   - cfg: 运行时配置
 //   - jsPath: JavaScript文件路径
 //   - x1Value: 从初始页面提取的x1值
 //   - difficultyValue: 从初始页面提取的difficulty值
@@ -666,35 +807,95 @@ type Keys struct {
 // 返回:
 //   - *Keys: 包含js1key和pow值的结构体
 //   - error: 如果生成过程中出现错误则返回对应错误信息
-func GenerateKey(jsPath, x1Value, difficultyValue string) (*Keys, error) {
-	if len(x1Value) != 32 {
-		return nil, fmt.Errorf("无效的x1Value长度: 期望32, 实际%d", len(x1Value))
+func GenerateKey(ctx context.Context, cfg *config.Config, jsPath, x1Value, difficultyValue string) (*Keys, error) {
+	alg, err := SelectAlgorithm(cfg.KeyAlgorithm, jsPath)
+	if err != nil {
+		return nil, err
 	}
 
-	if constants.Verbose {
-		fmt.Printf("开始生成密钥:\n")
-		fmt.Printf("- x1Value: %s\n", x1Value)
-		fmt.Printf("- difficultyValue: %s\n", difficultyValue)
-		fmt.Printf("- jsPath: %s\n", jsPath)
-		fmt.Printf("- BaseURL: %s\n", constants.BaseURL)
+	log := cfg.Log("parser")
+	log.Debug("开始生成密钥", "algorithm", alg.Version, "x1", x1Value, "difficulty", difficultyValue, "js_path", jsPath, "base_url", cfg.BaseURL)
+
+	return GenerateKeyWith(ctx, cfg, alg, x1Value, difficultyValue)
+}
+
+// GenerateKeyWith 使用指定的算法生成访问密钥
+//
+// 参数:
+//   - ctx: 上下文，取消后POW计算会尽快退出
+//   - cfg: 运行时配置
+//   - alg: 要使用的算法
+//   - x1Value: 从初始页面提取的x1值
+//   - difficultyValue: 从初始页面提取的difficulty值
+//
+// 返回:
+//   - *Keys: 包含js1key、pow值和算法版本的结构体
+//   - error: 如果生成过程中出现错误则返回对应错误信息
+func GenerateKeyWith(ctx context.Context, cfg *config.Config, alg *Algorithm, x1Value, difficultyValue string) (*Keys, error) {
+	keys, err := alg.Generate(ctx, cfg, x1Value, difficultyValue)
+	if err != nil {
+		return nil, err
 	}
+	keys.Algorithm = alg.Version
+	return keys, nil
+}
+
+// generateNewJs1keyPow 使用newjs1keypow.js版本的算法生成访问密钥
+func generateNewJs1keyPow(ctx context.Context, cfg *config.Config, x1Value, difficultyValue string) (*Keys, error) {
+	if len(x1Value) != 32 {
+		return nil, perrors.Wrap(perrors.ErrChallengeFailed, fmt.Errorf("无效的x1Value长度: 期望32, 实际%d", len(x1Value)))
+	}
+
+	log := cfg.Log("parser")
 
 	// 1. 计算js1key值
-	animated := false                 // 页面动画状态固定为关闭
-	locationHref := constants.BaseURL // 使用基础URL作为locationHref参数
+	animated := false           // 页面动画状态固定为关闭
+	locationHref := cfg.BaseURL // 使用基础URL作为locationHref参数
 	js1key := calculateJs1Key(x1Value, locationHref, animated)
 
-	// 2. 计算pow值
-	pow, err := calculatePow(x1Value, difficultyValue)
-	if err != nil {
-		return nil, fmt.Errorf("计算POW失败: %w", err)
+	// 2. 检查difficulty，避免注定失败的计算耗尽迭代次数
+	if err := validateDifficulty(difficultyValue); err != nil {
+		return nil, perrors.Wrap(perrors.ErrChallengeFailed, fmt.Errorf("无效的difficulty: %w", err))
+	}
+	maxIterations := cfg.PowMaxIterations
+	if maxIterations <= 0 {
+		maxIterations = config.DefaultPowMaxIterations
+	}
+	expected := powExpectedIterations(difficultyValue)
+	if expected > float64(maxIterations)*powHopelessFactor {
+		return nil, perrors.Wrap(perrors.ErrChallengeFailed, fmt.Errorf("difficulty(%s)过长: 平均需要约%.0f次迭代，远超最大迭代次数(%d)", difficultyValue, expected, maxIterations))
+	}
+	if expected > float64(maxIterations) {
+		log.Warn("difficulty较长，POW计算可能超过最大迭代次数", "difficulty", difficultyValue, "expected", int64(expected), "max", maxIterations)
 	}
 
-	if constants.Verbose {
-		fmt.Printf("生成的js1key: %d\n", js1key)
-		fmt.Printf("生成的pow: %d\n", pow)
+	// 3. 计算pow值，与上游请求使用相同的超时时间；详细模式下每秒输出一次计算进度
+	var progress powProgress
+	if log.Enabled(ctx, slog.LevelDebug) {
+		progress = func(iterations int64, elapsed time.Duration) {
+			log.Debug("POW计算进度", "iterations", iterations, "max", maxIterations,
+				"rate", fmt.Sprintf("%.0f/s", float64(iterations)/elapsed.Seconds()))
+		}
+	}
+	powCtx, cancel := context.WithTimeout(ctx, cfg.RequestTimeout())
+	defer cancel()
+	started := time.Now()
+	pow, err := calculatePow(powCtx, x1Value, difficultyValue, maxIterations, progress)
+	if err != nil {
+		err = fmt.Errorf("计算POW失败: %w", err)
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			return nil, perrors.Wrap(perrors.ErrTimeout, err)
+		case errors.Is(err, context.Canceled):
+			return nil, err
+		default:
+			return nil, perrors.Wrap(perrors.ErrChallengeFailed, err)
+		}
 	}
 
+	log.Debug("POW计算完成", "pow", pow, "elapsed", time.Since(started).Round(time.Millisecond))
+	log.Debug("密钥生成完成", "js1key", js1key, "pow", pow)
+
 	return &Keys{
 		Js1key: fmt.Sprintf("%d", js1key),
 		Pow:    fmt.Sprintf("%d", pow),
@@ -0,0 +1,82 @@
+package parser
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// sequentialPow 逐个尝试计数器，作为并行calculatePow的参照实现
+func sequentialPow(x1, difficulty string, maxIterations int) (int, bool) {
+	for counter := 0; counter < maxIterations; counter++ {
+		sum := sha256.Sum256([]byte(x1 + strconv.Itoa(counter)))
+		if strings.HasPrefix(hex.EncodeToString(sum[:]), difficulty) {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+func TestCalculatePowMatchesSequential(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	tests := []struct {
+		x1, difficulty string
+	}{
+		{"a3f9c0e4b7d15e2a", "0"},
+		{"a3f9c0e4b7d15e2a", "000"},
+		{"00a7e1c95b", "00a"},
+		{"5d41402abc4b2a76", "0000"},
+		{"e4d909c290d0fb1c", "abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.x1+"/"+tt.difficulty, func(t *testing.T) {
+			want, ok := sequentialPow(tt.x1, tt.difficulty, 1<<22)
+			if !ok {
+				t.Fatal("参照实现没有找到结果")
+			}
+			got, err := calculatePow(context.Background(), tt.x1, tt.difficulty, 1<<22, nil)
+			if err != nil {
+				t.Fatalf("calculatePow: %v", err)
+			}
+			// 多个协程可能同时找到结果，必须返回最小的计数器
+			if got != want {
+				t.Errorf("calculatePow = %d, 期望 %d", got, want)
+			}
+		})
+	}
+}
+
+func TestCalculatePowMaxIterations(t *testing.T) {
+	want, ok := sequentialPow("a3f9c0e4b7d15e2a", "000", 1<<22)
+	if !ok {
+		t.Fatal("参照实现没有找到结果")
+	}
+
+	// 上限不含本身，恰好等于结果时应找不到
+	_, err := calculatePow(context.Background(), "a3f9c0e4b7d15e2a", "000", want, nil)
+	if err == nil || !strings.Contains(err.Error(), "超过最大迭代次数") {
+		t.Errorf("err = %v, 期望超过最大迭代次数", err)
+	}
+
+	got, err := calculatePow(context.Background(), "a3f9c0e4b7d15e2a", "000", want+1, nil)
+	if err != nil || got != want {
+		t.Errorf("calculatePow = %d, %v, 期望 %d", got, err, want)
+	}
+}
+
+func TestCalculatePowCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// 不可能在上限内找到的难度，只能因取消而返回
+	_, err := calculatePow(ctx, "a3f9c0e4b7d15e2a", "00000000", 1<<30, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, 期望 context.Canceled", err)
+	}
+}
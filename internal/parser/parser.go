@@ -4,13 +4,26 @@
 package parser
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"html"
+	"log/slog"
+	"net/netip"
+	"os"
+	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
-
-	"ping0/internal/constants"
+	"time"
+	"unicode"
+
+	"ping0/internal/asn"
+	"ping0/internal/config"
+	perrors "ping0/internal/errors"
+	"ping0/internal/i18n"
+	"ping0/internal/metrics"
 	"ping0/internal/models"
 
 	"github.com/PuerkitoBio/goquery"
@@ -54,23 +67,63 @@ func getOrCompileRegex(pattern string) *regexp.Regexp {
 // 并将其组织到IPInfo结构体中。
 //
 // 参数:
+//   - cfg: 运行时配置
 //   - htmlContent: 包含IP信息的HTML内容
 //
 // 返回:
 //   - *models.IPInfo: 解析出的IP信息结构体
 //   - error: 如果解析失败则返回相应错误
-func ParseIPInfo(htmlContent string) (*models.IPInfo, error) {
+func ParseIPInfo(cfg *config.Config, htmlContent string) (*models.IPInfo, error) {
+	ipInfo, err := parseIPInfo(cfg, htmlContent)
+	if err != nil {
+		return nil, perrors.Wrap(perrors.ErrParseFailure, err)
+	}
+	return ipInfo, nil
+}
+
+// ParseFile 读取保存在磁盘上的HTML页面并解析IP信息，不进行任何网络请求
+// 可用于重新处理之前保存的页面，或针对页面样本编写解析器回归测试。
+//
+// 参数:
+//   - cfg: 运行时配置
+//   - path: HTML文件路径
+//
+// 返回:
+//   - *models.IPInfo: 解析出的IP信息结构体
+//   - error: 如果文件无法读取、是验证页面或解析失败则返回相应错误
+func ParseFile(cfg *config.Config, path string) (*models.IPInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取HTML文件失败: %w", err)
+	}
+
+	htmlContent := string(data)
+	if IsChallengePage(htmlContent) {
+		// 附上验证参数，便于用-x1和-diff复现密钥计算
+		if params, err := ExtractChallengeParams(htmlContent); err == nil {
+			return nil, perrors.Wrap(perrors.ErrParseFailure, fmt.Errorf("%s 是Ping0.cc的验证页面，不包含IP信息（x1=%s，difficulty=%s，JS路径 %s）", path, params.X1, params.Difficulty, params.JSPath))
+		}
+		return nil, perrors.Wrap(perrors.ErrParseFailure, fmt.Errorf("%s 是Ping0.cc的验证页面，不包含IP信息", path))
+	}
+	return ParseIPInfo(cfg, htmlContent)
+}
+
+// parseIPInfo 是ParseIPInfo的具体实现，返回的错误尚未标记类别
+func parseIPInfo(cfg *config.Config, htmlContent string) (*models.IPInfo, error) {
 	// 检查输入参数
 	if htmlContent == "" {
 		return nil, fmt.Errorf("HTML内容为空")
 	}
 
+	// 同一次解析使用同一组选择器，解析期间重新加载选择器不会造成混用
+	sel := currentSelectors()
+
 	// 检查是否包含错误信息
 	if strings.Contains(htmlContent, "系统发生错误") {
 		// 尝试提取更详细的错误信息
 		doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
 		if err == nil {
-			errorMsg := doc.Find(".error-message").Text()
+			errorMsg := doc.Find(sel.ErrorMessage).Text()
 			if errorMsg != "" {
 				return nil, fmt.Errorf("网站返回错误: %s", errorMsg)
 			}
@@ -89,167 +142,192 @@ func ParseIPInfo(htmlContent string) (*models.IPInfo, error) {
 		return nil, fmt.Errorf("网站返回错误页面: %s", title)
 	}
 
+	log := cfg.Log("parser")
 	ipInfo := models.NewIPInfo()
+	var warnings parseWarnings
 
 	// 从脚本标签中直接提取常用变量
 	scriptValues := extractScriptVariables(doc)
-	if constants.Verbose && len(scriptValues) > 0 {
-		fmt.Println("从脚本中提取的变量:")
-		for k, v := range scriptValues {
-			fmt.Printf("- %s: %s\n", k, v)
-		}
+	if len(scriptValues) > 0 {
+		log.Debug("从脚本中提取的变量", "values", scriptValues)
 	}
 
 	// 设置IP
 	if ip, ok := scriptValues["window.ip"]; ok && ip != "" {
 		ipInfo.IP = ip
-		if constants.Verbose {
-			fmt.Printf("从脚本中提取到IP: %s\n", ip)
-		}
+		log.Debug("从脚本中提取到IP", "ip", ip)
 	} else {
 		// 备选方法：从title中提取
 		ipParts := strings.Split(title, "-")
 		if len(ipParts) > 0 {
 			ipInfo.IP = strings.TrimSpace(ipParts[0])
-			if constants.Verbose {
-				fmt.Printf("从标题中提取到IP: %s\n", ipInfo.IP)
-			}
+			log.Debug("从标题中提取到IP", "ip", ipInfo.IP)
+			warnings.add("ip", models.WarningFallback, "脚本中没有window.ip，IP来自页面标题")
 		}
 	}
 
 	// 如果无法提取到IP，页面可能是错误页面
 	if ipInfo.IP == "" {
-		// 打印HTML内容的前200个字符以便调试
-		if constants.Verbose {
+		// 记录HTML内容的前200个字符以便调试
+		if log.Enabled(context.Background(), slog.LevelDebug) {
 			preview := htmlContent
 			if len(preview) > 200 {
 				preview = preview[:200] + "..."
 			}
-			fmt.Printf("HTML内容预览: %s\n", preview)
+			log.Debug("无法提取IP，HTML内容预览", "preview", preview)
 		}
 		return nil, fmt.Errorf("无法从页面提取IP信息，可能是错误页面")
 	}
 
+	// 双栈访问者的IPv4和IPv6地址
+	extractDualStack(scriptValues, ipInfo, &warnings)
+	if ipInfo.IPv4 != "" || ipInfo.IPv6 != "" {
+		log.Debug("提取到双栈地址", "ipv4", ipInfo.IPv4, "ipv6", ipInfo.IPv6)
+	}
+
 	// 设置IP位置
 	if loc, ok := scriptValues["window.loc"]; ok && loc != "" {
 		// 解码HTML实体
 		ipInfo.IPLocation = decodeHTMLEntities(loc)
-		if constants.Verbose {
-			fmt.Printf("从脚本中提取到位置: %s\n", ipInfo.IPLocation)
-		}
+		log.Debug("从脚本中提取到位置", "location", ipInfo.IPLocation)
 	} else {
 		// 备选方法：从DOM中提取
-		extractIPLocation(doc, ipInfo)
-		if constants.Verbose && ipInfo.IPLocation != "" {
-			fmt.Printf("从DOM中提取到位置: %s\n", ipInfo.IPLocation)
+		extractIPLocation(doc, sel, ipInfo)
+		if ipInfo.IPLocation != "" {
+			log.Debug("从DOM中提取到位置", "location", ipInfo.IPLocation)
+			warnings.add("ip_location", models.WarningFallback, "脚本中没有window.loc，位置来自页面元素")
 		}
 	}
 
 	// 提取国家旗帜
-	doc.Find(".line.loc .content img").Each(func(i int, s *goquery.Selection) {
+	doc.Find(sel.CountryFlag).Each(func(i int, s *goquery.Selection) {
 		flagSrc, exists := s.Attr("src")
 		if exists {
 			parts := strings.Split(flagSrc, "/")
 			if len(parts) > 0 {
 				flagFile := parts[len(parts)-1]
 				ipInfo.CountryFlag = strings.TrimSuffix(flagFile, ".png")
-				if constants.Verbose {
-					fmt.Printf("提取到国家旗帜: %s\n", ipInfo.CountryFlag)
-				}
+				log.Debug("提取到国家旗帜", "country_flag", ipInfo.CountryFlag)
 			}
 		}
 	})
 
+	// 拆分结构化的地理位置字段
+	ipInfo.CountryCode = countryCode(ipInfo.CountryFlag)
+	if ipInfo.CountryFlag != "" && ipInfo.CountryCode == "" {
+		warnings.add("country_flag", models.WarningUnparseable, "旗帜文件名 %q 不是两位国家代码", ipInfo.CountryFlag)
+	}
+	var isp string
+	ipInfo.Country, ipInfo.Region, ipInfo.City, isp = splitLocation(ipInfo.IPLocation)
+	ipInfo.LocationParts = locationParts(ipInfo.Country, ipInfo.Region, ipInfo.City, isp)
+	log.Debug("提取到地理位置字段", "country_code", ipInfo.CountryCode, "country", ipInfo.Country, "region", ipInfo.Region, "city", ipInfo.City, "isp", isp)
+
 	// 提取ASN
-	doc.Find(".line.asn .content a").Each(func(i int, s *goquery.Selection) {
+	doc.Find(sel.ASN).Each(func(i int, s *goquery.Selection) {
 		ipInfo.ASN = strings.TrimSpace(s.Text())
-		if constants.Verbose && ipInfo.ASN != "" {
-			fmt.Printf("提取到ASN: %s\n", ipInfo.ASN)
+		if ipInfo.ASN != "" {
+			ipInfo.ASNNumber, _ = asn.ParseNumber(ipInfo.ASN)
+			log.Debug("提取到ASN", "asn", ipInfo.ASN, "asn_number", ipInfo.ASNNumber)
 		}
 	})
+	if _, ok := asn.ParseNumber(ipInfo.ASN); ipInfo.ASN != "" && !ok {
+		warnings.add("asn", models.WarningUnparseable, "ASN %q 无法解析为编号", ipInfo.ASN)
+	}
 
 	// 提取ASN所有者和类型
-	extractASNInfo(doc, scriptValues, ipInfo)
-	if constants.Verbose {
-		if ipInfo.ASNOwner != "" {
-			fmt.Printf("提取到ASN所有者: %s\n", ipInfo.ASNOwner)
-		}
-		if ipInfo.ASNType != "" {
-			fmt.Printf("提取到ASN类型: %s\n", ipInfo.ASNType)
-		}
-	}
+	extractASNInfo(doc, sel, scriptValues, ipInfo)
+	log.Debug("提取到ASN所有者和类型", "asn_owner", ipInfo.ASNOwner, "asn_type", ipInfo.ASNType)
 
 	// 提取组织信息和类型
-	extractOrgInfo(doc, scriptValues, ipInfo)
-	if constants.Verbose {
-		if ipInfo.Organization != "" {
-			fmt.Printf("提取到组织: %s\n", ipInfo.Organization)
-		}
-		if ipInfo.OrgType != "" {
-			fmt.Printf("提取到组织类型: %s\n", ipInfo.OrgType)
-		}
-	}
+	extractOrgInfo(doc, sel, scriptValues, ipInfo)
+	log.Debug("提取到组织和类型", "organization", ipInfo.Organization, "org_type", ipInfo.OrgType)
 
 	// 提取经度
 	if longitude, ok := scriptValues["window.longitude"]; ok && longitude != "" {
 		ipInfo.Longitude = longitude
-		if constants.Verbose {
-			fmt.Printf("提取到经度: %s\n", longitude)
-		}
+		log.Debug("提取到经度", "longitude", longitude)
 	} else {
-		doc.Find(".line").Each(func(i int, s *goquery.Selection) {
-			name := strings.TrimSpace(s.Find(".name").Text())
-			if name == "经度" {
-				ipInfo.Longitude = strings.TrimSpace(s.Find(".content").Text())
-				if constants.Verbose {
-					fmt.Printf("从DOM中提取到经度: %s\n", ipInfo.Longitude)
-				}
+		doc.Find(sel.Line).Each(func(i int, s *goquery.Selection) {
+			name := strings.TrimSpace(s.Find(sel.LineName).Text())
+			if name == sel.LongitudeName {
+				ipInfo.Longitude = strings.TrimSpace(s.Find(sel.LineContent).Text())
+				log.Debug("从DOM中提取到经度", "longitude", ipInfo.Longitude)
 			}
 		})
+		if ipInfo.Longitude != "" {
+			warnings.add("longitude", models.WarningFallback, "脚本中没有window.longitude，经度来自页面元素")
+		}
 	}
 
 	// 提取纬度
 	if latitude, ok := scriptValues["window.latitude"]; ok && latitude != "" {
 		ipInfo.Latitude = latitude
-		if constants.Verbose {
-			fmt.Printf("提取到纬度: %s\n", latitude)
-		}
+		log.Debug("提取到纬度", "latitude", latitude)
 	} else {
-		doc.Find(".line").Each(func(i int, s *goquery.Selection) {
-			name := strings.TrimSpace(s.Find(".name").Text())
-			if name == "纬度" {
-				ipInfo.Latitude = strings.TrimSpace(s.Find(".content").Text())
-				if constants.Verbose {
-					fmt.Printf("从DOM中提取到纬度: %s\n", ipInfo.Latitude)
-				}
+		doc.Find(sel.Line).Each(func(i int, s *goquery.Selection) {
+			name := strings.TrimSpace(s.Find(sel.LineName).Text())
+			if name == sel.LatitudeName {
+				ipInfo.Latitude = strings.TrimSpace(s.Find(sel.LineContent).Text())
+				log.Debug("从DOM中提取到纬度", "latitude", ipInfo.Latitude)
 			}
 		})
+		if ipInfo.Latitude != "" {
+			warnings.add("latitude", models.WarningFallback, "脚本中没有window.latitude，纬度来自页面元素")
+		}
+	}
+
+	// 转换经纬度数值
+	var ok bool
+	if ipInfo.Lon, ok = parseCoordinate(ipInfo.Longitude); ipInfo.Longitude != "" && !ok {
+		warnings.add("longitude", models.WarningUnparseable, "经度 %q 无法解析为数值", ipInfo.Longitude)
+	}
+	if ipInfo.Lat, ok = parseCoordinate(ipInfo.Latitude); ipInfo.Latitude != "" && !ok {
+		warnings.add("latitude", models.WarningUnparseable, "纬度 %q 无法解析为数值", ipInfo.Latitude)
+	}
+
+	// 提取IP段
+	extractPrefix(doc, sel, ipInfo, &warnings)
+	if ipInfo.Prefix != "" {
+		log.Debug("提取到IP段", "prefix", ipInfo.Prefix)
+	}
+
+	// 提取数据更新时间
+	extractDataUpdated(doc, sel, ipInfo, &warnings)
+	if ipInfo.DataUpdated != "" {
+		log.Debug("提取到数据更新时间", "data_updated", ipInfo.DataUpdated)
 	}
 
 	// 提取IP类型 - 收集所有类型并用分号分隔
-	extractIPTypes(doc, ipInfo)
-	if constants.Verbose && ipInfo.IPType != "" {
-		fmt.Printf("提取到IP类型: %s\n", ipInfo.IPType)
+	extractIPTypes(doc, sel, ipInfo)
+	if ipInfo.IPType != "" {
+		log.Debug("提取到IP类型", "ip_type", ipInfo.IPType)
 	}
 
 	// 提取风控值
-	doc.Find(".line.line-risk .content .riskbar .riskcurrent").Each(func(i int, s *goquery.Selection) {
-		value := strings.TrimSpace(s.Find(".value").Text())
-		lab := strings.TrimSpace(s.Find(".lab").Text())
+	risk := doc.Find(sel.Risk)
+	risk.Each(func(i int, s *goquery.Selection) {
+		value := strings.TrimSpace(s.Find(sel.RiskValue).Text())
+		lab := strings.TrimSpace(s.Find(sel.RiskLabel).Text())
 		if value != "" && lab != "" {
 			ipInfo.RiskValue = value + " " + lab
-			if constants.Verbose {
-				fmt.Printf("提取到风控值: %s\n", ipInfo.RiskValue)
+			ipInfo.RiskLabel = lab
+			if ipInfo.RiskScore, ok = parseRiskScore(value); !ok {
+				warnings.add("risk_value", models.WarningUnparseable, "风控值 %q 无法解析为数值", value)
 			}
+			log.Debug("提取到风控值", "risk_value", ipInfo.RiskValue, "risk_score", ipInfo.RiskScore, "risk_label", ipInfo.RiskLabel)
 		}
 	})
 
+	// 提取风控值的组成因素
+	extractRiskFactors(doc, sel, ipInfo)
+	if len(ipInfo.RiskFactors) > 0 {
+		log.Debug("提取到风控因素", "risk_factors", ipInfo.RiskFactors)
+	}
+
 	// 提取原生IP
-	doc.Find(".line.line-nativeip .content .label").Each(func(i int, s *goquery.Selection) {
+	doc.Find(sel.NativeIP).Each(func(i int, s *goquery.Selection) {
 		ipInfo.NativeIP = strings.TrimSpace(s.Text())
-		if constants.Verbose {
-			fmt.Printf("提取到原生IP: %s\n", ipInfo.NativeIP)
-		}
+		log.Debug("提取到原生IP", "native_ip", ipInfo.NativeIP)
 	})
 
 	// 验证结果
@@ -257,20 +335,135 @@ func ParseIPInfo(htmlContent string) (*models.IPInfo, error) {
 		return nil, fmt.Errorf("未能提取到IP信息")
 	}
 
-	// 返回前确保Princess字段有值
-	if ipInfo.Princess == "" {
-		ipInfo.Princess = "https://linux.do/u/amna"
+	// 任一字段含有模板占位符说明页面没有渲染，其余字段同样不可信
+	if fields := templateResidue(ipInfo); len(fields) > 0 {
+		log.Debug("页面中有未渲染的模板占位符", "fields", fields)
+		return nil, fmt.Errorf("%w（字段: %s）", ErrUnrenderedPage, strings.Join(fields, ", "))
+	}
+
+	// 检查应有的字段，严格模式下缺少任一字段即失败，宽松模式下记录在missing_fields中
+	if missing := missingFields(ipInfo); len(missing) > 0 {
+		if cfg.ParseMode == config.ParseModeStrict {
+			return nil, fmt.Errorf("页面中缺少字段: %s（严格解析模式）", strings.Join(missing, ", "))
+		}
+		ipInfo.MissingFields = missing
+		log.Debug("页面中缺少部分字段", "missing_fields", missing)
+		for _, field := range missing {
+			warnings.add(field, models.WarningMissing, "%s", missingMessage(field, risk.Length() > 0))
+		}
+	}
+
+	// 记录解析警告和解析质量，警告逐渐增多说明页面结构正在变化
+	quality := warnings.quality()
+	ipInfo.ParseQuality = &quality
+	if len(warnings) > 0 {
+		ipInfo.Warnings = warnings
+		log.Debug("解析页面时发现问题", "warnings", len(warnings), "parse_quality", quality)
+		for _, w := range warnings {
+			metrics.ParseWarnings.WithLabelValues(w.Field, w.Code).Inc()
+		}
 	}
 
+	// 按配置的语言翻译标签值
+	i18n.Translate(ipInfo, cfg.Lang)
+
+	// 按配置设置Princess字段，配置了NoBranding时为空
+	ipInfo.Princess = models.Princess(cfg.Branding())
+
 	return ipInfo, nil
 }
 
+// expectedFields 结果页面中应当存在的字段，字段名与JSON输出一致
+var expectedFields = []struct {
+	name  string
+	label string // 缺少该字段时警告中使用的名称
+	value func(*models.IPInfo) string
+}{
+	{"ip_location", "位置", func(i *models.IPInfo) string { return i.IPLocation }},
+	{"country_flag", "国家旗帜", func(i *models.IPInfo) string { return i.CountryFlag }},
+	{"asn", "ASN", func(i *models.IPInfo) string { return i.ASN }},
+	{"asn_owner", "ASN所有者", func(i *models.IPInfo) string { return i.ASNOwner }},
+	{"organization", "组织", func(i *models.IPInfo) string { return i.Organization }},
+	{"longitude", "经度", func(i *models.IPInfo) string { return i.Longitude }},
+	{"latitude", "纬度", func(i *models.IPInfo) string { return i.Latitude }},
+	{"ip_type", "IP类型", func(i *models.IPInfo) string { return i.IPType }},
+	{"risk_value", "风控值", func(i *models.IPInfo) string { return i.RiskValue }},
+	{"native_ip", "原生IP", func(i *models.IPInfo) string { return i.NativeIP }},
+}
+
+// missingFields 返回解析结果中为空的应有字段，按expectedFields的顺序排列
+func missingFields(ipInfo *models.IPInfo) []string {
+	var missing []string
+	for _, f := range expectedFields {
+		if f.value(ipInfo) == "" {
+			missing = append(missing, f.name)
+		}
+	}
+	return missing
+}
+
+// missingMessage 返回缺少字段时的警告说明
+// 风控值区分整个区域不存在和区域中没有数值两种情况，前者通常说明页面结构发生了变化。
+func missingMessage(field string, riskArea bool) string {
+	if field == "risk_value" {
+		if riskArea {
+			return "风控值区域中没有数值或等级"
+		}
+		return "页面中没有风控值区域"
+	}
+	for _, f := range expectedFields {
+		if f.name == field {
+			return "页面中没有找到" + f.label
+		}
+	}
+	return "页面中没有找到该字段"
+}
+
+// parseWarnings 一次解析中收集的警告
+type parseWarnings []models.ParseWarning
+
+// add 记录一条警告
+func (w *parseWarnings) add(field, code, format string, args ...interface{}) {
+	*w = append(*w, models.ParseWarning{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+// quality 计算解析质量：没有missing或unparseable警告的应有字段所占的百分比
+// fallback警告说明值来自备选位置，值本身可用，不降低解析质量。
+func (w parseWarnings) quality() int {
+	good := 0
+	for _, f := range expectedFields {
+		bad := false
+		for _, warning := range w {
+			if warning.Field == f.name && warning.Code != models.WarningFallback {
+				bad = true
+				break
+			}
+		}
+		if !bad {
+			good++
+		}
+	}
+	return good * 100 / len(expectedFields)
+}
+
+// IsChallengePage 判断页面是否为Ping0.cc的验证页面
+// 访问密钥无效或已过期时，服务器不会返回IP信息，而是再次返回包含window.x1的验证页面。
+//
+// 参数:
+//   - htmlContent: 页面HTML内容
+//
+// 返回:
+//   - bool: 是否为验证页面
+func IsChallengePage(htmlContent string) bool {
+	return strings.Contains(htmlContent, "window.x1")
+}
+
 // extractScriptVariables 从脚本标签中提取变量
 func extractScriptVariables(doc *goquery.Document) map[string]string {
 	scriptValues := make(map[string]string)
 
 	varNames := []string{
-		"window.ip", "window.tar", "window.longitude", "window.latitude", "window.loc",
+		"window.ip", "window.ipv4", "window.ipv6", "window.tar", "window.longitude", "window.latitude", "window.loc",
 	}
 
 	doc.Find("script").Each(func(i int, s *goquery.Selection) {
@@ -284,8 +477,8 @@ func extractScriptVariables(doc *goquery.Document) map[string]string {
 }
 
 // extractIPLocation 从DOM中提取IP位置信息
-func extractIPLocation(doc *goquery.Document, ipInfo *models.IPInfo) {
-	doc.Find(".line.loc .content").Each(func(i int, s *goquery.Selection) {
+func extractIPLocation(doc *goquery.Document, sel *Selectors, ipInfo *models.IPInfo) {
+	doc.Find(sel.Location).Each(func(i int, s *goquery.Selection) {
 		// 获取原始HTML和文本
 		html, _ := s.Html()
 
@@ -295,22 +488,224 @@ func extractIPLocation(doc *goquery.Document, ipInfo *models.IPInfo) {
 		// 移除"错误提交"文本
 		text = strings.Replace(text, "错误提交", "", -1)
 
-		// 清理空格
-		text = strings.TrimSpace(text)
-		re := getOrCompileRegex(`\s+`)
-		text = re.ReplaceAllString(text, " ")
+		// 解码HTML实体并规范化空白，不换行空格和全角空格不属于\s，由normalizeText统一处理
+		if text = decodeHTMLEntities(text); text != "" {
+			ipInfo.IPLocation = text
+		}
+	})
+}
 
-		// 解码HTML实体
-		if text != "" {
-			ipInfo.IPLocation = decodeHTMLEntities(text)
+// countryCode 将旗帜文件名转换为ISO 3166-1两位代码
+// Ping0.cc的旗帜图片以小写国家代码命名（如us.png），不是两位字母时返回空字符串。
+func countryCode(flag string) string {
+	if len(flag) != 2 {
+		return ""
+	}
+	for _, r := range flag {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return ""
+		}
+	}
+	return strings.ToUpper(flag)
+}
+
+// ispSeparators 位置字符串中地理位置与运营商之间的分隔符，如"中国 广东 深圳 — 电信"
+var ispSeparators = []string{"—", "–", "|"}
+
+// splitLocation 将位置字符串拆分为国家、省/州、城市和运营商
+// 第一个运营商分隔符之后的内容为运营商；之前的地理位置以空白、逗号、顿号或斜杠分隔，
+// 如"美国 加州 洛杉矶"拆分为"美国"、"加州"、"洛杉矶"。缺少的部分为空字符串，
+// 超过三部分时多出的内容以空格连接后归入城市，因此"美国 加州 Los Angeles"的城市为"Los Angeles"。
+// 调用前应先用normalizeText规范化，全角标点此时已转换为半角。
+//
+// 参数:
+//   - loc: ip_location字段的内容
+//
+// 返回:
+//   - country: 国家/地区名称
+//   - region: 省/州
+//   - city: 城市
+//   - isp: 运营商
+func splitLocation(loc string) (country, region, city, isp string) {
+	for _, sep := range ispSeparators {
+		if before, after, ok := strings.Cut(loc, sep); ok {
+			loc, isp = before, strings.TrimSpace(after)
+			break
+		}
+	}
+
+	parts := strings.FieldsFunc(loc, func(r rune) bool {
+		return unicode.IsSpace(r) || r == ',' || r == '、' || r == '/'
+	})
+	switch {
+	case len(parts) >= 3:
+		return parts[0], parts[1], strings.Join(parts[2:], " "), isp
+	case len(parts) == 2:
+		return parts[0], parts[1], "", isp
+	case len(parts) == 1:
+		return parts[0], "", "", isp
+	default:
+		return "", "", "", isp
+	}
+}
+
+// locationParts 按国家、省/州、城市、运营商的顺序生成location_parts，省略为空的部分，全部为空时返回nil
+func locationParts(country, region, city, isp string) []models.LocationPart {
+	var parts []models.LocationPart
+	for _, p := range []models.LocationPart{
+		{Kind: models.LocationCountry, Name: country},
+		{Kind: models.LocationProvince, Name: region},
+		{Kind: models.LocationCity, Name: city},
+		{Kind: models.LocationISP, Name: isp},
+	} {
+		if p.Name != "" {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+// parseCoordinate 将经度或纬度字符串转换为数值，无法解析时返回0和false
+func parseCoordinate(s string) (float64, bool) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+// parseRiskScore 将风控值（如"26%"）转换为0-100的整数，无法解析时返回0和false
+func parseRiskScore(value string) (int, bool) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "%")), 64)
+	if err != nil {
+		return 0, false
+	}
+	switch {
+	case v < 0:
+		return 0, true
+	case v > 100:
+		return 100, true
+	default:
+		return int(v + 0.5), true
+	}
+}
+
+// extractDualStack 提取双栈访问者的IPv4和IPv6地址
+// 查询当前IP且访问者同时有IPv4和IPv6地址时，页面除window.ip外还分别给出两个地址。页面没有给出时两个字段都保持为空；
+// 只给出其中一个时，另一个地址族取window.ip（如果属于该地址族）。地址无效或不属于对应的地址族时记录警告并忽略。
+func extractDualStack(scriptValues map[string]string, ipInfo *models.IPInfo, warnings *parseWarnings) {
+	family := func(field, value string, v4 bool) string {
+		if value == "" {
+			return ""
+		}
+		addr, err := netip.ParseAddr(value)
+		if err != nil || addr.Is4() != v4 {
+			warnings.add(field, models.WarningUnparseable, "%q 不是有效的%s地址", value, strings.ToUpper(field[:2])+field[2:])
+			return ""
+		}
+		return addr.String()
+	}
+	ipInfo.IPv4 = family("ipv4", scriptValues["window.ipv4"], true)
+	ipInfo.IPv6 = family("ipv6", scriptValues["window.ipv6"], false)
+	if ipInfo.IPv4 == "" && ipInfo.IPv6 == "" {
+		return
+	}
+
+	if primary, err := netip.ParseAddr(ipInfo.IP); err == nil {
+		if ipInfo.IPv4 == "" && primary.Is4() {
+			ipInfo.IPv4 = primary.String()
+		}
+		if ipInfo.IPv6 == "" && primary.Is6() {
+			ipInfo.IPv6 = primary.String()
+		}
+	}
+}
+
+// extractPrefix 提取IP所属的地址段
+// 信息行的内容可能带有说明文字，取其中第一个CIDR格式的地址段；并非所有结果页面都列出IP段，
+// 没有找到时Prefix保持为空。地址段无法解析或不包含查询的IP时记录警告，Prefix同样保持为空。
+func extractPrefix(doc *goquery.Document, sel *Selectors, ipInfo *models.IPInfo, warnings *parseWarnings) {
+	text := lineContent(doc, sel, sel.PrefixName)
+	if text == "" {
+		return
+	}
+
+	for _, token := range strings.Fields(text) {
+		prefix, err := netip.ParsePrefix(token)
+		if err != nil {
+			continue
+		}
+		if addr, err := netip.ParseAddr(ipInfo.IP); err == nil && !prefix.Contains(addr) {
+			warnings.add("prefix", models.WarningUnparseable, "IP段 %s 不包含 %s", prefix, ipInfo.IP)
+			return
+		}
+		ipInfo.Prefix = prefix.Masked().String()
+		return
+	}
+	warnings.add("prefix", models.WarningUnparseable, "IP段 %q 中没有CIDR格式的地址段", text)
+}
+
+// dataUpdatedLayouts 数据更新时间可能使用的格式，依次尝试
+var dataUpdatedLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006/01/02 15:04:05",
+	"2006/01/02 15:04",
+	"2006-01-02",
+	"2006/01/02",
+}
+
+// beijingTime Ping0.cc页面上不带时区的时间使用北京时间（UTC+8）
+var beijingTime = time.FixedZone("CST", 8*60*60)
+
+// extractDataUpdated 提取Ping0.cc数据的更新时间，转换为RFC3339格式
+// 并非所有结果页面都列出更新时间，没有找到时DataUpdated保持为空；无法解析时记录警告，DataUpdated同样保持为空。
+func extractDataUpdated(doc *goquery.Document, sel *Selectors, ipInfo *models.IPInfo, warnings *parseWarnings) {
+	text := lineContent(doc, sel, sel.UpdatedName)
+	if text == "" {
+		return
+	}
+	for _, layout := range dataUpdatedLayouts {
+		if t, err := time.ParseInLocation(layout, text, beijingTime); err == nil {
+			ipInfo.DataUpdated = t.Format(time.RFC3339)
+			return
+		}
+	}
+	warnings.add("data_updated", models.WarningUnparseable, "更新时间 %q 无法解析", text)
+}
+
+// lineContent 返回指定名称的信息行的内容，没有该信息行时返回空字符串
+func lineContent(doc *goquery.Document, sel *Selectors, name string) string {
+	var text string
+	doc.Find(sel.Line).Each(func(i int, s *goquery.Selection) {
+		if strings.TrimSpace(s.Find(sel.LineName).Text()) == name {
+			text = strings.TrimSpace(s.Find(sel.LineContent).Text())
 		}
 	})
+	return text
+}
+
+// extractRiskFactors 提取风控值的组成因素，以因素名称为键
+// 并非所有结果页面都列出组成因素，没有找到时RiskFactors保持为nil；名称为空的项跳过，
+// 同名的项以最后一项为准。
+func extractRiskFactors(doc *goquery.Document, sel *Selectors, ipInfo *models.IPInfo) {
+	doc.Find(sel.RiskFactor).Each(func(i int, s *goquery.Selection) {
+		name := strings.TrimSpace(s.Find(sel.RiskFactorName).Text())
+		if name == "" {
+			return
+		}
+		if ipInfo.RiskFactors == nil {
+			ipInfo.RiskFactors = make(map[string]string)
+		}
+		ipInfo.RiskFactors[name] = strings.TrimSpace(s.Find(sel.RiskFactorValue).Text())
+	})
 }
 
 // extractIPTypes 提取IP类型
-func extractIPTypes(doc *goquery.Document, ipInfo *models.IPInfo) {
+func extractIPTypes(doc *goquery.Document, sel *Selectors, ipInfo *models.IPInfo) {
 	var ipTypes []string
-	doc.Find(".line.line-iptype .content .label").Each(func(i int, s *goquery.Selection) {
+	doc.Find(sel.IPType).Each(func(i int, s *goquery.Selection) {
 		ipType := strings.TrimSpace(s.Text())
 		if ipType != "" {
 			ipTypes = append(ipTypes, ipType)
@@ -323,14 +718,14 @@ func extractIPTypes(doc *goquery.Document, ipInfo *models.IPInfo) {
 }
 
 // extractASNInfo 提取ASN所有者和类型
-func extractASNInfo(doc *goquery.Document, scriptValues map[string]string, ipInfo *models.IPInfo) {
-	doc.Find(".line.asnname .content").Each(func(i int, s *goquery.Selection) {
+func extractASNInfo(doc *goquery.Document, sel *Selectors, scriptValues map[string]string, ipInfo *models.IPInfo) {
+	doc.Find(sel.ASNName).Each(func(i int, s *goquery.Selection) {
 		// 保存原始选择器，用于后续提取标签
 		original := s.Clone()
 
 		// 跳过标签元素，直接获取纯文本内容
 		// 移除掉标签元素
-		s.Find(".label").Each(func(i int, label *goquery.Selection) {
+		s.Find(sel.Label).Each(func(i int, label *goquery.Selection) {
 			label.Remove()
 		})
 
@@ -347,7 +742,7 @@ func extractASNInfo(doc *goquery.Document, scriptValues map[string]string, ipInf
 
 		// 提取ASN类型 - 收集所有类型并用分号分隔
 		var asnTypes []string
-		original.Find(".label").Each(func(i int, label *goquery.Selection) {
+		original.Find(sel.Label).Each(func(i int, label *goquery.Selection) {
 			asnType := strings.TrimSpace(label.Text())
 			if asnType != "" {
 				asnTypes = append(asnTypes, asnType)
@@ -361,14 +756,14 @@ func extractASNInfo(doc *goquery.Document, scriptValues map[string]string, ipInf
 }
 
 // extractOrgInfo 提取组织信息和类型
-func extractOrgInfo(doc *goquery.Document, scriptValues map[string]string, ipInfo *models.IPInfo) {
-	doc.Find(".line.orgname .content").Each(func(i int, s *goquery.Selection) {
+func extractOrgInfo(doc *goquery.Document, sel *Selectors, scriptValues map[string]string, ipInfo *models.IPInfo) {
+	doc.Find(sel.OrgName).Each(func(i int, s *goquery.Selection) {
 		// 保存原始选择器，用于后续提取标签
 		original := s.Clone()
 
 		// 跳过标签元素，直接获取纯文本内容
 		// 移除掉标签元素
-		s.Find(".label").Each(func(i int, label *goquery.Selection) {
+		s.Find(sel.Label).Each(func(i int, label *goquery.Selection) {
 			label.Remove()
 		})
 
@@ -385,7 +780,7 @@ func extractOrgInfo(doc *goquery.Document, scriptValues map[string]string, ipInf
 
 		// 提取组织类型 - 收集所有类型并用分号分隔
 		var orgTypes []string
-		original.Find(".label").Each(func(i int, label *goquery.Selection) {
+		original.Find(sel.Label).Each(func(i int, label *goquery.Selection) {
 			orgType := strings.TrimSpace(label.Text())
 			if orgType != "" {
 				orgTypes = append(orgTypes, orgType)
@@ -429,30 +824,48 @@ func extractTextBetweenTags(html string) string {
 	return strings.TrimSpace(text)
 }
 
-// cleanIPInfo 清理IPInfo中的Vue模板表达式
-func cleanIPInfo(info *models.IPInfo) {
-	// 检查并清理IP
-	if strings.Contains(info.IP, "{{") || strings.Contains(info.IP, "}}") {
-		info.IP = ""
+// ErrUnrenderedPage 表示最终页面中仍有未渲染的Vue模板占位符（如{{ ip }}）
+// 服务器在验证尚未通过时可能返回这样的页面模板，视同访问密钥被拒绝，调用方应重新握手后再请求。
+// 该错误属于ErrChallengeFailed类别。
+var ErrUnrenderedPage = perrors.Wrap(perrors.ErrChallengeFailed, errors.New("最终页面包含未渲染的模板占位符，验证可能尚未通过"))
+
+// templateResidue 返回解析结果中含有Vue模板占位符的字段，字段名与JSON输出一致
+func templateResidue(info *models.IPInfo) []string {
+	var fields []string
+	v := reflect.ValueOf(info).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if v.Field(i).Kind() != reflect.String {
+			continue
+		}
+		s := v.Field(i).String()
+		if strings.Contains(s, "{{") || strings.Contains(s, "}}") {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+			fields = append(fields, name)
+		}
 	}
+	return fields
 }
 
-// decodeHTMLEntities 解码HTML实体为正确的Unicode字符
+// decodeHTMLEntities 解码HTML实体为正确的Unicode字符，并用normalizeText规范化
+// 脚本变量中的字符可能以\uXXXX形式转义（如"\u0026mdash;"），先还原转义再解码HTML实体，
+// 结果与转义和实体的具体写法无关。
 func decodeHTMLEntities(text string) string {
-	// 优先使用标准库解码
-	decoded := html.UnescapeString(text)
-
-	// 处理一些特殊情况
-	customReplacements := map[string]string{
-		"\\u0026mdash;": "—",
-		"\\u0026#8212;": "—",
-	}
+	text = getOrCompileRegex(`\\u([0-9a-fA-F]{4})`).ReplaceAllStringFunc(text, func(m string) string {
+		r, _ := strconv.ParseUint(m[2:], 16, 32)
+		return string(rune(r))
+	})
+	return normalizeText(html.UnescapeString(text))
+}
 
-	for entity, replacement := range customReplacements {
-		if strings.Contains(decoded, entity) {
-			decoded = strings.ReplaceAll(decoded, entity, replacement)
+// normalizeText 将全角ASCII字符（如"，"、"Ａ"）转换为半角，并把连续的Unicode空白
+// （包括全角空格和不换行空格）合并为一个半角空格，去掉首尾空白
+func normalizeText(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r >= 0xFF01 && r <= 0xFF5E {
+			return r - 0xFEE0
 		}
-	}
-
-	return decoded
+		return r
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
 }
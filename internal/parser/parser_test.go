@@ -0,0 +1,213 @@
+package parser
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"ping0/internal/config"
+	perrors "ping0/internal/errors"
+)
+
+// readFixture 读取testdata目录下的HTML页面样本
+func readFixture(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("读取样本 %s 失败: %v", name, err)
+	}
+	return string(data)
+}
+
+func TestParseIPInfoFull(t *testing.T) {
+	info, err := ParseIPInfo(config.New(), readFixture(t, "result_full.html"))
+	if err != nil {
+		t.Fatalf("ParseIPInfo: %v", err)
+	}
+
+	fields := []struct {
+		name, got, want string
+	}{
+		{"ip", info.IP, "8.8.8.8"},
+		{"ipv4", info.IPv4, "8.8.8.8"},
+		{"ipv6", info.IPv6, "2001:4860:4860::8888"},
+		{"ip_location", info.IPLocation, "美国 加州 山景城 — 谷歌云"},
+		{"country_code", info.CountryCode, "US"},
+		{"country", info.Country, "美国"},
+		{"region", info.Region, "加州"},
+		{"city", info.City, "山景城"},
+		{"asn", info.ASN, "AS15169"},
+		{"asn_owner", info.ASNOwner, "Google LLC"},
+		{"asn_type", info.ASNType, "IDC"},
+		{"prefix", info.Prefix, "8.8.8.0/24"},
+		{"organization", info.Organization, "Google LLC"},
+		{"org_type", info.OrgType, "IDC; 大企业"},
+		{"longitude", info.Longitude, "-122.0838"},
+		{"latitude", info.Latitude, "37.3860"},
+		{"ip_type", info.IPType, "IDC机房IP; 广播IP"},
+		{"risk_value", info.RiskValue, "26% 中性"},
+		{"risk_label", info.RiskLabel, "中性"},
+		{"native_ip", info.NativeIP, "原生IP"},
+		{"country_flag", info.CountryFlag, "us"},
+		{"data_updated", info.DataUpdated, "2024-05-01T12:00:00+08:00"},
+	}
+	for _, f := range fields {
+		if f.got != f.want {
+			t.Errorf("%s = %q, 期望 %q", f.name, f.got, f.want)
+		}
+	}
+
+	if info.ASNNumber != 15169 {
+		t.Errorf("asn_number = %d, 期望 15169", info.ASNNumber)
+	}
+	if info.RiskScore != 26 {
+		t.Errorf("risk_score = %d, 期望 26", info.RiskScore)
+	}
+	if info.Lon != -122.0838 || info.Lat != 37.386 {
+		t.Errorf("lon/lat = %v/%v, 期望 -122.0838/37.386", info.Lon, info.Lat)
+	}
+	if len(info.LocationParts) != 4 || info.LocationParts[3].Kind != "isp" || info.LocationParts[3].Name != "谷歌云" {
+		t.Errorf("location_parts = %+v", info.LocationParts)
+	}
+	wantFactors := map[string]string{"代理检测": "否", "滥用历史": "有"}
+	if !reflect.DeepEqual(info.RiskFactors, wantFactors) {
+		t.Errorf("risk_factors = %v, 期望 %v", info.RiskFactors, wantFactors)
+	}
+	if info.ParseQuality == nil || *info.ParseQuality != 100 {
+		t.Errorf("parse_quality = %v, 期望 100", info.ParseQuality)
+	}
+	if len(info.Warnings) != 0 || len(info.MissingFields) != 0 {
+		t.Errorf("完整页面不应有警告: warnings=%v missing=%v", info.Warnings, info.MissingFields)
+	}
+}
+
+func TestParseIPInfoDOMOnly(t *testing.T) {
+	html := readFixture(t, "result_dom_only.html")
+
+	info, err := ParseIPInfo(config.New(), html)
+	if err != nil {
+		t.Fatalf("ParseIPInfo: %v", err)
+	}
+	if info.IP != "1.1.1.1" || info.CountryCode != "AU" || info.ASN != "AS13335" {
+		t.Errorf("ip/country_code/asn = %q/%q/%q", info.IP, info.CountryCode, info.ASN)
+	}
+	if info.IPLocation != "澳大利亚 昆士兰州 布里斯班" {
+		t.Errorf("ip_location = %q", info.IPLocation)
+	}
+	if info.ASNOwner != "Cloudflare, Inc." || info.Organization != "APNIC and Cloudflare DNS Resolver project" {
+		t.Errorf("asn_owner/organization = %q/%q", info.ASNOwner, info.Organization)
+	}
+	if info.Longitude != "153.0281" || info.Latitude != "-27.4679" {
+		t.Errorf("longitude/latitude = %q/%q", info.Longitude, info.Latitude)
+	}
+	if !reflect.DeepEqual(info.MissingFields, []string{"native_ip"}) {
+		t.Errorf("missing_fields = %v, 期望 [native_ip]", info.MissingFields)
+	}
+	if info.ParseQuality == nil || *info.ParseQuality != 90 {
+		t.Errorf("parse_quality = %v, 期望 90", info.ParseQuality)
+	}
+
+	codes := map[string]string{}
+	for _, w := range info.Warnings {
+		codes[w.Field] = w.Code
+	}
+	wantCodes := map[string]string{
+		"ip":          "fallback",
+		"ip_location": "fallback",
+		"longitude":   "fallback",
+		"latitude":    "fallback",
+		"native_ip":   "missing",
+	}
+	if !reflect.DeepEqual(codes, wantCodes) {
+		t.Errorf("warnings = %v, 期望 %v", codes, wantCodes)
+	}
+
+	// 严格模式下缺少原生IP应当失败
+	cfg := config.New()
+	cfg.ParseMode = config.ParseModeStrict
+	if _, err := ParseIPInfo(cfg, html); !errors.Is(err, perrors.ErrParseFailure) {
+		t.Errorf("严格模式: err = %v, 期望解析失败", err)
+	}
+}
+
+func TestParseIPInfoErrors(t *testing.T) {
+	tests := []struct {
+		fixture string
+		target  error
+		message string
+	}{
+		{"result_error.html", perrors.ErrParseFailure, "查询过于频繁，请稍后再试"},
+		{"result_unrendered.html", ErrUnrenderedPage, "字段: ip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			_, err := ParseIPInfo(config.New(), readFixture(t, tt.fixture))
+			if err == nil {
+				t.Fatal("期望返回错误")
+			}
+			if !errors.Is(err, tt.target) {
+				t.Errorf("err = %v, 期望匹配 %v", err, tt.target)
+			}
+			if !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("err = %q, 期望包含 %q", err, tt.message)
+			}
+		})
+	}
+
+	if _, err := ParseIPInfo(config.New(), readFixture(t, "result_unrendered.html")); !errors.Is(err, perrors.ErrChallengeFailed) {
+		t.Errorf("未渲染的页面应归类为验证失败: %v", err)
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	info, err := ParseFile(config.New(), filepath.Join("testdata", "result_full.html"))
+	if err != nil || info.IP != "8.8.8.8" {
+		t.Errorf("ParseFile = %+v, %v", info, err)
+	}
+
+	// 验证页面不包含IP信息
+	_, err = ParseFile(config.New(), filepath.Join("testdata", "challenge.html"))
+	if !errors.Is(err, perrors.ErrParseFailure) || !strings.Contains(err.Error(), "验证页面") {
+		t.Errorf("验证页面: err = %v", err)
+	}
+
+	if _, err := ParseFile(config.New(), filepath.Join("testdata", "missing.html")); err == nil {
+		t.Error("文件不存在时应返回错误")
+	}
+	if IsChallengePage(readFixture(t, "result_full.html")) {
+		t.Error("结果页面被识别为验证页面")
+	}
+}
+
+func TestExtractChallengeParams(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    ChallengeParams
+	}{
+		{"challenge.html", ChallengeParams{X1: "a3f9c0e4b7d15e2a", Difficulty: "0000", JSPath: "/static/js/main.js?v=20240501"}},
+		{"challenge_no_difficulty.html", ChallengeParams{X1: "00a7e1c95b", Difficulty: "00a", JSPath: "/js/main.js"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			html := readFixture(t, tt.fixture)
+			if !IsChallengePage(html) {
+				t.Error("IsChallengePage = false")
+			}
+			params, err := ExtractChallengeParams(html)
+			if err != nil {
+				t.Fatalf("ExtractChallengeParams: %v", err)
+			}
+			if *params != tt.want {
+				t.Errorf("params = %+v, 期望 %+v", *params, tt.want)
+			}
+		})
+	}
+
+	_, err := ExtractChallengeParams(readFixture(t, "challenge_no_x1.html"))
+	if !errors.Is(err, perrors.ErrChallengeFailed) || !strings.Contains(err.Error(), "未找到x1值") {
+		t.Errorf("缺少x1: err = %v", err)
+	}
+}
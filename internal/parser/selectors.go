@@ -0,0 +1,141 @@
+package parser
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"reflect"
+	"sync/atomic"
+
+	"github.com/andybalholm/cascadia"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultSelectorsYAML 内置的选择器定义，修改解析逻辑时需要同步更新selectors.yaml
+//
+//go:embed selectors.yaml
+var defaultSelectorsYAML []byte
+
+// Selectors 解析结果页面使用的CSS选择器
+// 内置的定义来自selectors.yaml，可以通过LoadSelectors加载的文件覆盖，
+// Ping0.cc调整页面结构时无需等待新版本即可修复解析。
+// 带有name后缀的项是信息行的名称文本，不是选择器。
+type Selectors struct {
+	ErrorMessage    string `yaml:"error_message"`     // 错误页面中的错误信息
+	Location        string `yaml:"location"`          // IP位置所在的内容区域
+	CountryFlag     string `yaml:"country_flag"`      // 国家旗帜图片
+	ASN             string `yaml:"asn"`               // ASN编号链接
+	ASNName         string `yaml:"asn_name"`          // ASN所有者所在的内容区域
+	OrgName         string `yaml:"org_name"`          // 组织名称所在的内容区域
+	Label           string `yaml:"label"`             // ASN所有者和组织名称中的类型标签，相对于所在的内容区域
+	Line            string `yaml:"line"`              // 按名称查找的信息行
+	LineName        string `yaml:"line_name"`         // 信息行的名称，相对于信息行
+	LineContent     string `yaml:"line_content"`      // 信息行的内容，相对于信息行
+	LongitudeName   string `yaml:"longitude_name"`    // 经度所在信息行的名称
+	LatitudeName    string `yaml:"latitude_name"`     // 纬度所在信息行的名称
+	PrefixName      string `yaml:"prefix_name"`       // IP段所在信息行的名称
+	UpdatedName     string `yaml:"updated_name"`      // 数据更新时间所在信息行的名称
+	IPType          string `yaml:"ip_type"`           // IP类型标签
+	Risk            string `yaml:"risk"`              // 风控值所在的区域
+	RiskValue       string `yaml:"risk_value"`        // 风控值百分比，相对于风控值区域
+	RiskLabel       string `yaml:"risk_label"`        // 风控等级，相对于风控值区域
+	RiskFactor      string `yaml:"risk_factor"`       // 风控值的组成因素，每个元素为一项
+	RiskFactorName  string `yaml:"risk_factor_name"`  // 因素名称，相对于因素元素
+	RiskFactorValue string `yaml:"risk_factor_value"` // 因素取值，相对于因素元素
+	NativeIP        string `yaml:"native_ip"`         // 原生IP标签
+}
+
+// lineNames 信息行名称文本的项，这些项不是选择器，不做语法检查
+var lineNames = map[string]bool{
+	"longitude_name": true,
+	"latitude_name":  true,
+	"prefix_name":    true,
+	"updated_name":   true,
+}
+
+var (
+	defaultSelectors *Selectors                // 内置的选择器定义，在init中解析后不再修改
+	selectors        atomic.Pointer[Selectors] // 当前使用的选择器，由SetSelectors替换
+)
+
+func init() {
+	s, err := parseSelectors(defaultSelectorsYAML, nil)
+	if err != nil {
+		panic(fmt.Sprintf("内置的选择器定义无效: %v", err))
+	}
+	defaultSelectors = s
+	selectors.Store(s)
+}
+
+// DefaultSelectors 返回内置的选择器定义文件，可以作为自定义选择器文件的模板
+func DefaultSelectors() []byte {
+	return defaultSelectorsYAML
+}
+
+// LoadSelectors 从YAML文件加载选择器定义，文件中未出现的项使用内置的默认值
+//
+// 参数:
+//   - path: 选择器定义文件路径
+//
+// 返回:
+//   - *Selectors: 合并了默认值的选择器定义
+//   - error: 如果文件无法读取、格式错误或包含无效的选择器则返回相应错误
+func LoadSelectors(path string) (*Selectors, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取选择器文件失败: %w", err)
+	}
+	s, err := parseSelectors(data, defaultSelectors)
+	if err != nil {
+		return nil, fmt.Errorf("选择器文件 %s 无效: %w", path, err)
+	}
+	return s, nil
+}
+
+// SetSelectors 替换解析使用的选择器，之后开始的解析都使用新的定义
+// 应在开始查询之前调用，也可以在运行期间调用以重新加载。
+func SetSelectors(s *Selectors) {
+	selectors.Store(s)
+}
+
+// currentSelectors 返回当前使用的选择器
+func currentSelectors() *Selectors {
+	return selectors.Load()
+}
+
+// parseSelectors 解析选择器定义并检查每一项
+//
+// 参数:
+//   - data: YAML格式的选择器定义
+//   - base: 作为默认值的定义，为nil时从空定义开始
+//
+// 返回:
+//   - *Selectors: 解析后的选择器定义
+//   - error: 如果格式错误、某一项为空或选择器语法错误则返回相应错误
+func parseSelectors(data []byte, base *Selectors) (*Selectors, error) {
+	s := &Selectors{}
+	if base != nil {
+		*s = *base
+	}
+	if err := yaml.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+
+	v := reflect.ValueOf(s).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("yaml")
+		value := v.Field(i).String()
+		if value == "" {
+			return nil, fmt.Errorf("%s 不能为空", name)
+		}
+		// 名称文本不是选择器
+		if lineNames[name] {
+			continue
+		}
+		if _, err := cascadia.Compile(value); err != nil {
+			return nil, fmt.Errorf("%s 的选择器 %q 无效: %w", name, value, err)
+		}
+	}
+	return s, nil
+}
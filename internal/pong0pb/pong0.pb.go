@@ -0,0 +1,1354 @@
+// Pong0 API的Protocol Buffers定义
+// 请求 Accept: application/x-protobuf 或 ?format=protobuf 时，单IP查询返回IPInfo（失败时返回Error），
+// 批量查询返回BatchResponse。字段与JSON响应中同名的字段含义相同，新增字段只会使用新的编号。
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.34.2
+// 	protoc        (unknown)
+// source: pong0.proto
+
+package pong0pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// IPInfo 单个IP的查询结果
+type IPInfo struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Ip             string            `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	Ptr            string            `protobuf:"bytes,2,opt,name=ptr,proto3" json:"ptr,omitempty"`
+	IpLocation     string            `protobuf:"bytes,3,opt,name=ip_location,json=ipLocation,proto3" json:"ip_location,omitempty"`
+	CountryCode    string            `protobuf:"bytes,4,opt,name=country_code,json=countryCode,proto3" json:"country_code,omitempty"`
+	Country        string            `protobuf:"bytes,5,opt,name=country,proto3" json:"country,omitempty"`
+	Region         string            `protobuf:"bytes,6,opt,name=region,proto3" json:"region,omitempty"`
+	City           string            `protobuf:"bytes,7,opt,name=city,proto3" json:"city,omitempty"`
+	Asn            string            `protobuf:"bytes,8,opt,name=asn,proto3" json:"asn,omitempty"`
+	AsnNumber      int64             `protobuf:"varint,9,opt,name=asn_number,json=asnNumber,proto3" json:"asn_number,omitempty"`
+	AsnOwner       string            `protobuf:"bytes,10,opt,name=asn_owner,json=asnOwner,proto3" json:"asn_owner,omitempty"`
+	AsnType        string            `protobuf:"bytes,11,opt,name=asn_type,json=asnType,proto3" json:"asn_type,omitempty"`
+	AsnRegistry    *ASNRegistry      `protobuf:"bytes,12,opt,name=asn_registry,json=asnRegistry,proto3" json:"asn_registry,omitempty"`
+	Organization   string            `protobuf:"bytes,13,opt,name=organization,proto3" json:"organization,omitempty"`
+	OrgType        string            `protobuf:"bytes,14,opt,name=org_type,json=orgType,proto3" json:"org_type,omitempty"`
+	Longitude      string            `protobuf:"bytes,15,opt,name=longitude,proto3" json:"longitude,omitempty"`
+	Latitude       string            `protobuf:"bytes,16,opt,name=latitude,proto3" json:"latitude,omitempty"`
+	Lon            float64           `protobuf:"fixed64,17,opt,name=lon,proto3" json:"lon,omitempty"`
+	Lat            float64           `protobuf:"fixed64,18,opt,name=lat,proto3" json:"lat,omitempty"`
+	IpType         string            `protobuf:"bytes,19,opt,name=ip_type,json=ipType,proto3" json:"ip_type,omitempty"`
+	RiskValue      string            `protobuf:"bytes,20,opt,name=risk_value,json=riskValue,proto3" json:"risk_value,omitempty"`
+	RiskScore      int64             `protobuf:"varint,21,opt,name=risk_score,json=riskScore,proto3" json:"risk_score,omitempty"`
+	RiskLabel      string            `protobuf:"bytes,22,opt,name=risk_label,json=riskLabel,proto3" json:"risk_label,omitempty"`
+	NativeIp       string            `protobuf:"bytes,23,opt,name=native_ip,json=nativeIp,proto3" json:"native_ip,omitempty"`
+	CountryFlag    string            `protobuf:"bytes,24,opt,name=country_flag,json=countryFlag,proto3" json:"country_flag,omitempty"`
+	Source         string            `protobuf:"bytes,25,opt,name=source,proto3" json:"source,omitempty"`
+	FallbackReason string            `protobuf:"bytes,26,opt,name=fallback_reason,json=fallbackReason,proto3" json:"fallback_reason,omitempty"`
+	Sources        []*Source         `protobuf:"bytes,27,rep,name=sources,proto3" json:"sources,omitempty"`
+	AgeSeconds     *int64            `protobuf:"varint,28,opt,name=age_seconds,json=ageSeconds,proto3,oneof" json:"age_seconds,omitempty"`
+	RequestId      string            `protobuf:"bytes,29,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	Princess       string            `protobuf:"bytes,30,opt,name=princess,proto3" json:"princess,omitempty"`
+	MissingFields  []string          `protobuf:"bytes,31,rep,name=missing_fields,json=missingFields,proto3" json:"missing_fields,omitempty"`
+	ParseQuality   *int64            `protobuf:"varint,32,opt,name=parse_quality,json=parseQuality,proto3,oneof" json:"parse_quality,omitempty"`
+	Warnings       []*ParseWarning   `protobuf:"bytes,33,rep,name=warnings,proto3" json:"warnings,omitempty"`
+	RiskFactors    map[string]string `protobuf:"bytes,34,rep,name=risk_factors,json=riskFactors,proto3" json:"risk_factors,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Prefix         string            `protobuf:"bytes,35,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	Ipv4           string            `protobuf:"bytes,36,opt,name=ipv4,proto3" json:"ipv4,omitempty"`
+	Ipv6           string            `protobuf:"bytes,37,opt,name=ipv6,proto3" json:"ipv6,omitempty"`
+	DataUpdated    string            `protobuf:"bytes,38,opt,name=data_updated,json=dataUpdated,proto3" json:"data_updated,omitempty"`
+	QueriedAt      string            `protobuf:"bytes,39,opt,name=queried_at,json=queriedAt,proto3" json:"queried_at,omitempty"`
+	LocationParts  []*LocationPart   `protobuf:"bytes,40,rep,name=location_parts,json=locationParts,proto3" json:"location_parts,omitempty"`
+	RedactedFields []string          `protobuf:"bytes,41,rep,name=redacted_fields,json=redactedFields,proto3" json:"redacted_fields,omitempty"`
+}
+
+func (x *IPInfo) Reset() {
+	*x = IPInfo{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pong0_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *IPInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IPInfo) ProtoMessage() {}
+
+func (x *IPInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_pong0_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IPInfo.ProtoReflect.Descriptor instead.
+func (*IPInfo) Descriptor() ([]byte, []int) {
+	return file_pong0_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *IPInfo) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *IPInfo) GetPtr() string {
+	if x != nil {
+		return x.Ptr
+	}
+	return ""
+}
+
+func (x *IPInfo) GetIpLocation() string {
+	if x != nil {
+		return x.IpLocation
+	}
+	return ""
+}
+
+func (x *IPInfo) GetCountryCode() string {
+	if x != nil {
+		return x.CountryCode
+	}
+	return ""
+}
+
+func (x *IPInfo) GetCountry() string {
+	if x != nil {
+		return x.Country
+	}
+	return ""
+}
+
+func (x *IPInfo) GetRegion() string {
+	if x != nil {
+		return x.Region
+	}
+	return ""
+}
+
+func (x *IPInfo) GetCity() string {
+	if x != nil {
+		return x.City
+	}
+	return ""
+}
+
+func (x *IPInfo) GetAsn() string {
+	if x != nil {
+		return x.Asn
+	}
+	return ""
+}
+
+func (x *IPInfo) GetAsnNumber() int64 {
+	if x != nil {
+		return x.AsnNumber
+	}
+	return 0
+}
+
+func (x *IPInfo) GetAsnOwner() string {
+	if x != nil {
+		return x.AsnOwner
+	}
+	return ""
+}
+
+func (x *IPInfo) GetAsnType() string {
+	if x != nil {
+		return x.AsnType
+	}
+	return ""
+}
+
+func (x *IPInfo) GetAsnRegistry() *ASNRegistry {
+	if x != nil {
+		return x.AsnRegistry
+	}
+	return nil
+}
+
+func (x *IPInfo) GetOrganization() string {
+	if x != nil {
+		return x.Organization
+	}
+	return ""
+}
+
+func (x *IPInfo) GetOrgType() string {
+	if x != nil {
+		return x.OrgType
+	}
+	return ""
+}
+
+func (x *IPInfo) GetLongitude() string {
+	if x != nil {
+		return x.Longitude
+	}
+	return ""
+}
+
+func (x *IPInfo) GetLatitude() string {
+	if x != nil {
+		return x.Latitude
+	}
+	return ""
+}
+
+func (x *IPInfo) GetLon() float64 {
+	if x != nil {
+		return x.Lon
+	}
+	return 0
+}
+
+func (x *IPInfo) GetLat() float64 {
+	if x != nil {
+		return x.Lat
+	}
+	return 0
+}
+
+func (x *IPInfo) GetIpType() string {
+	if x != nil {
+		return x.IpType
+	}
+	return ""
+}
+
+func (x *IPInfo) GetRiskValue() string {
+	if x != nil {
+		return x.RiskValue
+	}
+	return ""
+}
+
+func (x *IPInfo) GetRiskScore() int64 {
+	if x != nil {
+		return x.RiskScore
+	}
+	return 0
+}
+
+func (x *IPInfo) GetRiskLabel() string {
+	if x != nil {
+		return x.RiskLabel
+	}
+	return ""
+}
+
+func (x *IPInfo) GetNativeIp() string {
+	if x != nil {
+		return x.NativeIp
+	}
+	return ""
+}
+
+func (x *IPInfo) GetCountryFlag() string {
+	if x != nil {
+		return x.CountryFlag
+	}
+	return ""
+}
+
+func (x *IPInfo) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *IPInfo) GetFallbackReason() string {
+	if x != nil {
+		return x.FallbackReason
+	}
+	return ""
+}
+
+func (x *IPInfo) GetSources() []*Source {
+	if x != nil {
+		return x.Sources
+	}
+	return nil
+}
+
+func (x *IPInfo) GetAgeSeconds() int64 {
+	if x != nil && x.AgeSeconds != nil {
+		return *x.AgeSeconds
+	}
+	return 0
+}
+
+func (x *IPInfo) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *IPInfo) GetPrincess() string {
+	if x != nil {
+		return x.Princess
+	}
+	return ""
+}
+
+func (x *IPInfo) GetMissingFields() []string {
+	if x != nil {
+		return x.MissingFields
+	}
+	return nil
+}
+
+func (x *IPInfo) GetParseQuality() int64 {
+	if x != nil && x.ParseQuality != nil {
+		return *x.ParseQuality
+	}
+	return 0
+}
+
+func (x *IPInfo) GetWarnings() []*ParseWarning {
+	if x != nil {
+		return x.Warnings
+	}
+	return nil
+}
+
+func (x *IPInfo) GetRiskFactors() map[string]string {
+	if x != nil {
+		return x.RiskFactors
+	}
+	return nil
+}
+
+func (x *IPInfo) GetPrefix() string {
+	if x != nil {
+		return x.Prefix
+	}
+	return ""
+}
+
+func (x *IPInfo) GetIpv4() string {
+	if x != nil {
+		return x.Ipv4
+	}
+	return ""
+}
+
+func (x *IPInfo) GetIpv6() string {
+	if x != nil {
+		return x.Ipv6
+	}
+	return ""
+}
+
+func (x *IPInfo) GetDataUpdated() string {
+	if x != nil {
+		return x.DataUpdated
+	}
+	return ""
+}
+
+func (x *IPInfo) GetQueriedAt() string {
+	if x != nil {
+		return x.QueriedAt
+	}
+	return ""
+}
+
+func (x *IPInfo) GetLocationParts() []*LocationPart {
+	if x != nil {
+		return x.LocationParts
+	}
+	return nil
+}
+
+func (x *IPInfo) GetRedactedFields() []string {
+	if x != nil {
+		return x.RedactedFields
+	}
+	return nil
+}
+
+// LocationPart ip_location拆分后的一个组成部分
+type LocationPart struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Kind string `protobuf:"bytes,1,opt,name=kind,proto3" json:"kind,omitempty"`
+	Name string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+}
+
+func (x *LocationPart) Reset() {
+	*x = LocationPart{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pong0_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *LocationPart) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LocationPart) ProtoMessage() {}
+
+func (x *LocationPart) ProtoReflect() protoreflect.Message {
+	mi := &file_pong0_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LocationPart.ProtoReflect.Descriptor instead.
+func (*LocationPart) Descriptor() ([]byte, []int) {
+	return file_pong0_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *LocationPart) GetKind() string {
+	if x != nil {
+		return x.Kind
+	}
+	return ""
+}
+
+func (x *LocationPart) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+// ParseWarning 解析结果页面时发现的问题
+type ParseWarning struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Field   string `protobuf:"bytes,1,opt,name=field,proto3" json:"field,omitempty"`
+	Code    string `protobuf:"bytes,2,opt,name=code,proto3" json:"code,omitempty"`
+	Message string `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+}
+
+func (x *ParseWarning) Reset() {
+	*x = ParseWarning{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pong0_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ParseWarning) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ParseWarning) ProtoMessage() {}
+
+func (x *ParseWarning) ProtoReflect() protoreflect.Message {
+	mi := &file_pong0_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ParseWarning.ProtoReflect.Descriptor instead.
+func (*ParseWarning) Descriptor() ([]byte, []int) {
+	return file_pong0_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ParseWarning) GetField() string {
+	if x != nil {
+		return x.Field
+	}
+	return ""
+}
+
+func (x *ParseWarning) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *ParseWarning) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+// ASNRegistry ASN注册数据中的信息
+type ASNRegistry struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Number   int64  `protobuf:"varint,1,opt,name=number,proto3" json:"number,omitempty"`
+	Name     string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Country  string `protobuf:"bytes,3,opt,name=country,proto3" json:"country,omitempty"`
+	Registry string `protobuf:"bytes,4,opt,name=registry,proto3" json:"registry,omitempty"`
+}
+
+func (x *ASNRegistry) Reset() {
+	*x = ASNRegistry{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pong0_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ASNRegistry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ASNRegistry) ProtoMessage() {}
+
+func (x *ASNRegistry) ProtoReflect() protoreflect.Message {
+	mi := &file_pong0_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ASNRegistry.ProtoReflect.Descriptor instead.
+func (*ASNRegistry) Descriptor() ([]byte, []int) {
+	return file_pong0_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ASNRegistry) GetNumber() int64 {
+	if x != nil {
+		return x.Number
+	}
+	return 0
+}
+
+func (x *ASNRegistry) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ASNRegistry) GetCountry() string {
+	if x != nil {
+		return x.Country
+	}
+	return ""
+}
+
+func (x *ASNRegistry) GetRegistry() string {
+	if x != nil {
+		return x.Registry
+	}
+	return ""
+}
+
+// Source 附加数据源的结果
+type Source struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name         string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	CountryCode  string   `protobuf:"bytes,2,opt,name=country_code,json=countryCode,proto3" json:"country_code,omitempty"`
+	Country      string   `protobuf:"bytes,3,opt,name=country,proto3" json:"country,omitempty"`
+	Region       string   `protobuf:"bytes,4,opt,name=region,proto3" json:"region,omitempty"`
+	City         string   `protobuf:"bytes,5,opt,name=city,proto3" json:"city,omitempty"`
+	Lat          float64  `protobuf:"fixed64,6,opt,name=lat,proto3" json:"lat,omitempty"`
+	Lon          float64  `protobuf:"fixed64,7,opt,name=lon,proto3" json:"lon,omitempty"`
+	AsnNumber    int64    `protobuf:"varint,8,opt,name=asn_number,json=asnNumber,proto3" json:"asn_number,omitempty"`
+	AsnOwner     string   `protobuf:"bytes,9,opt,name=asn_owner,json=asnOwner,proto3" json:"asn_owner,omitempty"`
+	Organization string   `protobuf:"bytes,10,opt,name=organization,proto3" json:"organization,omitempty"`
+	Disagrees    []string `protobuf:"bytes,11,rep,name=disagrees,proto3" json:"disagrees,omitempty"`
+	Error        string   `protobuf:"bytes,12,opt,name=error,proto3" json:"error,omitempty"`
+}
+
+func (x *Source) Reset() {
+	*x = Source{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pong0_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Source) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Source) ProtoMessage() {}
+
+func (x *Source) ProtoReflect() protoreflect.Message {
+	mi := &file_pong0_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Source.ProtoReflect.Descriptor instead.
+func (*Source) Descriptor() ([]byte, []int) {
+	return file_pong0_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Source) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Source) GetCountryCode() string {
+	if x != nil {
+		return x.CountryCode
+	}
+	return ""
+}
+
+func (x *Source) GetCountry() string {
+	if x != nil {
+		return x.Country
+	}
+	return ""
+}
+
+func (x *Source) GetRegion() string {
+	if x != nil {
+		return x.Region
+	}
+	return ""
+}
+
+func (x *Source) GetCity() string {
+	if x != nil {
+		return x.City
+	}
+	return ""
+}
+
+func (x *Source) GetLat() float64 {
+	if x != nil {
+		return x.Lat
+	}
+	return 0
+}
+
+func (x *Source) GetLon() float64 {
+	if x != nil {
+		return x.Lon
+	}
+	return 0
+}
+
+func (x *Source) GetAsnNumber() int64 {
+	if x != nil {
+		return x.AsnNumber
+	}
+	return 0
+}
+
+func (x *Source) GetAsnOwner() string {
+	if x != nil {
+		return x.AsnOwner
+	}
+	return ""
+}
+
+func (x *Source) GetOrganization() string {
+	if x != nil {
+		return x.Organization
+	}
+	return ""
+}
+
+func (x *Source) GetDisagrees() []string {
+	if x != nil {
+		return x.Disagrees
+	}
+	return nil
+}
+
+func (x *Source) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+// Error 单IP查询失败时的响应
+type Error struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Error     string `protobuf:"bytes,1,opt,name=error,proto3" json:"error,omitempty"`
+	Code      string `protobuf:"bytes,2,opt,name=code,proto3" json:"code,omitempty"`
+	RequestId string `protobuf:"bytes,3,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	Princess  string `protobuf:"bytes,4,opt,name=princess,proto3" json:"princess,omitempty"`
+}
+
+func (x *Error) Reset() {
+	*x = Error{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pong0_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Error) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Error) ProtoMessage() {}
+
+func (x *Error) ProtoReflect() protoreflect.Message {
+	mi := &file_pong0_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Error.ProtoReflect.Descriptor instead.
+func (*Error) Descriptor() ([]byte, []int) {
+	return file_pong0_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Error) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Error) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Error) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *Error) GetPrincess() string {
+	if x != nil {
+		return x.Princess
+	}
+	return ""
+}
+
+// BatchError 批量查询中单个IP查询失败时的结果
+type BatchError struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Ip            string `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	Error         string `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	Code          string `protobuf:"bytes,3,opt,name=code,proto3" json:"code,omitempty"`
+	CorrelationId string `protobuf:"bytes,4,opt,name=correlation_id,json=correlationId,proto3" json:"correlation_id,omitempty"`
+	RequestId     string `protobuf:"bytes,5,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	Princess      string `protobuf:"bytes,6,opt,name=princess,proto3" json:"princess,omitempty"`
+}
+
+func (x *BatchError) Reset() {
+	*x = BatchError{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pong0_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BatchError) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchError) ProtoMessage() {}
+
+func (x *BatchError) ProtoReflect() protoreflect.Message {
+	mi := &file_pong0_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchError.ProtoReflect.Descriptor instead.
+func (*BatchError) Descriptor() ([]byte, []int) {
+	return file_pong0_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *BatchError) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *BatchError) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *BatchError) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *BatchError) GetCorrelationId() string {
+	if x != nil {
+		return x.CorrelationId
+	}
+	return ""
+}
+
+func (x *BatchError) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *BatchError) GetPrincess() string {
+	if x != nil {
+		return x.Princess
+	}
+	return ""
+}
+
+// BatchResult 批量查询中单个IP的结果
+type BatchResult struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Types that are assignable to Result:
+	//	*BatchResult_Info
+	//	*BatchResult_Error
+	Result isBatchResult_Result `protobuf_oneof:"result"`
+}
+
+func (x *BatchResult) Reset() {
+	*x = BatchResult{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pong0_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BatchResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchResult) ProtoMessage() {}
+
+func (x *BatchResult) ProtoReflect() protoreflect.Message {
+	mi := &file_pong0_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchResult.ProtoReflect.Descriptor instead.
+func (*BatchResult) Descriptor() ([]byte, []int) {
+	return file_pong0_proto_rawDescGZIP(), []int{7}
+}
+
+func (m *BatchResult) GetResult() isBatchResult_Result {
+	if m != nil {
+		return m.Result
+	}
+	return nil
+}
+
+func (x *BatchResult) GetInfo() *IPInfo {
+	if x, ok := x.GetResult().(*BatchResult_Info); ok {
+		return x.Info
+	}
+	return nil
+}
+
+func (x *BatchResult) GetError() *BatchError {
+	if x, ok := x.GetResult().(*BatchResult_Error); ok {
+		return x.Error
+	}
+	return nil
+}
+
+type isBatchResult_Result interface {
+	isBatchResult_Result()
+}
+
+type BatchResult_Info struct {
+	Info *IPInfo `protobuf:"bytes,1,opt,name=info,proto3,oneof"`
+}
+
+type BatchResult_Error struct {
+	Error *BatchError `protobuf:"bytes,2,opt,name=error,proto3,oneof"`
+}
+
+func (*BatchResult_Info) isBatchResult_Result() {}
+
+func (*BatchResult_Error) isBatchResult_Result() {}
+
+// BatchResponse 批量查询的响应，结果顺序与请求顺序一致
+type BatchResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Results []*BatchResult `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+}
+
+func (x *BatchResponse) Reset() {
+	*x = BatchResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pong0_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BatchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchResponse) ProtoMessage() {}
+
+func (x *BatchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pong0_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchResponse.ProtoReflect.Descriptor instead.
+func (*BatchResponse) Descriptor() ([]byte, []int) {
+	return file_pong0_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *BatchResponse) GetResults() []*BatchResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+var File_pong0_proto protoreflect.FileDescriptor
+
+var file_pong0_proto_rawDesc = []byte{
+	0x0a, 0x0b, 0x70, 0x6f, 0x6e, 0x67, 0x30, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x08, 0x70,
+	0x6f, 0x6e, 0x67, 0x30, 0x2e, 0x76, 0x31, 0x22, 0x8f, 0x0b, 0x0a, 0x06, 0x49, 0x50, 0x49, 0x6e,
+	0x66, 0x6f, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02,
+	0x69, 0x70, 0x12, 0x10, 0x0a, 0x03, 0x70, 0x74, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x03, 0x70, 0x74, 0x72, 0x12, 0x1f, 0x0a, 0x0b, 0x69, 0x70, 0x5f, 0x6c, 0x6f, 0x63, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x69, 0x70, 0x4c, 0x6f, 0x63,
+	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x21, 0x0a, 0x0c, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x72, 0x79,
+	0x5f, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x63, 0x6f, 0x75,
+	0x6e, 0x74, 0x72, 0x79, 0x43, 0x6f, 0x64, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x6f, 0x75, 0x6e,
+	0x74, 0x72, 0x79, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x63, 0x6f, 0x75, 0x6e, 0x74,
+	0x72, 0x79, 0x12, 0x16, 0x0a, 0x06, 0x72, 0x65, 0x67, 0x69, 0x6f, 0x6e, 0x18, 0x06, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x06, 0x72, 0x65, 0x67, 0x69, 0x6f, 0x6e, 0x12, 0x12, 0x0a, 0x04, 0x63, 0x69,
+	0x74, 0x79, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x63, 0x69, 0x74, 0x79, 0x12, 0x10,
+	0x0a, 0x03, 0x61, 0x73, 0x6e, 0x18, 0x08, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x61, 0x73, 0x6e,
+	0x12, 0x1d, 0x0a, 0x0a, 0x61, 0x73, 0x6e, 0x5f, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x18, 0x09,
+	0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x61, 0x73, 0x6e, 0x4e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x12,
+	0x1b, 0x0a, 0x09, 0x61, 0x73, 0x6e, 0x5f, 0x6f, 0x77, 0x6e, 0x65, 0x72, 0x18, 0x0a, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x08, 0x61, 0x73, 0x6e, 0x4f, 0x77, 0x6e, 0x65, 0x72, 0x12, 0x19, 0x0a, 0x08,
+	0x61, 0x73, 0x6e, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07,
+	0x61, 0x73, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x12, 0x38, 0x0a, 0x0c, 0x61, 0x73, 0x6e, 0x5f, 0x72,
+	0x65, 0x67, 0x69, 0x73, 0x74, 0x72, 0x79, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x15, 0x2e,
+	0x70, 0x6f, 0x6e, 0x67, 0x30, 0x2e, 0x76, 0x31, 0x2e, 0x41, 0x53, 0x4e, 0x52, 0x65, 0x67, 0x69,
+	0x73, 0x74, 0x72, 0x79, 0x52, 0x0b, 0x61, 0x73, 0x6e, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x72,
+	0x79, 0x12, 0x22, 0x0a, 0x0c, 0x6f, 0x72, 0x67, 0x61, 0x6e, 0x69, 0x7a, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x6f, 0x72, 0x67, 0x61, 0x6e, 0x69, 0x7a,
+	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x19, 0x0a, 0x08, 0x6f, 0x72, 0x67, 0x5f, 0x74, 0x79, 0x70,
+	0x65, 0x18, 0x0e, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6f, 0x72, 0x67, 0x54, 0x79, 0x70, 0x65,
+	0x12, 0x1c, 0x0a, 0x09, 0x6c, 0x6f, 0x6e, 0x67, 0x69, 0x74, 0x75, 0x64, 0x65, 0x18, 0x0f, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x09, 0x6c, 0x6f, 0x6e, 0x67, 0x69, 0x74, 0x75, 0x64, 0x65, 0x12, 0x1a,
+	0x0a, 0x08, 0x6c, 0x61, 0x74, 0x69, 0x74, 0x75, 0x64, 0x65, 0x18, 0x10, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x08, 0x6c, 0x61, 0x74, 0x69, 0x74, 0x75, 0x64, 0x65, 0x12, 0x10, 0x0a, 0x03, 0x6c, 0x6f,
+	0x6e, 0x18, 0x11, 0x20, 0x01, 0x28, 0x01, 0x52, 0x03, 0x6c, 0x6f, 0x6e, 0x12, 0x10, 0x0a, 0x03,
+	0x6c, 0x61, 0x74, 0x18, 0x12, 0x20, 0x01, 0x28, 0x01, 0x52, 0x03, 0x6c, 0x61, 0x74, 0x12, 0x17,
+	0x0a, 0x07, 0x69, 0x70, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x18, 0x13, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x06, 0x69, 0x70, 0x54, 0x79, 0x70, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x72, 0x69, 0x73, 0x6b, 0x5f,
+	0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x14, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x72, 0x69, 0x73,
+	0x6b, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x72, 0x69, 0x73, 0x6b, 0x5f, 0x73,
+	0x63, 0x6f, 0x72, 0x65, 0x18, 0x15, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x72, 0x69, 0x73, 0x6b,
+	0x53, 0x63, 0x6f, 0x72, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x72, 0x69, 0x73, 0x6b, 0x5f, 0x6c, 0x61,
+	0x62, 0x65, 0x6c, 0x18, 0x16, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x72, 0x69, 0x73, 0x6b, 0x4c,
+	0x61, 0x62, 0x65, 0x6c, 0x12, 0x1b, 0x0a, 0x09, 0x6e, 0x61, 0x74, 0x69, 0x76, 0x65, 0x5f, 0x69,
+	0x70, 0x18, 0x17, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x6e, 0x61, 0x74, 0x69, 0x76, 0x65, 0x49,
+	0x70, 0x12, 0x21, 0x0a, 0x0c, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x72, 0x79, 0x5f, 0x66, 0x6c, 0x61,
+	0x67, 0x18, 0x18, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x72, 0x79,
+	0x46, 0x6c, 0x61, 0x67, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x18, 0x19,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x12, 0x27, 0x0a, 0x0f,
+	0x66, 0x61, 0x6c, 0x6c, 0x62, 0x61, 0x63, 0x6b, 0x5f, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x18,
+	0x1a, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0e, 0x66, 0x61, 0x6c, 0x6c, 0x62, 0x61, 0x63, 0x6b, 0x52,
+	0x65, 0x61, 0x73, 0x6f, 0x6e, 0x12, 0x2a, 0x0a, 0x07, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x73,
+	0x18, 0x1b, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x70, 0x6f, 0x6e, 0x67, 0x30, 0x2e, 0x76,
+	0x31, 0x2e, 0x53, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x52, 0x07, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65,
+	0x73, 0x12, 0x24, 0x0a, 0x0b, 0x61, 0x67, 0x65, 0x5f, 0x73, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73,
+	0x18, 0x1c, 0x20, 0x01, 0x28, 0x03, 0x48, 0x00, 0x52, 0x0a, 0x61, 0x67, 0x65, 0x53, 0x65, 0x63,
+	0x6f, 0x6e, 0x64, 0x73, 0x88, 0x01, 0x01, 0x12, 0x1d, 0x0a, 0x0a, 0x72, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x5f, 0x69, 0x64, 0x18, 0x1d, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x72, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x49, 0x64, 0x12, 0x1a, 0x0a, 0x08, 0x70, 0x72, 0x69, 0x6e, 0x63, 0x65,
+	0x73, 0x73, 0x18, 0x1e, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x70, 0x72, 0x69, 0x6e, 0x63, 0x65,
+	0x73, 0x73, 0x12, 0x25, 0x0a, 0x0e, 0x6d, 0x69, 0x73, 0x73, 0x69, 0x6e, 0x67, 0x5f, 0x66, 0x69,
+	0x65, 0x6c, 0x64, 0x73, 0x18, 0x1f, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0d, 0x6d, 0x69, 0x73, 0x73,
+	0x69, 0x6e, 0x67, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x73, 0x12, 0x28, 0x0a, 0x0d, 0x70, 0x61, 0x72,
+	0x73, 0x65, 0x5f, 0x71, 0x75, 0x61, 0x6c, 0x69, 0x74, 0x79, 0x18, 0x20, 0x20, 0x01, 0x28, 0x03,
+	0x48, 0x01, 0x52, 0x0c, 0x70, 0x61, 0x72, 0x73, 0x65, 0x51, 0x75, 0x61, 0x6c, 0x69, 0x74, 0x79,
+	0x88, 0x01, 0x01, 0x12, 0x32, 0x0a, 0x08, 0x77, 0x61, 0x72, 0x6e, 0x69, 0x6e, 0x67, 0x73, 0x18,
+	0x21, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x70, 0x6f, 0x6e, 0x67, 0x30, 0x2e, 0x76, 0x31,
+	0x2e, 0x50, 0x61, 0x72, 0x73, 0x65, 0x57, 0x61, 0x72, 0x6e, 0x69, 0x6e, 0x67, 0x52, 0x08, 0x77,
+	0x61, 0x72, 0x6e, 0x69, 0x6e, 0x67, 0x73, 0x12, 0x44, 0x0a, 0x0c, 0x72, 0x69, 0x73, 0x6b, 0x5f,
+	0x66, 0x61, 0x63, 0x74, 0x6f, 0x72, 0x73, 0x18, 0x22, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x21, 0x2e,
+	0x70, 0x6f, 0x6e, 0x67, 0x30, 0x2e, 0x76, 0x31, 0x2e, 0x49, 0x50, 0x49, 0x6e, 0x66, 0x6f, 0x2e,
+	0x52, 0x69, 0x73, 0x6b, 0x46, 0x61, 0x63, 0x74, 0x6f, 0x72, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79,
+	0x52, 0x0b, 0x72, 0x69, 0x73, 0x6b, 0x46, 0x61, 0x63, 0x74, 0x6f, 0x72, 0x73, 0x12, 0x16, 0x0a,
+	0x06, 0x70, 0x72, 0x65, 0x66, 0x69, 0x78, 0x18, 0x23, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x70,
+	0x72, 0x65, 0x66, 0x69, 0x78, 0x12, 0x12, 0x0a, 0x04, 0x69, 0x70, 0x76, 0x34, 0x18, 0x24, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x04, 0x69, 0x70, 0x76, 0x34, 0x12, 0x12, 0x0a, 0x04, 0x69, 0x70, 0x76,
+	0x36, 0x18, 0x25, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x69, 0x70, 0x76, 0x36, 0x12, 0x21, 0x0a,
+	0x0c, 0x64, 0x61, 0x74, 0x61, 0x5f, 0x75, 0x70, 0x64, 0x61, 0x74, 0x65, 0x64, 0x18, 0x26, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x0b, 0x64, 0x61, 0x74, 0x61, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x64,
+	0x12, 0x1d, 0x0a, 0x0a, 0x71, 0x75, 0x65, 0x72, 0x69, 0x65, 0x64, 0x5f, 0x61, 0x74, 0x18, 0x27,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x71, 0x75, 0x65, 0x72, 0x69, 0x65, 0x64, 0x41, 0x74, 0x12,
+	0x3d, 0x0a, 0x0e, 0x6c, 0x6f, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x70, 0x61, 0x72, 0x74,
+	0x73, 0x18, 0x28, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x70, 0x6f, 0x6e, 0x67, 0x30, 0x2e,
+	0x76, 0x31, 0x2e, 0x4c, 0x6f, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x50, 0x61, 0x72, 0x74, 0x52,
+	0x0d, 0x6c, 0x6f, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x50, 0x61, 0x72, 0x74, 0x73, 0x12, 0x27,
+	0x0a, 0x0f, 0x72, 0x65, 0x64, 0x61, 0x63, 0x74, 0x65, 0x64, 0x5f, 0x66, 0x69, 0x65, 0x6c, 0x64,
+	0x73, 0x18, 0x29, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0e, 0x72, 0x65, 0x64, 0x61, 0x63, 0x74, 0x65,
+	0x64, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x73, 0x1a, 0x3e, 0x0a, 0x10, 0x52, 0x69, 0x73, 0x6b, 0x46,
+	0x61, 0x63, 0x74, 0x6f, 0x72, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b,
+	0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a,
+	0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61,
+	0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x42, 0x0e, 0x0a, 0x0c, 0x5f, 0x61, 0x67, 0x65, 0x5f,
+	0x73, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73, 0x42, 0x10, 0x0a, 0x0e, 0x5f, 0x70, 0x61, 0x72, 0x73,
+	0x65, 0x5f, 0x71, 0x75, 0x61, 0x6c, 0x69, 0x74, 0x79, 0x22, 0x36, 0x0a, 0x0c, 0x4c, 0x6f, 0x63,
+	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x50, 0x61, 0x72, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x6b, 0x69, 0x6e,
+	0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6b, 0x69, 0x6e, 0x64, 0x12, 0x12, 0x0a,
+	0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d,
+	0x65, 0x22, 0x52, 0x0a, 0x0c, 0x50, 0x61, 0x72, 0x73, 0x65, 0x57, 0x61, 0x72, 0x6e, 0x69, 0x6e,
+	0x67, 0x12, 0x14, 0x0a, 0x05, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x05, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x63, 0x6f, 0x64, 0x65, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x63, 0x6f, 0x64, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x6d,
+	0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6d, 0x65,
+	0x73, 0x73, 0x61, 0x67, 0x65, 0x22, 0x6f, 0x0a, 0x0b, 0x41, 0x53, 0x4e, 0x52, 0x65, 0x67, 0x69,
+	0x73, 0x74, 0x72, 0x79, 0x12, 0x16, 0x0a, 0x06, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x03, 0x52, 0x06, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x12, 0x12, 0x0a, 0x04,
+	0x6e, 0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65,
+	0x12, 0x18, 0x0a, 0x07, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x72, 0x79, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x07, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x65,
+	0x67, 0x69, 0x73, 0x74, 0x72, 0x79, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x72, 0x65,
+	0x67, 0x69, 0x73, 0x74, 0x72, 0x79, 0x22, 0xbd, 0x02, 0x0a, 0x06, 0x53, 0x6f, 0x75, 0x72, 0x63,
+	0x65, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x21, 0x0a, 0x0c, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x72, 0x79,
+	0x5f, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x63, 0x6f, 0x75,
+	0x6e, 0x74, 0x72, 0x79, 0x43, 0x6f, 0x64, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x6f, 0x75, 0x6e,
+	0x74, 0x72, 0x79, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x63, 0x6f, 0x75, 0x6e, 0x74,
+	0x72, 0x79, 0x12, 0x16, 0x0a, 0x06, 0x72, 0x65, 0x67, 0x69, 0x6f, 0x6e, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x06, 0x72, 0x65, 0x67, 0x69, 0x6f, 0x6e, 0x12, 0x12, 0x0a, 0x04, 0x63, 0x69,
+	0x74, 0x79, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x63, 0x69, 0x74, 0x79, 0x12, 0x10,
+	0x0a, 0x03, 0x6c, 0x61, 0x74, 0x18, 0x06, 0x20, 0x01, 0x28, 0x01, 0x52, 0x03, 0x6c, 0x61, 0x74,
+	0x12, 0x10, 0x0a, 0x03, 0x6c, 0x6f, 0x6e, 0x18, 0x07, 0x20, 0x01, 0x28, 0x01, 0x52, 0x03, 0x6c,
+	0x6f, 0x6e, 0x12, 0x1d, 0x0a, 0x0a, 0x61, 0x73, 0x6e, 0x5f, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72,
+	0x18, 0x08, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x61, 0x73, 0x6e, 0x4e, 0x75, 0x6d, 0x62, 0x65,
+	0x72, 0x12, 0x1b, 0x0a, 0x09, 0x61, 0x73, 0x6e, 0x5f, 0x6f, 0x77, 0x6e, 0x65, 0x72, 0x18, 0x09,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x61, 0x73, 0x6e, 0x4f, 0x77, 0x6e, 0x65, 0x72, 0x12, 0x22,
+	0x0a, 0x0c, 0x6f, 0x72, 0x67, 0x61, 0x6e, 0x69, 0x7a, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x0a,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x6f, 0x72, 0x67, 0x61, 0x6e, 0x69, 0x7a, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x12, 0x1c, 0x0a, 0x09, 0x64, 0x69, 0x73, 0x61, 0x67, 0x72, 0x65, 0x65, 0x73, 0x18,
+	0x0b, 0x20, 0x03, 0x28, 0x09, 0x52, 0x09, 0x64, 0x69, 0x73, 0x61, 0x67, 0x72, 0x65, 0x65, 0x73,
+	0x12, 0x14, 0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x22, 0x6c, 0x0a, 0x05, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x12,
+	0x14, 0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05,
+	0x65, 0x72, 0x72, 0x6f, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x04, 0x63, 0x6f, 0x64, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x72, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x5f, 0x69, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x72,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x49, 0x64, 0x12, 0x1a, 0x0a, 0x08, 0x70, 0x72, 0x69, 0x6e,
+	0x63, 0x65, 0x73, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x70, 0x72, 0x69, 0x6e,
+	0x63, 0x65, 0x73, 0x73, 0x22, 0xa8, 0x01, 0x0a, 0x0a, 0x42, 0x61, 0x74, 0x63, 0x68, 0x45, 0x72,
+	0x72, 0x6f, 0x72, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x02, 0x69, 0x70, 0x12, 0x14, 0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x63, 0x6f, 0x64,
+	0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x63, 0x6f, 0x64, 0x65, 0x12, 0x25, 0x0a,
+	0x0e, 0x63, 0x6f, 0x72, 0x72, 0x65, 0x6c, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x69, 0x64, 0x18,
+	0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x63, 0x6f, 0x72, 0x72, 0x65, 0x6c, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x49, 0x64, 0x12, 0x1d, 0x0a, 0x0a, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x5f,
+	0x69, 0x64, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x49, 0x64, 0x12, 0x1a, 0x0a, 0x08, 0x70, 0x72, 0x69, 0x6e, 0x63, 0x65, 0x73, 0x73, 0x18,
+	0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x70, 0x72, 0x69, 0x6e, 0x63, 0x65, 0x73, 0x73, 0x22,
+	0x6d, 0x0a, 0x0b, 0x42, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x26,
+	0x0a, 0x04, 0x69, 0x6e, 0x66, 0x6f, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x70,
+	0x6f, 0x6e, 0x67, 0x30, 0x2e, 0x76, 0x31, 0x2e, 0x49, 0x50, 0x49, 0x6e, 0x66, 0x6f, 0x48, 0x00,
+	0x52, 0x04, 0x69, 0x6e, 0x66, 0x6f, 0x12, 0x2c, 0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x70, 0x6f, 0x6e, 0x67, 0x30, 0x2e, 0x76, 0x31,
+	0x2e, 0x42, 0x61, 0x74, 0x63, 0x68, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x48, 0x00, 0x52, 0x05, 0x65,
+	0x72, 0x72, 0x6f, 0x72, 0x42, 0x08, 0x0a, 0x06, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x22, 0x40,
+	0x0a, 0x0d, 0x42, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12,
+	0x2f, 0x0a, 0x07, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b,
+	0x32, 0x15, 0x2e, 0x70, 0x6f, 0x6e, 0x67, 0x30, 0x2e, 0x76, 0x31, 0x2e, 0x42, 0x61, 0x74, 0x63,
+	0x68, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x52, 0x07, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x73,
+	0x42, 0x18, 0x5a, 0x16, 0x70, 0x69, 0x6e, 0x67, 0x30, 0x2f, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e,
+	0x61, 0x6c, 0x2f, 0x70, 0x6f, 0x6e, 0x67, 0x30, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x33,
+}
+
+var (
+	file_pong0_proto_rawDescOnce sync.Once
+	file_pong0_proto_rawDescData = file_pong0_proto_rawDesc
+)
+
+func file_pong0_proto_rawDescGZIP() []byte {
+	file_pong0_proto_rawDescOnce.Do(func() {
+		file_pong0_proto_rawDescData = protoimpl.X.CompressGZIP(file_pong0_proto_rawDescData)
+	})
+	return file_pong0_proto_rawDescData
+}
+
+var file_pong0_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_pong0_proto_goTypes = []any{
+	(*IPInfo)(nil),        // 0: pong0.v1.IPInfo
+	(*LocationPart)(nil),  // 1: pong0.v1.LocationPart
+	(*ParseWarning)(nil),  // 2: pong0.v1.ParseWarning
+	(*ASNRegistry)(nil),   // 3: pong0.v1.ASNRegistry
+	(*Source)(nil),        // 4: pong0.v1.Source
+	(*Error)(nil),         // 5: pong0.v1.Error
+	(*BatchError)(nil),    // 6: pong0.v1.BatchError
+	(*BatchResult)(nil),   // 7: pong0.v1.BatchResult
+	(*BatchResponse)(nil), // 8: pong0.v1.BatchResponse
+	nil,                   // 9: pong0.v1.IPInfo.RiskFactorsEntry
+}
+var file_pong0_proto_depIdxs = []int32{
+	3, // 0: pong0.v1.IPInfo.asn_registry:type_name -> pong0.v1.ASNRegistry
+	4, // 1: pong0.v1.IPInfo.sources:type_name -> pong0.v1.Source
+	2, // 2: pong0.v1.IPInfo.warnings:type_name -> pong0.v1.ParseWarning
+	9, // 3: pong0.v1.IPInfo.risk_factors:type_name -> pong0.v1.IPInfo.RiskFactorsEntry
+	1, // 4: pong0.v1.IPInfo.location_parts:type_name -> pong0.v1.LocationPart
+	0, // 5: pong0.v1.BatchResult.info:type_name -> pong0.v1.IPInfo
+	6, // 6: pong0.v1.BatchResult.error:type_name -> pong0.v1.BatchError
+	7, // 7: pong0.v1.BatchResponse.results:type_name -> pong0.v1.BatchResult
+	8, // [8:8] is the sub-list for method output_type
+	8, // [8:8] is the sub-list for method input_type
+	8, // [8:8] is the sub-list for extension type_name
+	8, // [8:8] is the sub-list for extension extendee
+	0, // [0:8] is the sub-list for field type_name
+}
+
+func init() { file_pong0_proto_init() }
+func file_pong0_proto_init() {
+	if File_pong0_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_pong0_proto_msgTypes[0].Exporter = func(v any, i int) any {
+			switch v := v.(*IPInfo); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pong0_proto_msgTypes[1].Exporter = func(v any, i int) any {
+			switch v := v.(*LocationPart); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pong0_proto_msgTypes[2].Exporter = func(v any, i int) any {
+			switch v := v.(*ParseWarning); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pong0_proto_msgTypes[3].Exporter = func(v any, i int) any {
+			switch v := v.(*ASNRegistry); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pong0_proto_msgTypes[4].Exporter = func(v any, i int) any {
+			switch v := v.(*Source); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pong0_proto_msgTypes[5].Exporter = func(v any, i int) any {
+			switch v := v.(*Error); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pong0_proto_msgTypes[6].Exporter = func(v any, i int) any {
+			switch v := v.(*BatchError); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pong0_proto_msgTypes[7].Exporter = func(v any, i int) any {
+			switch v := v.(*BatchResult); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pong0_proto_msgTypes[8].Exporter = func(v any, i int) any {
+			switch v := v.(*BatchResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	file_pong0_proto_msgTypes[0].OneofWrappers = []any{}
+	file_pong0_proto_msgTypes[7].OneofWrappers = []any{
+		(*BatchResult_Info)(nil),
+		(*BatchResult_Error)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_pong0_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   10,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_pong0_proto_goTypes,
+		DependencyIndexes: file_pong0_proto_depIdxs,
+		MessageInfos:      file_pong0_proto_msgTypes,
+	}.Build()
+	File_pong0_proto = out.File
+	file_pong0_proto_rawDesc = nil
+	file_pong0_proto_goTypes = nil
+	file_pong0_proto_depIdxs = nil
+}
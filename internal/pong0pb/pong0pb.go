@@ -0,0 +1,14 @@
+// Package pong0pb contains the Protocol Buffers messages that the API server
+// returns for ?format=protobuf. pong0.pb.go is generated from pong0.proto with
+// protoc-gen-go; the schema itself is served at /pong0.proto so that callers
+// can generate decoders for their own languages.
+package pong0pb
+
+import _ "embed"
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative pong0.proto
+
+// Schema 是Protocol Buffers响应的消息定义，修改后需要重新生成pong0.pb.go
+//
+//go:embed pong0.proto
+var Schema []byte
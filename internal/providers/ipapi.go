@@ -0,0 +1,114 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"ping0/internal/models"
+)
+
+// IPAPIURL ip-api.com免费接口的地址，免费接口只支持HTTP
+const IPAPIURL = "http://ip-api.com/json/"
+
+// IPAPI 基于ip-api.com的数据源
+// 免费接口限制每个来源IP每分钟45次请求，适合单次查询和小批量查询。
+type IPAPI struct {
+	client    *http.Client
+	baseURL   string
+	userAgent string
+}
+
+// NewIPAPI 创建ip-api.com数据源
+//
+// 参数:
+//   - client: 发送请求使用的HTTP客户端
+//   - userAgent: 请求的User-Agent头
+//
+// 返回:
+//   - *IPAPI: 数据源
+func NewIPAPI(client *http.Client, userAgent string) *IPAPI {
+	return &IPAPI{client: client, baseURL: IPAPIURL, userAgent: userAgent}
+}
+
+// ipapiResponse ip-api.com的响应
+type ipapiResponse struct {
+	Status      string  `json:"status"`
+	Message     string  `json:"message"`
+	CountryCode string  `json:"countryCode"`
+	Country     string  `json:"country"`
+	RegionName  string  `json:"regionName"`
+	City        string  `json:"city"`
+	Lat         float64 `json:"lat"`
+	Lon         float64 `json:"lon"`
+	AS          string  `json:"as"` // 如"AS13335 Cloudflare, Inc."
+	ASName      string  `json:"asname"`
+	Org         string  `json:"org"`
+}
+
+// Name 返回数据源名称
+func (p *IPAPI) Name() string {
+	return "ipapi"
+}
+
+// Lookup 查询IP信息，名称类字段使用简体中文
+func (p *IPAPI) Lookup(ctx context.Context, ip string) (*models.Source, error) {
+	query := url.Values{
+		"fields": {"status,message,countryCode,country,regionName,city,lat,lon,as,asname,org"},
+		"lang":   {"zh-CN"},
+	}
+	var resp ipapiResponse
+	if err := getJSON(ctx, p.client, p.userAgent, p.baseURL+url.PathEscape(ip)+"?"+query.Encode(), &resp); err != nil {
+		return nil, err
+	}
+	if resp.Status != "success" {
+		return nil, fmt.Errorf("ip-api.com返回错误: %s", resp.Message)
+	}
+
+	src := &models.Source{
+		CountryCode:  resp.CountryCode,
+		Country:      resp.Country,
+		Region:       resp.RegionName,
+		City:         resp.City,
+		Lat:          resp.Lat,
+		Lon:          resp.Lon,
+		ASNOwner:     resp.ASName,
+		Organization: resp.Org,
+	}
+	num, owner, _ := strings.Cut(resp.AS, " ")
+	if n, err := strconv.Atoi(strings.TrimPrefix(num, "AS")); err == nil {
+		src.ASNNumber = n
+	}
+	if src.ASNOwner == "" {
+		src.ASNOwner = owner
+	}
+	return src, nil
+}
+
+// getJSON 发送GET请求并将JSON响应解码到v
+func getJSON(ctx context.Context, client *http.Client, userAgent, rawURL string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("返回状态码 %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("解析响应失败: %w", err)
+	}
+	return nil
+}
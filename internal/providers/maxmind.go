@@ -0,0 +1,121 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+
+	"ping0/internal/models"
+)
+
+// mmdbRecord GeoLite2/GeoIP2 City、Country和ASN数据库中用到的字段
+// 不同类型的数据库只包含其中一部分字段，缺少的字段保持零值。
+type mmdbRecord struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+	ASN   int    `maxminddb:"autonomous_system_number"`
+	ASOrg string `maxminddb:"autonomous_system_organization"`
+}
+
+// MaxMind 基于本地MaxMind mmdb数据库（如GeoLite2-City和GeoLite2-ASN）的数据源
+// 查询完全离线进行，可以同时打开多个数据库并合并结果。
+type MaxMind struct {
+	readers []*maxminddb.Reader
+}
+
+// OpenMaxMind 打开一个或多个mmdb数据库
+//
+// 参数:
+//   - paths: 数据库文件路径，通常为一个City（或Country）数据库加一个ASN数据库
+//
+// 返回:
+//   - *MaxMind: 数据源
+//   - error: 如果任一数据库无法打开则返回相应错误
+func OpenMaxMind(paths ...string) (*MaxMind, error) {
+	m := &MaxMind{}
+	for _, path := range paths {
+		reader, err := maxminddb.Open(path)
+		if err != nil {
+			m.Close()
+			return nil, fmt.Errorf("打开MaxMind数据库 %s 失败: %w", path, err)
+		}
+		m.readers = append(m.readers, reader)
+	}
+	if len(m.readers) == 0 {
+		return nil, fmt.Errorf("未指定MaxMind数据库")
+	}
+	return m, nil
+}
+
+// Name 返回数据源名称
+func (m *MaxMind) Name() string {
+	return "maxmind"
+}
+
+// Lookup 在所有数据库中查询IP，合并各数据库给出的字段
+func (m *MaxMind) Lookup(ctx context.Context, ip string) (*models.Source, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil, fmt.Errorf("无效的IP地址: %s", ip)
+	}
+
+	src := &models.Source{}
+	for _, reader := range m.readers {
+		var rec mmdbRecord
+		if err := reader.Lookup(addr, &rec); err != nil {
+			return nil, fmt.Errorf("查询MaxMind数据库失败: %w", err)
+		}
+
+		if src.CountryCode == "" {
+			src.CountryCode = rec.Country.ISOCode
+			src.Country = localizedName(rec.Country.Names)
+		}
+		if src.Region == "" && len(rec.Subdivisions) > 0 {
+			src.Region = localizedName(rec.Subdivisions[0].Names)
+		}
+		if src.City == "" {
+			src.City = localizedName(rec.City.Names)
+		}
+		if src.Lat == 0 && src.Lon == 0 {
+			src.Lat, src.Lon = rec.Location.Latitude, rec.Location.Longitude
+		}
+		if src.ASNNumber == 0 {
+			src.ASNNumber = rec.ASN
+			src.ASNOwner = rec.ASOrg
+		}
+	}
+	return src, nil
+}
+
+// Close 关闭所有数据库
+func (m *MaxMind) Close() error {
+	for _, reader := range m.readers {
+		reader.Close()
+	}
+	return nil
+}
+
+// localizedName 从多语言名称中选择一个，优先使用与Ping0.cc一致的简体中文
+func localizedName(names map[string]string) string {
+	for _, lang := range []string{"zh-CN", "en"} {
+		if name := strings.TrimSpace(names[lang]); name != "" {
+			return name
+		}
+	}
+	return ""
+}
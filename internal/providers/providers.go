@@ -0,0 +1,125 @@
+// Package providers implements additional IP data sources that augment and
+// cross-validate the Ping0.cc result. Each source implements Provider; Enrich
+// queries all enabled providers concurrently, fills fields that Ping0.cc left
+// empty, and records for every provider which fields disagree with Ping0.cc.
+package providers
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+
+	"ping0/internal/models"
+)
+
+// Provider 附加的IP信息数据源
+// 实现需要可以被多个goroutine并发调用。
+type Provider interface {
+	// Name 返回数据源名称，输出在sources字段中
+	Name() string
+
+	// Lookup 查询IP的信息
+	//
+	// 参数:
+	//   - ctx: 请求上下文
+	//   - ip: 要查询的IP地址
+	//
+	// 返回:
+	//   - *models.Source: 数据源给出的信息，Name字段由Enrich填写
+	//   - error: 如果查询失败则返回相应错误
+	Lookup(ctx context.Context, ip string) (*models.Source, error)
+}
+
+// Enrich 并发查询所有数据源，补充并交叉验证ipInfo
+// 先将每个数据源的结果与Ping0.cc的原始结果比较，记录不一致的字段，
+// 再按providers的顺序用第一个提供了该字段的数据源补充Ping0.cc缺失的字段。
+// 单个数据源失败只记录在其结果的error字段中，不影响其他数据源。
+//
+// 参数:
+//   - ctx: 请求上下文
+//   - providers: 启用的数据源，按优先级排列
+//   - ipInfo: Ping0.cc的查询结果，结果写入其Sources字段
+//   - log: 日志记录器
+func Enrich(ctx context.Context, providers []Provider, ipInfo *models.IPInfo, log *slog.Logger) {
+	if len(providers) == 0 || ipInfo.IP == "" {
+		return
+	}
+
+	sources := make([]models.Source, len(providers))
+	var wg sync.WaitGroup
+	for i, p := range providers {
+		wg.Add(1)
+		go func(i int, p Provider) {
+			defer wg.Done()
+			src, err := p.Lookup(ctx, ipInfo.IP)
+			if err != nil {
+				log.Debug("附加数据源查询失败", "source", p.Name(), "ip", ipInfo.IP, "error", err)
+				src = &models.Source{Error: err.Error()}
+			}
+			src.Name = p.Name()
+			sources[i] = *src
+		}(i, p)
+	}
+	wg.Wait()
+
+	for i := range sources {
+		sources[i].Disagrees = compare(ipInfo, &sources[i])
+		if len(sources[i].Disagrees) > 0 {
+			log.Debug("附加数据源与Ping0.cc结果不一致", "source", sources[i].Name, "fields", sources[i].Disagrees)
+		}
+	}
+	for i := range sources {
+		augment(ipInfo, &sources[i])
+	}
+
+	ipInfo.Sources = sources
+}
+
+// compare 返回数据源与Ping0.cc结果中都有值但不一致的字段
+// 只比较与语言无关的国家代码和ASN编号，名称类字段的语言和写法因数据源而异，不参与比较。
+func compare(ipInfo *models.IPInfo, src *models.Source) []string {
+	var fields []string
+	if ipInfo.CountryCode != "" && src.CountryCode != "" && !strings.EqualFold(ipInfo.CountryCode, src.CountryCode) {
+		fields = append(fields, "country_code")
+	}
+	if ipInfo.ASNNumber != 0 && src.ASNNumber != 0 && ipInfo.ASNNumber != src.ASNNumber {
+		fields = append(fields, "asn_number")
+	}
+	return fields
+}
+
+// augment 用数据源的结果补充ipInfo中为空的字段
+// 地理位置字段只在数据源与Ping0.cc的国家一致（或Ping0.cc没有任何位置信息）时补充，
+// 网络归属字段只在ASN一致（或Ping0.cc没有ASN）时补充，避免把不同数据源的结论拼在一起。
+func augment(ipInfo *models.IPInfo, src *models.Source) {
+	fill := func(dst *string, v string) {
+		if *dst == "" {
+			*dst = v
+		}
+	}
+
+	sameCountry := strings.EqualFold(ipInfo.CountryCode, src.CountryCode)
+	if ipInfo.CountryCode == "" {
+		sameCountry = ipInfo.Country == ""
+	}
+	if sameCountry {
+		fill(&ipInfo.CountryCode, strings.ToUpper(src.CountryCode))
+		fill(&ipInfo.Country, src.Country)
+		fill(&ipInfo.Region, src.Region)
+		fill(&ipInfo.City, src.City)
+		if ipInfo.Lat == 0 && ipInfo.Lon == 0 {
+			ipInfo.Lat, ipInfo.Lon = src.Lat, src.Lon
+		}
+	}
+
+	if ipInfo.ASNNumber == 0 && src.ASNNumber != 0 {
+		ipInfo.ASNNumber = src.ASNNumber
+		fill(&ipInfo.ASN, "AS"+strconv.Itoa(src.ASNNumber))
+	}
+	if ipInfo.ASNNumber == src.ASNNumber {
+		fill(&ipInfo.ASNOwner, src.ASNOwner)
+		fill(&ipInfo.Organization, src.Organization)
+	}
+}
@@ -0,0 +1,82 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"ping0/internal/models"
+)
+
+// RIPEstatURL RIPEstat数据接口的地址
+const RIPEstatURL = "https://stat.ripe.net/data/"
+
+// RIPEstat 基于RIPEstat数据接口的数据源
+// 提供IP所在前缀的宣告ASN以及RIR登记的国家，不提供城市和经纬度。
+type RIPEstat struct {
+	client    *http.Client
+	baseURL   string
+	userAgent string
+}
+
+// NewRIPEstat 创建RIPEstat数据源
+//
+// 参数:
+//   - client: 发送请求使用的HTTP客户端
+//   - userAgent: 请求的User-Agent头
+//
+// 返回:
+//   - *RIPEstat: 数据源
+func NewRIPEstat(client *http.Client, userAgent string) *RIPEstat {
+	return &RIPEstat{client: client, baseURL: RIPEstatURL, userAgent: userAgent}
+}
+
+// prefixOverview prefix-overview接口的响应
+type prefixOverview struct {
+	Data struct {
+		ASNs []struct {
+			ASN    int    `json:"asn"`
+			Holder string `json:"holder"`
+		} `json:"asns"`
+	} `json:"data"`
+}
+
+// rirStatsCountry rir-stats-country接口的响应
+type rirStatsCountry struct {
+	Data struct {
+		LocatedResources []struct {
+			Location string `json:"location"`
+		} `json:"located_resources"`
+	} `json:"data"`
+}
+
+// Name 返回数据源名称
+func (p *RIPEstat) Name() string {
+	return "ripestat"
+}
+
+// Lookup 查询IP所在前缀的宣告ASN和RIR登记的国家
+func (p *RIPEstat) Lookup(ctx context.Context, ip string) (*models.Source, error) {
+	query := "?resource=" + url.QueryEscape(ip) + "&sourceapp=pong0"
+	src := &models.Source{}
+
+	var overview prefixOverview
+	if err := getJSON(ctx, p.client, p.userAgent, p.baseURL+"prefix-overview/data.json"+query, &overview); err != nil {
+		return nil, fmt.Errorf("查询RIPEstat前缀信息失败: %w", err)
+	}
+	if len(overview.Data.ASNs) > 0 {
+		src.ASNNumber = overview.Data.ASNs[0].ASN
+		src.ASNOwner = overview.Data.ASNs[0].Holder
+	}
+
+	var country rirStatsCountry
+	if err := getJSON(ctx, p.client, p.userAgent, p.baseURL+"rir-stats-country/data.json"+query, &country); err != nil {
+		return nil, fmt.Errorf("查询RIPEstat国家信息失败: %w", err)
+	}
+	if len(country.Data.LocatedResources) > 0 {
+		src.CountryCode = country.Data.LocatedResources[0].Location
+	}
+
+	return src, nil
+}
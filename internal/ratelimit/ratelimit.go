@@ -0,0 +1,113 @@
+// Package ratelimit implements token bucket rate limiting for the Pong0 API server.
+// A Limiter keeps one bucket per key (for example a client IP address), so the
+// same type can be used both for per-client and global limits.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// 空闲桶的清理间隔，避免长期运行时桶的数量无限增长
+const cleanupInterval = time.Minute
+
+// bucket 单个令牌桶的状态
+type bucket struct {
+	tokens float64   // 当前可用令牌数
+	last   time.Time // 上次更新令牌数的时间
+}
+
+// Limiter 基于令牌桶算法的限流器
+// 每个key拥有独立的令牌桶，令牌以固定速率补充，桶容量即允许的突发请求数。
+type Limiter struct {
+	rate  float64 // 每秒补充的令牌数
+	burst float64 // 桶容量
+
+	mu          sync.Mutex
+	buckets     map[string]*bucket
+	lastCleanup time.Time
+	now         func() time.Time
+}
+
+// NewPerMinute 创建一个每分钟允许perMinute次请求的限流器
+// 桶容量等于perMinute，即空闲的key可以一次性突发使用一分钟的配额。
+//
+// 参数:
+//   - perMinute: 每分钟允许的请求数，必须大于0
+//
+// 返回:
+//   - *Limiter: 新创建的限流器
+func NewPerMinute(perMinute int) *Limiter {
+	return &Limiter{
+		rate:        float64(perMinute) / 60,
+		burst:       float64(perMinute),
+		buckets:     make(map[string]*bucket),
+		lastCleanup: time.Now(),
+		now:         time.Now,
+	}
+}
+
+// Allow 尝试为key消耗一个令牌
+//
+// 参数:
+//   - key: 限流的键，例如客户端IP；全局限流可以使用固定的键
+//
+// 返回:
+//   - bool: 是否允许本次请求
+//   - time.Duration: 不允许时，距离下一个令牌可用需要等待的时间
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	return l.AllowN(key, 1)
+}
+
+// AllowN 尝试为key一次性消耗n个令牌，令牌不足时不消耗任何令牌
+// n超过桶容量时永远不会被允许，调用方应事先限制n的大小。
+//
+// 参数:
+//   - key: 限流的键
+//   - n: 需要消耗的令牌数，例如批量查询中的IP数量
+//
+// 返回:
+//   - bool: 是否允许本次请求
+//   - time.Duration: 不允许时，距离令牌足够需要等待的时间
+func (l *Limiter) AllowN(key string, n int) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.cleanup(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	// 按经过的时间补充令牌
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens = math.Min(l.burst, b.tokens+elapsed*l.rate)
+	b.last = now
+
+	need := float64(n)
+	if b.tokens >= need {
+		b.tokens -= need
+		return true, 0
+	}
+
+	wait := time.Duration((need - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// cleanup 删除已经补满的空闲令牌桶，调用方需持有锁
+func (l *Limiter) cleanup(now time.Time) {
+	if now.Sub(l.lastCleanup) < cleanupInterval {
+		return
+	}
+	l.lastCleanup = now
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
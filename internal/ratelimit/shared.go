@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// sharedWarnInterval Redis不可用时两次警告日志之间的最短间隔，避免每个请求都记录一条警告
+	sharedWarnInterval = time.Minute
+
+	// sharedTimeout 单次限流脚本的超时时间，超时后按Redis不可用处理
+	sharedTimeout = 3 * time.Second
+)
+
+// allowScript 在Redis中原子地补充并消耗令牌
+// 时间取自Redis服务器（需要Redis 5或更新版本），各副本的时钟偏差不影响令牌的补充速度。
+// 桶的状态保存为哈希（tokens、last），补满所需的时间过后自动过期。
+// 返回 {是否允许, 不允许时需要等待的毫秒数}。通过EVALSHA执行，Redis中没有缓存该脚本时自动退回到EVAL。
+var allowScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(state[1]) or burst
+local last = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - last) * rate)
+local allowed, wait = 0, 0
+if tokens >= n then
+	tokens = tokens - n
+	allowed = 1
+else
+	wait = math.ceil((n - tokens) / rate)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate) + 1000)
+return {allowed, wait}`)
+
+// Allower 限流器接口，由只在本进程内计数的Limiter和多个副本共享计数的Shared实现
+// n超过桶容量时永远不会被允许，返回的等待时间也没有意义，调用方应事先拒绝这样的请求。
+type Allower interface {
+	AllowN(key string, n int) (bool, time.Duration)
+}
+
+// Shared 在Redis中保存令牌桶的限流器，连接同一个Redis的全部副本共同遵守同一份配额
+// 令牌桶的算法与Limiter相同，每个key对应Redis中的一个哈希。
+// Redis不可用时退回到只在本进程内计数的令牌桶，此时每个副本各自按完整的配额限流。
+type Shared struct {
+	client   redis.Scripter
+	prefix   string // Redis中键的前缀
+	rate     string // 每毫秒补充的令牌数
+	burst    string // 桶容量
+	fallback *Limiter
+	log      *slog.Logger
+
+	mu       sync.Mutex
+	lastWarn time.Time
+}
+
+// NewSharedPerMinute 创建一个在Redis中计数、每分钟允许perMinute次请求的限流器
+//
+// 参数:
+//   - client: Redis客户端，由调用方负责关闭
+//   - prefix: Redis中键的前缀，不同用途的限流器应使用不同的前缀
+//   - perMinute: 每分钟允许的请求数，必须大于0
+//   - log: 记录Redis不可用时的警告
+//
+// 返回:
+//   - *Shared: 新创建的限流器
+func NewSharedPerMinute(client redis.Scripter, prefix string, perMinute int, log *slog.Logger) *Shared {
+	return &Shared{
+		client:   client,
+		prefix:   prefix,
+		rate:     strconv.FormatFloat(float64(perMinute)/60000, 'g', -1, 64),
+		burst:    strconv.Itoa(perMinute),
+		fallback: NewPerMinute(perMinute),
+		log:      log,
+	}
+}
+
+// AllowN 尝试为key一次性消耗n个令牌，令牌不足时不消耗任何令牌，语义与Limiter.AllowN相同
+// 与Limiter一样，n不能超过perMinute，调用方需要事先限制。
+func (s *Shared) AllowN(key string, n int) (bool, time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), sharedTimeout)
+	defer cancel()
+
+	reply, err := allowScript.Run(ctx, s.client, []string{s.prefix + key}, s.rate, s.burst, n).Int64Slice()
+	if err == nil {
+		if len(reply) == 2 {
+			return reply[0] == 1, time.Duration(reply[1]) * time.Millisecond
+		}
+		err = errors.New("限流脚本返回了无效的回复")
+	}
+
+	s.mu.Lock()
+	if time.Since(s.lastWarn) >= sharedWarnInterval {
+		s.lastWarn = time.Now()
+		s.log.Warn("使用Redis限流失败，暂时按本副本单独计数", "error", err)
+	}
+	s.mu.Unlock()
+	return s.fallback.AllowN(key, n)
+}
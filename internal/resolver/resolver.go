@@ -0,0 +1,117 @@
+// Package resolver provides DNS resolution for the Pong0 application.
+// It builds net.Resolver instances that either use the system resolver or
+// send all queries to a configured DNS server, and offers helpers for
+// resolving hostnames into the IP addresses that should be looked up and for
+// reverse (PTR) lookups of the queried addresses.
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// 连接自定义DNS服务器的超时时间
+const dialTimeout = 5 * time.Second
+
+// New 创建DNS解析器
+//
+// 参数:
+//   - server: DNS服务器地址，如 8.8.8.8 或 1.1.1.1:53，为空时使用系统解析器
+//
+// 返回:
+//   - *net.Resolver: DNS解析器
+//   - error: 如果服务器地址无效则返回相应错误
+func New(server string) (*net.Resolver, error) {
+	if server == "" {
+		return net.DefaultResolver, nil
+	}
+
+	addr := normalizeServer(server)
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("无效的DNS服务器地址 %s: %w", server, err)
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			d := net.Dialer{Timeout: dialTimeout}
+			return d.DialContext(ctx, network, addr)
+		},
+	}, nil
+}
+
+// normalizeServer 为未指定端口的DNS服务器地址补充默认端口53
+// IPv6地址需要用方括号包裹，如 [2001:4860:4860::8888]:53
+func normalizeServer(server string) string {
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server
+	}
+	if ip := net.ParseIP(server); ip != nil {
+		return net.JoinHostPort(ip.String(), "53")
+	}
+	return net.JoinHostPort(server, "53")
+}
+
+// LookupHost 解析主机名的全部A和AAAA记录
+// 结果先列出IPv4地址再列出IPv6地址，并去除重复地址。
+//
+// 参数:
+//   - ctx: 控制解析过程的上下文
+//   - r: DNS解析器
+//   - host: 要解析的主机名
+//
+// 返回:
+//   - []string: 解析得到的IP地址列表
+//   - error: 如果解析失败或没有任何地址则返回相应错误
+func LookupHost(ctx context.Context, r *net.Resolver, host string) ([]string, error) {
+	addrs, err := r.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("解析主机名 %s 失败: %w", host, err)
+	}
+
+	var v4, v6 []string
+	seen := make(map[string]bool)
+	for _, addr := range addrs {
+		ip := addr.IP.String()
+		if seen[ip] {
+			continue
+		}
+		seen[ip] = true
+		if addr.IP.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+
+	ips := append(v4, v6...)
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("主机名 %s 没有A或AAAA记录", host)
+	}
+	return ips, nil
+}
+
+// LookupPTR 查询IP的反向DNS（PTR）记录
+// 有多条记录时返回第一条，结果去掉末尾的点。
+//
+// 参数:
+//   - ctx: 控制查询过程的上下文
+//   - r: DNS解析器
+//   - ip: 要查询的IP地址
+//
+// 返回:
+//   - string: PTR记录中的主机名
+//   - error: 如果查询失败或没有PTR记录则返回相应错误
+func LookupPTR(ctx context.Context, r *net.Resolver, ip string) (string, error) {
+	names, err := r.LookupAddr(ctx, ip)
+	if err != nil {
+		return "", fmt.Errorf("查询 %s 的反向DNS失败: %w", ip, err)
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("%s 没有PTR记录", ip)
+	}
+	return strings.TrimSuffix(names[0], "."), nil
+}
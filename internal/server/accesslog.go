@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 访问日志格式
+const (
+	AccessLogCombined = "combined" // Apache combined格式，末尾附加耗时和查询的IP
+	AccessLogJSON     = "json"     // 每行一个JSON对象
+)
+
+// accessLogKey 是请求上下文中访问日志条目的键
+type accessLogKey struct{}
+
+// accessEntry 处理请求过程中由处理器补充的访问日志信息
+type accessEntry struct {
+	mu        sync.Mutex
+	queriedIP string // 本次请求查询的IP
+	keyName   string // 使用的API密钥名称
+}
+
+// accessRecorder 包装http.ResponseWriter以记录状态码和响应大小
+type accessRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// WriteHeader 记录状态码并转发给底层ResponseWriter
+func (r *accessRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Write 记录写入的字节数并转发给底层ResponseWriter
+func (r *accessRecorder) Write(p []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap 返回底层ResponseWriter，供http.ResponseController使用
+func (r *accessRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// accessLogRecord JSON格式访问日志的一行
+type accessLogRecord struct {
+	Time      string  `json:"time"`
+	Client    string  `json:"client"`
+	Method    string  `json:"method"`
+	Path      string  `json:"path"`
+	Status    int     `json:"status"`
+	Bytes     int64   `json:"bytes"`
+	LatencyMS float64 `json:"latency_ms"`
+	QueriedIP string  `json:"queried_ip,omitempty"`
+	Key       string  `json:"key,omitempty"`
+	Referer   string  `json:"referer,omitempty"`
+	UserAgent string  `json:"user_agent,omitempty"`
+	RequestID string  `json:"request_id,omitempty"`
+}
+
+// accessLog 创建访问日志中间件，在每个请求结束后向w写入一行访问日志
+//
+// 参数:
+//   - w: 访问日志的输出目标
+//   - format: 日志格式，AccessLogCombined或AccessLogJSON
+//
+// 返回:
+//   - Middleware: 记录访问日志的中间件
+func (s *apiServer) accessLog(w io.Writer, format string) Middleware {
+	var mu sync.Mutex
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			entry := &accessEntry{}
+			rec := &accessRecorder{ResponseWriter: rw, status: http.StatusOK}
+
+			next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), accessLogKey{}, entry)))
+
+			entry.mu.Lock()
+			queriedIP, keyName := entry.queriedIP, entry.keyName
+			entry.mu.Unlock()
+
+			size := "-"
+			if rec.bytes > 0 {
+				size = strconv.FormatInt(rec.bytes, 10)
+			}
+
+			client := s.clientIP(r)
+			var line []byte
+			if format == AccessLogJSON {
+				line, _ = json.Marshal(accessLogRecord{
+					Time:      start.Format(time.RFC3339),
+					Client:    client,
+					Method:    r.Method,
+					Path:      r.URL.RequestURI(),
+					Status:    rec.status,
+					Bytes:     rec.bytes,
+					LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+					QueriedIP: queriedIP,
+					Key:       keyName,
+					Referer:   r.Referer(),
+					UserAgent: r.UserAgent(),
+					RequestID: rec.Header().Get(requestIDHeader),
+				})
+				line = append(line, '\n')
+			} else {
+				line = []byte(fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s %q %q %.3f %q\n",
+					client,
+					orDash(keyName),
+					start.Format("02/Jan/2006:15:04:05 -0700"),
+					r.Method, r.URL.RequestURI(), r.Proto,
+					rec.status,
+					size,
+					orDash(r.Referer()),
+					orDash(r.UserAgent()),
+					float64(time.Since(start).Microseconds())/1000,
+					orDash(queriedIP)))
+			}
+
+			mu.Lock()
+			w.Write(line)
+			mu.Unlock()
+		})
+	}
+}
+
+// orDash 空字段以 - 表示，与combined格式的约定一致
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// setQueriedIP 在访问日志和审计日志中记录本次请求查询的IP，都未启用时不做任何事
+func setQueriedIP(r *http.Request, ip string) {
+	if entry, ok := r.Context().Value(accessLogKey{}).(*accessEntry); ok {
+		entry.mu.Lock()
+		entry.queriedIP = ip
+		entry.mu.Unlock()
+	}
+}
+
+// setKeyName 在访问日志和审计日志中记录本次请求使用的API密钥名称，都未启用时不做任何事
+func setKeyName(r *http.Request, name string) {
+	if entry, ok := r.Context().Value(accessLogKey{}).(*accessEntry); ok {
+		entry.mu.Lock()
+		entry.keyName = name
+		entry.mu.Unlock()
+	}
+}
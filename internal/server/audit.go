@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ping0/internal/audit"
+	"ping0/internal/models"
+)
+
+// auditPage GET /admin/audit的响应
+type auditPage struct {
+	Entries    []audit.Entry `json:"entries"`               // 按时间从新到旧排列的记录
+	NextCursor int64         `json:"next_cursor,omitempty"` // 读取下一页时使用的cursor参数，没有更多记录时省略
+	Princess   string        `json:"princess,omitempty"`
+}
+
+// audited 创建审计中间件，请求结束后向审计日志追加一条记录，未启用审计日志时直接调用下一个处理器
+// 中间件放在API密钥验证和限流之前，被拒绝的请求同样会被记录。查询的IP和密钥名称由处理器
+// 通过setQueriedIP和setKeyName补充，与访问日志共用同一个条目。客户端记录为TCP连接的对端地址，
+// 代理头可以被调用方任意设置，原样记录在单独的forwarded字段中，不作为客户端。
+func (s *apiServer) audited(next http.Handler) http.Handler {
+	if s.cfg.Audit == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry, ok := r.Context().Value(accessLogKey{}).(*accessEntry)
+		if !ok {
+			entry = &accessEntry{}
+			r = r.WithContext(context.WithValue(r.Context(), accessLogKey{}, entry))
+		}
+		rec := &accessRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		entry.mu.Lock()
+		record := &audit.Entry{
+			Time:      start,
+			Client:    peerIP(r),
+			Forwarded: forwardedFor(r),
+			Key:       entry.keyName,
+			Method:    r.Method,
+			Path:      r.URL.RequestURI(),
+			QueriedIP: entry.queriedIP,
+			Status:    rec.status,
+			RequestID: rec.Header().Get(requestIDHeader),
+		}
+		entry.mu.Unlock()
+
+		// 请求可能已被客户端取消，写入审计日志不受其影响
+		if err := s.cfg.Audit.Append(context.WithoutCancel(r.Context()), record); err != nil {
+			s.logFor(r.Context()).Error("写入审计日志失败", "error", err)
+		}
+	})
+}
+
+// handleAudit 处理审计日志查询请求，需要管理员密钥
+// GET /admin/audit?limit=100&cursor=123&ip=1.1.1.1&key=team-a 按时间从新到旧返回记录，
+// 响应中的next_cursor作为下一次请求的cursor参数即可读取下一页。
+func (s *apiServer) handleAudit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if s.cfg.Audit == nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(models.WithPrincess(map[string]string{
+			"error": "服务器未启用审计日志",
+		}, s.cfg.Branding()))
+		return
+	}
+	if !s.checkAdminKey(w, r, "读取审计日志") {
+		return
+	}
+
+	query := r.URL.Query()
+	q := audit.Query{IP: query.Get("ip"), Key: query.Get("key"), Limit: audit.DefaultLimit}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > audit.MaxLimit {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(models.WithPrincess(map[string]string{
+				"error": "limit参数必须是1到" + strconv.Itoa(audit.MaxLimit) + "之间的整数",
+			}, s.cfg.Branding()))
+			return
+		}
+		q.Limit = n
+	}
+	if v := query.Get("cursor"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(models.WithPrincess(map[string]string{
+				"error": "cursor参数必须是正整数",
+			}, s.cfg.Branding()))
+			return
+		}
+		q.Cursor = n
+	}
+
+	// 多读取一条以判断是否还有下一页
+	limit := q.Limit
+	q.Limit++
+	entries, err := s.cfg.Audit.List(r.Context(), q)
+	if err != nil {
+		s.logFor(r.Context()).Warn("读取审计日志失败", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(models.WithPrincess(map[string]string{
+			"error": err.Error(),
+		}, s.cfg.Branding()))
+		return
+	}
+
+	page := auditPage{Entries: entries, Princess: models.Princess(s.cfg.Branding())}
+	if len(entries) > limit {
+		page.Entries = entries[:limit]
+		page.NextCursor = entries[limit-1].ID
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+}
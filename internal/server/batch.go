@@ -0,0 +1,298 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ping0/internal/auth"
+	perrors "ping0/internal/errors"
+	"ping0/internal/logger"
+	"ping0/internal/models"
+	"ping0/internal/output"
+)
+
+const (
+	// maxBatchSize 单次批量查询允许的最大IP数量
+	maxBatchSize = 100
+
+	// batchWorkers 批量查询时并发执行查询的最大工作协程数
+	// 数量不宜过大，避免短时间内向Ping0.cc发出过多请求
+	batchWorkers = 4
+)
+
+// batchError 批量查询中单个IP查询失败时的结果
+type batchError struct {
+	IP            string `json:"ip"`
+	Error         string `json:"error"`
+	Code          string `json:"code"`                     // 错误类别代码，如 timeout、challenge_failed
+	CorrelationID string `json:"correlation_id,omitempty"` // 查询中发生panic时的关联ID
+	RequestID     string `json:"request_id,omitempty"`     // 批量查询请求的ID
+	Princess      string `json:"princess,omitempty"`
+}
+
+// handleBatchQuery 处理批量IP查询请求
+// 请求体为IP字符串组成的JSON数组，响应为与请求顺序一致的结果数组。
+// 单个IP查询失败不会影响其他IP，失败项以包含ip和error字段的对象返回。
+// 指定 ?format=csv 时以CSV表格返回，每个IP一行；也可以返回MessagePack或Protocol Buffers，见batchFormat。
+func (s *apiServer) handleBatchQuery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	format, csvOpts, err := batchFormat(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(models.WithPrincess(map[string]string{
+			"error": err.Error(),
+		}, s.cfg.Branding()))
+		return
+	}
+
+	// 解析请求体中的IP列表
+	var ips []string
+	if err := json.NewDecoder(r.Body).Decode(&ips); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(models.WithPrincess(map[string]string{
+			"error": "无法解析请求体，需要IP字符串组成的JSON数组：" + err.Error(),
+		}, s.cfg.Branding()))
+		return
+	}
+
+	if len(ips) == 0 || len(ips) > maxBatchSize {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(models.WithPrincess(map[string]string{
+			"error": fmt.Sprintf("IP数量必须在1到%d之间", maxBatchSize),
+		}, s.cfg.Branding()))
+		return
+	}
+
+	if limit := s.burstLimit(); limit > 0 && len(ips) > limit {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(models.WithPrincess(map[string]string{
+			"error": fmt.Sprintf("启用限流时批量查询的IP数量不能超过每分钟的配额（%d个）", limit),
+		}, s.cfg.Branding()))
+		return
+	}
+
+	// timeout参数限制整个批量查询的耗时
+	ctx, cancel, err := s.queryContext(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(models.WithPrincess(map[string]string{
+			"error": err.Error(),
+		}, s.cfg.Branding()))
+		return
+	}
+	defer cancel()
+
+	// 批量查询按IP数量计入限流配额
+	if !s.checkRateLimit(w, r, len(ips)) {
+		return
+	}
+
+	setQueriedIP(r, strings.Join(ips, ","))
+	s.logFor(r.Context()).Debug("处理批量查询", "count", len(ips), "client", s.clientIP(r))
+
+	// 批量查询耗时可能超过服务器的写超时，取消本次响应的写截止时间，
+	// 查询的总耗时仍由请求上下文（包括timeout参数）和每个上游请求的超时时间控制
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		s.log.Debug("无法取消写超时", "error", err)
+	}
+
+	// 流式模式下每完成一个查询立即输出一行NDJSON
+	key := s.requestKey(r)
+	if format == formatJSON && wantsStream(r) {
+		s.streamBatch(ctx, w, ips, key)
+		return
+	}
+
+	results := make([]interface{}, len(ips))
+	s.processBatch(ctx, ips, func(idx int, result interface{}, _ time.Duration) {
+		results[idx] = redactResult(key, result)
+	})
+
+	switch format {
+	case formatCSV:
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="pong0-batch.csv"`)
+		w.WriteHeader(http.StatusOK)
+		err = output.WriteCSV(w, results, csvOpts)
+	case formatMsgPack:
+		w.Header().Set("Content-Type", formatMediaTypes[formatMsgPack][0])
+		w.WriteHeader(http.StatusOK)
+		err = output.WriteMsgPack(w, results)
+	case formatProtobuf:
+		var body []byte
+		if body, err = marshalProto(batchProto(results)); err == nil {
+			w.Header().Set("Content-Type", formatMediaTypes[formatProtobuf][0])
+			w.WriteHeader(http.StatusOK)
+			_, err = w.Write(body)
+		}
+	default:
+		for i, result := range results {
+			results[i] = s.signed(result)
+		}
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(results)
+	}
+	if err != nil {
+		s.logFor(r.Context()).Warn("输出批量查询结果失败", "format", format, "error", err)
+	}
+}
+
+// batchFormats 批量查询支持的响应格式，按Accept请求头权重相同时的优先顺序排列
+var batchFormats = []string{formatJSON, formatCSV, formatMsgPack, formatProtobuf}
+
+// batchFormat 解析批量查询的响应格式和format、columns、header查询参数
+// format为json（默认）、csv、msgpack或protobuf，未提供时按Accept请求头协商，没有可接受的格式时返回JSON；
+// columns为以逗号分隔的列名，header=false时不输出表头行，两者只在format=csv时有效。
+// 只有JSON可以使用stream参数流式返回，其他格式按请求顺序一次返回全部结果。
+//
+// 参数:
+//   - r: HTTP请求
+//
+// 返回:
+//   - string: 响应格式
+//   - output.CSVOptions: CSV输出选项
+//   - error: 如果参数无效则返回相应错误
+func batchFormat(r *http.Request) (string, output.CSVOptions, error) {
+	query := r.URL.Query()
+	var opts output.CSVOptions
+
+	format := query.Get("format")
+	if format == "" {
+		if format = negotiateAccept(r.Header.Get("Accept"), batchFormats); format == "" {
+			format = formatJSON
+		}
+	} else if !slices.Contains(batchFormats, format) {
+		return "", opts, fmt.Errorf("不支持的format参数: %s（可选 %s）", format, strings.Join(batchFormats, "、"))
+	}
+
+	if format != formatCSV && (query.Has("columns") || query.Has("header")) {
+		return "", opts, fmt.Errorf("columns和header参数只能在format=csv时使用")
+	}
+	if v := query.Get("stream"); format != formatJSON && (v == "1" || v == "true") {
+		return "", opts, fmt.Errorf("format=%s不能与stream参数同时使用", format)
+	}
+	if query.Has("columns") {
+		opts.Columns = output.ParseColumns(query.Get("columns"))
+		if len(opts.Columns) == 0 {
+			return "", opts, fmt.Errorf("columns参数没有指定任何列")
+		}
+	}
+	if v := query.Get("header"); v != "" {
+		header, err := strconv.ParseBool(v)
+		if err != nil {
+			return "", opts, fmt.Errorf("header参数必须是true或false: %q", v)
+		}
+		opts.NoHeader = !header
+	}
+	return format, opts, nil
+}
+
+// wantsStream 判断客户端是否请求流式（NDJSON）响应
+// 通过 ?stream=1 查询参数或 Accept: application/x-ndjson 请求头启用
+func wantsStream(r *http.Request) bool {
+	if v := r.URL.Query().Get("stream"); v == "1" || v == "true" {
+		return true
+	}
+	return strings.Contains(r.Header.Get("Accept"), "application/x-ndjson")
+}
+
+// streamBatch 以NDJSON格式按完成顺序逐行输出批量查询结果
+// 每行在结果对象之外附带sequence（在请求数组中的序号，从1开始）和elapsed_ms字段，这两个字段不在签名范围内。
+// 结果按请求使用的API密钥key的脱敏策略处理，key为nil时不脱敏。
+func (s *apiServer) streamBatch(ctx context.Context, w http.ResponseWriter, ips []string, key *auth.Key) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	rc.Flush()
+
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	s.processBatch(ctx, ips, func(idx int, result interface{}, elapsed time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		enc.Encode(models.StreamRecord{Sequence: idx + 1, Elapsed: elapsed, Result: s.signed(redactResult(key, result))})
+		if err := rc.Flush(); err != nil {
+			s.log.Debug("刷新流式响应失败", "error", err)
+		}
+	})
+}
+
+// processBatch 使用有界的工作协程池并发查询IP列表
+// 每完成一个查询就调用一次emit，emit可能被多个工作协程并发调用。
+//
+// 参数:
+//   - ctx: 请求上下文，取消后尚未开始的查询会直接返回错误
+//   - ips: 要查询的IP列表
+//   - emit: 结果回调，参数为IP在ips中的下标、查询结果（成功为*models.IPInfo，失败为batchError）和查询耗时
+func (s *apiServer) processBatch(ctx context.Context, ips []string, emit func(idx int, result interface{}, elapsed time.Duration)) {
+	workers := batchWorkers
+	if len(ips) < workers {
+		workers = len(ips)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				startTime := time.Now()
+				result := s.queryOne(ctx, ips[idx])
+				emit(idx, result, time.Since(startTime))
+			}
+		}()
+	}
+
+	for idx := range ips {
+		jobs <- idx
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// queryOne 查询单个IP并将错误转换为批量查询的失败项
+// 查询在工作协程中进行，中间件无法捕获其中的panic，因此在这里转换为带关联ID的失败项。
+// 同一批量查询中的所有结果都带有该请求的request_id。
+func (s *apiServer) queryOne(ctx context.Context, ip string) (result interface{}) {
+	requestID := logger.RequestID(ctx)
+	defer func() {
+		if v := recover(); v != nil {
+			id := s.reportPanic(ctx, v, nil)
+			result = batchError{IP: ip, Error: "服务器内部错误", Code: "internal", CorrelationID: id, RequestID: requestID, Princess: models.Princess(s.cfg.Branding())}
+		}
+	}()
+
+	if err := ctx.Err(); err != nil {
+		err = deadlineError(ctx, err)
+		s.recordUsage(ctx, ip, err)
+		return batchError{IP: ip, Error: err.Error(), Code: perrors.Code(err), RequestID: requestID, Princess: models.Princess(s.cfg.Branding())}
+	}
+
+	ipInfo, err := s.lookup(ctx, ip)
+	if err != nil {
+		err = deadlineError(ctx, err)
+		s.recordUsage(ctx, ip, err)
+		s.logFor(ctx).Warn("批量查询中的IP查询失败", "ip", ip, "error", err)
+		return batchError{IP: ip, Error: err.Error(), Code: perrors.Code(err), RequestID: requestID, Princess: models.Princess(s.cfg.Branding())}
+	}
+
+	s.recordUsage(ctx, ip, nil)
+
+	// 缓存中保存的是同一个结果，写入请求ID前先复制
+	info := *ipInfo
+	info.RequestID = requestID
+	// 按配置设置Princess字段
+	info.Princess = models.Princess(s.cfg.Branding())
+	return &info
+}
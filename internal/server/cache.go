@@ -0,0 +1,206 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"ping0/internal/core"
+	"ping0/internal/logger"
+	"ping0/internal/metrics"
+	"ping0/internal/models"
+)
+
+// maxCacheEntries 结果缓存最多保存的IP数量，超过后先清除过期的结果，仍然超过时清除最早的结果
+const maxCacheEntries = 10000
+
+// cacheEntry 一条缓存的查询结果
+type cacheEntry struct {
+	info      *models.IPInfo // 查询结果，缓存后只读
+	fetchedAt time.Time      // 完成查询的时间
+}
+
+// resultCache 按IP缓存查询结果，支持stale-while-revalidate
+// 不超过softTTL的结果直接返回；超过softTTL但不超过ttl的结果同样立即返回，
+// 同时在后台重新查询并替换缓存；超过ttl的结果不再使用。
+type resultCache struct {
+	ttl     time.Duration // 结果的最长使用时间
+	softTTL time.Duration // 超过该时间的结果在返回的同时后台刷新，0表示不刷新
+
+	mu         sync.Mutex
+	entries    map[string]cacheEntry
+	refreshing map[string]bool // 正在后台刷新的IP，同一个IP同时只刷新一次
+}
+
+// cacheBypassKey 标记本次查询不使用缓存结果的上下文键
+type cacheBypassKey struct{}
+
+// cacheSkipKey 标记本次查询既不使用也不写入缓存的上下文键，用于手动指定验证参数的调试查询
+type cacheSkipKey struct{}
+
+// newResultCache 创建结果缓存
+//
+// 参数:
+//   - ttl: 结果的最长使用时间
+//   - softTTL: 超过该时间的结果在返回的同时后台刷新，不大于0或不小于ttl时不在后台刷新
+//
+// 返回:
+//   - *resultCache: 新的结果缓存
+func newResultCache(ttl, softTTL time.Duration) *resultCache {
+	if softTTL >= ttl {
+		softTTL = 0
+	}
+	return &resultCache{
+		ttl:        ttl,
+		softTTL:    softTTL,
+		entries:    make(map[string]cacheEntry),
+		refreshing: make(map[string]bool),
+	}
+}
+
+// get 返回缓存的结果
+// 返回的是副本，其中的AgeSeconds为结果已缓存的秒数。
+//
+// 返回:
+//   - *models.IPInfo: 缓存的结果
+//   - bool: 结果是否超过softTTL，需要在后台刷新
+//   - bool: 是否有可用的结果
+func (c *resultCache) get(ip string) (*models.IPInfo, bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[ip]
+	if !ok {
+		return nil, false, false
+	}
+	age := time.Since(entry.fetchedAt)
+	if age > c.ttl {
+		delete(c.entries, ip)
+		return nil, false, false
+	}
+
+	info := *entry.info
+	seconds := int(age.Seconds())
+	info.AgeSeconds = &seconds
+	return &info, c.softTTL > 0 && age > c.softTTL, true
+}
+
+// put 保存查询结果，降级结果不缓存
+func (c *resultCache) put(ip string, info *models.IPInfo) {
+	if info.Source != "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[ip]; !ok && len(c.entries) >= maxCacheEntries {
+		c.evict()
+	}
+	c.entries[ip] = cacheEntry{info: info, fetchedAt: time.Now()}
+}
+
+// evict 清除过期的结果，没有过期结果时清除最早的一条，调用方必须持有锁
+func (c *resultCache) evict() {
+	var oldestIP string
+	var oldest time.Time
+	for ip, entry := range c.entries {
+		if time.Since(entry.fetchedAt) > c.ttl {
+			delete(c.entries, ip)
+			continue
+		}
+		if oldest.IsZero() || entry.fetchedAt.Before(oldest) {
+			oldestIP, oldest = ip, entry.fetchedAt
+		}
+	}
+	if len(c.entries) >= maxCacheEntries {
+		delete(c.entries, oldestIP)
+	}
+}
+
+// beginRefresh 标记IP开始后台刷新，已经在刷新时返回false
+func (c *resultCache) beginRefresh(ip string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.refreshing[ip] {
+		return false
+	}
+	c.refreshing[ip] = true
+	return true
+}
+
+// endRefresh 清除IP的后台刷新标记
+func (c *resultCache) endRefresh(ip string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.refreshing, ip)
+}
+
+// lookup 查询IP信息，启用结果缓存时优先返回缓存的结果
+// 请求带有nocache参数时跳过缓存直接查询，成功的结果仍然写入缓存；
+// 手动指定了验证参数的查询既不读取也不写入缓存；带标签的查询命中缓存时同样把结果保存到历史记录。
+//
+// 参数:
+//   - ctx: 查询上下文
+//   - ip: 要查询的IP，为空时查询当前IP
+//
+// 返回:
+//   - *models.IPInfo: 查询结果，来自缓存时AgeSeconds不为nil
+//   - error: 如果查询失败则返回相应错误
+func (s *apiServer) lookup(ctx context.Context, ip string) (*models.IPInfo, error) {
+	if skip, _ := ctx.Value(cacheSkipKey{}).(bool); s.cache == nil || skip {
+		return core.ProcessIPInfo(ctx, s.cfg, ip)
+	}
+
+	if bypass, _ := ctx.Value(cacheBypassKey{}).(bool); !bypass {
+		if info, stale, ok := s.cache.get(ip); ok {
+			if stale {
+				metrics.CacheResults.WithLabelValues("stale").Inc()
+				s.refresh(ip)
+			} else {
+				metrics.CacheResults.WithLabelValues("hit").Inc()
+			}
+			core.SaveCachedResult(ctx, s.cfg, info)
+			return info, nil
+		}
+	}
+	metrics.CacheResults.WithLabelValues("miss").Inc()
+
+	info, err := core.ProcessIPInfo(ctx, s.cfg, ip)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.put(ip, info)
+	return info, nil
+}
+
+// refresh 在后台重新查询IP并替换缓存的结果
+// 刷新不受发起请求的上下文影响，最长使用服务器允许的最长查询时间；失败时保留原有结果直到其过期。
+func (s *apiServer) refresh(ip string) {
+	if !s.cache.beginRefresh(ip) {
+		return
+	}
+
+	go func() {
+		defer s.cache.endRefresh(ip)
+
+		// 刷新与触发它的请求无关，使用自己的请求ID关联刷新过程中的日志
+		ctx, cancel := context.WithTimeout(logger.WithRequestID(context.Background(), newRequestID()), s.cfg.QueryTimeoutLimit())
+		defer cancel()
+		defer func() {
+			if v := recover(); v != nil {
+				s.reportPanic(ctx, v, nil)
+			}
+		}()
+
+		info, err := core.ProcessIPInfo(ctx, s.cfg, ip)
+		if err != nil {
+			s.logFor(ctx).Warn("后台刷新缓存结果失败", "ip", ip, "error", err)
+			return
+		}
+		s.cache.put(ip, info)
+		s.logFor(ctx).Debug("后台刷新缓存结果完成", "ip", ip)
+	}()
+}
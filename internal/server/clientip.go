@@ -0,0 +1,108 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ParseTrustedProxies 解析以逗号分隔的可信代理列表，每项为IP地址或CIDR网段
+//
+// 参数:
+//   - s: 可信代理列表，如 "10.0.0.0/8,127.0.0.1"，为空时返回nil
+//
+// 返回:
+//   - []netip.Prefix: 解析后的网段，单个IP视为只包含该地址的网段
+//   - error: 如果某一项无法解析则返回相应错误
+func ParseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if strings.Contains(item, "/") {
+			prefix, err := netip.ParsePrefix(item)
+			if err != nil {
+				return nil, fmt.Errorf("无效的可信代理网段: %s", item)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, fmt.Errorf("无效的可信代理地址: %s", item)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// trustedProxy 检查地址是否属于配置的可信代理
+func (s *apiServer) trustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range s.proxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP 获取客户端IP地址，用于限流、API密钥的allowed_ips、/myip和访问日志
+// 默认使用TCP连接的对端地址。只有对端是配置的可信代理时才读取X-Forwarded-For：从右向左跳过
+// 可信代理，第一个不是可信代理的地址即为客户端；没有X-Forwarded-For时使用X-Real-IP。
+// 调用方可以任意设置这两个请求头，来自其他地址的请求中的代理头一律忽略。
+func (s *apiServer) clientIP(r *http.Request) string {
+	ip := peerIP(r)
+	if !s.trustedProxy(ip) {
+		return ip
+	}
+
+	if xForwardedFor := r.Header.Values("X-Forwarded-For"); len(xForwardedFor) > 0 {
+		hops := strings.Split(strings.Join(xForwardedFor, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				// 无法识别的地址不可信，使用最后一个可信代理记录的地址
+				return ip
+			}
+			ip = hop
+			if !s.trustedProxy(hop) {
+				return ip
+			}
+		}
+		return ip
+	}
+
+	if xRealIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(xRealIP) != nil {
+		return xRealIP
+	}
+	return ip
+}
+
+// forwardedFor 返回请求中的转发链，用于审计记录
+// 多个X-Forwarded-For请求头按顺序以逗号连接，没有时返回X-Real-IP；内容未经验证，可能由调用方伪造。
+func forwardedFor(r *http.Request) string {
+	if xForwardedFor := r.Header.Values("X-Forwarded-For"); len(xForwardedFor) > 0 {
+		return strings.Join(xForwardedFor, ", ")
+	}
+	return strings.TrimSpace(r.Header.Get("X-Real-IP"))
+}
+
+// peerIP 返回TCP连接的对端地址
+func peerIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		// 如果无法解析，直接返回RemoteAddr
+		return r.RemoteAddr
+	}
+	return ip
+}
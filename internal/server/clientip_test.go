@@ -0,0 +1,88 @@
+package server
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	got, err := ParseTrustedProxies(" 10.0.0.0/8, 127.0.0.1,,::ffff:192.0.2.1, 2001:db8::/32, 10.1.2.3/16 ")
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies: %v", err)
+	}
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("127.0.0.1/32"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("2001:db8::/32"),
+		netip.MustParsePrefix("10.1.0.0/16"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseTrustedProxies = %v, 期望 %v", got, want)
+	}
+
+	if got, err := ParseTrustedProxies(""); err != nil || got != nil {
+		t.Errorf("空列表: %v, %v", got, err)
+	}
+	for _, s := range []string{"10.0.0.0/33", "10.0.0/8", "10.0.0", "example.com", "10.0.0.0/8,fe80::/129"} {
+		if _, err := ParseTrustedProxies(s); err == nil {
+			t.Errorf("ParseTrustedProxies(%q) 期望返回错误", s)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8,2001:db8::/32")
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies: %v", err)
+	}
+	s := &apiServer{proxies: proxies}
+
+	tests := []struct {
+		name    string
+		remote  string
+		xff     []string
+		xRealIP string
+		want    string
+	}{
+		{"直连", "203.0.113.5:4000", nil, "", "203.0.113.5"},
+		{"不可信对端伪造X-Forwarded-For", "203.0.113.5:4000", []string{"198.51.100.1"}, "", "203.0.113.5"},
+		{"不可信对端伪造X-Real-IP", "203.0.113.5:4000", nil, "198.51.100.1", "203.0.113.5"},
+		{"单层可信代理", "10.0.0.2:4000", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"多层代理从右向左跳过可信代理", "10.0.0.2:4000", []string{"6.6.6.6, 198.51.100.1, 10.0.0.7"}, "", "198.51.100.1"},
+		{"多个X-Forwarded-For请求头", "10.0.0.2:4000", []string{"6.6.6.6, 198.51.100.1", "10.0.0.7"}, "", "198.51.100.1"},
+		{"全部是可信代理", "10.0.0.2:4000", []string{"10.0.0.9, 10.0.0.7"}, "", "10.0.0.9"},
+		{"无法识别的地址", "10.0.0.2:4000", []string{"198.51.100.1, unknown, 10.0.0.7"}, "", "10.0.0.7"},
+		{"IPv4映射的IPv6对端", "[::ffff:10.0.0.2]:4000", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"不可信的IPv4映射对端", "[::ffff:203.0.113.5]:4000", []string{"198.51.100.1"}, "", "::ffff:203.0.113.5"},
+		{"IPv6可信代理", "[2001:db8::1]:4000", []string{"2001:db9::5"}, "", "2001:db9::5"},
+		{"X-Real-IP回退", "10.0.0.2:4000", nil, "198.51.100.1", "198.51.100.1"},
+		{"无效的X-Real-IP", "10.0.0.2:4000", nil, "not-an-ip", "10.0.0.2"},
+		{"X-Forwarded-For优先于X-Real-IP", "10.0.0.2:4000", []string{"198.51.100.1"}, "198.51.100.2", "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/query", nil)
+			r.RemoteAddr = tt.remote
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if tt.xRealIP != "" {
+				r.Header.Set("X-Real-IP", tt.xRealIP)
+			}
+			if got := s.clientIP(r); got != tt.want {
+				t.Errorf("clientIP = %q, 期望 %q", got, tt.want)
+			}
+		})
+	}
+
+	// 没有配置可信代理时一律使用对端地址
+	r := httptest.NewRequest("GET", "/query", nil)
+	r.RemoteAddr = "10.0.0.2:4000"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	if got := (&apiServer{}).clientIP(r); got != "10.0.0.2" {
+		t.Errorf("未配置可信代理: clientIP = %q, 期望 10.0.0.2", got)
+	}
+}
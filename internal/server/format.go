@@ -0,0 +1,262 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"ping0/internal/models"
+	"ping0/internal/output"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// maxCallbackLength JSONP回调函数名的最大长度
+const maxCallbackLength = 128
+
+// 响应格式
+const (
+	formatJSON     = "json"
+	formatXML      = "xml"
+	formatCSV      = "csv"
+	formatMsgPack  = "msgpack"
+	formatProtobuf = "protobuf"
+	formatNDJSON   = "ndjson"
+)
+
+// formatMediaTypes 各响应格式在Accept请求头中可以使用的媒体类型，第一个是响应的Content-Type
+var formatMediaTypes = map[string][]string{
+	formatJSON:     {"application/json"},
+	formatXML:      {"application/xml", "text/xml"},
+	formatCSV:      {"text/csv"},
+	formatMsgPack:  {"application/x-msgpack", "application/msgpack", "application/vnd.msgpack"},
+	formatProtobuf: {"application/x-protobuf", "application/protobuf", "application/vnd.google.protobuf"},
+	formatNDJSON:   {"application/x-ndjson"},
+}
+
+// queryFormats 单IP查询支持的响应格式，按权重相同时的优先顺序排列
+var queryFormats = []string{formatJSON, formatXML, formatMsgPack, formatProtobuf}
+
+// queryFormat 单IP查询响应的格式
+// 由format和callback查询参数或Accept请求头决定，只影响查询结果和查询错误的响应，
+// 认证、限流等中间件返回的错误仍然是JSON。
+type queryFormat struct {
+	name     string // 响应格式，如json、xml、msgpack、protobuf
+	callback string // JSONP回调函数名，为空时不使用JSONP
+
+	// sign 为JSON和JSONP结果添加签名，为nil时不签名；其他格式不签名
+	sign func(v interface{}) interface{}
+
+	branding bool // 是否在错误中添加Princess字段
+}
+
+// negotiateFormat 根据请求选择单IP查询响应的格式
+// format参数直接指定格式（json、xml、msgpack、protobuf）；callback参数以JSONP返回JSON结果，只能与JSON格式一起使用；
+// 都未提供时按Accept请求头协商（见negotiateAccept），权重相同时优先JSON。
+// 浏览器直接打开页面时的Accept请求头（包含text/html）通常也接受XML，这时仍然返回JSON。
+//
+// 参数:
+//   - r: HTTP请求
+//
+// 返回:
+//   - queryFormat: 响应格式
+//   - int: 参数无效时为400，Accept请求头中没有支持的格式时为406
+//   - error: 如果无法确定响应格式则返回相应错误
+func negotiateFormat(r *http.Request) (queryFormat, int, error) {
+	query := r.URL.Query()
+	f := queryFormat{name: formatJSON}
+
+	if query.Has("callback") {
+		f.callback = query.Get("callback")
+		if !validCallback(f.callback) {
+			return f, http.StatusBadRequest, fmt.Errorf("callback参数必须是JavaScript函数名（如 handle 或 app.handle），且不超过%d个字符", maxCallbackLength)
+		}
+	}
+
+	if format := query.Get("format"); format != "" {
+		if !slices.Contains(queryFormats, format) {
+			return f, http.StatusBadRequest, fmt.Errorf("不支持的format参数: %s（可选 %s）", format, strings.Join(queryFormats, "、"))
+		}
+		if f.callback != "" && format != formatJSON {
+			return f, http.StatusBadRequest, fmt.Errorf("callback参数只能与JSON格式一起使用")
+		}
+		f.name = format
+		return f, 0, nil
+	}
+
+	if f.callback != "" {
+		return f, 0, nil
+	}
+	accept := r.Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" || strings.Contains(strings.ToLower(accept), "text/html") {
+		return f, 0, nil
+	}
+	if f.name = negotiateAccept(accept, queryFormats); f.name == "" {
+		var types []string
+		for _, format := range queryFormats {
+			types = append(types, formatMediaTypes[format][0])
+		}
+		return f, http.StatusNotAcceptable, fmt.Errorf("不支持Accept请求头中的格式，可选 %s", strings.Join(types, "、"))
+	}
+	return f, 0, nil
+}
+
+// negotiateAccept 按Accept请求头从formats中选择权重最高的响应格式
+// 每个格式的权重取其各个媒体类型（见formatMediaTypes）中最高的权重，权重相同时按formats中的顺序选择。
+//
+// 参数:
+//   - accept: Accept请求头
+//   - formats: 可以使用的响应格式，按优先顺序排列
+//
+// 返回:
+//   - string: 选择的格式，没有可接受的格式时返回空字符串
+func negotiateAccept(accept string, formats []string) string {
+	best, bestQ := "", 0.0
+	for _, format := range formats {
+		q := 0.0
+		for _, mediaType := range formatMediaTypes[format] {
+			typ, subtype, _ := strings.Cut(mediaType, "/")
+			q = max(q, acceptQuality(accept, typ, subtype))
+		}
+		if q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+	return best
+}
+
+// acceptQuality 返回Accept请求头对指定媒体类型的权重
+// 使用最具体的匹配项（type/subtype优先于type/*，type/*优先于*/*），没有匹配项时返回0。
+func acceptQuality(accept, typ, subtype string) float64 {
+	best, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		t, st, _ := strings.Cut(mediaType, "/")
+
+		level := -1
+		switch {
+		case t == typ && st == subtype:
+			level = 2
+		case t == typ && st == "*":
+			level = 1
+		case t == "*" && st == "*":
+			level = 0
+		}
+		if level < specificity || level < 0 {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(name, "q") {
+				if v, err := strconv.ParseFloat(value, 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if level > specificity || q > best {
+			best, specificity = q, level
+		}
+	}
+	return best
+}
+
+// validCallback 判断JSONP回调函数名是否安全：由点分隔的JavaScript标识符
+// 限制字符可以防止通过回调参数向响应中注入任意脚本。
+func validCallback(name string) bool {
+	if name == "" || len(name) > maxCallbackLength {
+		return false
+	}
+	for _, ident := range strings.Split(name, ".") {
+		if ident == "" {
+			return false
+		}
+		for i := 0; i < len(ident); i++ {
+			c := ident[i]
+			switch {
+			case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', c == '_', c == '$':
+			case '0' <= c && c <= '9':
+				if i == 0 {
+					return false
+				}
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// write 按响应格式写出状态码和结果
+// JSONP响应的状态码总是200，因为浏览器不会执行非2xx响应中的脚本。
+//
+// 参数:
+//   - w: 响应
+//   - status: HTTP状态码
+//   - root: XML根元素名称
+//   - v: 要输出的结果或错误
+func (f queryFormat) write(w http.ResponseWriter, status int, root string, v interface{}) error {
+	switch {
+	case f.name == formatXML:
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.WriteHeader(status)
+		return output.WriteXML(w, root, v)
+	case f.name == formatMsgPack:
+		w.Header().Set("Content-Type", formatMediaTypes[formatMsgPack][0])
+		w.WriteHeader(status)
+		return output.WriteMsgPack(w, v)
+	case f.name == formatProtobuf:
+		var msg proto.Message
+		switch t := v.(type) {
+		case *models.IPInfo:
+			msg = ipInfoProto(t)
+		case map[string]string:
+			msg = errorProto(t)
+		default:
+			return fmt.Errorf("无法编码为Protocol Buffers的类型 %T", v)
+		}
+		body, err := marshalProto(msg)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", formatMediaTypes[formatProtobuf][0])
+		w.WriteHeader(status)
+		_, err = w.Write(body)
+		return err
+	case f.callback != "":
+		if f.sign != nil {
+			v = f.sign(v)
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusOK)
+		// 开头的注释防止响应被当作其他内容类型解析（Rosetta Flash等攻击）
+		_, err = fmt.Fprintf(w, "/**/%s(%s);\n", f.callback, data)
+		return err
+	default:
+		if f.sign != nil {
+			v = f.sign(v)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		return json.NewEncoder(w).Encode(v)
+	}
+}
+
+// writeError 按响应格式写出错误
+// JSONP的状态码总是200，原状态码放在错误的status字段中。配置了签名密钥时错误也带有签名。
+func (f queryFormat) writeError(w http.ResponseWriter, status int, fields map[string]string) error {
+	if f.callback != "" {
+		fields["status"] = strconv.Itoa(status)
+	}
+	return f.write(w, status, "error", models.WithPrincess(fields, f.branding))
+}
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"ping0/internal/models"
+	"ping0/internal/output"
+	"ping0/internal/store"
+)
+
+// handleHistory 处理历史记录查询请求
+// GET /history?ip=1.1.1.1&limit=20 返回该IP最近的查询记录，按时间从早到晚排列
+func (s *apiServer) handleHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if s.cfg.History == nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(models.WithPrincess(map[string]string{
+			"error": "服务器未启用历史记录",
+		}, s.cfg.Branding()))
+		return
+	}
+
+	ip := r.URL.Query().Get("ip")
+	if ip == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(models.WithPrincess(map[string]string{
+			"error": "缺少ip参数",
+		}, s.cfg.Branding()))
+		return
+	}
+
+	setQueriedIP(r, ip)
+
+	limit := store.DefaultHistoryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > store.MaxHistoryLimit {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(models.WithPrincess(map[string]string{
+				"error": "limit参数必须是1到" + strconv.Itoa(store.MaxHistoryLimit) + "之间的整数",
+			}, s.cfg.Branding()))
+			return
+		}
+		limit = n
+	}
+
+	records, err := s.cfg.History.History(r.Context(), ip, limit)
+	if err != nil {
+		s.logFor(r.Context()).Warn("读取历史记录失败", "ip", ip, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(models.WithPrincess(map[string]string{
+			"error": err.Error(),
+		}, s.cfg.Branding()))
+		return
+	}
+
+	key := s.requestKey(r)
+	for i := range records {
+		// 保存记录时的配置可能不同，按当前配置设置Princess字段
+		records[i].Info.Princess = models.Princess(s.cfg.Branding())
+		records[i].Info = redactInfo(key, records[i].Info)
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(records)
+}
+
+// exportFormats 导出历史记录支持的格式，按权重相同时的优先顺序排列
+var exportFormats = []string{formatNDJSON, formatCSV}
+
+// exportColumns 导出CSV时默认输出的列
+// 流式导出无法预先得知全部记录中出现的字段，因此使用固定的列，需要其他字段时通过columns参数指定。
+var exportColumns = []string{
+	"queried_at", "tag", "ip", "ip_location", "country_code", "country", "region", "city",
+	"asn", "asn_number", "asn_owner", "asn_type", "prefix", "organization", "org_type",
+	"latitude", "longitude", "ip_type", "risk_value", "risk_score", "risk_label", "native_ip",
+}
+
+// handleHistoryExport 处理历史记录导出请求
+// GET /history/export?since=24h&tag=batch-1&format=csv 按保存顺序流式返回时间范围内（指定tag时只包括带有该标签的）全部历史记录，
+// format为ndjson（默认，每行一条与/history相同的记录）或csv，未提供时按Accept请求头协商。
+// 响应开始后读取失败时中断连接，避免客户端把不完整的导出当作完整的结果。
+func (s *apiServer) handleHistoryExport(w http.ResponseWriter, r *http.Request) {
+	writeError := func(code int, msg string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(models.WithPrincess(map[string]string{
+			"error": msg,
+		}, s.cfg.Branding()))
+	}
+
+	if s.cfg.History == nil {
+		writeError(http.StatusNotFound, "服务器未启用历史记录")
+		return
+	}
+
+	query := r.URL.Query()
+	now := time.Now()
+	since, err := parseExportTime(query.Get("since"), now)
+	if err != nil {
+		writeError(http.StatusBadRequest, "since参数无效: "+err.Error())
+		return
+	}
+	until, err := parseExportTime(query.Get("until"), now)
+	if err != nil {
+		writeError(http.StatusBadRequest, "until参数无效: "+err.Error())
+		return
+	}
+	if !until.IsZero() && !since.Before(until) {
+		writeError(http.StatusBadRequest, "since必须早于until")
+		return
+	}
+	tag := query.Get("tag")
+	if err := store.CheckTag(tag); err != nil {
+		writeError(http.StatusBadRequest, "tag参数无效: "+err.Error())
+		return
+	}
+
+	format := query.Get("format")
+	if format == "" {
+		if format = negotiateAccept(r.Header.Get("Accept"), exportFormats); format == "" {
+			format = formatNDJSON
+		}
+	} else if !slices.Contains(exportFormats, format) {
+		writeError(http.StatusBadRequest, fmt.Sprintf("不支持的format参数: %s（可选 %s）", format, strings.Join(exportFormats, "、")))
+		return
+	}
+	if format != formatCSV && (query.Has("columns") || query.Has("header")) {
+		writeError(http.StatusBadRequest, "columns和header参数只能在format=csv时使用")
+		return
+	}
+	columns := exportColumns
+	if query.Has("columns") {
+		if columns = output.ParseColumns(query.Get("columns")); len(columns) == 0 {
+			writeError(http.StatusBadRequest, "columns参数没有指定任何列")
+			return
+		}
+	}
+	header := true
+	if v := query.Get("header"); v != "" {
+		if header, err = strconv.ParseBool(v); err != nil {
+			writeError(http.StatusBadRequest, fmt.Sprintf("header参数必须是true或false: %q", v))
+			return
+		}
+	}
+
+	key := s.requestKey(r)
+	w.Header().Set("Content-Type", formatMediaTypes[format][0])
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="pong0-history-%s.%s"`, now.UTC().Format("20060102T150405Z"), format))
+	w.WriteHeader(http.StatusOK)
+
+	var write func(store.Record) error
+	cw := csv.NewWriter(w)
+	if format == formatCSV {
+		if header {
+			cw.Write(columns)
+		}
+		write = func(rec store.Record) error {
+			values, err := output.ToRecord(rec)
+			if err != nil {
+				return err
+			}
+			row := make([]string, len(columns))
+			for i, col := range columns {
+				if v, ok := values.Lookup(col); ok {
+					row[i] = output.CellString(v)
+				}
+			}
+			return cw.Write(row)
+		}
+	} else {
+		enc := json.NewEncoder(w)
+		write = func(rec store.Record) error {
+			return enc.Encode(rec)
+		}
+	}
+
+	count := 0
+	q := store.ExportQuery{Since: since, Until: until, Tag: tag}
+	err = s.cfg.History.Export(r.Context(), q, func(rec store.Record) error {
+		rec.Info.Princess = models.Princess(s.cfg.Branding())
+		rec.Info = redactInfo(key, rec.Info)
+		count++
+		return write(rec)
+	})
+	if err == nil {
+		cw.Flush()
+		err = cw.Error()
+	}
+	if err != nil {
+		s.logFor(r.Context()).Warn("导出历史记录失败", "exported", count, "error", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// parseExportTime 解析导出的时间范围参数
+// 可以是RFC3339时间（如 2024-06-01T00:00:00Z）、日期（如 2024-06-01，按UTC）或相对于now的时长（如 24h，表示24小时前），
+// 为空时返回零值。
+func parseExportTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("应为RFC3339时间、日期或时长: %q", value)
+	}
+	return now.Add(-d), nil
+}
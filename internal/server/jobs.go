@@ -0,0 +1,531 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ping0/internal/models"
+	"ping0/internal/store"
+)
+
+const (
+	// maxJobSize 单个批量查询任务允许的最大IP数量，任务在后台执行，因此远大于同步批量查询的上限
+	maxJobSize = 10000
+
+	// maxRunningJobs 同时执行的批量查询任务数上限
+	maxRunningJobs = 16
+
+	// jobWorkers 全部任务共用的查询工作协程数，任务再多也不会增加发往Ping0.cc的并发
+	jobWorkers = batchWorkers
+
+	// jobKeepAlive SSE连接没有新事件时发送注释行的间隔，避免代理服务器断开空闲连接
+	jobKeepAlive = 15 * time.Second
+)
+
+// 任务状态
+const (
+	jobRunning = "running"
+	jobDone    = "done"
+)
+
+// batchJob 一个在后台执行的批量查询任务
+// 结果按完成顺序保存在events中，SSE连接可以从任意位置开始读取，断线重连后不会丢失进度。
+type batchJob struct {
+	id      string
+	ips     []string
+	created time.Time
+	ctx     context.Context // 任务中查询使用的上下文，包含创建任务的请求ID和timeout参数
+	cancel  context.CancelFunc
+
+	// wait 每个查询交给工作池之前调用，等待限流放行；返回时已取得令牌或ctx已结束，为nil时不等待
+	wait func(ctx context.Context)
+
+	princess string // 任务状态中的Princess字段，关闭时为空
+
+	mu       sync.Mutex
+	events   []models.StreamRecord // 按完成顺序排列的结果
+	results  []interface{}         // 按请求顺序排列的结果，未完成的为nil
+	failed   int                   // 失败的查询数
+	finished time.Time             // 完成时间，未完成时为零值
+	notify   chan struct{}         // 有新结果或任务完成时关闭并替换
+}
+
+// jobProgress SSE result事件的数据：查询结果和任务进度
+type jobProgress struct {
+	Completed int                 `json:"completed"` // 已完成的查询数
+	Total     int                 `json:"total"`     // 任务中的IP数量
+	Result    models.StreamRecord `json:"result"`    // 本次完成的查询结果，附带sequence和elapsed_ms字段
+}
+
+// jobStatus 任务状态，作为创建任务、查询任务的响应和SSE done事件的数据
+type jobStatus struct {
+	ID         string        `json:"id"`
+	Status     string        `json:"status"` // running或done
+	Total      int           `json:"total"`
+	Completed  int           `json:"completed"`
+	Failed     int           `json:"failed"`
+	CreatedAt  time.Time     `json:"created_at"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+	EventsURL  string        `json:"events_url"`
+	Results    []interface{} `json:"results,omitempty"` // 查询任务时按请求顺序返回结果，未完成的为null
+	Princess   string        `json:"princess,omitempty"`
+}
+
+// status 返回任务当前的状态，withResults为true时包含全部结果
+func (j *batchJob) status(withResults bool) jobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	st := jobStatus{
+		ID:        j.id,
+		Status:    jobRunning,
+		Total:     len(j.ips),
+		Completed: len(j.events),
+		Failed:    j.failed,
+		CreatedAt: j.created,
+		EventsURL: "/jobs/" + j.id + "/events",
+		Princess:  j.princess,
+	}
+	if !j.finished.IsZero() {
+		finished := j.finished
+		st.Status, st.FinishedAt = jobDone, &finished
+	}
+	if withResults {
+		st.Results = append([]interface{}(nil), j.results...)
+	}
+	return st
+}
+
+// record 保存一个完成的查询结果并通知等待的SSE连接
+func (j *batchJob) record(idx int, result interface{}, elapsed time.Duration) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.events = append(j.events, models.StreamRecord{Sequence: idx + 1, Elapsed: elapsed, Result: result})
+	j.results[idx] = result
+	if _, ok := result.(batchError); ok {
+		j.failed++
+	}
+	close(j.notify)
+	j.notify = make(chan struct{})
+}
+
+// finish 标记任务完成并通知等待的SSE连接
+func (j *batchJob) finish() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.finished = time.Now()
+	close(j.notify)
+	j.notify = make(chan struct{})
+}
+
+// since 返回第from个之后的结果、任务是否已完成，以及等待下一次变化的通道
+func (j *batchJob) since(from int) ([]models.StreamRecord, bool, <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var events []models.StreamRecord
+	if from < len(j.events) {
+		events = append(events, j.events[from:]...)
+	}
+	return events, !j.finished.IsZero(), j.notify
+}
+
+// jobTask 工作池中等待执行的一个查询
+type jobTask struct {
+	job  *batchJob
+	idx  int    // IP在任务中的下标
+	done func() // 查询完成后调用
+}
+
+// jobStore 保存批量查询任务，并用固定数量的工作协程执行全部任务中的查询
+// 完成超过保留时间的任务在创建新任务或查询任务时清除。
+type jobStore struct {
+	retention time.Duration                                    // 任务完成后保留结果的时间
+	query     func(ctx context.Context, ip string) interface{} // 查询单个IP，返回*models.IPInfo或batchError
+	tasks     chan jobTask
+	start     sync.Once
+
+	mu     sync.Mutex
+	jobs   map[string]*batchJob
+	closed bool
+}
+
+// newJobStore 创建任务存储，工作协程在第一个任务开始时才启动
+//
+// 参数:
+//   - retention: 任务完成后保留结果的时间
+//   - query: 查询单个IP的函数，返回*models.IPInfo或batchError
+//
+// 返回:
+//   - *jobStore: 新的任务存储
+func newJobStore(retention time.Duration, query func(ctx context.Context, ip string) interface{}) *jobStore {
+	return &jobStore{
+		retention: retention,
+		query:     query,
+		tasks:     make(chan jobTask),
+		jobs:      make(map[string]*batchJob),
+	}
+}
+
+// run 将任务中的查询依次交给工作池，全部完成后标记任务完成
+// 各任务的查询按提交顺序交替执行，先创建的大任务不会让之后的任务一直等待。
+// 每个查询提交前在任务自己的协程中等待限流放行，被限流的任务不会占用共用的工作协程。
+func (st *jobStore) run(job *batchJob) {
+	st.start.Do(func() {
+		for i := 0; i < jobWorkers; i++ {
+			go st.work()
+		}
+	})
+	defer job.cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(len(job.ips))
+	for idx := range job.ips {
+		// 任务被取消或超时后不再等待，查询会立即以相应的错误结束
+		if job.wait != nil {
+			job.wait(job.ctx)
+		}
+		st.tasks <- jobTask{job: job, idx: idx, done: wg.Done}
+	}
+	wg.Wait()
+	job.finish()
+}
+
+// work 工作协程，执行工作池中的查询，随服务器进程一直运行
+func (st *jobStore) work() {
+	for task := range st.tasks {
+		startTime := time.Now()
+		result := st.query(task.job.ctx, task.job.ips[task.idx])
+		task.job.record(task.idx, result, time.Since(startTime))
+		task.done()
+	}
+}
+
+// add 登记新任务，正在执行的任务已达上限或服务器正在关闭时返回错误
+func (st *jobStore) add(job *batchJob) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.closed {
+		return fmt.Errorf("服务器正在关闭")
+	}
+	running := 0
+	for id, j := range st.jobs {
+		j.mu.Lock()
+		finished := j.finished
+		j.mu.Unlock()
+		switch {
+		case finished.IsZero():
+			running++
+		case time.Since(finished) > st.retention:
+			delete(st.jobs, id)
+		}
+	}
+	if running >= maxRunningJobs {
+		return fmt.Errorf("正在执行的批量查询任务已达上限（%d个），请稍后重试", maxRunningJobs)
+	}
+	st.jobs[job.id] = job
+	return nil
+}
+
+// get 返回任务，任务不存在或已超过保留时间时返回nil
+func (st *jobStore) get(id string) *batchJob {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	job := st.jobs[id]
+	if job == nil {
+		return nil
+	}
+	job.mu.Lock()
+	expired := !job.finished.IsZero() && time.Since(job.finished) > st.retention
+	job.mu.Unlock()
+	if expired {
+		delete(st.jobs, id)
+		return nil
+	}
+	return job
+}
+
+// close 取消全部正在执行的任务，在服务器关闭时调用
+// 被取消的任务中尚未开始的查询立即以错误结束，SSE连接收到done事件后返回，不会阻塞服务器关闭。
+func (st *jobStore) close() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.closed = true
+	for _, job := range st.jobs {
+		job.cancel()
+	}
+}
+
+// handleCreateJob 创建后台执行的批量查询任务
+// 请求体与 /query/batch 相同，但最多可以包含maxJobSize个IP，立即以202返回任务ID；之后通过 GET /jobs/{id} 查询状态和结果，
+// 或通过 GET /jobs/{id}/events 以Server-Sent Events逐个接收完成的结果，便于网页显示进度。
+// timeout参数限制整个任务的耗时，任务在客户端断开后继续执行。
+func (s *apiServer) handleCreateJob(w http.ResponseWriter, r *http.Request) {
+	var ips []string
+	if err := json.NewDecoder(r.Body).Decode(&ips); err != nil {
+		s.writeJSONError(w, http.StatusBadRequest, "无法解析请求体，需要IP字符串组成的JSON数组："+err.Error())
+		return
+	}
+	if len(ips) == 0 || len(ips) > maxJobSize {
+		s.writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("IP数量必须在1到%d之间", maxJobSize))
+		return
+	}
+
+	// 任务不随请求结束而取消，但保留请求ID等上下文信息
+	ctx, cancelTimeout, err := s.queryContext(w, r.WithContext(context.WithoutCancel(r.Context())))
+	if err != nil {
+		s.writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// API密钥当天的配额在创建任务时按IP数量扣除；客户端和全局限流在执行每个查询前等待，见waitRateLimit
+	if retryAfter, message := s.useKeyQuota(r.Context(), s.requestKey(r), len(ips)); retryAfter > 0 {
+		cancelTimeout()
+		w.Header().Set("Content-Type", "application/json")
+		s.writeTooManyRequests(w, retryAfter, message)
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	client := s.clientIP(r)
+
+	job := &batchJob{
+		id:      newRequestID(),
+		ips:     ips,
+		created: time.Now(),
+		ctx:     ctx,
+		cancel: func() {
+			cancel()
+			cancelTimeout()
+		},
+		wait: func(ctx context.Context) {
+			s.waitRateLimit(ctx, client)
+		},
+		results:  make([]interface{}, len(ips)),
+		notify:   make(chan struct{}),
+		princess: models.Princess(s.cfg.Branding()),
+	}
+	if err := s.jobs.add(job); err != nil {
+		job.cancel()
+		w.Header().Set("Retry-After", "60")
+		s.writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	setQueriedIP(r, strings.Join(ips, ","))
+	s.logFor(r.Context()).Debug("创建批量查询任务", "job", job.id, "count", len(ips), "client", client)
+
+	go func() {
+		s.jobs.run(job)
+		s.logFor(ctx).Debug("批量查询任务已完成", "job", job.id)
+		s.saveJob(job)
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/jobs/"+job.id)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job.status(false))
+}
+
+// handleJob 处理 GET /jobs/{id} 和 GET /jobs/{id}/events
+func (s *apiServer) handleJob(w http.ResponseWriter, r *http.Request) {
+	id, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
+	if sub != "" && sub != "events" {
+		s.writeJSONError(w, http.StatusNotFound, "未找到: "+r.URL.Path)
+		return
+	}
+	job := s.jobs.get(id)
+	if job == nil {
+		job = s.loadJob(r.Context(), id)
+	}
+	if job == nil {
+		s.writeJSONError(w, http.StatusNotFound, "任务不存在或已过期: "+id)
+		return
+	}
+
+	if sub == "events" {
+		s.streamJob(w, r, job)
+		return
+	}
+	// 结果按读取任务的请求使用的API密钥脱敏，而不是创建任务时的密钥
+	st := job.status(true)
+	key := s.requestKey(r)
+	for i, result := range st.Results {
+		st.Results[i] = redactResult(key, result)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(st)
+}
+
+// streamJob 以Server-Sent Events发送任务的进度
+// 每完成一个查询发送一个result事件（数据为jobProgress，id为已完成的查询数），全部完成后发送done事件（数据为jobStatus）并结束响应。
+// 连接时先发送已完成的结果；断线重连时浏览器会带上Last-Event-ID请求头，只发送之后的结果。
+func (s *apiServer) streamJob(w http.ResponseWriter, r *http.Request, job *batchJob) {
+	from := 0
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			from = n
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// 禁止nginx等反向代理缓冲响应，否则事件会积攒到一起才送达
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// 事件流的持续时间取决于任务，取消本次响应的写截止时间
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		s.log.Debug("无法取消写超时", "error", err)
+	}
+	rc.Flush()
+
+	keepAlive := time.NewTicker(jobKeepAlive)
+	defer keepAlive.Stop()
+
+	key := s.requestKey(r)
+	total := len(job.ips)
+	for {
+		events, finished, notify := job.since(from)
+		for _, event := range events {
+			from++
+			event.Result = redactResult(key, event.Result)
+			data, err := json.Marshal(jobProgress{Completed: from, Total: total, Result: event})
+			if err != nil {
+				s.logFor(r.Context()).Warn("转换任务进度失败", "job", job.id, "error", err)
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: result\ndata: %s\n\n", from, data)
+		}
+		if finished {
+			data, _ := json.Marshal(job.status(false))
+			fmt.Fprintf(w, "event: done\ndata: %s\n\n", data)
+			rc.Flush()
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			s.log.Debug("刷新事件流失败", "error", err)
+			return
+		}
+
+		select {
+		case <-notify:
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// savedJob 保存到历史记录数据库中的已完成任务，服务器重启后或在连接同一数据库的其他副本上仍可以读取
+type savedJob struct {
+	ID       string       `json:"id"`
+	IPs      []string     `json:"ips"`
+	Created  time.Time    `json:"created"`
+	Finished time.Time    `json:"finished"`
+	Events   []savedEvent `json:"events"` // 按完成顺序排列的结果
+}
+
+// savedEvent 已完成任务中的一个查询结果，成功时Info不为nil，失败时Error不为nil
+type savedEvent struct {
+	Sequence int            `json:"sequence"`
+	Elapsed  time.Duration  `json:"elapsed"`
+	Info     *models.IPInfo `json:"info,omitempty"`
+	Error    *batchError    `json:"error,omitempty"`
+}
+
+// saveJob 将已完成的任务保存到历史记录数据库，保留时间与内存中相同，未配置数据库时不做任何处理
+// 保存的是脱敏前的结果，读取时按读取请求使用的API密钥脱敏。
+func (s *apiServer) saveJob(job *batchJob) {
+	if s.cfg.History == nil {
+		return
+	}
+
+	job.mu.Lock()
+	saved := savedJob{ID: job.id, IPs: job.ips, Created: job.created, Finished: job.finished, Events: make([]savedEvent, 0, len(job.events))}
+	for _, event := range job.events {
+		ev := savedEvent{Sequence: event.Sequence, Elapsed: event.Elapsed}
+		switch result := event.Result.(type) {
+		case *models.IPInfo:
+			ev.Info = result
+		case batchError:
+			ev.Error = &result
+		}
+		saved.Events = append(saved.Events, ev)
+	}
+	job.mu.Unlock()
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		s.log.Warn("转换批量查询任务失败", "job", job.id, "error", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.cfg.History.SaveJob(ctx, job.id, data, saved.Finished.Add(s.jobs.retention)); err != nil {
+		s.log.Warn("保存批量查询任务失败", "job", job.id, "error", err)
+	}
+}
+
+// loadJob 从历史记录数据库读取已完成的任务，任务不存在、已过期或未配置数据库时返回nil
+// 读取的任务不加入内存中的任务列表，也不计入正在执行的任务数。
+func (s *apiServer) loadJob(ctx context.Context, id string) *batchJob {
+	if s.cfg.History == nil {
+		return nil
+	}
+
+	data, err := s.cfg.History.Job(ctx, id)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			s.logFor(ctx).Warn("读取批量查询任务失败", "job", id, "error", err)
+		}
+		return nil
+	}
+	var saved savedJob
+	if err := json.Unmarshal(data, &saved); err != nil {
+		s.logFor(ctx).Warn("解析批量查询任务失败", "job", id, "error", err)
+		return nil
+	}
+
+	job := &batchJob{
+		id:       saved.ID,
+		ips:      saved.IPs,
+		created:  saved.Created,
+		ctx:      context.Background(),
+		cancel:   func() {},
+		results:  make([]interface{}, len(saved.IPs)),
+		finished: saved.Finished,
+		notify:   make(chan struct{}),
+		princess: models.Princess(s.cfg.Branding()),
+	}
+	for _, ev := range saved.Events {
+		var result interface{}
+		switch {
+		case ev.Error != nil:
+			result = *ev.Error
+			job.failed++
+		case ev.Info != nil:
+			result = ev.Info
+		default:
+			continue
+		}
+		job.events = append(job.events, models.StreamRecord{Sequence: ev.Sequence, Elapsed: ev.Elapsed, Result: result})
+		if ev.Sequence >= 1 && ev.Sequence <= len(job.results) {
+			job.results[ev.Sequence-1] = result
+		}
+	}
+	return job
+}
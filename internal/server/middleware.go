@@ -0,0 +1,315 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"ping0/internal/logger"
+	"ping0/internal/metrics"
+	"ping0/internal/models"
+	"ping0/internal/tracing"
+
+	"github.com/getsentry/sentry-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware 包装处理器，在其前后添加处理逻辑
+// 与config.Config.Middleware中的元素是同一种类型，库的调用方可以直接传入自己的中间件。
+type Middleware = func(http.Handler) http.Handler
+
+// Chain 按顺序组合中间件，第一个中间件在最外层，最先处理请求
+//
+// 参数:
+//   - h: 最终处理请求的处理器
+//   - mws: 中间件列表
+//
+// 返回:
+//   - http.Handler: 组合后的处理器
+func Chain(h http.Handler, mws ...Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// writeJSONError 返回带Princess字段的JSON错误
+func (s *apiServer) writeJSONError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.WithPrincess(map[string]string{
+		"error": message,
+	}, s.cfg.Branding()))
+}
+
+// recovery 将处理器中的panic转换为500错误，避免单个请求导致连接被直接断开
+// 响应中的correlation_id与日志和Sentry事件中的一致，调用方报告问题时提供该ID即可找到对应的堆栈。
+// http.ErrAbortHandler是有意中止响应的信号，继续向上传递。
+func (s *apiServer) recovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			id := s.reportPanic(r.Context(), v, r)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(models.WithPrincess(map[string]string{
+				"error":          "服务器内部错误",
+				"code":           "internal",
+				"correlation_id": id,
+				"request_id":     logger.RequestID(r.Context()),
+			}, s.cfg.Branding()))
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// reportPanic 记录panic的堆栈，配置了Sentry时同时上报，返回本次panic的关联ID
+// 请求中发生的panic以请求ID作为关联ID，后台任务中的panic使用新生成的ID。
+// 必须在recover所在的延迟函数中直接调用，才能取得引发panic时的调用栈。
+//
+// 参数:
+//   - ctx: 发生panic的请求或任务的上下文
+//   - v: recover()返回的值
+//   - r: 发生panic的请求，不在请求处理器中时为nil
+//
+// 返回:
+//   - string: 关联ID
+func (s *apiServer) reportPanic(ctx context.Context, v interface{}, r *http.Request) string {
+	id := logger.RequestID(ctx)
+	if id == "" {
+		id = newRequestID()
+	}
+	attrs := []any{"correlation_id", id, "panic", v, "stack", string(debug.Stack())}
+	if r != nil {
+		attrs = append(attrs, "method", r.Method, "path", r.URL.Path)
+	}
+	s.log.Error("发生panic", attrs...)
+
+	// 每次上报使用独立的hub，标签和请求信息不会影响其他请求的上报；事件由SDK在后台发送
+	if s.cfg.Sentry != nil {
+		hub := s.cfg.Sentry.Clone()
+		hub.ConfigureScope(func(scope *sentry.Scope) {
+			scope.SetTag("correlation_id", id)
+			if r != nil {
+				scope.SetRequest(sentryRequest(r))
+			}
+		})
+		hub.Recover(v)
+	}
+	return id
+}
+
+// sentryRequest 返回上报Sentry时附带的请求副本，只保留User-Agent请求头，不上报API密钥、管理员密钥等请求头
+func sentryRequest(r *http.Request) *http.Request {
+	req := r.Clone(context.Background())
+	req.Header = http.Header{"User-Agent": r.Header.Values("User-Agent")}
+	return req
+}
+
+// requestIDHeader 传递请求ID的请求头和响应头
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength 接受的调用方请求ID的最大长度
+const maxRequestIDLength = 128
+
+// assignRequestID 为每个请求分配请求ID，放入请求上下文并通过X-Request-ID响应头返回
+// 请求带有有效的X-Request-ID头时沿用调用方的ID，便于与网关或调用方自己的日志关联，否则生成新的ID。
+// 查询过程中的日志、查询结果和错误响应中的request_id都是这个ID。
+func assignRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logger.WithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID 检查调用方提供的请求ID，只接受不含空白的可打印ASCII字符，避免污染日志
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// logFor 返回附带请求ID的日志记录器，ctx中没有请求ID时返回s.log
+func (s *apiServer) logFor(ctx context.Context) *slog.Logger {
+	if id := logger.RequestID(ctx); id != "" {
+		return s.log.With("request_id", id)
+	}
+	return s.log
+}
+
+// newRequestID 生成32位十六进制的请求ID
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// instrument 按路径和状态码统计请求数
+// 启用追踪时为每个请求记录一个服务端区间，请求带有traceparent头时加入调用方的追踪，
+// 查询过程中的区间都是它的子区间。
+//
+// 参数:
+//   - path: 统计和追踪使用的路由名称，如 /query/{ip}
+func (s *apiServer) instrument(path string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, span := s.cfg.Tracer().Start(tracing.Extract(r.Context(), r.Header), r.Method+" "+path,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.request.method", r.Method),
+					attribute.String("http.route", path),
+					attribute.String("url.path", r.URL.Path),
+					attribute.String("client.address", s.clientIP(r)),
+					attribute.String("pong0.request_id", logger.RequestID(r.Context())),
+				))
+
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r.WithContext(ctx))
+			metrics.HTTPRequests.WithLabelValues(path, strconv.Itoa(rec.status)).Inc()
+
+			span.SetAttributes(attribute.Int("http.response.status_code", rec.status))
+			if rec.status >= 500 {
+				tracing.SetError(span, fmt.Errorf("HTTP %d", rec.status))
+			}
+			span.End()
+		})
+	}
+}
+
+// cors 允许浏览器跨域调用接口，并直接响应OPTIONS预检请求
+//
+// 参数:
+//   - methods: 允许的请求方法，OPTIONS会自动加入
+func cors(methods ...string) Middleware {
+	allowMethods := strings.Join(append(methods, "OPTIONS"), ", ")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Access-Control-Allow-Methods", allowMethods)
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+			if r.Method == "OPTIONS" {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// when 创建只对满足条件的请求生效的中间件，其他请求直接交给下一个处理器
+//
+// 参数:
+//   - cond: 判断请求是否需要经过中间件
+//   - mws: 满足条件时依次经过的中间件，顺序与Chain相同
+//
+// 返回:
+//   - Middleware: 按条件组合的中间件
+func when(cond func(r *http.Request) bool, mws ...Middleware) Middleware {
+	return func(next http.Handler) http.Handler {
+		chained := Chain(next, mws...)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if cond(r) {
+				chained.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// allowMethods 拒绝其他请求方法，返回405
+//
+// 参数:
+//   - methods: 允许的请求方法
+func (s *apiServer) allowMethods(methods ...string) Middleware {
+	message := "仅支持" + strings.Join(methods, "和") + "请求"
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, m := range methods {
+				if r.Method == m {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			s.writeJSONError(w, http.StatusMethodNotAllowed, message)
+		})
+	}
+}
+
+// requireAPIKey 验证API密钥，未配置任何API密钥时总是允许，规则见checkAPIKey
+func (s *apiServer) requireAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !s.checkAPIKey(w, r) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimit 每个请求按一次查询计入限流配额，规则见checkRateLimit
+// 批量查询按IP数量计算配额，需要先解析请求体，因此在处理器中单独检查。
+func (s *apiServer) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !s.checkRateLimit(w, r, 1) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validateClientIP 检查调用方IP是否为有效的IP，用于查询调用方自己的 /myip?full=1
+// 代理头可能被伪造成任意内容，无效时返回400；放在限流之前，无效的请求不消耗限流额度。
+func (s *apiServer) validateClientIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if clientIP := s.clientIP(r); net.ParseIP(clientIP) == nil {
+			s.writeJSONError(w, http.StatusBadRequest, "无法识别调用方IP: "+clientIP)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validatePathIP 检查 /query/{ip} 路径中的IP
+// 路径中包含多级时返回404，IP格式无效时返回400；放在限流之前，无效的请求不消耗限流额度。
+func (s *apiServer) validatePathIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := strings.TrimPrefix(r.URL.Path, "/query/")
+		if strings.Contains(ip, "/") {
+			s.writeJSONError(w, http.StatusNotFound, "未找到: "+r.URL.Path)
+			return
+		}
+		if ip != "" && net.ParseIP(ip) == nil {
+			s.writeJSONError(w, http.StatusBadRequest, "无效的IP地址: "+ip)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"ping0/internal/models"
+)
+
+// handleMyIP 返回调用方的公网IP
+// GET /myip 默认以纯文本返回IP（便于 curl 直接使用），请求头 Accept 包含 application/json
+// 或带有 format=json 参数时返回 {"ip": "..."}。这一形式不访问Ping0.cc，不需要API密钥，也不计入限流。
+// 带有 full=1 参数时对调用方IP执行完整查询，返回与 /query 相同的结果，此时与 /query 一样经过审计日志、
+// API密钥验证和限流中间件（见routes）。
+func (s *apiServer) handleMyIP(w http.ResponseWriter, r *http.Request) {
+	clientIP := s.clientIP(r)
+
+	if fullMyIP(r) {
+		w.Header().Set("Content-Type", "application/json")
+		s.respondQuery(w, r, clientIP)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(models.WithPrincess(map[string]string{
+			"ip": clientIP,
+		}, s.cfg.Branding()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(clientIP + "\n"))
+}
+
+// fullMyIP 判断/myip请求是否带有full=1参数，即对调用方IP执行完整查询
+func fullMyIP(r *http.Request) bool {
+	v := r.URL.Query().Get("full")
+	return v == "1" || v == "true"
+}
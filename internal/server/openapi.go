@@ -0,0 +1,67 @@
+package server
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"ping0/internal/constants"
+	"ping0/internal/models"
+)
+
+// openAPISpec 是API的OpenAPI 3文档，修改接口时需要同步更新openapi.json
+// 文档中的info.version固定为dev，返回时替换为当前程序版本。
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// swaggerUIPage 是Swagger UI页面，从CDN加载Swagger UI并读取/openapi.json
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+  <meta charset="utf-8">
+  <title>Pong0 API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: "/openapi.json", dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>
+`
+
+// handleOpenAPI 返回API的OpenAPI文档，文档中的版本号替换为当前程序版本
+func (s *apiServer) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(bytes.Replace(openAPISpec, []byte(`"version": "dev"`), []byte(fmt.Sprintf(`"version": %q`, constants.Version)), 1))
+}
+
+// handleSchema 返回查询结果（IPInfo）的JSON Schema，便于调用方生成校验器和其他语言的类型定义
+func (s *apiServer) handleSchema(w http.ResponseWriter, r *http.Request) {
+	schema, err := models.IPInfoSchemaJSON()
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(models.WithPrincess(map[string]string{
+			"error": "生成JSON Schema失败: " + err.Error(),
+		}, s.cfg.Branding()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(schema)
+}
+
+// handleDocs 返回Swagger UI页面
+func (s *apiServer) handleDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, swaggerUIPage)
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ping0/internal/core"
+	perrors "ping0/internal/errors"
+	"ping0/internal/store"
+)
+
+// serverWriteTimeout 服务器默认的写超时，timeout参数超过该值时会相应延长本次响应的写截止时间
+const serverWriteTimeout = 10 * time.Second
+
+// queryContext 根据请求的timeout、nocache和tag查询参数创建查询上下文
+// timeout为本次查询的总超时时间，可以是Go时间格式（如 2s、1m30s）或秒数（如 5），
+// 超过服务器允许的最长查询时间时按最长时间处理；nocache=1时不使用缓存的结果，也不复用已保存的访问密钥，
+// 本次查询重新完成握手和POW计算；tag为与结果一起保存到历史记录的标签，见core.WithTag。
+// 上下文中还带有用量统计使用的API密钥名称，见recordUsage。
+//
+// 参数:
+//   - w: 响应，timeout较长时用于延长写截止时间
+//   - r: 请求
+//
+// 返回:
+//   - context.Context: 查询使用的上下文
+//   - context.CancelFunc: 查询结束后必须调用的取消函数
+//   - error: 参数格式无效时返回相应错误
+func (s *apiServer) queryContext(w http.ResponseWriter, r *http.Request) (context.Context, context.CancelFunc, error) {
+	ctx := context.WithValue(r.Context(), usageKeyCtx{}, s.usageKeyName(r))
+	query := r.URL.Query()
+
+	if v := query.Get("nocache"); v == "1" || v == "true" {
+		ctx = core.WithoutSessionReuse(ctx)
+		ctx = context.WithValue(ctx, cacheBypassKey{}, true)
+	}
+
+	tag := query.Get("tag")
+	if err := store.CheckTag(tag); err != nil {
+		return nil, nil, fmt.Errorf("无效的tag参数: %w", err)
+	}
+	ctx = core.WithTag(ctx, tag)
+
+	value := query.Get("timeout")
+	if value == "" {
+		return ctx, func() {}, nil
+	}
+
+	timeout, err := parseTimeout(value)
+	if err != nil {
+		return nil, nil, err
+	}
+	if limit := s.cfg.QueryTimeoutLimit(); timeout > limit {
+		s.logFor(ctx).Debug("timeout参数超过服务器允许的最长查询时间", "timeout", timeout, "limit", limit)
+		timeout = limit
+	}
+
+	// 超时时间长于服务器的写超时时，延长本次响应的写截止时间，留出写出错误信息的余量
+	if timeout > serverWriteTimeout {
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + serverWriteTimeout)); err != nil {
+			s.log.Debug("无法延长写超时", "error", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, cancel, nil
+}
+
+// parseTimeout 解析timeout参数，支持Go时间格式和秒数
+func parseTimeout(value string) (time.Duration, error) {
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, convErr := strconv.ParseFloat(value, 64)
+		if convErr != nil {
+			return 0, fmt.Errorf("无效的timeout参数 %q，需要时间（如 5s）或秒数", value)
+		}
+		timeout = time.Duration(seconds * float64(time.Second))
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("timeout参数必须大于0")
+	}
+	return timeout, nil
+}
+
+// deadlineError 查询因timeout参数设置的截止时间到达而失败时，将错误标记为ErrTimeout
+// 排队等待等环节直接返回context.DeadlineExceeded，标记后才能被映射为504和timeout代码。
+func deadlineError(ctx context.Context, err error) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return perrors.Wrap(perrors.ErrTimeout, err)
+	}
+	return err
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"net/http"
+
+	"ping0/internal/asn"
+	"ping0/internal/models"
+	"ping0/internal/pong0pb"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// handleProtoSchema 返回Protocol Buffers响应的消息定义，调用方可以用protoc生成各语言的解码代码
+func (s *apiServer) handleProtoSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(pong0pb.Schema)
+}
+
+// marshalProto 编码Protocol Buffers消息，map字段按键排序，相同的结果总是得到相同的编码
+func marshalProto(m proto.Message) ([]byte, error) {
+	return proto.MarshalOptions{Deterministic: true}.Marshal(m)
+}
+
+// ipInfoProto 将查询结果转换为IPInfo消息
+func ipInfoProto(info *models.IPInfo) *pong0pb.IPInfo {
+	msg := &pong0pb.IPInfo{
+		Ip:             info.IP,
+		Ptr:            info.PTR,
+		IpLocation:     info.IPLocation,
+		CountryCode:    info.CountryCode,
+		Country:        info.Country,
+		Region:         info.Region,
+		City:           info.City,
+		Asn:            info.ASN,
+		AsnNumber:      int64(info.ASNNumber),
+		AsnOwner:       info.ASNOwner,
+		AsnType:        info.ASNType,
+		Organization:   info.Organization,
+		OrgType:        info.OrgType,
+		Longitude:      info.Longitude,
+		Latitude:       info.Latitude,
+		Lon:            info.Lon,
+		Lat:            info.Lat,
+		IpType:         info.IPType,
+		RiskValue:      info.RiskValue,
+		RiskScore:      int64(info.RiskScore),
+		RiskLabel:      info.RiskLabel,
+		NativeIp:       info.NativeIP,
+		CountryFlag:    info.CountryFlag,
+		Source:         info.Source,
+		FallbackReason: info.FallbackReason,
+		RequestId:      info.RequestID,
+		Princess:       info.Princess,
+		MissingFields:  info.MissingFields,
+		RiskFactors:    info.RiskFactors,
+		Prefix:         info.Prefix,
+		Ipv4:           info.IPv4,
+		Ipv6:           info.IPv6,
+		DataUpdated:    info.DataUpdated,
+		QueriedAt:      info.QueriedAt,
+		RedactedFields: info.RedactedFields,
+	}
+	if info.ASNRegistry != nil {
+		msg.AsnRegistry = asnRegistryProto(info.ASNRegistry)
+	}
+	for i := range info.Sources {
+		msg.Sources = append(msg.Sources, sourceProto(&info.Sources[i]))
+	}
+	// age_seconds和parse_quality是optional字段，取值为0时也要写出
+	if info.AgeSeconds != nil {
+		msg.AgeSeconds = proto.Int64(int64(*info.AgeSeconds))
+	}
+	if info.ParseQuality != nil {
+		msg.ParseQuality = proto.Int64(int64(*info.ParseQuality))
+	}
+	for _, w := range info.Warnings {
+		msg.Warnings = append(msg.Warnings, &pong0pb.ParseWarning{Field: w.Field, Code: w.Code, Message: w.Message})
+	}
+	for _, part := range info.LocationParts {
+		msg.LocationParts = append(msg.LocationParts, &pong0pb.LocationPart{Kind: part.Kind, Name: part.Name})
+	}
+	return msg
+}
+
+// asnRegistryProto 将ASN注册信息转换为ASNRegistry消息
+func asnRegistryProto(reg *asn.Info) *pong0pb.ASNRegistry {
+	return &pong0pb.ASNRegistry{
+		Number:   int64(reg.Number),
+		Name:     reg.Name,
+		Country:  reg.Country,
+		Registry: reg.Registry,
+	}
+}
+
+// sourceProto 将附加数据源的结果转换为Source消息
+func sourceProto(src *models.Source) *pong0pb.Source {
+	return &pong0pb.Source{
+		Name:         src.Name,
+		CountryCode:  src.CountryCode,
+		Country:      src.Country,
+		Region:       src.Region,
+		City:         src.City,
+		Lat:          src.Lat,
+		Lon:          src.Lon,
+		AsnNumber:    int64(src.ASNNumber),
+		AsnOwner:     src.ASNOwner,
+		Organization: src.Organization,
+		Disagrees:    src.Disagrees,
+		Error:        src.Error,
+	}
+}
+
+// errorProto 将单IP查询的错误转换为Error消息
+func errorProto(fields map[string]string) *pong0pb.Error {
+	return &pong0pb.Error{
+		Error:     fields["error"],
+		Code:      fields["code"],
+		RequestId: fields["request_id"],
+		Princess:  fields["princess"],
+	}
+}
+
+// batchProto 将批量查询的结果转换为BatchResponse消息
+// results中的元素为*models.IPInfo或batchError，与JSON响应相同。
+func batchProto(results []interface{}) *pong0pb.BatchResponse {
+	msg := &pong0pb.BatchResponse{Results: make([]*pong0pb.BatchResult, 0, len(results))}
+	for _, result := range results {
+		item := &pong0pb.BatchResult{}
+		switch t := result.(type) {
+		case *models.IPInfo:
+			item.Result = &pong0pb.BatchResult_Info{Info: ipInfoProto(t)}
+		case batchError:
+			item.Result = &pong0pb.BatchResult_Error{Error: &pong0pb.BatchError{
+				Ip:            t.IP,
+				Error:         t.Error,
+				Code:          t.Code,
+				CorrelationId: t.CorrelationID,
+				RequestId:     t.RequestID,
+				Princess:      t.Princess,
+			}}
+		}
+		msg.Results = append(msg.Results, item)
+	}
+	return msg
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"ping0/internal/metrics"
+)
+
+// pruneInterval 两次按保留时间清理之间的间隔
+const pruneInterval = time.Hour
+
+// startPruning 在后台定期删除超过保留时间的历史记录、批量查询任务和审计日志
+// 启动后立即清理一次，之后每隔pruneInterval清理一次，直到ctx结束。
+// 没有配置历史记录数据库和审计日志时不启动。
+func (s *apiServer) startPruning(ctx context.Context) {
+	if s.cfg.History == nil && s.cfg.Audit == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(pruneInterval)
+		defer ticker.Stop()
+		for {
+			s.prune(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// prune 执行一次清理
+// 已过期的批量查询任务总是删除；历史记录和审计日志只在设置了保留时间时删除。
+func (s *apiServer) prune(ctx context.Context) {
+	now := time.Now()
+	if s.cfg.History != nil {
+		if s.cfg.HistoryRetention > 0 {
+			n, err := s.cfg.History.PruneHistory(ctx, now.Add(-s.cfg.HistoryRetention))
+			s.recordPrune("history", n, err)
+		}
+		n, err := s.cfg.History.PruneJobs(ctx)
+		s.recordPrune("jobs", n, err)
+	}
+	if s.cfg.Audit != nil && s.cfg.AuditRetention > 0 {
+		n, err := s.cfg.Audit.Prune(ctx, now.Add(-s.cfg.AuditRetention))
+		s.recordPrune("audit_log", n, err)
+	}
+}
+
+// recordPrune 记录一张表的清理结果
+func (s *apiServer) recordPrune(table string, n int64, err error) {
+	if err != nil {
+		s.log.Warn("按保留时间清理失败", "table", table, "error", err)
+		return
+	}
+	if n > 0 {
+		metrics.PrunedRows.WithLabelValues(table).Add(float64(n))
+		s.log.Info("已按保留时间清理过期记录", "table", table, "rows", n)
+	}
+}
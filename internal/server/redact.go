@@ -0,0 +1,56 @@
+package server
+
+import (
+	"ping0/internal/auth"
+	"ping0/internal/models"
+	"ping0/internal/monitor"
+)
+
+// redactInfo 按API密钥的脱敏策略（redact和omit）处理查询结果
+// 单个密钥（-k）、客户端证书和未配置密钥的请求没有脱敏策略，结果原样返回。
+// 脱敏在签名之前进行，签名覆盖的是客户端实际收到的字段。
+func redactInfo(key *auth.Key, info *models.IPInfo) *models.IPInfo {
+	if key == nil || info == nil {
+		return info
+	}
+	return info.Redact(key.Redact, key.Omit)
+}
+
+// redactResult 按API密钥的脱敏策略处理批量查询的单个结果，失败项原样返回
+func redactResult(key *auth.Key, result interface{}) interface{} {
+	if info, ok := result.(*models.IPInfo); ok {
+		return redactInfo(key, info)
+	}
+	return result
+}
+
+// redactEvent 按API密钥的脱敏策略处理变化事件
+// 变化前后的结果都会脱敏，被清空或移除的字段的变化从changes中去掉。
+//
+// 返回:
+//   - monitor.Event: 脱敏后的事件
+//   - bool: 去掉被脱敏的字段后是否还有变化，没有时不应推送该事件
+func redactEvent(key *auth.Key, event monitor.Event) (monitor.Event, bool) {
+	if key == nil || (len(key.Redact) == 0 && len(key.Omit) == 0) {
+		return event, true
+	}
+
+	hidden := make(map[string]bool, len(key.Redact)+len(key.Omit))
+	for _, name := range key.Redact {
+		hidden[name] = true
+	}
+	for _, name := range key.Omit {
+		hidden[name] = true
+	}
+
+	changes := make([]monitor.Change, 0, len(event.Changes))
+	for _, change := range event.Changes {
+		if !hidden[change.Field] {
+			changes = append(changes, change)
+		}
+	}
+	event.Changes = changes
+	event.Previous = redactInfo(key, event.Previous)
+	event.Current = redactInfo(key, event.Current)
+	return event, len(changes) > 0
+}
@@ -4,100 +4,320 @@
 package server
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"math"
 	"net"
 	"net/http"
+	"net/netip"
+	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
+	"ping0/internal/auth"
+	"ping0/internal/config"
 	"ping0/internal/constants"
 	"ping0/internal/core"
+	perrors "ping0/internal/errors"
+	"ping0/internal/logfile"
+	"ping0/internal/logger"
+	"ping0/internal/metrics"
+	"ping0/internal/models"
+	"ping0/internal/parser"
+	"ping0/internal/ratelimit"
+	"ping0/internal/stats"
 )
 
+// apiServer 保存API服务器处理请求时需要的状态
+// 所有处理器都是其方法，从而避免依赖包级全局变量
+type apiServer struct {
+	cfg           *config.Config    // 服务器配置，在请求处理过程中只读
+	clientLimiter ratelimit.Allower // 按客户端IP限流，未启用时为nil
+	globalLimiter ratelimit.Allower // 全局限流，未启用时为nil
+	proxies       []netip.Prefix    // 可信代理，只有来自这些地址的请求才读取X-Forwarded-For
+	cache         *resultCache      // 查询结果缓存，未启用时为nil
+	watch         *watchHub         // WebSocket订阅管理
+	jobs          *jobStore         // 后台执行的批量查询任务
+	usage         *stats.Usage      // 最近一小时的查询用量统计
+	log           *slog.Logger      // 带组件标签的日志记录器
+}
+
+// newAPIServer 根据配置创建API服务器的状态，包括限流器和结果缓存
+func newAPIServer(cfg *config.Config) *apiServer {
+	s := &apiServer{cfg: cfg, log: cfg.Log("server"), usage: stats.NewUsage()}
+	s.jobs = newJobStore(cfg.JobRetentionTime(), s.queryOne)
+	proxies, err := ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		// 命令行和配置文件中的值已在启动时检查，这里只可能来自嵌入方，忽略全部代理头
+		s.log.Error("可信代理配置无效，忽略X-Forwarded-For", "error", err)
+	}
+	s.proxies = proxies
+	// 配置了限流Redis时在Redis中计数，全局配额按上游站点区分，连接同一上游的全部副本共用
+	switch {
+	case cfg.RateLimit > 0 && cfg.RateStore != nil:
+		s.clientLimiter = ratelimit.NewSharedPerMinute(cfg.RateStore, "pong0:rate:client:", cfg.RateLimit, s.log)
+	case cfg.RateLimit > 0:
+		s.clientLimiter = ratelimit.NewPerMinute(cfg.RateLimit)
+	}
+	switch {
+	case cfg.GlobalRateLimit > 0 && cfg.RateStore != nil:
+		s.globalLimiter = ratelimit.NewSharedPerMinute(cfg.RateStore, "pong0:rate:global:"+cfg.BaseURL, cfg.GlobalRateLimit, s.log)
+	case cfg.GlobalRateLimit > 0:
+		s.globalLimiter = ratelimit.NewPerMinute(cfg.GlobalRateLimit)
+	}
+	s.watch = newWatchHub(cfg, s.globalLimiter)
+	if cfg.CacheTTL > 0 {
+		s.cache = newResultCache(cfg.CacheTTL, cfg.CacheSoftTTL)
+	}
+	return s
+}
+
+// Handler 创建包含全部API路由和中间件的HTTP处理器，但不监听端口
+// 供嵌入方把API挂载到自己的HTTP服务器上，配置中的Middleware会加入每个路由的中间件链。
+// 访问日志和优雅退出由StartServer负责，使用Handler时不启用。
+//
+// 参数:
+//   - cfg: 服务器配置
+//
+// 返回:
+//   - http.Handler: API处理器
+func Handler(cfg *config.Config) http.Handler {
+	return newAPIServer(cfg).routes()
+}
+
+// routes 注册全部路由
+// 每个路由的中间件链依次为：分配请求ID、panic恢复、指标和追踪、配置中的自定义中间件、路由自己的中间件（CORS、
+// 请求方法、审计日志、API密钥、限流等），最后才是处理器，因此处理器中只剩下解析参数和查询的逻辑。
+func (s *apiServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	handle := func(pattern, name string, h http.HandlerFunc, mws ...Middleware) {
+		chain := []Middleware{assignRequestID, s.recovery, s.instrument(name)}
+		chain = append(chain, s.cfg.Middleware...)
+		mux.Handle(pattern, Chain(h, append(chain, mws...)...))
+	}
+
+	handle("/query", "/query", s.handleIPQuery,
+		cors("POST", "GET"), s.allowMethods("POST", "GET"), s.audited, s.requireAPIKey, s.rateLimit)
+	handle("/query/", "/query/{ip}", s.handlePathQuery,
+		cors("GET"), s.allowMethods("GET"), s.audited, s.requireAPIKey, s.validatePathIP, s.rateLimit)
+	handle("/query/batch", "/query/batch", s.handleBatchQuery,
+		cors("POST"), s.allowMethods("POST"), s.audited, s.requireAPIKey)
+	handle("/jobs", "/jobs", s.handleCreateJob, cors("POST"), s.allowMethods("POST"), s.audited, s.requireAPIKey)
+	handle("/jobs/", "/jobs/{id}", s.handleJob, cors("GET"), s.allowMethods("GET"), s.requireAPIKey)
+	// 只返回调用方IP的/myip不访问Ping0.cc，不记录审计日志、不验证API密钥也不计入限流；full=1时与/query相同
+	handle("/myip", "/myip", s.handleMyIP, cors("GET"), s.allowMethods("GET"),
+		when(fullMyIP, s.audited, s.requireAPIKey, s.validateClientIP, s.rateLimit))
+	handle("/ws", "/ws", s.handleWatch, s.allowMethods("GET"), s.audited, s.requireAPIKey, s.rateLimit)
+	handle("/history", "/history", s.handleHistory, s.allowMethods("GET"), s.audited, s.requireAPIKey)
+	handle("/history/export", "/history/export", s.handleHistoryExport, s.allowMethods("GET"), s.audited, s.requireAPIKey)
+	handle("/admin/audit", "/admin/audit", s.handleAudit, s.allowMethods("GET"), s.audited)
+	handle("/stats", "/stats", s.handleStats, cors("GET"), s.allowMethods("GET"))
+	handle("/openapi.json", "/openapi.json", s.handleOpenAPI, cors("GET"))
+	handle("/pong0.proto", "/pong0.proto", s.handleProtoSchema, cors("GET"))
+	handle("/schema", "/schema", s.handleSchema, cors("GET"))
+	if s.cfg.Docs {
+		handle("/docs", "/docs", s.handleDocs)
+	}
+	mux.Handle("/metrics", metrics.Handler())
+	return mux
+}
+
 // StartServer 启动HTTP API服务器
 // 该函数配置并启动一个HTTP服务器，提供IP信息查询API。
 // 它设置路由处理器、超时配置，并监听指定端口。
 //
+// 参数:
+//   - cfg: 服务器配置，包括端口、API密钥等
+//
+// 返回:
+//   - error: 如果服务器启动失败则返回相应错误
+func StartServer(cfg *config.Config) error {
+	// 监听退出信号，收到SIGINT或SIGTERM后优雅退出；之后恢复默认处理，再次按Ctrl+C可以直接退出
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	return Serve(ctx, cfg, nil)
+}
+
+// Serve 启动HTTP API服务器，直到ctx结束后优雅退出
+// 与StartServer相同，但由调用方决定何时退出，供作为系统服务运行时响应服务管理器的停止请求。
+//
+// 参数:
+//   - ctx: 结束时停止接受新连接，并等待进行中的请求完成
+//   - cfg: 服务器配置，包括端口、API密钥等
+//   - ready: 开始监听端口后调用，可以为nil，用于通知服务管理器服务已就绪
+//
 // 返回:
 //   - error: 如果服务器启动失败则返回相应错误
-func StartServer() error {
+func Serve(ctx context.Context, cfg *config.Config, ready func()) error {
+	s := newAPIServer(cfg)
+
 	// 设置服务器地址
-	serverAddr := fmt.Sprintf(":%s", constants.APIPort)
+	serverAddr := fmt.Sprintf(":%s", cfg.APIPort)
 
 	// 端口检测
-	if !isPortAvailable(constants.APIPort) {
-		return fmt.Errorf("端口 %s 已被占用，请使用 -p 参数指定其他端口", constants.APIPort)
+	if !isPortAvailable(s.log, cfg.APIPort) {
+		return fmt.Errorf("端口 %s 已被占用，请使用 -p 参数指定其他端口", cfg.APIPort)
 	}
 
-	// 设置路由
-	http.HandleFunc("/query", handleIPQuery)
-
 	// 打印启动信息
-	fmt.Printf("Pong0 v%s 服务器模式已启动，监听端口 %s\n", constants.Version, constants.APIPort)
+	s.log.Info("服务器模式已启动", "version", constants.Version, "port", cfg.APIPort)
+
+	if cfg.APIKey != "" {
+		s.log.Info("已启用API密钥验证")
+	}
+
+	if cfg.APIKeys != nil {
+		s.log.Info("已加载API密钥文件", "keys", cfg.APIKeys.Len())
+	}
+
+	tlsConfig, err := s.tlsConfig()
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		s.log.Info("已启用HTTPS", "cert", cfg.TLSCert)
+	}
+	if cfg.ClientCA != "" {
+		s.log.Info("已启用客户端证书验证（mTLS）", "client_ca", cfg.ClientCA, "required", !s.hasAPIKeys())
+	}
+
+	if s.clientLimiter != nil || s.globalLimiter != nil {
+		s.log.Info("已启用限流", "per_client_per_minute", cfg.RateLimit, "global_per_minute", cfg.GlobalRateLimit, "shared", cfg.RateStore != nil)
+	}
+
+	if cfg.TracerProvider != nil {
+		s.log.Info("已启用分布式追踪", "otlp_endpoint", cfg.OTLPEndpoint)
+	}
 
-	if constants.APIKey != "" && constants.Verbose {
-		fmt.Println("已启用API密钥验证")
+	if cfg.Queue != nil {
+		s.log.Info("已启用查询并发限制", "concurrency", cfg.Concurrency, "queue_depth", cfg.QueueDepth)
 	}
 
-	fmt.Println("服务器已准备就绪，按Ctrl+C停止服务...")
+	if cfg.Docs {
+		s.log.Info("已启用Swagger UI", "path", "/docs")
+	}
+
+	s.log.Info("服务器已准备就绪，按Ctrl+C停止服务...")
+
+	// 启用访问日志，访问日志在所有中间件的最外层，被拒绝的请求同样会被记录
+	handler := s.routes()
+	if cfg.AccessLog != "" {
+		file, err := logfile.Open(cfg.AccessLog, cfg.AccessLogMaxSize, cfg.AccessLogBackups)
+		if err != nil {
+			return fmt.Errorf("打开访问日志失败: %w", err)
+		}
+		defer file.Close()
+		handler = s.accessLog(file, cfg.AccessLogFormat)(handler)
+		s.log.Info("已启用访问日志", "path", cfg.AccessLog, "format", cfg.AccessLogFormat)
+	}
 
 	// 添加超时设置
 	server := &http.Server{
 		Addr:         serverAddr,
+		Handler:      handler,
 		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		WriteTimeout: serverWriteTimeout,
 		IdleTimeout:  120 * time.Second,
+		TLSConfig:    tlsConfig,
+	}
+	// WebSocket连接已脱离HTTP服务器的管理，关闭时需要单独断开
+	server.RegisterOnShutdown(s.watch.close)
+	// 取消后台的批量查询任务，使事件流结束，不阻塞服务器关闭
+	server.RegisterOnShutdown(s.jobs.close)
+
+	// 启动服务器，端口监听成功后才算就绪
+	listener, err := net.Listen("tcp", serverAddr)
+	if err != nil {
+		return fmt.Errorf("服务器启动失败: %v", err)
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		if tlsConfig != nil {
+			// 证书已在TLSConfig中加载
+			errCh <- server.ServeTLS(listener, "", "")
+			return
+		}
+		errCh <- server.Serve(listener)
+	}()
+	if ready != nil {
+		ready()
 	}
+	// 在后台完成一次握手，不阻塞服务器启动
+	go s.warmup(ctx)
+	s.startPruning(ctx)
 
-	// 启动服务器
-	if err := server.ListenAndServe(); err != nil {
+	select {
+	case err := <-errCh:
 		return fmt.Errorf("服务器启动失败: %v", err)
+	case <-ctx.Done():
 	}
 
-	return nil
+	return s.shutdown(server)
 }
 
-// handleIPQuery 处理IP查询请求
-func handleIPQuery(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+// warmup 服务器启动后完成一次握手并验证访问密钥，密钥保存后第一次查询即可直接复用
+// 密钥算法已失效时立即记录错误日志，而不是等到第一个用户请求失败才发现。
+func (s *apiServer) warmup(ctx context.Context) {
+	startTime := time.Now()
+	info, err := core.Warmup(ctx, s.cfg)
+	switch {
+	case err == nil:
+		s.log.Info("启动预热完成，访问密钥已被接受", "algorithm", info.Algorithm, "js_path", info.JSPath,
+			"difficulty", info.Difficulty, "elapsed", time.Since(startTime))
+	case ctx.Err() != nil:
+	case errors.Is(err, parser.ErrAlgorithmChanged):
+		s.log.Error("启动预热失败：访问密钥被拒绝，Ping0.cc的密钥算法可能已更新，查询将会失败，请检查是否有新版本", "error", err)
+	default:
+		s.log.Warn("启动预热失败，将在第一次查询时重试", "error", err)
+	}
+}
 
-	// 设置CORS
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+// shutdown 停止接受新连接，并等待进行中的请求在排空超时时间内完成
+// 超时后仍未完成的请求会被强制中断。
+//
+// 参数:
+//   - server: 要关闭的HTTP服务器
+//
+// 返回:
+//   - error: 如果在超时时间内未能完成关闭则返回相应错误
+func (s *apiServer) shutdown(server *http.Server) error {
+	timeout := s.cfg.ShutdownTimeout
+	s.log.Info("收到退出信号，正在等待进行中的请求完成...", "timeout", timeout)
 
-	// 处理OPTIONS请求
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
-	// 仅接受POST或GET请求
-	if r.Method != "POST" && r.Method != "GET" {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error":    "仅支持POST和GET请求",
-			"princess": "https://linux.do/u/amna",
-		})
-		return
+	if err := server.Shutdown(ctx); err != nil {
+		server.Close()
+		return fmt.Errorf("服务器关闭超时，已强制中断剩余请求: %w", err)
 	}
 
-	// 检查API密钥（如果配置了的话）
-	if constants.APIKey != "" {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") || authHeader[7:] != constants.APIKey {
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(map[string]string{
-				"error":    "未授权：无效或缺失的API密钥",
-				"princess": "https://linux.do/u/amna",
-			})
-			return
-		}
-	}
+	s.log.Info("服务器已停止")
+	return nil
+}
+
+// handleIPQuery 处理IP查询请求
+// CORS、请求方法、API密钥和限流（防止公开部署被滥用导致服务器IP被Ping0.cc封禁）由中间件处理。
+func (s *apiServer) handleIPQuery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
 
-	var ipToQuery string
+	var ipToQuery, x1, difficulty string
 
 	// 处理POST请求
 	if r.Method == "POST" {
@@ -108,97 +328,390 @@ func handleIPQuery(w http.ResponseWriter, r *http.Request) {
 			var requestBody map[string]string
 			if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
 				w.WriteHeader(http.StatusBadRequest)
-				json.NewEncoder(w).Encode(map[string]string{
-					"error":    "无法解析请求体：" + err.Error(),
-					"princess": "https://linux.do/u/amna",
-				})
+				json.NewEncoder(w).Encode(models.WithPrincess(map[string]string{
+					"error": "无法解析请求体：" + err.Error(),
+				}, s.cfg.Branding()))
 				return
 			}
 			ipToQuery = requestBody["ip"]
+			x1, difficulty = requestBody["x1"], requestBody["difficulty"]
 		} else {
 			// 处理表单格式请求
 			r.ParseForm()
 			ipToQuery = r.FormValue("ip")
+			x1, difficulty = r.FormValue("x1"), r.FormValue("difficulty")
 		}
 	} else if r.Method == "GET" {
 		// 处理GET请求
 		ipToQuery = r.URL.Query().Get("ip")
 	}
 
-	// 记录处理请求
-	if constants.Verbose {
-		if ipToQuery == "" {
-			log.Printf("处理查询：当前IP")
-		} else {
-			log.Printf("处理IP查询: %s", ipToQuery)
+	// 手动指定验证参数用于在线调试算法变化，需要管理员密钥，结果不读写缓存
+	if x1 != "" || difficulty != "" {
+		if !s.checkAdminKey(w, r, "指定x1或difficulty") {
+			return
 		}
+		s.logFor(r.Context()).Info("使用手动指定的验证参数查询", "x1", x1, "difficulty", difficulty, "client", s.clientIP(r))
+		ctx := core.WithChallengeParams(r.Context(), x1, difficulty)
+		r = r.WithContext(context.WithValue(ctx, cacheSkipKey{}, true))
+	}
+
+	s.respondQuery(w, r, ipToQuery)
+}
+
+// checkAdminKey 检查请求的X-Admin-Key请求头是否与配置的管理员密钥一致
+// 未配置管理员密钥时总是拒绝。密钥不一致时返回403状态码。
+//
+// 参数:
+//   - action: 需要管理员密钥的操作，用于错误信息和日志，如“读取审计日志”
+//
+// 返回:
+//   - bool: 请求是否允许继续处理
+func (s *apiServer) checkAdminKey(w http.ResponseWriter, r *http.Request, action string) bool {
+	if s.isAdmin(r) {
+		return true
+	}
+	s.logFor(r.Context()).Info("拒绝未授权的管理请求", "action", action, "client", s.clientIP(r))
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(models.WithPrincess(map[string]string{
+		"error": "禁止访问：" + action + "需要有效的管理员密钥（X-Admin-Key）",
+	}, s.cfg.Branding()))
+	return false
+}
+
+// isAdmin 判断请求是否带有与配置一致的管理员密钥，未配置管理员密钥时返回false
+func (s *apiServer) isAdmin(r *http.Request) bool {
+	return s.cfg.AdminKey != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Admin-Key")), []byte(s.cfg.AdminKey)) == 1
+}
+
+// handlePathQuery 处理路径参数形式的IP查询请求
+// GET /query/1.1.1.1 查询指定IP，GET /query/ 查询当前IP，与 /query?ip= 的结果相同。
+// 路径中的IP已由validatePathIP检查过。
+func (s *apiServer) handlePathQuery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	s.respondQuery(w, r, strings.TrimPrefix(r.URL.Path, "/query/"))
+}
+
+// respondQuery 执行查询并按协商的格式（JSON、XML或JSONP）写出结果或错误
+//
+// 参数:
+//   - w: 响应
+//   - r: 请求，其上下文用于在客户端断开时取消查询
+//   - ipToQuery: 要查询的IP，为空时查询当前IP
+func (s *apiServer) respondQuery(w http.ResponseWriter, r *http.Request, ipToQuery string) {
+	w.Header().Add("Vary", "Accept")
+	format, status, err := negotiateFormat(r)
+	if err != nil {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(models.WithPrincess(map[string]string{
+			"error": err.Error(),
+		}, s.cfg.Branding()))
+		return
+	}
+	format.sign = s.signed
+	format.branding = s.cfg.Branding()
+
+	// 记录处理请求
+	setQueriedIP(r, ipToQuery)
+	if ipToQuery == "" {
+		s.logFor(r.Context()).Debug("处理查询：当前IP", "client", s.clientIP(r))
+	} else {
+		s.logFor(r.Context()).Debug("处理IP查询", "ip", ipToQuery, "client", s.clientIP(r))
+	}
+
+	// 执行IP查询，使用请求上下文以便客户端断开时取消查询
+	// 每次查询都会创建独立的会话，多个请求之间不共享状态，可以并行处理
+	ctx, cancel, err := s.queryContext(w, r)
+	if err != nil {
+		format.writeError(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return
 	}
+	defer cancel()
 
-	// 执行IP查询，确保传递IP参数
-	ipInfo, err := core.ProcessIPInfo(ipToQuery)
+	ipInfo, err := s.lookup(ctx, ipToQuery)
 	if err != nil {
-		if constants.Verbose {
-			log.Printf("查询失败: %v", err)
+		err = deadlineError(ctx, err)
+		s.recordUsage(ctx, ipToQuery, err)
+		s.logFor(r.Context()).Warn("查询失败", "ip", ipToQuery, "error", err)
+		status := statusForError(err)
+		if status == http.StatusServiceUnavailable {
+			w.Header().Set("Retry-After", strconv.Itoa(overloadRetryAfter))
 		}
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error":    err.Error(),
-			"princess": "https://linux.do/u/amna",
+		format.writeError(w, status, map[string]string{
+			"error":      err.Error(),
+			"code":       perrors.Code(err),
+			"request_id": logger.RequestID(r.Context()),
 		})
 		return
 	}
 
-	// 返回结果
-	w.WriteHeader(http.StatusOK)
-	// 确保IPInfo结构体有Princess字段
-	if ipInfo.Princess == "" {
-		ipInfo.Princess = "https://linux.do/u/amna"
+	// 返回结果，缓存的结果通过Age响应头和age_seconds字段说明已缓存的时间
+	if ipInfo.AgeSeconds != nil {
+		w.Header().Set("Age", strconv.Itoa(*ipInfo.AgeSeconds))
+	}
+	// 查询当前IP时在访问日志、审计日志和用量统计中记录实际查询到的IP
+	if ipToQuery == "" {
+		setQueriedIP(r, ipInfo.IP)
+	}
+	s.recordUsage(ctx, ipInfo.IP, nil)
+
+	// 缓存中保存的是同一个结果，写入请求ID前先复制
+	result := *ipInfo
+	result.RequestID = logger.RequestID(r.Context())
+	// 按配置设置Princess字段
+	result.Princess = models.Princess(s.cfg.Branding())
+	if err := format.write(w, http.StatusOK, "ip_info", redactInfo(s.requestKey(r), &result)); err != nil {
+		s.logFor(r.Context()).Debug("写出查询结果失败", "error", err)
 	}
-	json.NewEncoder(w).Encode(ipInfo)
 }
 
-// isPortAvailable 检查端口是否可用
-func isPortAvailable(port string) bool {
-	// 尝试监听指定端口，与服务器相同的地址
-	addr := fmt.Sprintf(":%s", port)
-	server, err := net.Listen("tcp", addr)
+// overloadRetryAfter 查询队列已满时建议客户端等待的秒数
+const overloadRetryAfter = 5
 
-	// 如果有错误，说明端口不可用
-	if err != nil {
-		// 输出详细的错误信息
-		if constants.Verbose {
-			log.Printf("端口检测失败: %v", err)
-		}
+// statusForError 根据错误类别返回对应的HTTP状态码
+//
+// 参数:
+//   - err: 查询过程返回的错误
+//
+// 返回:
+//   - int: 超时返回504，上游限流返回429，网络错误、上游拒绝、验证失败和解析失败返回502，
+//     查询队列已满返回503，其他错误返回500
+func statusForError(err error) int {
+	switch perrors.Class(err) {
+	case perrors.ErrOverloaded:
+		return http.StatusServiceUnavailable
+	case perrors.ErrTimeout:
+		return http.StatusGatewayTimeout
+	case perrors.ErrRateLimited:
+		return http.StatusTooManyRequests
+	case perrors.ErrNetwork, perrors.ErrUpstreamBlocked, perrors.ErrChallengeFailed, perrors.ErrParseFailure:
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// hasAPIKeys 是否配置了API密钥（单个密钥或密钥文件）
+func (s *apiServer) hasAPIKeys() bool {
+	return s.cfg.APIKey != "" || s.cfg.APIKeys != nil
+}
+
+// checkAPIKey 检查请求是否携带了有效的API密钥
+// 未配置任何API密钥时总是允许。同时配置了单个密钥（-k）和密钥文件（-keys）时，两者都可以使用。
+// 启用mTLS（-client-ca）时，持有已验证客户端证书的请求不需要API密钥。
+// 密钥无效时返回401状态码，客户端IP不在密钥允许的范围内时返回403状态码。
+//
+// 返回:
+//   - bool: 请求是否允许继续处理
+func (s *apiServer) checkAPIKey(w http.ResponseWriter, r *http.Request) bool {
+	// 客户端证书已在TLS握手时由配置的CA验证，访问日志中以证书名称代替密钥名称
+	if name := clientCertName(r); name != "" {
+		setKeyName(r, "cert:"+name)
+		return true
+	}
+	if !s.hasAPIKeys() {
+		return true
+	}
+
+	token := bearerToken(r)
+	if s.cfg.APIKey != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.APIKey)) == 1 {
+		return true
+	}
+
+	key := s.requestKey(r)
+	if key == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(models.WithPrincess(map[string]string{
+			"error": "未授权：无效或缺失的API密钥",
+		}, s.cfg.Branding()))
 		return false
 	}
+	setKeyName(r, key.Name)
 
-	// 成功监听，关闭并返回true
-	server.Close()
+	if clientIP := s.clientIP(r); !key.Allows(clientIP) {
+		s.logFor(r.Context()).Info("客户端IP不在API密钥允许的范围内", "key", key.Name, "client", clientIP)
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(models.WithPrincess(map[string]string{
+			"error": "禁止访问：客户端IP不允许使用该API密钥",
+		}, s.cfg.Branding()))
+		return false
+	}
+	return true
+}
+
+// bearerToken 返回Authorization请求头中的Bearer令牌，没有时返回空字符串
+func bearerToken(r *http.Request) string {
+	authHeader := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return ""
+	}
+	return authHeader[7:]
+}
+
+// requestKey 返回请求使用的多密钥配置中的API密钥，未启用密钥文件或密钥不存在时返回nil
+func (s *apiServer) requestKey(r *http.Request) *auth.Key {
+	if s.cfg.APIKeys == nil {
+		return nil
+	}
+	return s.cfg.APIKeys.Lookup(bearerToken(r))
+}
+
+// checkRateLimit 检查请求是否超出限流配额
+// 先检查客户端IP（见clientIP）的配额，再检查全局配额，最后检查API密钥当天的配额。超出配额时返回429状态码，
+// 并通过Retry-After头告知客户端需要等待的秒数。
+//
+// 参数:
+//   - n: 本次请求包含的查询次数，批量查询按IP数量计算
+//
+// 返回:
+//   - bool: 请求是否允许继续处理
+func (s *apiServer) checkRateLimit(w http.ResponseWriter, r *http.Request, n int) bool {
+	if retryAfter, message := s.takeQuota(r.Context(), s.clientIP(r), s.requestKey(r), n); retryAfter > 0 {
+		s.writeTooManyRequests(w, retryAfter, message)
+		return false
+	}
 	return true
 }
 
-// getClientIP 获取客户端IP地址
-func getClientIP(r *http.Request) string {
-	// 尝试从X-Forwarded-For获取
-	xForwardedFor := r.Header.Get("X-Forwarded-For")
-	if xForwardedFor != "" {
-		// X-Forwarded-For可能包含多个IP，取第一个
-		ips := strings.Split(xForwardedFor, ",")
-		return strings.TrimSpace(ips[0])
+// burstLimit 返回启用限流时一次请求最多可以计入的查询次数，即客户端和全局每分钟配额中较小的一个，未启用限流时返回0
+// 令牌桶最多积攒一分钟的配额，超过这个数量的请求无论等待多久都不会被放行，应直接拒绝而不是返回429。
+func (s *apiServer) burstLimit() int {
+	limit := 0
+	for _, n := range []int{s.cfg.RateLimit, s.cfg.GlobalRateLimit} {
+		if n > 0 && (limit == 0 || n < limit) {
+			limit = n
+		}
+	}
+	return limit
+}
+
+// takeQuota 为n次查询扣除客户端、全局和API密钥的配额，规则见checkRateLimit
+// WebSocket订阅没有可以返回429的HTTP响应，直接使用该函数按订阅的IP数量计算配额。
+//
+// 参数:
+//   - ctx: 请求上下文，用于日志
+//   - client: 客户端IP（见clientIP）
+//   - key: 请求使用的API密钥，没有时为nil
+//   - n: 查询次数
+//
+// 返回:
+//   - int: 超出配额时需要等待的秒数，允许时为0
+//   - string: 超出配额时的错误信息
+func (s *apiServer) takeQuota(ctx context.Context, client string, key *auth.Key, n int) (int, string) {
+	allowed, wait := true, time.Duration(0)
+	if s.clientLimiter != nil {
+		allowed, wait = s.clientLimiter.AllowN(client, n)
+	}
+	if allowed && s.globalLimiter != nil {
+		allowed, wait = s.globalLimiter.AllowN("", n)
+	}
+	if !allowed {
+		retryAfter := retryAfterSeconds(wait)
+		s.logFor(ctx).Info("请求被限流", "client", client, "retry_after", retryAfter)
+		return retryAfter, fmt.Sprintf("请求过于频繁，请在 %d 秒后重试", retryAfter)
+	}
+
+	return s.useKeyQuota(ctx, key, n)
+}
+
+// useKeyQuota 为n次查询扣除API密钥当天的配额，key为nil时总是允许
+//
+// 返回:
+//   - int: 配额不足时距离配额重置需要等待的秒数，允许时为0
+//   - string: 配额不足时的错误信息
+func (s *apiServer) useKeyQuota(ctx context.Context, key *auth.Key, n int) (int, string) {
+	if key == nil {
+		return 0, ""
+	}
+	if allowed, wait := s.cfg.APIKeys.Use(key, n); !allowed {
+		retryAfter := retryAfterSeconds(wait)
+		s.logFor(ctx).Info("API密钥当天的配额已用完", "key", key.Name, "daily_quota", key.DailyQuota, "retry_after", retryAfter)
+		return retryAfter, fmt.Sprintf("API密钥当天的配额（%d 次）已用完，配额在UTC零点重置", key.DailyQuota)
+	}
+	return 0, ""
+}
+
+// waitRateLimit 依次等待客户端和全局限流器各放行一次查询，ctx结束时立即返回
+// 后台任务逐个查询时使用：令牌不足时等待补充而不是拒绝，因此任务的IP数量不受每分钟配额的限制。
+//
+// 参数:
+//   - ctx: 任务的上下文
+//   - client: 创建任务的客户端IP（见clientIP）
+func (s *apiServer) waitRateLimit(ctx context.Context, client string) {
+	for _, l := range []struct {
+		limiter ratelimit.Allower
+		key     string
+	}{{s.clientLimiter, client}, {s.globalLimiter, ""}} {
+		if l.limiter == nil {
+			continue
+		}
+		for {
+			allowed, wait := l.limiter.AllowN(l.key, 1)
+			if allowed {
+				break
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
 	}
+}
 
-	// 尝试从X-Real-IP获取
-	xRealIP := r.Header.Get("X-Real-IP")
-	if xRealIP != "" {
-		return xRealIP
+// retryAfterSeconds 将等待时间向上取整为秒数，至少为1秒
+func retryAfterSeconds(wait time.Duration) int {
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
 	}
+	return retryAfter
+}
+
+// writeTooManyRequests 返回429状态码，并通过Retry-After头告知客户端需要等待的秒数
+func (s *apiServer) writeTooManyRequests(w http.ResponseWriter, retryAfter int, message string) {
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(models.WithPrincess(map[string]string{
+		"error": message,
+	}, s.cfg.Branding()))
+}
+
+// statusRecorder 包装http.ResponseWriter以记录响应状态码
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader 记录状态码并转发给底层ResponseWriter
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap 返回底层ResponseWriter，供http.ResponseController使用
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// isPortAvailable 检查端口是否可用
+func isPortAvailable(log *slog.Logger, port string) bool {
+	// 尝试监听指定端口，与服务器相同的地址
+	addr := fmt.Sprintf(":%s", port)
+	server, err := net.Listen("tcp", addr)
 
-	// 如果上述都没有，使用RemoteAddr
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	// 如果有错误，说明端口不可用
 	if err != nil {
-		// 如果无法解析，直接返回RemoteAddr
-		return r.RemoteAddr
+		// 输出详细的错误信息
+		log.Error("端口检测失败", "error", err)
+		return false
 	}
 
-	return ip
+	// 成功监听，关闭并返回true
+	server.Close()
+	return true
 }
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// signatureField 响应签名字段的名称
+const signatureField = "signature"
+
+// signObject 为JSON对象计算HMAC-SHA256签名并添加signature字段
+// 签名的内容是去掉signature字段后对象的规范JSON（见canonicalJSON），
+// 调用方按相同规则重新序列化收到的对象即可验证，不依赖字段顺序和空白。
+//
+// 参数:
+//   - key: 签名密钥
+//   - v: 要签名的结果，序列化后必须是JSON对象
+//
+// 返回:
+//   - map[string]interface{}: 添加了signature字段的对象，序列化时字段按名称排序
+//   - error: 如果结果无法序列化或不是JSON对象则返回相应错误
+func signObject(key string, v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("转换为JSON失败: %w", err)
+	}
+
+	// 数字保留原文，避免经过float64转换后与原结果不一致
+	var obj map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&obj); err != nil || obj == nil {
+		return nil, fmt.Errorf("只能为JSON对象签名")
+	}
+	delete(obj, signatureField)
+
+	payload, err := canonicalJSON(obj)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(payload)
+	obj[signatureField] = hex.EncodeToString(mac.Sum(nil))
+	return obj, nil
+}
+
+// canonicalJSON 返回签名使用的规范JSON：对象的字段按名称排序，没有空白，
+// 非ASCII字符按UTF-8原样输出，不转义<、>和&
+func canonicalJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, fmt.Errorf("转换为JSON失败: %w", err)
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// signed 配置了签名密钥时返回添加了signature字段的结果，否则原样返回
+// 签名失败时记录日志并返回未签名的结果，调用方验证时会发现缺少签名。
+func (s *apiServer) signed(v interface{}) interface{} {
+	if s.cfg.SigningKey == "" {
+		return v
+	}
+	obj, err := signObject(s.cfg.SigningKey, v)
+	if err != nil {
+		s.log.Warn("为响应签名失败", "error", err)
+		return v
+	}
+	return obj
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"ping0/internal/client"
+	"ping0/internal/models"
+	"ping0/internal/stats"
+)
+
+// maxStatsTop /stats的top参数允许的最大值
+const maxStatsTop = 100
+
+// statsResponse GET /stats的响应：各阶段统计、最近一小时的查询用量和初始页面引用的脚本指纹
+type statsResponse struct {
+	stats.Snapshot
+	Usage   stats.UsageSnapshot        `json:"usage"`             // 最近一小时的查询用量，top_ips和keys只返回给带有管理员密钥的请求
+	Scripts []client.ScriptFingerprint `json:"scripts,omitempty"` // 已下载的脚本指纹，known为false说明Ping0.cc可能更换了脚本
+}
+
+// handleStats 返回查询流程各阶段的耗时和成功率统计
+// GET /stats 不需要API密钥，与 /metrics 一样用于运维排查：对比上游请求（初始页面、最终页面）
+// 和本地计算（POW、解析）的耗时，判断查询变慢的原因；脚本指纹用于确认Ping0.cc是否更换了计算密钥的脚本。
+// usage中的查询次数和按错误类别的失败率对所有请求可见；查询最多的IP（数量由 ?top=10 指定）
+// 和每个API密钥的查询次数会暴露使用方的信息，只在请求带有有效的X-Admin-Key时返回。
+func (s *apiServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	top := stats.DefaultTopN
+	if v := r.URL.Query().Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxStatsTop {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(models.WithPrincess(map[string]string{
+				"error": "top参数必须是1到" + strconv.Itoa(maxStatsTop) + "之间的整数",
+			}, s.cfg.Branding()))
+			return
+		}
+		top = n
+	}
+
+	usage := s.usage.Snapshot(top)
+	if !s.isAdmin(r) {
+		usage.TopIPs, usage.Keys = nil, nil
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(statsResponse{
+		Snapshot: s.cfg.Stats.Snapshot(),
+		Usage:    usage,
+		Scripts:  client.ScriptFingerprints(s.cfg),
+	})
+}
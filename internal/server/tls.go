@@ -0,0 +1,73 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// tlsConfig 根据配置创建HTTPS服务器的TLS配置，未配置证书时返回nil
+// 配置了客户端CA时启用mTLS：没有配置任何API密钥时所有连接都必须提供有效的客户端证书；
+// 配置了API密钥时客户端证书是可选的，没有证书的请求仍然可以使用API密钥，见checkAPIKey。
+//
+// 返回:
+//   - *tls.Config: TLS配置，以HTTP提供服务时为nil
+//   - error: 如果证书和私钥只配置了一个、客户端CA缺少服务器证书或文件无法加载则返回相应错误
+func (s *apiServer) tlsConfig() (*tls.Config, error) {
+	cfg := s.cfg
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return nil, fmt.Errorf("-tls-cert 和 -tls-key 必须同时指定")
+	}
+	if cfg.TLSCert == "" {
+		if cfg.ClientCA != "" {
+			return nil, fmt.Errorf("-client-ca 需要同时指定 -tls-cert 和 -tls-key，客户端证书只能在HTTPS连接中验证")
+		}
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("加载TLS证书失败: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if cfg.ClientCA == "" {
+		return tlsConfig, nil
+	}
+
+	data, err := os.ReadFile(cfg.ClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("读取客户端CA证书失败: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("客户端CA证书文件中没有有效的PEM证书: %s", cfg.ClientCA)
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	if !s.hasAPIKeys() {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// clientCertName 返回请求中已验证的客户端证书的名称，没有客户端证书时返回空字符串
+// 名称优先使用证书主题的CommonName，没有时使用第一个DNS名称或证书序列号。
+func clientCertName(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	switch {
+	case cert.Subject.CommonName != "":
+		return cert.Subject.CommonName
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	default:
+		return cert.SerialNumber.String()
+	}
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	perrors "ping0/internal/errors"
+)
+
+// usageKeyCtx 查询上下文中用量统计使用的API密钥名称的键
+type usageKeyCtx struct{}
+
+// usageKeyName 返回请求在用量统计中使用的API密钥名称
+// 密钥文件中的密钥使用其名称，客户端证书使用cert:加证书名称，与访问日志一致；
+// 单个密钥（-k）和未配置密钥的请求为"-"。
+func (s *apiServer) usageKeyName(r *http.Request) string {
+	if name := clientCertName(r); name != "" {
+		return "cert:" + name
+	}
+	if key := s.requestKey(r); key != nil {
+		return key.Name
+	}
+	return "-"
+}
+
+// recordUsage 在用量统计中记录一次查询
+//
+// 参数:
+//   - ctx: 由queryContext创建的查询上下文，其中带有API密钥名称
+//   - ip: 查询的IP
+//   - err: 查询失败时的错误，成功时为nil
+func (s *apiServer) recordUsage(ctx context.Context, ip string, err error) {
+	key, _ := ctx.Value(usageKeyCtx{}).(string)
+	if key == "" {
+		key = "-"
+	}
+	code := ""
+	if err != nil {
+		code = perrors.Code(err)
+	}
+	s.usage.Record(ip, key, code)
+}
@@ -0,0 +1,464 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"ping0/internal/auth"
+	"ping0/internal/config"
+	"ping0/internal/models"
+	"ping0/internal/monitor"
+	"ping0/internal/output"
+	"ping0/internal/ratelimit"
+	"ping0/internal/websocket"
+)
+
+const (
+	// maxWatchIPs 单个WebSocket连接最多订阅的IP数量
+	maxWatchIPs = maxBatchSize
+
+	// maxWatchConns 服务器同时保持的WebSocket连接数量上限
+	maxWatchConns = 256
+
+	// maxWatchedIPs 全部连接合计订阅的不同IP数量上限，即监控器定期查询的IP数量上限
+	maxWatchedIPs = 1000
+
+	// maxWatchMessage 客户端消息的最大字节数
+	maxWatchMessage = 64 * 1024
+
+	// watchPingInterval 向客户端发送ping的间隔，用于保持连接和发现已断开的客户端
+	watchPingInterval = 30 * time.Second
+
+	// watchSendBuffer 每个连接等待发送的消息数量上限，超过时认为客户端读取过慢并断开连接
+	watchSendBuffer = 64
+)
+
+// watchRequest 客户端发送的订阅请求
+type watchRequest struct {
+	Action string   `json:"action"` // subscribe或unsubscribe
+	IPs    []string `json:"ips"`    // 要订阅或取消订阅的IP
+}
+
+// watchMessage 服务器推送给客户端的消息，type为subscribed、snapshot、change或error
+type watchMessage struct {
+	Type     string         `json:"type"`
+	IPs      *[]string      `json:"ips,omitempty"`   // subscribed：当前订阅的全部IP，没有订阅时为空数组
+	IP       string         `json:"ip,omitempty"`    // snapshot：IP
+	Info     *models.IPInfo `json:"info,omitempty"`  // snapshot：监控最近一次的查询结果
+	Event    *monitor.Event `json:"event,omitempty"` // change：IP属性变化事件
+	Error    string         `json:"error,omitempty"` // error：错误信息
+	Princess string         `json:"princess,omitempty"`
+}
+
+// watchClient 一个订阅了IP变化的WebSocket连接
+type watchClient struct {
+	conn *websocket.Conn
+	send chan []byte         // 等待发送的消息
+	ips  map[string]struct{} // 订阅的IP，由watchHub.mu保护
+	key  *auth.Key           // 建立连接时使用的API密钥，推送的结果按其脱敏策略处理
+	done chan struct{}       // 连接断开后关闭
+	once sync.Once
+
+	client string // 客户端IP，新订阅的IP按它计入限流
+
+	princess string // 错误消息中的Princess字段，关闭时为空
+}
+
+// close 关闭连接，可以多次调用
+func (c *watchClient) close(code int, reason string) {
+	c.once.Do(func() {
+		close(c.done)
+		c.conn.Close(code, reason)
+	})
+}
+
+// watchHub 管理WebSocket订阅，并用一个共享的监控器定期查询所有被订阅的IP
+// 多个连接订阅同一个IP时只查询一次；没有连接订阅的IP从监控列表中移除。
+type watchHub struct {
+	mon *monitor.Monitor
+	log *slog.Logger
+
+	princess string // 错误消息中的Princess字段，关闭时为空
+
+	ctx    context.Context // 监控器的生命周期，close时取消
+	cancel context.CancelFunc
+	start  sync.Once
+
+	mu      sync.Mutex
+	subs    map[string]map[*watchClient]struct{} // IP到订阅它的连接
+	clients map[*watchClient]struct{}
+	conns   int // 已建立和正在握手的连接数量，见acquire
+}
+
+// newWatchHub 创建订阅管理器，监控器在第一次订阅时才开始运行
+// 监控器使用配置中的monitor_interval作为查询间隔，但不发送Webhook通知。
+// 启用全局限流时监控器的每次查询同样计入全局配额，超出配额的IP在本轮跳过，下一轮再查询。
+//
+// 参数:
+//   - cfg: 服务器配置
+//   - global: 全局限流器，未启用全局限流时为nil
+func newWatchHub(cfg *config.Config, global ratelimit.Allower) *watchHub {
+	monitorCfg := *cfg
+	monitorCfg.Webhook = ""
+
+	mon := monitor.New(&monitorCfg, nil)
+	if global != nil {
+		mon.Allow = func(string) bool {
+			allowed, _ := global.AllowN("", 1)
+			return allowed
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &watchHub{
+		mon:      mon,
+		log:      cfg.Log("watch"),
+		princess: models.Princess(cfg.Branding()),
+		ctx:      ctx,
+		cancel:   cancel,
+		subs:     make(map[string]map[*watchClient]struct{}),
+		clients:  make(map[*watchClient]struct{}),
+	}
+}
+
+// subscribe 为连接订阅IP，返回连接当前订阅的全部IP，ips中不能有重复的IP
+// 连接新订阅的IP数量先交给charge计入限流和API密钥配额，charge返回错误时不订阅任何IP。
+// charge可能访问Redis，调用时不持有锁；之后重新检查订阅数量上限，期间其他连接占满名额时已计入的配额不退还。
+func (h *watchHub) subscribe(c *watchClient, ips []string, charge func(n int) error) ([]string, error) {
+	h.mu.Lock()
+	added, err := h.checkSubscribe(c, ips)
+	h.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if added > 0 {
+		if err := charge(added); err != nil {
+			return nil, err
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, err := h.checkSubscribe(c, ips); err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		c.ips[ip] = struct{}{}
+		if h.subs[ip] == nil {
+			h.subs[ip] = make(map[*watchClient]struct{})
+			h.mon.Watch(ip)
+		}
+		h.subs[ip][c] = struct{}{}
+	}
+	h.start.Do(func() {
+		go h.mon.Run(h.ctx, h.broadcast)
+	})
+	return h.subscribed(c), nil
+}
+
+// checkSubscribe 检查订阅后是否超出连接和服务器的订阅数量上限，返回连接新订阅的IP数量，调用方需持有锁
+func (h *watchHub) checkSubscribe(c *watchClient, ips []string) (int, error) {
+	added, watched := 0, 0
+	for _, ip := range ips {
+		if _, ok := c.ips[ip]; !ok {
+			added++
+		}
+		if h.subs[ip] == nil {
+			watched++
+		}
+	}
+	if len(c.ips)+added > maxWatchIPs {
+		return 0, fmt.Errorf("每个连接最多订阅%d个IP", maxWatchIPs)
+	}
+	if len(h.subs)+watched > maxWatchedIPs {
+		return 0, fmt.Errorf("服务器订阅的IP已达上限（%d个），请稍后重试", maxWatchedIPs)
+	}
+	return added, nil
+}
+
+// unsubscribe 为连接取消订阅IP，返回连接当前订阅的全部IP
+func (h *watchHub) unsubscribe(c *watchClient, ips []string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, ip := range ips {
+		h.unsubscribeLocked(c, ip)
+	}
+	return h.subscribed(c)
+}
+
+// unsubscribeLocked 取消一个订阅，调用方需持有锁
+func (h *watchHub) unsubscribeLocked(c *watchClient, ip string) {
+	delete(c.ips, ip)
+	if subs := h.subs[ip]; subs != nil {
+		delete(subs, c)
+		if len(subs) == 0 {
+			delete(h.subs, ip)
+			h.mon.Unwatch(ip)
+		}
+	}
+}
+
+// subscribed 返回连接订阅的全部IP，按字母顺序排列，调用方需持有锁
+func (h *watchHub) subscribed(c *watchClient) []string {
+	ips := make([]string, 0, len(c.ips))
+	for ip := range c.ips {
+		ips = append(ips, ip)
+	}
+	slices.Sort(ips)
+	return ips
+}
+
+// acquire 为新连接占用一个名额，连接数量已达maxWatchConns时返回false
+// 名额在握手之前占用，连接断开或握手失败后需要调用release归还。
+func (h *watchHub) acquire() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.conns >= maxWatchConns {
+		return false
+	}
+	h.conns++
+	return true
+}
+
+// release 归还acquire占用的连接名额
+func (h *watchHub) release() {
+	h.mu.Lock()
+	h.conns--
+	h.mu.Unlock()
+}
+
+// add 登记新连接，key为建立连接时使用的API密钥，没有时为nil；client为客户端IP
+func (h *watchHub) add(conn *websocket.Conn, key *auth.Key, client string) *watchClient {
+	c := &watchClient{
+		conn: conn,
+		send: make(chan []byte, watchSendBuffer),
+		ips:  make(map[string]struct{}),
+		key:  key,
+		done: make(chan struct{}),
+
+		client: client,
+
+		princess: h.princess,
+	}
+	h.mu.Lock()
+	h.clients[c] = struct{}{}
+	h.mu.Unlock()
+	return c
+}
+
+// remove 注销连接并取消它的全部订阅
+func (h *watchHub) remove(c *watchClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ip := range c.ips {
+		h.unsubscribeLocked(c, ip)
+	}
+	delete(h.clients, c)
+}
+
+// broadcast 将变化事件推送给订阅了该IP的连接，由监控器在每次发现变化时调用
+// 使用有脱敏策略的API密钥的连接单独转换事件，变化的字段全部被脱敏时不推送。
+func (h *watchHub) broadcast(event monitor.Event) {
+	data, err := json.Marshal(watchMessage{Type: "change", Event: &event})
+	if err != nil {
+		h.log.Warn("转换变化事件失败", "ip", event.IP, "error", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.subs[event.IP] {
+		if c.key == nil {
+			c.push(data)
+			continue
+		}
+		redacted, ok := redactEvent(c.key, event)
+		if !ok {
+			continue
+		}
+		c.reply(watchMessage{Type: "change", Event: &redacted})
+	}
+}
+
+// push 将消息放入发送队列，队列已满时断开读取过慢的客户端
+func (c *watchClient) push(data []byte) {
+	select {
+	case c.send <- data:
+	case <-c.done:
+	default:
+		go c.close(websocket.CloseGoingAway, "客户端读取过慢")
+	}
+}
+
+// close 停止监控器并断开全部连接，在服务器关闭时调用
+func (h *watchHub) close() {
+	h.cancel()
+
+	h.mu.Lock()
+	clients := make([]*watchClient, 0, len(h.clients))
+	for c := range h.clients {
+		clients = append(clients, c)
+	}
+	h.mu.Unlock()
+
+	for _, c := range clients {
+		c.close(websocket.CloseGoingAway, "服务器正在关闭")
+	}
+}
+
+// handleWatch 处理WebSocket订阅请求
+// 客户端可以在URL中用 ?ip=1.1.1.1,8.8.8.8 指定初始订阅，之后发送 {"action":"subscribe","ips":[...]}
+// 或 {"action":"unsubscribe","ips":[...]} 调整订阅。服务器在每次订阅变化后回复subscribed消息，
+// 对已有查询结果的新订阅IP推送snapshot消息，监控器发现风控值、IP类型、原生IP或地理位置变化时推送change消息。
+// 握手本身按一次查询计入限流，之后每个新订阅的IP再计一次；连接数量达到maxWatchConns时返回503。
+func (s *apiServer) handleWatch(w http.ResponseWriter, r *http.Request) {
+	var initial []string
+	if v := r.URL.Query().Get("ip"); v != "" {
+		var err error
+		if initial, err = normalizeWatchIPs(output.ParseColumns(v)); err != nil {
+			s.writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	if !s.watch.acquire() {
+		s.writeJSONError(w, http.StatusServiceUnavailable, fmt.Sprintf("WebSocket连接数量已达上限（%d个），请稍后重试", maxWatchConns))
+		return
+	}
+	defer s.watch.release()
+
+	conn, err := websocket.Upgrade(w, r, maxWatchMessage)
+	if err != nil {
+		s.logFor(r.Context()).Debug("WebSocket握手失败", "error", err)
+		return
+	}
+
+	c := s.watch.add(conn, s.requestKey(r), s.clientIP(r))
+	defer s.watch.remove(c)
+	defer c.close(websocket.CloseNormal, "")
+	log := s.logFor(r.Context()).With("client", c.client)
+	log.Debug("WebSocket连接已建立")
+
+	go s.writeWatch(c, log)
+
+	if len(initial) > 0 {
+		s.handleWatchRequest(r.Context(), c, watchRequest{Action: "subscribe", IPs: initial})
+	}
+	for {
+		data, err := conn.ReadMessage()
+		if err != nil {
+			log.Debug("WebSocket连接已断开", "error", err)
+			return
+		}
+
+		var req watchRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			c.reply(watchMessage{Type: "error", Error: "无法解析消息：" + err.Error()})
+			continue
+		}
+		s.handleWatchRequest(r.Context(), c, req)
+	}
+}
+
+// handleWatchRequest 处理一条订阅或取消订阅请求，ctx为握手请求的上下文
+func (s *apiServer) handleWatchRequest(ctx context.Context, c *watchClient, req watchRequest) {
+	requested, err := normalizeWatchIPs(req.IPs)
+	if err != nil {
+		c.reply(watchMessage{Type: "error", Error: err.Error()})
+		return
+	}
+
+	switch req.Action {
+	case "subscribe":
+		ips, err := s.watch.subscribe(c, requested, func(n int) error {
+			if limit := s.burstLimit(); limit > 0 && n > limit {
+				return fmt.Errorf("启用限流时一次新订阅的IP数量不能超过每分钟的配额（%d个）", limit)
+			}
+			if retryAfter, message := s.takeQuota(ctx, c.client, c.key, n); retryAfter > 0 {
+				return errors.New(message)
+			}
+			return nil
+		})
+		if err != nil {
+			c.reply(watchMessage{Type: "error", Error: err.Error()})
+			return
+		}
+		c.reply(watchMessage{Type: "subscribed", IPs: &ips})
+		for _, ip := range requested {
+			if info := s.watch.mon.Last(ip); info != nil {
+				c.reply(watchMessage{Type: "snapshot", IP: ip, Info: redactInfo(c.key, info)})
+			}
+		}
+	case "unsubscribe":
+		ips := s.watch.unsubscribe(c, requested)
+		c.reply(watchMessage{Type: "subscribed", IPs: &ips})
+	default:
+		c.reply(watchMessage{Type: "error", Error: fmt.Sprintf("未知的action: %q（可选 subscribe、unsubscribe）", req.Action)})
+	}
+}
+
+// reply 将消息放入连接的发送队列
+func (c *watchClient) reply(msg watchMessage) {
+	if msg.Type == "error" {
+		msg.Princess = c.princess
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	c.push(data)
+}
+
+// writeWatch 依次发送连接队列中的消息，并定期发送ping
+func (s *apiServer) writeWatch(c *watchClient, log *slog.Logger) {
+	ticker := time.NewTicker(watchPingInterval)
+	defer ticker.Stop()
+
+	for {
+		var err error
+		select {
+		case <-c.done:
+			return
+		case data := <-c.send:
+			err = c.conn.WriteMessage(data)
+		case <-ticker.C:
+			err = c.conn.Ping()
+		}
+		if err != nil {
+			log.Debug("WebSocket写入失败", "error", err)
+			c.close(websocket.CloseGoingAway, "")
+			return
+		}
+	}
+}
+
+// normalizeWatchIPs 检查订阅的IP列表，并转换为标准形式，使同一个IPv6地址的不同写法对应同一个订阅
+// 重复的IP（包括同一地址的不同写法）只保留第一个，不会重复计入订阅数量和限流配额。
+func normalizeWatchIPs(ips []string) ([]string, error) {
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("ips不能为空")
+	}
+	normalized := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		parsed := net.ParseIP(strings.TrimSpace(ip))
+		if parsed == nil {
+			return nil, fmt.Errorf("无效的IP地址: %s", ip)
+		}
+		if s := parsed.String(); !slices.Contains(normalized, s) {
+			normalized = append(normalized, s)
+		}
+	}
+	return normalized, nil
+}
@@ -0,0 +1,188 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatedTimeLayout 轮转后的文件名中的时间格式
+const rotatedTimeLayout = "20060102-150405"
+
+// fileSink 追加写入本地文件的输出，按大小或日期轮转
+// 轮转时当前文件重命名为 <文件名>-<开始写入的时间>.<扩展名>，如 ip-20260101-080000.ndjson，
+// 然后在原路径创建新文件，读取方总是可以从原路径读取最新的记录。
+type fileSink struct {
+	path    string
+	maxSize int64 // 单个文件的最大字节数，为0时不按大小轮转
+	daily   bool  // 是否在日期变化时轮转
+	keep    int   // 保留的历史文件数量，为0时全部保留
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	started time.Time // 当前文件开始写入的时间
+}
+
+// openFileSink 打开文件输出，文件已存在时追加写入
+//
+// 参数:
+//   - path: 文件路径
+//   - q: 轮转选项（max_size、daily、keep），可以为nil
+//
+// 返回:
+//   - Sink: 文件输出
+//   - error: 如果选项无效或无法打开文件则返回相应错误
+func openFileSink(path string, q url.Values) (Sink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("输出文件路径不能为空")
+	}
+
+	s := &fileSink{path: path}
+	if q != nil {
+		maxSizeMB, err := intOption(q, "max_size", 0)
+		if err != nil {
+			return nil, err
+		}
+		s.maxSize = int64(maxSizeMB) * 1024 * 1024
+		if s.daily, err = boolOption(q, "daily"); err != nil {
+			return nil, err
+		}
+		if s.keep, err = intOption(q, "keep", 0); err != nil {
+			return nil, err
+		}
+	}
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("创建输出目录失败: %w", err)
+		}
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// open 以追加模式打开当前文件，已有内容时以文件的修改时间作为开始写入的时间，调用方需持有锁或在初始化阶段调用
+func (s *fileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("打开输出文件失败: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("读取输出文件信息失败: %w", err)
+	}
+
+	s.file = file
+	s.size = info.Size()
+	s.started = time.Now()
+	if s.size > 0 {
+		s.started = info.ModTime()
+	}
+	return nil
+}
+
+// Write 写入一行记录，写入前按需轮转
+func (s *fileSink) Write(record []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return os.ErrClosed
+	}
+
+	line := append(bytes.TrimRight(record, "\n"), '\n')
+	if s.size > 0 && s.needsRotate(int64(len(line))) {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+// needsRotate 判断写入n字节前是否需要轮转
+func (s *fileSink) needsRotate(n int64) bool {
+	if s.maxSize > 0 && s.size+n > s.maxSize {
+		return true
+	}
+	if s.daily {
+		y1, m1, d1 := s.started.Date()
+		y2, m2, d2 := time.Now().Date()
+		return y1 != y2 || m1 != m2 || d1 != d2
+	}
+	return false
+}
+
+// rotate 将当前文件重命名为带时间的历史文件并打开新文件，调用方需持有锁
+func (s *fileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("关闭输出文件失败: %w", err)
+	}
+	s.file = nil
+
+	ext := filepath.Ext(s.path)
+	base := strings.TrimSuffix(s.path, ext)
+	rotated := base + "-" + s.started.Format(rotatedTimeLayout) + ext
+	// 同一秒内多次按大小轮转时追加序号，避免覆盖
+	for i := 1; ; i++ {
+		if _, err := os.Stat(rotated); os.IsNotExist(err) {
+			break
+		}
+		rotated = fmt.Sprintf("%s-%s.%d%s", base, s.started.Format(rotatedTimeLayout), i, ext)
+	}
+	if err := os.Rename(s.path, rotated); err != nil {
+		return fmt.Errorf("轮转输出文件失败: %w", err)
+	}
+	s.prune(base, ext)
+
+	return s.open()
+}
+
+// prune 删除超出保留数量的最早的历史文件
+// 带序号的文件名按字典序排列与时间顺序不一致，因此按修改时间排序。
+func (s *fileSink) prune(base, ext string) {
+	if s.keep <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(base + "-[0-9]*" + ext)
+	if err != nil || len(matches) <= s.keep {
+		return
+	}
+	modTimes := make(map[string]time.Time, len(matches))
+	for _, name := range matches {
+		if info, err := os.Stat(name); err == nil {
+			modTimes[name] = info.ModTime()
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return modTimes[matches[i]].Before(modTimes[matches[j]])
+	})
+	for _, old := range matches[:len(matches)-s.keep] {
+		os.Remove(old)
+	}
+}
+
+// Close 关闭文件
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
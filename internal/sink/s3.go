@@ -0,0 +1,212 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3输出的默认参数
+const (
+	defaultS3Batch    = 1000        // 每个对象包含的记录数
+	defaultS3Interval = time.Hour   // 缓冲中最早的记录等待上传的最长时间
+	s3UploadTimeout   = time.Minute // 单次上传的超时时间
+	s3CheckInterval   = time.Minute // 检查缓冲是否超过等待时间的间隔
+)
+
+// s3Sink 将记录分批上传到S3兼容存储的输出
+// 每攒满一批或最早的记录等待超过interval时，将缓冲中的记录作为一个NDJSON对象上传，
+// 对象键为 <前缀>/<UTC时间>-<随机数>.ndjson。上传通过minio-go完成，使用路径形式的地址，
+// 因此同样适用于MinIO、Cloudflare R2等兼容存储。
+type s3Sink struct {
+	client   *minio.Client
+	bucket   string
+	prefix   string
+	batch    int
+	interval time.Duration
+
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	count   int       // 缓冲中的记录数
+	first   time.Time // 缓冲中最早的记录的写入时间
+	lastErr error     // 后台上传的最近一次错误，在下一次Write或Close时返回
+	closed  bool
+	done    chan struct{}
+}
+
+// newS3Sink 根据 s3://bucket/prefix?选项 创建S3输出
+// 选项：endpoint为存储服务地址（默认为AWS_ENDPOINT_URL_S3、AWS_ENDPOINT_URL环境变量或AWS的区域地址），
+// region为区域（默认为AWS_REGION、AWS_DEFAULT_REGION环境变量或us-east-1），
+// batch为每个对象包含的记录数（默认1000），interval为最早的记录等待上传的最长时间（默认1h）。
+func newS3Sink(u *url.URL) (Sink, error) {
+	q := u.Query()
+	s := &s3Sink{
+		bucket: u.Host,
+		prefix: strings.Trim(u.Path, "/"),
+		done:   make(chan struct{}),
+	}
+	if s.bucket == "" {
+		return nil, fmt.Errorf("S3输出缺少存储桶名称，应为 s3://bucket/prefix")
+	}
+	accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf("S3输出需要设置AWS_ACCESS_KEY_ID和AWS_SECRET_ACCESS_KEY环境变量")
+	}
+	region := firstEnv(q.Get("region"), "AWS_REGION", "AWS_DEFAULT_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	endpoint := firstEnv(q.Get("endpoint"), "AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL")
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	e, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil || e.Host == "" || (e.Scheme != "http" && e.Scheme != "https") {
+		return nil, fmt.Errorf("无效的S3地址 %q", endpoint)
+	}
+	if e.Path != "" {
+		return nil, fmt.Errorf("S3地址 %q 不能包含路径", endpoint)
+	}
+	s.client, err = minio.New(e.Host, &minio.Options{
+		Creds:        credentials.NewStaticV4(accessKey, secretKey, os.Getenv("AWS_SESSION_TOKEN")),
+		Secure:       e.Scheme == "https",
+		Region:       region,
+		BucketLookup: minio.BucketLookupPath,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建S3客户端失败: %w", err)
+	}
+
+	if s.batch, err = intOption(q, "batch", defaultS3Batch); err != nil {
+		return nil, err
+	}
+	if s.batch == 0 {
+		s.batch = defaultS3Batch
+	}
+	s.interval = defaultS3Interval
+	if v := q.Get("interval"); v != "" {
+		if s.interval, err = time.ParseDuration(v); err != nil || s.interval <= 0 {
+			return nil, fmt.Errorf("选项 interval 必须是正的时间间隔: %q", v)
+		}
+	}
+
+	go s.run()
+	return s, nil
+}
+
+// firstEnv 返回value，为空时返回第一个非空的环境变量
+func firstEnv(value string, names ...string) string {
+	for _, name := range names {
+		if value != "" {
+			break
+		}
+		value = os.Getenv(name)
+	}
+	return value
+}
+
+// Write 将记录加入缓冲，攒满一批时立即上传
+func (s *s3Sink) Write(record []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return os.ErrClosed
+	}
+	if err := s.lastErr; err != nil {
+		s.lastErr = nil
+		return err
+	}
+
+	if s.count == 0 {
+		s.first = time.Now()
+	}
+	s.buf.Write(bytes.TrimRight(record, "\n"))
+	s.buf.WriteByte('\n')
+	s.count++
+
+	if s.count >= s.batch {
+		return s.flush()
+	}
+	return nil
+}
+
+// run 定期上传等待时间超过interval的缓冲，使记录很少的监控也能按时上传
+func (s *s3Sink) run() {
+	ticker := time.NewTicker(min(s3CheckInterval, s.interval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.count > 0 && time.Since(s.first) >= s.interval {
+				if err := s.flush(); err != nil {
+					s.lastErr = err
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// Close 上传缓冲中剩余的记录
+func (s *s3Sink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+
+	if err := s.flush(); err != nil {
+		return err
+	}
+	return s.lastErr
+}
+
+// flush 将缓冲作为一个对象上传，调用方需持有锁
+// 上传失败时保留缓冲，下一次上传会连同之后的记录一起重试。
+func (s *s3Sink) flush() error {
+	if s.count == 0 {
+		return nil
+	}
+
+	var suffix [4]byte
+	rand.Read(suffix[:])
+	key := fmt.Sprintf("%s-%s.ndjson", time.Now().UTC().Format("20060102T150405Z"), hex.EncodeToString(suffix[:]))
+	if s.prefix != "" {
+		key = s.prefix + "/" + key
+	}
+
+	if err := s.put(key, s.buf.Bytes()); err != nil {
+		return fmt.Errorf("上传 %d 条记录到 s3://%s/%s 失败: %w", s.count, s.bucket, key, err)
+	}
+	s.buf.Reset()
+	s.count = 0
+	return nil
+}
+
+// put 上传一个对象
+func (s *s3Sink) put(key string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s3UploadTimeout)
+	defer cancel()
+	_, err := s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(body), int64(len(body)),
+		minio.PutObjectOptions{ContentType: "application/x-ndjson"})
+	return err
+}
@@ -0,0 +1,113 @@
+// Package sink writes NDJSON records produced by the long-running command line
+// modes (batch, host and watch) to a destination chosen by a single spec
+// string: standard output, a local file that is rotated by size or by day, or
+// an S3-compatible bucket that receives each finished batch as one object.
+// This lets a monitor run unattended without an external log shipper.
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Sink 接收NDJSON记录的输出目标，可以被多个goroutine并发写入
+type Sink interface {
+	// Write 写入一条记录，record不包含末尾的换行符
+	Write(record []byte) error
+	// Close 写出缓冲中的记录并释放资源，之后不能再写入
+	Close() error
+}
+
+// Open 根据输出目标描述打开输出
+// 支持的形式：
+//   - "-" 或空字符串：标准输出
+//   - 文件路径，如 results.ndjson：追加写入本地文件
+//   - file:///var/log/pong0/ip.ndjson?max_size=100&daily=true&keep=30：带轮转选项的本地文件
+//   - s3://bucket/prefix?endpoint=https://minio:9000&region=us-east-1&batch=1000&interval=1h：上传到S3兼容存储
+//
+// 文件的选项：max_size为单个文件的最大大小（MB），daily为true时每天轮转一次，keep为保留的历史文件数量（默认全部保留）。
+// S3的选项见newS3Sink，访问密钥从AWS_ACCESS_KEY_ID、AWS_SECRET_ACCESS_KEY等标准环境变量读取。
+//
+// 参数:
+//   - spec: 输出目标描述
+//
+// 返回:
+//   - Sink: 打开的输出
+//   - error: 如果描述无效或无法打开输出则返回相应错误
+func Open(spec string) (Sink, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "-" {
+		return &writerSink{w: os.Stdout}, nil
+	}
+
+	// 不带协议的描述是文件路径，Windows的盘符（如 C:\out.ndjson）也按路径处理
+	scheme, _, ok := strings.Cut(spec, "://")
+	if !ok || len(scheme) == 1 {
+		return openFileSink(spec, nil)
+	}
+
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("无效的输出目标 %q: %w", spec, err)
+	}
+	switch u.Scheme {
+	case "file":
+		return openFileSink(u.Host+u.Path, u.Query())
+	case "s3":
+		return newS3Sink(u)
+	default:
+		return nil, fmt.Errorf("不支持的输出目标 %q（支持文件路径、file:// 和 s3://）", spec)
+	}
+}
+
+// writerSink 写入io.Writer（标准输出）的输出
+type writerSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// Write 写入一行记录
+func (s *writerSink) Write(record []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.w.Write(append(bytes.TrimRight(record, "\n"), '\n'))
+	return err
+}
+
+// Close 标准输出不需要关闭
+func (s *writerSink) Close() error {
+	return nil
+}
+
+// intOption 读取整数选项，未设置时返回def
+func intOption(q url.Values, name string, def int) (int, error) {
+	v := q.Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("选项 %s 必须是非负整数: %q", name, v)
+	}
+	return n, nil
+}
+
+// boolOption 读取布尔选项，未设置时返回false
+func boolOption(q url.Values, name string) (bool, error) {
+	v := q.Get(name)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("选项 %s 必须是true或false: %q", name, v)
+	}
+	return b, nil
+}
@@ -0,0 +1,204 @@
+// Package stats keeps in-process latency and success statistics for each
+// stage of the lookup pipeline. Unlike the Prometheus metrics, the numbers are
+// meant to be read directly by operators (through /stats or verbose command
+// line output) to tell whether slowness comes from the upstream site or from
+// local work such as the POW calculation and HTML parsing. Usage additionally
+// keeps rolling per-IP, per-key and per-error counters for the API server.
+package stats
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// recentSamples 每个阶段保留的最近耗时样本数，用于计算分位数
+const recentSamples = 256
+
+// Stage 描述查询流程中的一个阶段
+type Stage struct {
+	Name     string // 阶段名称
+	Upstream bool   // 是否为发往上游站点的请求，false表示本地计算
+}
+
+// Registry 按阶段统计耗时和成功率，可以安全地并发使用；nil注册表不记录任何数据
+type Registry struct {
+	started time.Time
+	stages  []Stage
+
+	mu     sync.Mutex
+	totals map[string]*stageTotals
+}
+
+// stageTotals 单个阶段的累计数据
+type stageTotals struct {
+	count    int64
+	failures int64
+	total    time.Duration
+	max      time.Duration
+	last     time.Duration
+	recent   []time.Duration // 最近的耗时样本，环形缓冲区
+	next     int             // 下一个样本在recent中的位置
+}
+
+// StageStats 单个阶段的统计快照，耗时单位为毫秒
+type StageStats struct {
+	Stage       string  `json:"stage"`        // 阶段名称
+	Kind        string  `json:"kind"`         // upstream表示上游站点请求，local表示本地计算
+	Count       int64   `json:"count"`        // 执行次数
+	Failures    int64   `json:"failures"`     // 失败次数
+	SuccessRate float64 `json:"success_rate"` // 成功率（0-1）
+	AvgMs       float64 `json:"avg_ms"`       // 平均耗时
+	P50Ms       float64 `json:"p50_ms"`       // 最近样本的中位数耗时
+	P95Ms       float64 `json:"p95_ms"`       // 最近样本的95分位耗时
+	MaxMs       float64 `json:"max_ms"`       // 最长耗时
+	LastMs      float64 `json:"last_ms"`      // 最近一次的耗时
+}
+
+// Snapshot 某一时刻全部阶段的统计
+type Snapshot struct {
+	Since  time.Time    `json:"since"`  // 开始统计的时间
+	Stages []StageStats `json:"stages"` // 按流程顺序排列的各阶段统计
+}
+
+// New 创建统计注册表
+//
+// 参数:
+//   - stages: 按流程顺序排列的阶段，快照中的顺序与此相同；未列出的阶段排在最后
+//
+// 返回:
+//   - *Registry: 新的统计注册表
+func New(stages ...Stage) *Registry {
+	return &Registry{
+		started: time.Now(),
+		stages:  stages,
+		totals:  make(map[string]*stageTotals),
+	}
+}
+
+// Record 记录一个阶段的一次执行
+//
+// 参数:
+//   - stage: 阶段名称
+//   - elapsed: 耗时
+//   - err: 阶段的执行结果，不为nil时计为失败
+func (r *Registry) Record(stage string, elapsed time.Duration, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.totals[stage]
+	if !ok {
+		t = &stageTotals{recent: make([]time.Duration, 0, recentSamples)}
+		r.totals[stage] = t
+	}
+
+	t.count++
+	if err != nil {
+		t.failures++
+	}
+	t.total += elapsed
+	t.last = elapsed
+	if elapsed > t.max {
+		t.max = elapsed
+	}
+	if len(t.recent) < recentSamples {
+		t.recent = append(t.recent, elapsed)
+	} else {
+		t.recent[t.next] = elapsed
+	}
+	t.next = (t.next + 1) % recentSamples
+}
+
+// Start 开始一个阶段的计时，返回的函数在阶段结束时调用以记录耗时和结果
+//
+// 参数:
+//   - stage: 阶段名称
+//
+// 返回:
+//   - func(error): 记录本次执行的函数
+func (r *Registry) Start(stage string) func(error) {
+	start := time.Now()
+	return func(err error) {
+		r.Record(stage, time.Since(start), err)
+	}
+}
+
+// Snapshot 返回当前的统计快照，只包含执行过至少一次的阶段，nil注册表返回不含任何阶段的快照
+//
+// 返回:
+//   - Snapshot: 统计快照
+func (r *Registry) Snapshot() Snapshot {
+	if r == nil {
+		return Snapshot{Stages: []StageStats{}}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snap := Snapshot{Since: r.started, Stages: []StageStats{}}
+	seen := make(map[string]bool, len(r.totals))
+	for _, stage := range r.stages {
+		seen[stage.Name] = true
+		if t, ok := r.totals[stage.Name]; ok {
+			snap.Stages = append(snap.Stages, t.stats(stage))
+		}
+	}
+
+	var others []string
+	for name := range r.totals {
+		if !seen[name] {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	for _, name := range others {
+		snap.Stages = append(snap.Stages, r.totals[name].stats(Stage{Name: name}))
+	}
+	return snap
+}
+
+// stats 生成阶段的统计快照，调用方必须持有锁
+func (t *stageTotals) stats(stage Stage) StageStats {
+	kind := "local"
+	if stage.Upstream {
+		kind = "upstream"
+	}
+
+	sorted := append([]time.Duration(nil), t.recent...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return StageStats{
+		Stage:       stage.Name,
+		Kind:        kind,
+		Count:       t.count,
+		Failures:    t.failures,
+		SuccessRate: float64(t.count-t.failures) / float64(t.count),
+		AvgMs:       milliseconds(t.total / time.Duration(t.count)),
+		P50Ms:       milliseconds(percentile(sorted, 0.5)),
+		P95Ms:       milliseconds(percentile(sorted, 0.95)),
+		MaxMs:       milliseconds(t.max),
+		LastMs:      milliseconds(t.last),
+	}
+}
+
+// percentile 返回已排序样本的p分位数（最近秩法）
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted))*p+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+// milliseconds 将耗时转换为保留两位小数的毫秒数
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()/10) / 100
+}
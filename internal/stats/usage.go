@@ -0,0 +1,181 @@
+package stats
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// UsageWindow 查询用量统计覆盖的时间范围，更早的查询不再计入
+	UsageWindow = time.Hour
+
+	// usageBuckets 时间范围被划分的分段数，统计按分段整体滚动
+	usageBuckets = 60
+
+	// maxBucketIPs 每个分段最多单独计数的不同IP数量，超过后的新IP只计入总数，避免大量扫描时占用过多内存
+	maxBucketIPs = 10000
+
+	// DefaultTopN 快照中默认列出的查询最多的IP数量
+	DefaultTopN = 10
+)
+
+// Usage 按滚动时间窗口统计API服务器的查询：每个IP和每个API密钥的查询次数，以及按错误类别的失败次数
+// 时间窗口划分为若干分段，每过一个分段丢弃最早的分段，统计只反映最近UsageWindow内的查询。
+// 数据只保存在内存中，服务器重启后重新统计。可以安全地并发使用。
+type Usage struct {
+	bucket time.Duration
+
+	mu      sync.Mutex
+	buckets [usageBuckets]usageBucket
+	now     func() time.Time
+}
+
+// usageBucket 一个时间分段内的计数
+type usageBucket struct {
+	start    time.Time        // 分段的开始时间，零值表示未使用
+	queries  int64            // 查询次数
+	failures int64            // 失败次数
+	ips      map[string]int64 // 每个IP的查询次数
+	keys     map[string]int64 // 每个API密钥的查询次数
+	errors   map[string]int64 // 每个错误类别的失败次数
+}
+
+// Count 一个名称及其计数
+type Count struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// ErrorCount 一个错误类别的失败次数及其在全部查询中的占比
+type ErrorCount struct {
+	Code  string  `json:"code"`  // 错误代码，与API错误响应中的code字段一致
+	Count int64   `json:"count"` // 失败次数
+	Rate  float64 `json:"rate"`  // 占全部查询的比例（0-1）
+}
+
+// UsageSnapshot 最近一个时间窗口内的查询用量
+type UsageSnapshot struct {
+	WindowSeconds int          `json:"window_seconds"`    // 统计覆盖的秒数
+	Queries       int64        `json:"queries"`           // 查询次数，批量查询中每个IP计为一次
+	Failures      int64        `json:"failures"`          // 失败次数
+	ErrorRate     float64      `json:"error_rate"`        // 失败次数占查询次数的比例（0-1）
+	TopIPs        []Count      `json:"top_ips,omitempty"` // 查询次数最多的IP，按次数从多到少排列，没有查询或调用方隐藏时省略
+	Keys          []Count      `json:"keys,omitempty"`    // 每个API密钥的查询次数，按次数从多到少排列，没有查询或调用方隐藏时省略
+	Errors        []ErrorCount `json:"errors"`            // 每个错误类别的失败次数，按次数从多到少排列
+}
+
+// NewUsage 创建覆盖最近UsageWindow的查询用量统计
+//
+// 返回:
+//   - *Usage: 新的用量统计
+func NewUsage() *Usage {
+	return &Usage{bucket: UsageWindow / usageBuckets, now: time.Now}
+}
+
+// Record 记录一次查询
+//
+// 参数:
+//   - ip: 查询的IP，查询当前IP失败时为空字符串，不计入IP排行
+//   - key: 使用的API密钥名称
+//   - code: 失败时的错误代码，成功时为空字符串
+func (u *Usage) Record(ip, key, code string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	b := u.current()
+	b.queries++
+	b.keys[key]++
+	if ip != "" {
+		if _, ok := b.ips[ip]; ok || len(b.ips) < maxBucketIPs {
+			b.ips[ip]++
+		}
+	}
+	if code != "" {
+		b.failures++
+		b.errors[code]++
+	}
+}
+
+// current 返回当前时间所在的分段，分段已过期时先清空，调用方必须持有锁
+func (u *Usage) current() *usageBucket {
+	start := u.now().Truncate(u.bucket)
+	b := &u.buckets[start.UnixNano()/int64(u.bucket)%usageBuckets]
+	if !b.start.Equal(start) {
+		*b = usageBucket{
+			start:  start,
+			ips:    make(map[string]int64),
+			keys:   make(map[string]int64),
+			errors: make(map[string]int64),
+		}
+	}
+	return b
+}
+
+// Snapshot 汇总最近一个时间窗口内的查询用量
+//
+// 参数:
+//   - top: 列出的查询最多的IP数量，不大于0时使用DefaultTopN
+//
+// 返回:
+//   - UsageSnapshot: 用量快照
+func (u *Usage) Snapshot(top int) UsageSnapshot {
+	if top <= 0 {
+		top = DefaultTopN
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	snap := UsageSnapshot{WindowSeconds: int(UsageWindow / time.Second)}
+	ips := make(map[string]int64)
+	keys := make(map[string]int64)
+	errors := make(map[string]int64)
+	oldest := u.now().Truncate(u.bucket).Add(-UsageWindow + u.bucket)
+	for i := range u.buckets {
+		b := &u.buckets[i]
+		if b.start.IsZero() || b.start.Before(oldest) {
+			continue
+		}
+		snap.Queries += b.queries
+		snap.Failures += b.failures
+		for name, n := range b.ips {
+			ips[name] += n
+		}
+		for name, n := range b.keys {
+			keys[name] += n
+		}
+		for name, n := range b.errors {
+			errors[name] += n
+		}
+	}
+
+	if snap.Queries > 0 {
+		snap.ErrorRate = float64(snap.Failures) / float64(snap.Queries)
+	}
+	snap.TopIPs = sortedCounts(ips)
+	if len(snap.TopIPs) > top {
+		snap.TopIPs = snap.TopIPs[:top]
+	}
+	snap.Keys = sortedCounts(keys)
+	snap.Errors = make([]ErrorCount, 0, len(errors))
+	for _, c := range sortedCounts(errors) {
+		snap.Errors = append(snap.Errors, ErrorCount{Code: c.Name, Count: c.Count, Rate: float64(c.Count) / float64(snap.Queries)})
+	}
+	return snap
+}
+
+// sortedCounts 将计数按次数从多到少排列，次数相同时按名称排列
+func sortedCounts(m map[string]int64) []Count {
+	counts := make([]Count, 0, len(m))
+	for name, n := range m {
+		counts = append(counts, Count{Name: name, Count: n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Name < counts[j].Name
+	})
+	return counts
+}
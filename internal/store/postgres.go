@@ -0,0 +1,161 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"ping0/internal/models"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // 以pgx名称注册的PostgreSQL驱动
+)
+
+// postgresSchema PostgreSQL数据库结构，打开数据库时自动创建，与SQLite的结构相同
+// tag列是后来增加的，通过ALTER TABLE添加到旧的表中。
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS history (
+	id         BIGSERIAL PRIMARY KEY,
+	ip         TEXT      NOT NULL,
+	queried_at BIGINT    NOT NULL,
+	risk_value TEXT      NOT NULL DEFAULT '',
+	ip_type    TEXT      NOT NULL DEFAULT '',
+	native_ip  TEXT      NOT NULL DEFAULT '',
+	data       TEXT      NOT NULL
+);
+ALTER TABLE history ADD COLUMN IF NOT EXISTS tag TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_history_ip_time ON history (ip, queried_at);
+CREATE INDEX IF NOT EXISTS idx_history_time ON history (queried_at);
+CREATE INDEX IF NOT EXISTS idx_history_tag_time ON history (tag, queried_at);
+CREATE TABLE IF NOT EXISTS jobs (
+	id         TEXT      PRIMARY KEY,
+	expires_at BIGINT    NOT NULL,
+	data       TEXT      NOT NULL
+);
+`
+
+// postgresStore 基于PostgreSQL的存储，多个服务器副本可以共用同一个数据库
+type postgresStore struct {
+	db *sql.DB
+}
+
+// isPostgresDSN 判断是否是PostgreSQL连接地址（postgres://或postgresql://开头）
+func isPostgresDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")
+}
+
+// openPostgres 连接PostgreSQL数据库并创建需要的表
+// 连接地址的参数与libpq相同，如sslmode和connect_timeout。
+func openPostgres(dsn string) (*postgresStore, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("无效的PostgreSQL连接地址: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if _, err := db.ExecContext(ctx, postgresSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("初始化数据库失败: %w", err)
+	}
+
+	return &postgresStore{db: db}, nil
+}
+
+// Close 关闭数据库连接
+func (s *postgresStore) Close() error {
+	return s.db.Close()
+}
+
+// Save 保存一次查询结果
+func (s *postgresStore) Save(ctx context.Context, info *models.IPInfo, queriedAt time.Time, tag string) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("序列化查询结果失败: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO history (ip, queried_at, risk_value, ip_type, native_ip, tag, data) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		info.IP, queriedAt.UnixMilli(), info.RiskValue, info.IPType, info.NativeIP, tag, string(data))
+	if err != nil {
+		return fmt.Errorf("保存查询结果失败: %w", err)
+	}
+	return nil
+}
+
+// History 返回指定IP的历史查询记录，按查询时间从早到晚排列
+func (s *postgresStore) History(ctx context.Context, ip string, limit int) ([]Record, error) {
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT queried_at, tag, data FROM (
+			SELECT id, queried_at, tag, data FROM history WHERE ip = $1 ORDER BY queried_at DESC, id DESC LIMIT $2
+		) AS recent ORDER BY queried_at ASC, id ASC`,
+		ip, limit)
+	if err != nil {
+		return nil, fmt.Errorf("读取历史记录失败: %w", err)
+	}
+	return scanRecords(rows)
+}
+
+// Export 按保存顺序逐条读取符合条件的历史记录
+func (s *postgresStore) Export(ctx context.Context, q ExportQuery, fn func(Record) error) error {
+	start, end := q.timeRange()
+	return exportPages(func(afterID int64) (*sql.Rows, error) {
+		return s.db.QueryContext(ctx,
+			`SELECT id, queried_at, tag, data FROM history
+			WHERE id > $1 AND queried_at >= $2 AND queried_at < $3 AND ($4 = '' OR tag = $4) ORDER BY id LIMIT $5`,
+			afterID, start, end, q.Tag, exportBatch)
+	}, fn)
+}
+
+// SaveJob 保存已完成的批量查询任务，并删除已过期的任务
+func (s *postgresStore) SaveJob(ctx context.Context, id string, data []byte, expires time.Time) error {
+	if _, err := s.PruneJobs(ctx); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO jobs (id, expires_at, data) VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO UPDATE SET expires_at = excluded.expires_at, data = excluded.data`,
+		id, expires.UnixMilli(), string(data))
+	if err != nil {
+		return fmt.Errorf("保存任务失败: %w", err)
+	}
+	return nil
+}
+
+// Job 返回保存的批量查询任务
+func (s *postgresStore) Job(ctx context.Context, id string) ([]byte, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, `SELECT data FROM jobs WHERE id = $1 AND expires_at >= $2`, id, time.Now().UnixMilli()).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取任务失败: %w", err)
+	}
+	return []byte(data), nil
+}
+
+// PruneHistory 删除查询时间早于before的历史记录
+func (s *postgresStore) PruneHistory(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM history WHERE queried_at < $1`, before.UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("删除过期的历史记录失败: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// PruneJobs 删除已过期的批量查询任务
+func (s *postgresStore) PruneJobs(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM jobs WHERE expires_at < $1`, time.Now().UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("删除过期的任务失败: %w", err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,174 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"ping0/internal/models"
+
+	_ "modernc.org/sqlite" // 纯Go实现的SQLite驱动，无需cgo
+)
+
+// sqliteSchema SQLite数据库结构，打开数据库时自动创建
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS history (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	ip         TEXT    NOT NULL,
+	queried_at INTEGER NOT NULL,
+	risk_value TEXT    NOT NULL DEFAULT '',
+	ip_type    TEXT    NOT NULL DEFAULT '',
+	native_ip  TEXT    NOT NULL DEFAULT '',
+	tag        TEXT    NOT NULL DEFAULT '',
+	data       TEXT    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_history_ip_time ON history (ip, queried_at);
+CREATE INDEX IF NOT EXISTS idx_history_time ON history (queried_at);
+CREATE TABLE IF NOT EXISTS jobs (
+	id         TEXT    PRIMARY KEY,
+	expires_at INTEGER NOT NULL,
+	data       TEXT    NOT NULL
+);
+`
+
+// sqliteStore 基于SQLite的存储
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// openSQLite 打开（必要时创建）SQLite数据库
+func openSQLite(path string) (*sqliteStore, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("创建数据库目录失败: %w", err)
+		}
+	}
+
+	// busy_timeout避免服务器并发写入时立即返回SQLITE_BUSY
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("打开数据库失败: %w", err)
+	}
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("初始化数据库失败: %w", err)
+	}
+
+	// tag列是后来增加的，旧的数据库中没有这一列
+	var n int
+	err = db.QueryRow(`SELECT count(*) FROM pragma_table_info('history') WHERE name = 'tag'`).Scan(&n)
+	if err == nil && n == 0 {
+		_, err = db.Exec(`ALTER TABLE history ADD COLUMN tag TEXT NOT NULL DEFAULT ''`)
+	}
+	if err == nil {
+		_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_history_tag_time ON history (tag, queried_at)`)
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("升级数据库结构失败: %w", err)
+	}
+
+	return &sqliteStore{db: db}, nil
+}
+
+// Close 关闭数据库
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+// Save 保存一次查询结果
+func (s *sqliteStore) Save(ctx context.Context, info *models.IPInfo, queriedAt time.Time, tag string) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("序列化查询结果失败: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO history (ip, queried_at, risk_value, ip_type, native_ip, tag, data) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		info.IP, queriedAt.UnixMilli(), info.RiskValue, info.IPType, info.NativeIP, tag, string(data))
+	if err != nil {
+		return fmt.Errorf("保存查询结果失败: %w", err)
+	}
+	return nil
+}
+
+// History 返回指定IP的历史查询记录，按查询时间从早到晚排列
+func (s *sqliteStore) History(ctx context.Context, ip string, limit int) ([]Record, error) {
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+
+	// 先取最近的limit条，再按时间正序返回，便于观察变化
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT queried_at, tag, data FROM (
+			SELECT id, queried_at, tag, data FROM history WHERE ip = ? ORDER BY queried_at DESC, id DESC LIMIT ?
+		) ORDER BY queried_at ASC, id ASC`,
+		ip, limit)
+	if err != nil {
+		return nil, fmt.Errorf("读取历史记录失败: %w", err)
+	}
+	return scanRecords(rows)
+}
+
+// Export 按保存顺序逐条读取符合条件的历史记录
+func (s *sqliteStore) Export(ctx context.Context, q ExportQuery, fn func(Record) error) error {
+	start, end := q.timeRange()
+	return exportPages(func(afterID int64) (*sql.Rows, error) {
+		return s.db.QueryContext(ctx,
+			`SELECT id, queried_at, tag, data FROM history
+			WHERE id > ? AND queried_at >= ? AND queried_at < ? AND (? = '' OR tag = ?) ORDER BY id LIMIT ?`,
+			afterID, start, end, q.Tag, q.Tag, exportBatch)
+	}, fn)
+}
+
+// SaveJob 保存已完成的批量查询任务，并删除已过期的任务
+func (s *sqliteStore) SaveJob(ctx context.Context, id string, data []byte, expires time.Time) error {
+	if _, err := s.PruneJobs(ctx); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO jobs (id, expires_at, data) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET expires_at = excluded.expires_at, data = excluded.data`,
+		id, expires.UnixMilli(), string(data))
+	if err != nil {
+		return fmt.Errorf("保存任务失败: %w", err)
+	}
+	return nil
+}
+
+// Job 返回保存的批量查询任务
+func (s *sqliteStore) Job(ctx context.Context, id string) ([]byte, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, `SELECT data FROM jobs WHERE id = ? AND expires_at >= ?`, id, time.Now().UnixMilli()).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取任务失败: %w", err)
+	}
+	return []byte(data), nil
+}
+
+// PruneHistory 删除查询时间早于before的历史记录
+func (s *sqliteStore) PruneHistory(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM history WHERE queried_at < ?`, before.UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("删除过期的历史记录失败: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// PruneJobs 删除已过期的批量查询任务
+func (s *sqliteStore) PruneJobs(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM jobs WHERE expires_at < ?`, time.Now().UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("删除过期的任务失败: %w", err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,216 @@
+// Package store implements persistent storage of query results for the Pong0
+// application. Every successful lookup can be recorded with a timestamp, so that
+// changes of an IP's risk value and type can be tracked over time, and finished
+// batch jobs of the API server can be kept beyond a restart. Data is kept in a
+// SQLite file or, for teams running several replicas, in a PostgreSQL database.
+package store
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+	"unicode"
+
+	"ping0/internal/models"
+)
+
+// DefaultHistoryLimit 是查询历史记录时默认返回的最大条数
+const DefaultHistoryLimit = 100
+
+// MaxHistoryLimit 是查询历史记录时一次最多返回的条数
+const MaxHistoryLimit = 1000
+
+// exportBatch 导出历史记录时每次从数据库读取的条数
+const exportBatch = 1000
+
+// MaxTagLength 查询标签的最大长度（字节）
+const MaxTagLength = 128
+
+// ErrNotFound 要读取的任务不存在或已过期
+var ErrNotFound = errors.New("记录不存在")
+
+// Store 查询历史记录和已完成批量查询任务的存储
+// 实现可以被多个goroutine并发使用。
+type Store interface {
+	// Save 保存一次查询结果，tag为查询附带的标签，没有时为空
+	Save(ctx context.Context, info *models.IPInfo, queriedAt time.Time, tag string) error
+	// History 返回指定IP最近的limit条历史记录（limit不大于0时使用DefaultHistoryLimit），按查询时间从早到晚排列
+	History(ctx context.Context, ip string, limit int) ([]Record, error)
+	// Export 按保存顺序逐条读取符合条件的全部历史记录
+	// 记录分批从数据库读取，不会一次全部读入内存；fn返回错误时停止读取并返回该错误。
+	Export(ctx context.Context, q ExportQuery, fn func(Record) error) error
+	// SaveJob 保存已完成的批量查询任务，expires之后不再返回；同时删除已过期的任务
+	SaveJob(ctx context.Context, id string, data []byte, expires time.Time) error
+	// Job 返回保存的批量查询任务，不存在或已过期时返回ErrNotFound
+	Job(ctx context.Context, id string) ([]byte, error)
+	// PruneHistory 删除查询时间早于before的历史记录，返回删除的条数
+	PruneHistory(ctx context.Context, before time.Time) (int64, error)
+	// PruneJobs 删除已过期的批量查询任务，返回删除的条数
+	PruneJobs(ctx context.Context) (int64, error)
+	// Close 关闭存储
+	Close() error
+}
+
+// Record 一条历史查询记录
+type Record struct {
+	QueriedAt time.Time      // 查询时间
+	Tag       string         // 查询附带的标签，没有时为空
+	Info      *models.IPInfo // 当时的查询结果
+}
+
+// ExportQuery 导出历史记录的条件
+type ExportQuery struct {
+	Since time.Time // 查询时间的下限（包含）
+	Until time.Time // 查询时间的上限（不包含），零值时不限制
+	Tag   string    // 只导出带有该标签的记录，为空时不限制
+}
+
+// CheckTag 检查查询标签是否有效
+// 标签是任意文本（如 proxy-batch-2024-06），但不能超过MaxTagLength字节，也不能包含控制字符。
+func CheckTag(tag string) error {
+	if len(tag) > MaxTagLength {
+		return fmt.Errorf("标签不能超过%d个字节", MaxTagLength)
+	}
+	for _, r := range tag {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("标签不能包含控制字符")
+		}
+	}
+	return nil
+}
+
+// MarshalJSON 将查询时间作为queried_at字段、标签作为tag字段（没有标签时省略）放在查询结果字段之前
+func (r Record) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(r.Info)
+	if err != nil {
+		return nil, err
+	}
+
+	data = bytes.TrimSpace(data)
+	if len(data) < 2 || data[0] != '{' {
+		return nil, fmt.Errorf("历史记录的查询结果必须是JSON对象")
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `{"queried_at":%q`, r.QueriedAt.Format(time.RFC3339))
+	if r.Tag != "" {
+		tag, _ := json.Marshal(r.Tag)
+		buf.WriteString(`,"tag":`)
+		buf.Write(tag)
+	}
+	if len(data) > 2 {
+		buf.WriteByte(',')
+	}
+	buf.Write(data[1:])
+	return buf.Bytes(), nil
+}
+
+// Open 打开（必要时创建）存储
+// 以 postgres:// 或 postgresql:// 开头时连接PostgreSQL数据库，其他按SQLite数据库文件路径打开，需要的表在打开时自动创建。
+//
+// 参数:
+//   - dsn: SQLite数据库文件路径或PostgreSQL连接地址
+//
+// 返回:
+//   - Store: 打开的存储
+//   - error: 如果无法打开数据库或创建表结构则返回相应错误
+func Open(dsn string) (Store, error) {
+	if isPostgresDSN(dsn) {
+		return openPostgres(dsn)
+	}
+	return openSQLite(dsn)
+}
+
+// timeRange 将导出的时间范围转换为毫秒时间戳，Until为零值时不限制结束时间
+func (q ExportQuery) timeRange() (int64, int64) {
+	end := int64(math.MaxInt64)
+	if !q.Until.IsZero() {
+		end = q.Until.UnixMilli()
+	}
+	return q.Since.UnixMilli(), end
+}
+
+// exportPages 按ID分页读取历史记录并逐条调用fn
+// page返回ID大于afterID的最多exportBatch条 (id, queried_at, tag, data) 记录，按ID从小到大排列。
+func exportPages(page func(afterID int64) (*sql.Rows, error), fn func(Record) error) error {
+	var afterID int64
+	for {
+		rows, err := page(afterID)
+		if err != nil {
+			return fmt.Errorf("导出历史记录失败: %w", err)
+		}
+
+		var records []Record
+		for rows.Next() {
+			var (
+				queriedAt int64
+				tag, data string
+			)
+			if err := rows.Scan(&afterID, &queriedAt, &tag, &data); err != nil {
+				rows.Close()
+				return fmt.Errorf("导出历史记录失败: %w", err)
+			}
+			rec, err := decodeRecord(queriedAt, tag, data)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			records = append(records, rec)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("导出历史记录失败: %w", err)
+		}
+
+		// 先读完一页并释放连接再回调，fn写入很慢的客户端时不会长时间占用数据库连接
+		for _, rec := range records {
+			if err := fn(rec); err != nil {
+				return err
+			}
+		}
+		if len(records) < exportBatch {
+			return nil
+		}
+	}
+}
+
+// scanRecords 读取 (queried_at, tag, data) 三列组成的历史记录
+func scanRecords(rows *sql.Rows) ([]Record, error) {
+	defer rows.Close()
+
+	records := []Record{}
+	for rows.Next() {
+		var (
+			queriedAt int64
+			tag, data string
+		)
+		if err := rows.Scan(&queriedAt, &tag, &data); err != nil {
+			return nil, fmt.Errorf("读取历史记录失败: %w", err)
+		}
+
+		rec, err := decodeRecord(queriedAt, tag, data)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取历史记录失败: %w", err)
+	}
+
+	return records, nil
+}
+
+// decodeRecord 由数据库中的列还原一条历史记录
+func decodeRecord(queriedAt int64, tag, data string) (Record, error) {
+	info := &models.IPInfo{}
+	if err := json.Unmarshal([]byte(data), info); err != nil {
+		return Record{}, fmt.Errorf("解析历史记录失败: %w", err)
+	}
+	return Record{QueriedAt: time.UnixMilli(queriedAt), Tag: tag, Info: info}, nil
+}
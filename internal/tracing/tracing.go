@@ -0,0 +1,119 @@
+// Package tracing sets up OpenTelemetry distributed tracing for the Pong0
+// application. Spans are created with the OpenTelemetry API and exported in
+// batches to an OTLP/HTTP receiver (such as the OpenTelemetry Collector, Jaeger
+// or Tempo). Incoming API requests carrying a W3C traceparent header join the
+// caller's trace.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName 创建追踪器使用的instrumentation scope名称
+const ScopeName = "pong0"
+
+// propagator 在请求头中读取调用方区间使用的W3C Trace Context传播器
+var propagator = propagation.TraceContext{}
+
+// New 创建追踪器提供者，结束的区间在后台批量导出到OTLP/HTTP接收端
+// 接收端不可用时只通过otel的错误处理器报告，不影响查询；采样遵循调用方在traceparent中的决定。
+//
+// 参数:
+//   - endpoint: OTLP/HTTP接收端地址，如 http://localhost:4318；没有以/v1/traces结尾时自动补上
+//   - headers: 导出请求附带的请求头，如认证信息
+//   - serviceName: 资源属性service.name的值
+//   - version: 资源属性service.version的值
+//
+// 返回:
+//   - *sdktrace.TracerProvider: 新的追踪器提供者，使用完毕后需要调用Shutdown导出剩余的区间
+//   - error: 如果接收端地址无效则返回相应错误
+func New(endpoint string, headers map[string]string, serviceName, version string) (*sdktrace.TracerProvider, error) {
+	endpoint = strings.TrimRight(strings.TrimSpace(endpoint), "/")
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		return nil, fmt.Errorf("无效的OTLP地址 %q，应以http://或https://开头", endpoint)
+	}
+	if !strings.HasSuffix(endpoint, "/v1/traces") {
+		endpoint += "/v1/traces"
+	}
+
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpointURL(endpoint)}
+	if len(headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(headers))
+	}
+	// 创建导出器不会连接接收端，连接在第一次导出时才建立
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("创建OTLP导出器失败: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", serviceName),
+		attribute.String("service.version", version),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("创建追踪资源失败: %w", err)
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	), nil
+}
+
+// Extract 从请求头的traceparent中读取调用方的区间，作为之后创建的区间的远程父区间
+// 请求头不存在或格式无效时返回原来的ctx。
+//
+// 参数:
+//   - ctx: 请求上下文
+//   - header: 收到的请求头
+//
+// 返回:
+//   - context.Context: 带有远程父区间的上下文
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return propagator.Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// SetError 记录错误并将区间标记为失败，err为nil时不做任何事
+func SetError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// ParseHeaders 解析导出请求附带的请求头
+// 格式与OTEL_EXPORTER_OTLP_HEADERS相同，如 "Authorization=Bearer xxx,X-Scope-OrgID=team-a"。
+//
+// 参数:
+//   - s: 以逗号分隔的key=value列表，为空时返回nil
+//
+// 返回:
+//   - map[string]string: 请求头
+//   - error: 如果某一项不是key=value形式则返回相应错误
+func ParseHeaders(s string) (map[string]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	headers := make(map[string]string)
+	for _, item := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(item, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("无效的请求头 %q，应为key=value形式", strings.TrimSpace(item))
+		}
+		headers[key] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
@@ -0,0 +1,129 @@
+package verify
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dop251/goja"
+)
+
+// host 提供goja中没有的浏览器基础功能，由runner.js包装成atob、TextEncoder、crypto和URL等全局对象
+// 出错时抛出JavaScript异常，与浏览器中的行为一致。
+type host struct {
+	rt *goja.Runtime
+}
+
+// Atob 解码base64字符串，返回每个字节对应一个字符的二进制字符串
+func (h *host) Atob(s string) string {
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		panic(h.rt.NewGoError(fmt.Errorf("atob: 无效的base64字符串: %w", err)))
+	}
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// Btoa 将每个字符都不超过0xFF的二进制字符串编码为base64
+func (h *host) Btoa(s string) string {
+	data := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xFF {
+			panic(h.rt.NewGoError(fmt.Errorf("btoa: 字符 %q 超出Latin1范围", r)))
+		}
+		data = append(data, byte(r))
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// Encode 返回字符串的UTF-8编码
+func (h *host) Encode(s string) goja.ArrayBuffer {
+	return h.rt.NewArrayBuffer([]byte(s))
+}
+
+// Decode 将UTF-8字节解码为字符串，无效的字节替换为U+FFFD
+func (h *host) Decode(buf goja.ArrayBuffer) string {
+	return strings.ToValidUTF8(string(buf.Bytes()), string(utf8.RuneError))
+}
+
+// Digest 计算crypto.subtle.digest支持的摘要
+func (h *host) Digest(algorithm string, buf goja.ArrayBuffer) goja.ArrayBuffer {
+	var hh hash.Hash
+	switch strings.ToUpper(algorithm) {
+	case "SHA-1":
+		hh = sha1.New()
+	case "SHA-256":
+		hh = sha256.New()
+	case "SHA-384":
+		hh = sha512.New384()
+	case "SHA-512":
+		hh = sha512.New()
+	default:
+		panic(h.rt.NewGoError(fmt.Errorf("digest: 不支持的算法 %s", algorithm)))
+	}
+	hh.Write(buf.Bytes())
+	return h.rt.NewArrayBuffer(hh.Sum(nil))
+}
+
+// RandomBytes 返回n个随机字节，用于crypto.getRandomValues
+func (h *host) RandomBytes(n int) goja.ArrayBuffer {
+	if n < 0 || n > 65536 {
+		panic(h.rt.NewGoError(fmt.Errorf("getRandomValues: 长度 %d 超出范围", n)))
+	}
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(h.rt.NewGoError(err))
+	}
+	return h.rt.NewArrayBuffer(b)
+}
+
+// ParseURL 解析URL并返回与浏览器URL对象相同的各个字段，base不为空时相对于base解析
+func (h *host) ParseURL(href, base string) map[string]interface{} {
+	u, err := url.Parse(href)
+	if err == nil && base != "" {
+		var b *url.URL
+		if b, err = url.Parse(base); err == nil {
+			u = b.ResolveReference(u)
+		}
+	}
+	if err != nil || !u.IsAbs() {
+		panic(h.rt.NewTypeError("Invalid URL: %s", href))
+	}
+
+	path := u.EscapedPath()
+	if path == "" && u.Host != "" {
+		path = "/"
+	}
+	search, hash := "", ""
+	if u.RawQuery != "" {
+		search = "?" + u.RawQuery
+	}
+	if u.Fragment != "" {
+		hash = "#" + u.EscapedFragment()
+	}
+	origin := "null"
+	if u.Host != "" {
+		origin = u.Scheme + "://" + u.Host
+	}
+	return map[string]interface{}{
+		"href":     u.Scheme + "://" + u.Host + path + search + hash,
+		"origin":   origin,
+		"protocol": u.Scheme + ":",
+		"host":     u.Host,
+		"hostname": u.Hostname(),
+		"port":     u.Port(),
+		"pathname": path,
+		"search":   search,
+		"hash":     hash,
+	}
+}
@@ -0,0 +1,226 @@
+// Prepares a minimal browser-like sandbox in which Ping0.cc's key generation
+// script runs, and reports the js1key and pow cookies the script sets.
+//
+// The Go side evaluates this file in a fresh goja runtime for every sample.
+// It evaluates to a function that takes the host primitives goja lacks
+// (base64, UTF-8, hashing, random bytes and URL parsing) and the sample
+// input {"base_url", "user_agent", "x1", "difficulty"}. The function turns the
+// global object into the sandbox window and returns a controller:
+//
+//   loaded()  called after the script has run, fires window.onload
+//   step()    runs the next timer, returns false once the sample is finished
+//   timeout() finishes the sample with the cookies set so far
+//   result()  {"js1key", "pow", "error"}
+//
+// Timers run one at a time in the order they fall due without actually
+// waiting, so that scripts that delay the calculation for animation do not
+// slow the run down. Promise callbacks run between steps.
+(function (host, input) {
+  'use strict';
+
+  // Timer delays are capped at this many milliseconds before ordering them.
+  const maxTimerDelay = 20;
+
+  const sandbox = globalThis;
+  const cookies = {};
+  const timers = new Map();
+  let nextTimer = 1;
+  let clock = 0;
+  let finished = null;
+
+  function noop() {}
+
+  function element() {
+    return {
+      style: {},
+      dataset: {},
+      classList: { add: noop, remove: noop, toggle: noop, contains: () => false },
+      appendChild: noop,
+      removeChild: noop,
+      setAttribute: noop,
+      getAttribute: () => null,
+      addEventListener: noop,
+      removeEventListener: noop,
+      getAnimations: () => [],
+      getBoundingClientRect: () => ({ top: 0, left: 0, width: 0, height: 0 }),
+      innerHTML: '',
+      textContent: '',
+    };
+  }
+
+  // toBuffer copies the bytes of an ArrayBuffer or a typed array view into a
+  // new ArrayBuffer for the host functions.
+  function toBuffer(data) {
+    if (data === undefined) return new ArrayBuffer(0);
+    if (ArrayBuffer.isView(data)) return data.buffer.slice(data.byteOffset, data.byteOffset + data.byteLength);
+    return data;
+  }
+
+  const finish = (result) => {
+    if (finished) return;
+    finished = result;
+    timers.clear();
+  };
+  const check = () => {
+    if (cookies.js1key !== undefined && cookies.pow !== undefined) {
+      finish({ js1key: cookies.js1key, pow: cookies.pow });
+    }
+  };
+  const guard = (fn, args) => {
+    if (finished) return;
+    try {
+      fn(...args);
+      check();
+    } catch (e) {
+      finish({ error: String((e && e.message) || e) });
+    }
+  };
+  const schedule = (fn, ms, args, interval) => {
+    const id = nextTimer++;
+    const delay = Math.min(Number(ms) || 0, maxTimerDelay);
+    timers.set(id, { fn, args, delay, interval, due: clock + delay });
+    return id;
+  };
+
+  function URL(href, base) {
+    Object.assign(this, host.parseURL(String(href), base === undefined ? '' : String(base)));
+  }
+  URL.prototype.toString = function () {
+    return this.href;
+  };
+
+  function TextEncoder() {}
+  TextEncoder.prototype.encoding = 'utf-8';
+  TextEncoder.prototype.encode = function (s) {
+    return new Uint8Array(host.encode(s === undefined ? '' : String(s)));
+  };
+
+  function TextDecoder() {}
+  TextDecoder.prototype.encoding = 'utf-8';
+  TextDecoder.prototype.decode = function (data) {
+    return host.decode(toBuffer(data));
+  };
+
+  const document = {
+    get cookie() {
+      return Object.entries(cookies).map(([k, v]) => k + '=' + v).join('; ');
+    },
+    set cookie(value) {
+      const pair = String(value).split(';')[0];
+      const i = pair.indexOf('=');
+      if (i > 0) cookies[pair.slice(0, i).trim()] = pair.slice(i + 1).trim();
+    },
+    readyState: 'complete',
+    body: element(),
+    documentElement: element(),
+    head: element(),
+    getElementById: element,
+    querySelector: element,
+    querySelectorAll: () => [],
+    getElementsByTagName: () => [],
+    getElementsByClassName: () => [],
+    createElement: element,
+    addEventListener: (type, fn) => sandbox.setTimeout(fn, 0),
+    removeEventListener: noop,
+    getAnimations: () => [],
+  };
+
+  // location.href is the base URL exactly as configured, the same value the
+  // Go port passes as locationHref, so that only algorithm changes diverge.
+  const href = input.base_url;
+  const url = new URL(href);
+  const location = {
+    href,
+    origin: url.origin,
+    host: url.host,
+    hostname: url.hostname,
+    pathname: url.pathname,
+    protocol: url.protocol,
+    search: '',
+    hash: '',
+    reload: check,
+    replace: check,
+    assign: check,
+    toString: () => href,
+  };
+
+  Object.assign(sandbox, {
+    x1: input.x1,
+    difficulty: input.difficulty,
+    document,
+    location,
+    navigator: { userAgent: input.user_agent || '', language: 'zh-CN', languages: ['zh-CN'], webdriver: false },
+    screen: { width: 1920, height: 1080 },
+    console: { log: noop, info: noop, warn: noop, error: noop, debug: noop },
+    crypto: {
+      getRandomValues: (a) => {
+        new Uint8Array(a.buffer, a.byteOffset, a.byteLength).set(new Uint8Array(host.randomBytes(a.byteLength)));
+        return a;
+      },
+      subtle: {
+        digest: (alg, data) => {
+          try {
+            return Promise.resolve(host.digest(typeof alg === 'string' ? alg : alg.name, toBuffer(data)));
+          } catch (e) {
+            return Promise.reject(e);
+          }
+        },
+      },
+    },
+    TextEncoder,
+    TextDecoder,
+    URL,
+    atob: (s) => host.atob(String(s)),
+    btoa: (s) => host.btoa(String(s)),
+    setTimeout: (fn, ms, ...args) => schedule(fn, ms, args, false),
+    clearTimeout: (t) => timers.delete(t),
+    setInterval: (fn, ms, ...args) => schedule(fn, ms, args, true),
+    clearInterval: (t) => timers.delete(t),
+    requestAnimationFrame: (fn) => sandbox.setTimeout(fn, 0, Date.now()),
+    cancelAnimationFrame: (t) => sandbox.clearTimeout(t),
+    addEventListener: (type, fn) => sandbox.setTimeout(fn, 0),
+    removeEventListener: noop,
+    localStorage: { getItem: () => null, setItem: noop, removeItem: noop },
+    sessionStorage: { getItem: () => null, setItem: noop, removeItem: noop },
+  });
+  sandbox.window = sandbox;
+  sandbox.self = sandbox;
+  sandbox.top = sandbox;
+  sandbox.parent = sandbox;
+
+  return {
+    loaded() {
+      if (typeof sandbox.onload === 'function') sandbox.setTimeout(sandbox.onload, 0);
+      check();
+    },
+    step() {
+      check();
+      if (finished) return false;
+
+      let next;
+      for (const entry of timers) {
+        if (!next || entry[1].due < next[1].due) next = entry;
+      }
+      if (!next) {
+        finish({ js1key: cookies.js1key, pow: cookies.pow, error: 'no pending timers' });
+        return false;
+      }
+
+      const [id, timer] = next;
+      clock = timer.due;
+      if (timer.interval) {
+        timer.due = clock + Math.max(timer.delay, 1);
+      } else {
+        timers.delete(id);
+      }
+      guard(timer.fn, timer.args);
+      return !finished;
+    },
+    timeout() {
+      finish({ js1key: cookies.js1key, pow: cookies.pow, error: 'timeout' });
+    },
+    result() {
+      return finished || {};
+    },
+  };
+});
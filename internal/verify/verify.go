@@ -0,0 +1,237 @@
+// Package verify compares the Go port of a key generation algorithm with
+// Ping0.cc's own JavaScript. The downloaded script is executed in-process by
+// goja in a minimal browser-like sandbox for a series of random x1 values, and the
+// js1key and pow cookies it sets are compared with the keys computed in Go.
+// Divergences after an upstream update show which part of the algorithm needs
+// to be ported again.
+package verify
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"ping0/internal/config"
+	"ping0/internal/parser"
+
+	"github.com/dop251/goja"
+)
+
+//go:embed runner.js
+var runnerScript string
+
+// runnerProgram 编译后的runner.js，所有样本共用
+var runnerProgram = sync.OnceValues(func() (*goja.Program, error) {
+	return goja.Compile("runner.js", runnerScript, true)
+})
+
+// 默认参数
+const (
+	DefaultSamples    = 20              // 默认的随机x1值数量
+	DefaultDifficulty = "00"            // 默认的difficulty，较短以便JS中的POW计算很快完成
+	DefaultTimeout    = 5 * time.Second // 默认的单个样本在JS中的最长运行时间
+)
+
+// Options 对比的参数
+type Options struct {
+	Samples    int           // 随机x1值的数量，不大于0时使用DefaultSamples
+	Difficulty string        // 计算POW使用的difficulty，为空时使用DefaultDifficulty
+	Timeout    time.Duration // 单个样本在JS中的最长运行时间，不大于0时使用DefaultTimeout
+}
+
+// Sample 一个x1值在Go和JS中计算出的密钥
+type Sample struct {
+	X1         string `json:"x1"`
+	Difficulty string `json:"difficulty"`
+	GoJs1key   string `json:"go_js1key"`
+	GoPow      string `json:"go_pow"`
+	JSJs1key   string `json:"js_js1key"`
+	JSPow      string `json:"js_pow"`
+	Match      bool   `json:"match"`           // js1key和pow是否都一致
+	Error      string `json:"error,omitempty"` // Go或JS计算失败的原因
+}
+
+// Report 一次对比的结果
+type Report struct {
+	Algorithm    string   `json:"algorithm"`     // Go中使用的算法版本
+	Script       string   `json:"script"`        // 脚本的来源：路径或文件名
+	ScriptSHA256 string   `json:"script_sha256"` // 脚本内容的SHA-256
+	Samples      []Sample `json:"samples"`
+	Divergences  int      `json:"divergences"` // 不一致或计算失败的样本数
+}
+
+// runnerInput 传给runner.js的一个样本的输入
+type runnerInput struct {
+	BaseURL    string `json:"base_url"`
+	UserAgent  string `json:"user_agent"`
+	X1         string `json:"x1"`
+	Difficulty string `json:"difficulty"`
+}
+
+// runnerResult runner.js返回的一个样本的结果
+type runnerResult struct {
+	Js1key string `json:"js1key"`
+	Pow    string `json:"pow"`
+	Error  string `json:"error"`
+}
+
+// Run 使用随机x1值对比Go算法和JavaScript脚本生成的访问密钥
+// 样本依次在进程内的goja运行时中执行，每个样本使用独立的运行时作为沙箱。
+//
+// 参数:
+//   - ctx: 控制Go和JS中计算的上下文
+//   - cfg: 运行配置，提供站点地址、User-Agent和POW迭代上限
+//   - alg: 要对比的Go算法
+//   - script: 脚本来源的说明，写入报告
+//   - content: 脚本内容
+//   - opts: 对比参数
+//
+// 返回:
+//   - *Report: 对比结果，Divergences大于0说明Go算法与脚本不一致
+//   - error: 如果ctx被取消或runner.js无法运行则返回相应错误
+func Run(ctx context.Context, cfg *config.Config, alg *parser.Algorithm, script string, content []byte, opts Options) (*Report, error) {
+	if opts.Samples <= 0 {
+		opts.Samples = DefaultSamples
+	}
+	if opts.Difficulty == "" {
+		opts.Difficulty = DefaultDifficulty
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+
+	sum := sha256.Sum256(content)
+	report := &Report{
+		Algorithm:    alg.Version,
+		Script:       script,
+		ScriptSHA256: hex.EncodeToString(sum[:]),
+	}
+	for i := 0; i < opts.Samples; i++ {
+		x1, err := randomX1()
+		if err != nil {
+			return nil, err
+		}
+		input := runnerInput{BaseURL: cfg.BaseURL, UserAgent: cfg.UserAgent, X1: x1, Difficulty: opts.Difficulty}
+		result, err := runSample(ctx, script, string(content), &input, opts.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		sample := Sample{X1: x1, Difficulty: opts.Difficulty, JSJs1key: result.Js1key, JSPow: result.Pow}
+
+		keys, err := parser.GenerateKeyWith(ctx, cfg, alg, x1, opts.Difficulty)
+		switch {
+		case err != nil:
+			sample.Error = "Go: " + err.Error()
+		case result.Error != "":
+			sample.GoJs1key, sample.GoPow = keys.Js1key, keys.Pow
+			sample.Error = "JS: " + result.Error
+		default:
+			sample.GoJs1key, sample.GoPow = keys.Js1key, keys.Pow
+			sample.Match = keys.Js1key == result.Js1key && keys.Pow == result.Pow
+		}
+		if !sample.Match {
+			report.Divergences++
+		}
+		report.Samples = append(report.Samples, sample)
+	}
+	return report, nil
+}
+
+// runSample 在新的goja运行时中执行脚本，返回一个样本的结果
+// 脚本抛出异常或超过timeout仍未设置cookie时，原因记录在结果的Error中，不作为错误返回。
+//
+// 参数:
+//   - ctx: 控制JS执行的上下文，被取消时中断脚本
+//   - name: 脚本的名称，用于异常的堆栈信息
+//   - script: 脚本内容
+//   - input: 样本的输入
+//   - timeout: 脚本的最长运行时间
+//
+// 返回:
+//   - runnerResult: JS中设置的cookie或失败原因
+//   - error: 如果ctx被取消或runner.js无法运行则返回相应错误
+func runSample(ctx context.Context, name, script string, input *runnerInput, timeout time.Duration) (runnerResult, error) {
+	prog, err := runnerProgram()
+	if err != nil {
+		return runnerResult{}, fmt.Errorf("编译runner.js失败: %w", err)
+	}
+
+	rt := goja.New()
+	rt.SetFieldNameMapper(goja.TagFieldNameMapper("json", true))
+
+	sampleCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	stop := context.AfterFunc(sampleCtx, func() { rt.Interrupt(sampleCtx.Err()) })
+	defer stop()
+
+	setupValue, err := rt.RunProgram(prog)
+	if err != nil {
+		return runnerResult{}, fmt.Errorf("运行runner.js失败: %w", err)
+	}
+	setup, ok := goja.AssertFunction(setupValue)
+	if !ok {
+		return runnerResult{}, errors.New("runner.js没有返回函数")
+	}
+	controlValue, err := setup(goja.Undefined(), rt.ToValue(&host{rt: rt}), rt.ToValue(input))
+	if err != nil {
+		return runnerResult{}, fmt.Errorf("初始化沙箱失败: %w", err)
+	}
+	var control struct {
+		Loaded  func() error         `json:"loaded"`
+		Step    func() (bool, error) `json:"step"`
+		Timeout func() error         `json:"timeout"`
+		Result  func() runnerResult  `json:"result"`
+	}
+	if err := rt.ExportTo(controlValue, &control); err != nil {
+		return runnerResult{}, fmt.Errorf("初始化沙箱失败: %w", err)
+	}
+
+	err = func() error {
+		if _, err := rt.RunScript(name, script); err != nil {
+			return err
+		}
+		if err := control.Loaded(); err != nil {
+			return err
+		}
+		for {
+			more, err := control.Step()
+			if err != nil || !more {
+				return err
+			}
+		}
+	}()
+
+	var interrupted *goja.InterruptedError
+	switch {
+	case errors.As(err, &interrupted):
+		if ctx.Err() != nil {
+			return runnerResult{}, ctx.Err()
+		}
+		rt.ClearInterrupt()
+		if err := control.Timeout(); err != nil {
+			return runnerResult{}, fmt.Errorf("读取沙箱结果失败: %w", err)
+		}
+	case err != nil:
+		var exception *goja.Exception
+		if errors.As(err, &exception) {
+			return runnerResult{Error: exception.Value().String()}, nil
+		}
+		return runnerResult{Error: err.Error()}, nil
+	}
+	return control.Result(), nil
+}
+
+// randomX1 生成与初始页面中格式相同的随机x1值（32个小写十六进制字符）
+func randomX1() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("生成随机x1值失败: %w", err)
+	}
+	return hex.EncodeToString(b[:]), nil
+}
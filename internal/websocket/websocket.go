@@ -0,0 +1,307 @@
+// Package websocket implements the server side of the WebSocket protocol
+// (RFC 6455) for the API server's push endpoints. Only what those endpoints
+// need is supported: the HTTP/1.1 upgrade handshake, text messages (including
+// fragmented ones), ping/pong and the closing handshake. Extensions such as
+// permessage-deflate are not negotiated.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// acceptGUID 计算Sec-WebSocket-Accept时附加在客户端密钥后的固定字符串
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// 帧的操作码
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// 关闭帧的状态码
+const (
+	CloseNormal          = 1000 // 正常关闭
+	CloseGoingAway       = 1001 // 服务器停止
+	CloseProtocolError   = 1002 // 协议错误
+	CloseUnsupportedData = 1003 // 收到不支持的数据类型（如二进制消息）
+	CloseMessageTooBig   = 1009 // 消息超过大小上限
+)
+
+// writeTimeout 写出一帧的超时时间，避免不再读取的客户端阻塞服务器
+const writeTimeout = 10 * time.Second
+
+// ErrClosed 连接已关闭（收到或发送了关闭帧）
+var ErrClosed = errors.New("WebSocket连接已关闭")
+
+// Conn 一个已完成握手的WebSocket连接
+// ReadMessage只能在一个goroutine中调用；WriteMessage、Ping和Close可以并发调用。
+type Conn struct {
+	conn       net.Conn
+	br         *bufio.Reader
+	maxMessage int // 单条消息的最大字节数
+
+	mu     sync.Mutex // 保护写操作
+	closed bool       // 是否已发送关闭帧
+}
+
+// IsUpgrade 判断请求是否为WebSocket升级请求
+func IsUpgrade(r *http.Request) bool {
+	return headerContains(r.Header, "Connection", "upgrade") && headerContains(r.Header, "Upgrade", "websocket")
+}
+
+// Upgrade 完成WebSocket握手，接管HTTP连接
+// 握手失败时已向客户端写出错误响应。
+//
+// 参数:
+//   - w: 响应，必须支持http.Hijacker（可以通过Unwrap获得）
+//   - r: 升级请求
+//   - maxMessage: 单条消息的最大字节数，超过时以1009关闭连接
+//
+// 返回:
+//   - *Conn: 建立的连接
+//   - error: 如果请求不是有效的WebSocket握手或无法接管连接则返回相应错误
+func Upgrade(w http.ResponseWriter, r *http.Request, maxMessage int) (*Conn, error) {
+	if r.Method != http.MethodGet || !IsUpgrade(r) {
+		http.Error(w, "需要WebSocket升级请求", http.StatusBadRequest)
+		return nil, fmt.Errorf("不是WebSocket升级请求")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "不支持的WebSocket版本", http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("不支持的WebSocket版本: %q", r.Header.Get("Sec-WebSocket-Version"))
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "无效的Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, fmt.Errorf("无效的Sec-WebSocket-Key: %q", key)
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "服务器不支持WebSocket", http.StatusInternalServerError)
+		return nil, fmt.Errorf("接管连接失败: %w", err)
+	}
+	// 服务器为HTTP请求设置的读写截止时间不适用于长连接
+	conn.SetDeadline(time.Time{})
+
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n"
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := io.WriteString(conn, response); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("写出握手响应失败: %w", err)
+	}
+	conn.SetWriteDeadline(time.Time{})
+
+	return &Conn{conn: conn, br: rw.Reader, maxMessage: maxMessage}, nil
+}
+
+// headerContains 判断以逗号分隔的请求头中是否包含指定的值（不区分大小写）
+func headerContains(h http.Header, name, value string) bool {
+	for _, v := range h.Values(name) {
+		for _, item := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadMessage 读取下一条文本消息
+// 自动回复ping，忽略pong；收到关闭帧时回复关闭帧并返回ErrClosed；收到二进制消息时以1003关闭连接。
+//
+// 返回:
+//   - []byte: 消息内容
+//   - error: 如果连接关闭、读取失败或客户端违反协议则返回相应错误
+func (c *Conn) ReadMessage() ([]byte, error) {
+	var message []byte
+	fragmented := false
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			code := CloseNormal
+			if len(payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(payload))
+			}
+			c.Close(code, "")
+			return nil, ErrClosed
+		case opBinary:
+			c.Close(CloseUnsupportedData, "只支持文本消息")
+			return nil, fmt.Errorf("收到二进制消息")
+		case opText:
+			if fragmented {
+				c.Close(CloseProtocolError, "")
+				return nil, fmt.Errorf("分片消息未结束时收到新消息")
+			}
+			message = payload
+		case opContinuation:
+			if !fragmented {
+				c.Close(CloseProtocolError, "")
+				return nil, fmt.Errorf("收到没有起始帧的后续帧")
+			}
+			if len(message)+len(payload) > c.maxMessage {
+				c.Close(CloseMessageTooBig, "")
+				return nil, fmt.Errorf("消息超过 %d 字节", c.maxMessage)
+			}
+			message = append(message, payload...)
+		default:
+			c.Close(CloseProtocolError, "")
+			return nil, fmt.Errorf("未知的操作码 %#x", opcode)
+		}
+
+		if fin {
+			return message, nil
+		}
+		fragmented = true
+	}
+}
+
+// readFrame 读取一帧，客户端发送的帧必须带掩码
+func (c *Conn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(c.br, header[:]); err != nil {
+		return
+	}
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0f
+	if header[0]&0x70 != 0 || header[1]&0x80 == 0 {
+		c.Close(CloseProtocolError, "")
+		return false, 0, nil, fmt.Errorf("帧设置了保留位或没有掩码")
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	// 控制帧的载荷不超过125字节，也不能分片
+	if opcode >= opClose && (length > 125 || !fin) {
+		c.Close(CloseProtocolError, "")
+		return false, 0, nil, fmt.Errorf("无效的控制帧")
+	}
+	if length > uint64(c.maxMessage) {
+		c.Close(CloseMessageTooBig, "")
+		return false, 0, nil, fmt.Errorf("消息超过 %d 字节", c.maxMessage)
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(c.br, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// WriteMessage 发送一条文本消息
+func (c *Conn) WriteMessage(data []byte) error {
+	return c.writeFrame(opText, data)
+}
+
+// Ping 发送一个ping帧，客户端会自动回复pong，用于保持连接和发现已断开的客户端
+func (c *Conn) Ping() error {
+	return c.writeFrame(opPing, nil)
+}
+
+// writeFrame 发送一个不分片、不带掩码的帧
+func (c *Conn) writeFrame(opcode byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+	return c.writeFrameLocked(opcode, payload)
+}
+
+// writeFrameLocked 发送一帧，调用方需持有锁
+func (c *Conn) writeFrameLocked(opcode byte, payload []byte) error {
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, 0x80|opcode)
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	frame = append(frame, payload...)
+
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// Close 发送关闭帧并关闭底层连接，可以多次调用
+//
+// 参数:
+//   - code: 关闭状态码，如CloseNormal、CloseGoingAway
+//   - reason: 关闭原因，超过123字节时截断
+//
+// 返回:
+//   - error: 如果关闭底层连接失败则返回相应错误
+func (c *Conn) Close(code int, reason string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	c.writeFrameLocked(opClose, append(payload, reason...))
+	return c.conn.Close()
+}
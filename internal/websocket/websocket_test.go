@@ -0,0 +1,375 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// frame 客户端一侧收到的一帧
+type frame struct {
+	fin     bool
+	opcode  byte
+	payload []byte
+}
+
+// clientFrame 按客户端的方式编码一帧（带掩码）
+func clientFrame(fin bool, opcode byte, payload []byte) []byte {
+	b := opcode
+	if fin {
+		b |= 0x80
+	}
+	out := []byte{b}
+	switch n := len(payload); {
+	case n <= 125:
+		out = append(out, 0x80|byte(n))
+	case n <= 0xffff:
+		out = append(out, 0x80|126)
+		out = binary.BigEndian.AppendUint16(out, uint16(n))
+	default:
+		out = append(out, 0x80|127)
+		out = binary.BigEndian.AppendUint64(out, uint64(n))
+	}
+	mask := [4]byte{0x37, 0xfa, 0x21, 0x3d}
+	out = append(out, mask[:]...)
+	for i, c := range payload {
+		out = append(out, c^mask[i%4])
+	}
+	return out
+}
+
+// readServerFrame 解码服务器发送的一帧，服务器的帧不能带掩码
+func readServerFrame(r io.Reader) (frame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return frame{}, err
+	}
+	if header[1]&0x80 != 0 {
+		return frame{}, errors.New("服务器发送的帧带有掩码")
+	}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return frame{}, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return frame{}, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return frame{}, err
+	}
+	return frame{fin: header[0]&0x80 != 0, opcode: header[0] & 0x0f, payload: payload}, nil
+}
+
+// newPipe 创建一个通过内存管道连接的Conn
+// 返回的通道依次给出客户端一侧收到的帧，send在后台写出客户端的帧。
+func newPipe(t *testing.T, maxMessage int) (c *Conn, frames <-chan frame, send func(...[]byte)) {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+
+	ch := make(chan frame, 16)
+	go func() {
+		defer close(ch)
+		for {
+			f, err := readServerFrame(client)
+			if err != nil {
+				return
+			}
+			ch <- f
+		}
+	}()
+
+	send = func(data ...[]byte) {
+		go func() {
+			for _, d := range data {
+				if _, err := client.Write(d); err != nil {
+					return
+				}
+			}
+		}()
+	}
+	return &Conn{conn: server, br: bufio.NewReader(server), maxMessage: maxMessage}, ch, send
+}
+
+// nextFrame 等待客户端一侧收到下一帧
+func nextFrame(t *testing.T, frames <-chan frame) frame {
+	t.Helper()
+	select {
+	case f, ok := <-frames:
+		if !ok {
+			t.Fatal("连接已关闭，没有收到帧")
+		}
+		return f
+	case <-time.After(2 * time.Second):
+		t.Fatal("等待服务器的帧超时")
+	}
+	return frame{}
+}
+
+// expectClose 检查客户端收到了带指定状态码的关闭帧
+func expectClose(t *testing.T, frames <-chan frame, code int) {
+	t.Helper()
+	f := nextFrame(t, frames)
+	if f.opcode != opClose || len(f.payload) < 2 {
+		t.Fatalf("收到 opcode=%#x payload=%q，期望关闭帧", f.opcode, f.payload)
+	}
+	if got := int(binary.BigEndian.Uint16(f.payload)); got != code {
+		t.Errorf("关闭状态码 = %d, 期望 %d", got, code)
+	}
+}
+
+func TestReadMessageLengths(t *testing.T) {
+	for _, n := range []int{0, 5, 125, 126, 300, 0xffff, 0x10000, 70000} {
+		c, _, send := newPipe(t, 1<<20)
+		payload := bytes.Repeat([]byte("abcdefg"), n/7+1)[:n]
+		send(clientFrame(true, opText, payload))
+
+		got, err := c.ReadMessage()
+		if err != nil {
+			t.Fatalf("%d 字节: ReadMessage: %v", n, err)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Errorf("%d 字节: 解码后的消息与原文不一致", n)
+		}
+	}
+}
+
+func TestReadMessageFragmented(t *testing.T) {
+	c, frames, send := newPipe(t, 1024)
+	send(
+		clientFrame(false, opText, []byte("hello, ")),
+		clientFrame(true, opPing, []byte("p1")),
+		clientFrame(false, opContinuation, []byte("web")),
+		clientFrame(true, opPong, nil),
+		clientFrame(true, opContinuation, []byte("socket")),
+		clientFrame(true, opText, []byte("next")),
+	)
+
+	got, err := c.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	if string(got) != "hello, websocket" {
+		t.Errorf("消息 = %q, 期望 %q", got, "hello, websocket")
+	}
+
+	// 分片之间的ping应当原样回复pong
+	if f := nextFrame(t, frames); f.opcode != opPong || string(f.payload) != "p1" {
+		t.Errorf("收到 opcode=%#x payload=%q，期望pong p1", f.opcode, f.payload)
+	}
+
+	if got, err := c.ReadMessage(); err != nil || string(got) != "next" {
+		t.Errorf("下一条消息 = %q, %v", got, err)
+	}
+}
+
+func TestReadMessageProtocolErrors(t *testing.T) {
+	unmasked := []byte{0x81, 0x02, 'h', 'i'}
+	reserved := clientFrame(true, opText, []byte("hi"))
+	reserved[0] |= 0x40
+
+	tests := []struct {
+		name   string
+		max    int
+		frames [][]byte
+		code   int
+	}{
+		{"没有掩码", 1024, [][]byte{unmasked}, CloseProtocolError},
+		{"保留位", 1024, [][]byte{reserved}, CloseProtocolError},
+		{"二进制消息", 1024, [][]byte{clientFrame(true, opBinary, []byte{1, 2})}, CloseUnsupportedData},
+		{"超过大小上限", 100, [][]byte{clientFrame(true, opText, make([]byte, 101))}, CloseMessageTooBig},
+		{"分片合计超过上限", 100, [][]byte{
+			clientFrame(false, opText, make([]byte, 60)),
+			clientFrame(true, opContinuation, make([]byte, 60)),
+		}, CloseMessageTooBig},
+		{"控制帧过长", 1024, [][]byte{clientFrame(true, opPing, make([]byte, 126))}, CloseProtocolError},
+		{"分片的控制帧", 1024, [][]byte{clientFrame(false, opPing, nil)}, CloseProtocolError},
+		{"没有起始帧的后续帧", 1024, [][]byte{clientFrame(true, opContinuation, []byte("x"))}, CloseProtocolError},
+		{"分片未结束时的新消息", 1024, [][]byte{
+			clientFrame(false, opText, []byte("a")),
+			clientFrame(true, opText, []byte("b")),
+		}, CloseProtocolError},
+		{"未知操作码", 1024, [][]byte{clientFrame(true, 0x3, nil)}, CloseProtocolError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, frames, send := newPipe(t, tt.max)
+			send(tt.frames...)
+
+			if _, err := c.ReadMessage(); err == nil {
+				t.Fatal("期望返回错误")
+			}
+			expectClose(t, frames, tt.code)
+			if err := c.WriteMessage([]byte("x")); !errors.Is(err, ErrClosed) {
+				t.Errorf("关闭后WriteMessage = %v, 期望 ErrClosed", err)
+			}
+		})
+	}
+}
+
+func TestReadMessageClose(t *testing.T) {
+	c, frames, send := newPipe(t, 1024)
+	send(clientFrame(true, opClose, binary.BigEndian.AppendUint16(nil, CloseGoingAway)))
+
+	if _, err := c.ReadMessage(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("err = %v, 期望 ErrClosed", err)
+	}
+	// 回复的关闭帧使用客户端的状态码
+	expectClose(t, frames, CloseGoingAway)
+}
+
+func TestWriteFrameLengths(t *testing.T) {
+	tests := []struct {
+		n      int
+		length byte // 第二个字节中的长度字段
+	}{
+		{0, 0},
+		{125, 125},
+		{126, 126},
+		{0xffff, 126},
+		{0x10000, 127},
+	}
+	for _, tt := range tests {
+		server, client := net.Pipe()
+		c := &Conn{conn: server, br: bufio.NewReader(server), maxMessage: 1024}
+		payload := bytes.Repeat([]byte{'z'}, tt.n)
+
+		errc := make(chan error, 1)
+		go func() { errc <- c.WriteMessage(payload) }()
+
+		raw := make([]byte, 2)
+		if _, err := io.ReadFull(client, raw); err != nil {
+			t.Fatalf("%d 字节: 读取帧头失败: %v", tt.n, err)
+		}
+		if raw[0] != 0x80|opText || raw[1] != tt.length {
+			t.Errorf("%d 字节: 帧头 = %#x %#x, 期望 %#x %#x", tt.n, raw[0], raw[1], 0x80|opText, tt.length)
+		}
+		f, err := readServerFrame(io.MultiReader(bytes.NewReader(raw), client))
+		if err != nil {
+			t.Fatalf("%d 字节: 解码失败: %v", tt.n, err)
+		}
+		if !bytes.Equal(f.payload, payload) {
+			t.Errorf("%d 字节: 载荷不一致", tt.n)
+		}
+		if err := <-errc; err != nil {
+			t.Errorf("%d 字节: WriteMessage: %v", tt.n, err)
+		}
+		server.Close()
+		client.Close()
+	}
+}
+
+func TestCloseTruncatesReason(t *testing.T) {
+	c, frames, _ := newPipe(t, 1024)
+	if err := c.Close(CloseNormal, strings.Repeat("r", 200)); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	f := nextFrame(t, frames)
+	// 控制帧的载荷不超过125字节：2字节状态码加123字节原因
+	if f.opcode != opClose || len(f.payload) != 125 {
+		t.Errorf("关闭帧 opcode=%#x 长度=%d, 期望长度125", f.opcode, len(f.payload))
+	}
+	if err := c.Close(CloseNormal, ""); err != nil {
+		t.Errorf("重复Close = %v", err)
+	}
+	if err := c.Ping(); !errors.Is(err, ErrClosed) {
+		t.Errorf("关闭后Ping = %v, 期望 ErrClosed", err)
+	}
+}
+
+func TestUpgradeHandshake(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Upgrade(w, r, 1024)
+		if err != nil {
+			return
+		}
+		msg, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		c.WriteMessage(append([]byte("echo: "), msg...))
+		c.Close(CloseNormal, "")
+	}))
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("连接失败: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// RFC 6455 第1.3节中的示例密钥
+	io.WriteString(conn, "GET /ws HTTP/1.1\r\n"+
+		"Host: example.com\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"+
+		"Sec-WebSocket-Version: 13\r\n\r\n")
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("读取握手响应失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("状态码 = %d, 期望 101", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Sec-WebSocket-Accept = %q", got)
+	}
+
+	conn.Write(clientFrame(true, opText, []byte("ping0")))
+	f, err := readServerFrame(br)
+	if err != nil {
+		t.Fatalf("读取消息失败: %v", err)
+	}
+	if f.opcode != opText || string(f.payload) != "echo: ping0" {
+		t.Errorf("收到 opcode=%#x payload=%q", f.opcode, f.payload)
+	}
+}
+
+func TestUpgradeRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		header map[string]string
+		status int
+	}{
+		{"不是升级请求", map[string]string{}, http.StatusBadRequest},
+		{"版本不支持", map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "8", "Sec-WebSocket-Key": "dGhlIHNhbXBsZSBub25jZQ=="}, http.StatusUpgradeRequired},
+		{"无效的密钥", map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": "c2hvcnQ="}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		for k, v := range tt.header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		if _, err := Upgrade(w, r, 1024); err == nil {
+			t.Errorf("%s: 期望返回错误", tt.name)
+		}
+		if w.Code != tt.status {
+			t.Errorf("%s: 状态码 = %d, 期望 %d", tt.name, w.Code, tt.status)
+		}
+	}
+}
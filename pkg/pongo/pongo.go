@@ -0,0 +1,128 @@
+// Package pongo provides an embeddable Go API for retrieving IP information
+// from the Ping0.cc service. It wraps the internal client, parser and core
+// packages so that other Go programs can perform lookups without executing
+// the pong0 binary.
+package pongo
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"ping0/internal/client"
+	"ping0/internal/config"
+	"ping0/internal/core"
+	"ping0/internal/models"
+	"ping0/internal/parser"
+	"ping0/internal/server"
+)
+
+// IPInfo 查询返回的IP信息，与命令行和API服务器输出的结构一致
+type IPInfo = models.IPInfo
+
+// Client 是Ping0.cc查询客户端
+// 零值不可用，请使用NewClient创建实例。同一个Client可以被多个goroutine并发使用。
+type Client struct {
+	cfg *config.Config
+}
+
+// Option 用于在创建Client时修改其配置
+type Option func(*Client)
+
+// WithLogger 设置查询过程使用的结构化日志记录器，默认不输出任何日志
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Client) {
+		c.cfg.Logger = logger
+	}
+}
+
+// WithLang 设置IP类型、风控等级等标签值的输出语言，可选"zh"（默认）和"en"
+// 不支持的语言按"zh"处理，即保持Ping0.cc页面上的原始中文。
+func WithLang(lang string) Option {
+	return func(c *Client) {
+		c.cfg.Lang = lang
+	}
+}
+
+// WithBranding 设置查询结果和Handler的响应中是否包含princess字段，默认包含
+// 只影响使用该选项创建的Client，同一进程中的其他Client不受影响。
+func WithBranding(enabled bool) Option {
+	return func(c *Client) {
+		c.cfg.NoBranding = !enabled
+	}
+}
+
+// Middleware 包装HTTP处理器的中间件，用于在Handler返回的API路由中插入自定义逻辑
+type Middleware = func(http.Handler) http.Handler
+
+// WithMiddleware 为Handler返回的API处理器添加中间件
+// 中间件按顺序加入每个路由的中间件链，位于panic恢复和指标统计之内、CORS和API密钥验证之外，
+// 可以用来实现自己的认证、审计日志或请求改写；多次调用时按调用顺序追加。
+func WithMiddleware(mws ...Middleware) Option {
+	return func(c *Client) {
+		c.cfg.Middleware = append(c.cfg.Middleware, mws...)
+	}
+}
+
+// NewClient 创建一个新的查询客户端
+// 同一个Client的多次查询会复用已通过验证的会话，只有会话失效时才重新计算访问密钥。
+func NewClient(opts ...Option) *Client {
+	c := &Client{cfg: config.New()}
+	c.cfg.Stats = core.NewStats()
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.cfg.Sessions = client.NewSessionManager(c.cfg)
+	return c
+}
+
+// Query 查询指定IP的信息
+// 该函数执行完整的查询流程（获取初始页面、生成密钥、获取并解析最终页面），
+// ctx会贯穿整个流程，被取消或超时时正在进行的请求和密钥计算会立即中止。
+//
+// 参数:
+//   - ctx: 控制查询生命周期的上下文
+//   - ip: 要查询的IP地址，为空时查询当前出口IP
+//
+// 返回:
+//   - *IPInfo: 包含IP详细信息的结构体
+//   - error: 如果查询失败或ctx被取消则返回相应错误
+func (c *Client) Query(ctx context.Context, ip string) (*IPInfo, error) {
+	return core.ProcessIPInfo(ctx, c.cfg, ip)
+}
+
+// WithChallengeParams 返回为单次查询手动指定x1值和difficulty值的上下文，与-x1、-diff参数的作用相同
+// 用于在Ping0.cc调整密钥算法时针对单次查询调试，不影响同一个Client上的其他查询；为空的值仍然来自初始页面。
+//
+// 参数:
+//   - ctx: 原始上下文
+//   - x1: 手动指定的x1值
+//   - difficulty: 手动指定的difficulty值
+//
+// 返回:
+//   - context.Context: 传给Query的上下文
+func WithChallengeParams(ctx context.Context, x1, difficulty string) context.Context {
+	return core.WithChallengeParams(ctx, x1, difficulty)
+}
+
+// Handler 返回与pong0 -c相同的API处理器（/query、/query/batch、/myip等路由），
+// 供嵌入方挂载到自己的HTTP服务器上。查询使用该Client的配置并与Query共享已通过验证的会话。
+//
+// 返回:
+//   - http.Handler: API处理器
+func (c *Client) Handler() http.Handler {
+	return server.Handler(c.cfg)
+}
+
+// ParseFile 解析保存在磁盘上的Ping0.cc结果页面，不进行任何网络请求
+// 可用于重新处理之前保存的页面，或针对页面样本编写解析器回归测试。
+//
+// 参数:
+//   - path: HTML文件路径
+//
+// 返回:
+//   - *IPInfo: 解析出的IP信息
+//   - error: 如果文件无法读取、是验证页面或解析失败则返回相应错误
+func ParseFile(path string) (*IPInfo, error) {
+	return parser.ParseFile(config.New(), path)
+}